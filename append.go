@@ -0,0 +1,175 @@
+package arc
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+
+	"github.com/bernardo1r/encdec"
+)
+
+const (
+	queryFileEncryptionKeyAny = `SELECT id, key FROM encryption_metadata LIMIT 1`
+
+	queryDictionaries = `SELECT id, class, dict FROM dictionaries`
+)
+
+// openDatabaseArgs opens an existing database, failing if it's missing.
+const openDatabaseArgs = databaseArgs + "&mode=rw"
+
+// readContainerKey derives the container key from password, using the
+// stored key params, and checks it against the key check, and the key
+// of a stored file.
+func readContainerKey(db *sql.DB, capabilities Capabilities, password []byte) ([]byte, error) {
+	var paramsString []byte
+	err := db.QueryRow(queryEncryptionKeyParams).Scan(&paramsString)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := encdec.ParseHeader(bytes.NewReader(paramsString))
+	if err != nil {
+		return nil, err
+	}
+	key, err := encdec.Key(password, params)
+	if err != nil {
+		return nil, err
+	}
+	_, err = verifyKeyCheck(db, capabilities, key)
+	if err != nil {
+		wipe(key)
+		return nil, err
+	}
+
+	var id int
+	var keyEncrypted []byte
+	err = db.QueryRow(containerKeyQuery(capabilities)).Scan(&id, &keyEncrypted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = readFileKey(keyEncrypted, id, key)
+	if err != nil {
+		wipe(key)
+		return nil, ErrWrongPassword
+	}
+
+	return key, nil
+}
+
+func (writer *Writer) loadDictionaries() (err error) {
+	rows, err := writer.db.Query(queryDictionaries)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	writer.dictionaries = make(map[ContentClass]dictionary)
+	for rows.Next() {
+		var dict dictionary
+		var class string
+		err = rows.Scan(&dict.id, &class, &dict.dict)
+		if err != nil {
+			return err
+		}
+		writer.dictionaries[ContentClass(class)] = dict
+	}
+
+	return rows.Err()
+}
+
+// OpenWriter opens the existing container databasePath for adding files,
+// keeping the files already stored.
+//
+// The container key is derived from password with the key params of the
+// container, so password must be the one used when creating it, or
+// [ErrWrongPassword] is returned. If the container has no key params
+// yet, a new key is created instead.
+// password may be nil if no encrypted files will be added.
+func OpenWriter(databasePath string, blocksize int, password []byte) (*Writer, error) {
+	return openWriter(databasePath, blocksize, password, nil, KDFParams{})
+}
+
+// openWriter opens the existing container databasePath, with pragmas,
+// for adding files, deriving new keys with kdf.
+func openWriter(databasePath string, blocksize int, password []byte, pragmas *Pragmas, kdf KDFParams) (*Writer, error) {
+	_, err := os.Stat(databasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	blocksize, err = checkBlocksize(blocksize)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := new(Writer)
+	writer.blocksize = blocksize
+	writer.kdf = kdf
+	writer.path = databasePath
+	writer.db, writer.err = openDB("file:"+databasePath+openDatabaseArgs, pragmas)
+	if writer.err != nil {
+		return nil, writer.err
+	}
+
+	capabilities, err := detectCapabilities(writer.db)
+	writer.capabilities = capabilities
+	if err == nil && capabilities.Has(FeatureDictionaries) {
+		err = writer.loadDictionaries()
+	}
+	if err == nil {
+		writer.suite, err = readCipherSuite(writer.db, capabilities)
+	}
+	if err == nil && password != nil {
+		err = writer.openEncryptionKey(capabilities, password)
+	}
+	if err == nil {
+		err = clearSummary(writer.db, capabilities)
+	}
+	if err != nil {
+		writer.db.Close()
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (writer *Writer) openEncryptionKey(capabilities Capabilities, password []byte) error {
+	if !capabilities.Has(FeatureEncryption) {
+		return FeatureEncryption.missingError()
+	}
+
+	writer.encryptionKey, writer.err = readContainerKey(writer.db, capabilities, password)
+	if errors.Is(writer.err, sql.ErrNoRows) {
+		return writer.createEncryptionKey(password)
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+	// Containers migrated to the key check store it once opened.
+	writer.err = storeKeyCheck(writer.db, capabilities, writer.encryptionKey)
+	return writer.err
+}
+
+// OpenWriterConfig opens the existing container databasePath for adding
+// files, using the blocksize, password and pragmas from config.
+func OpenWriterConfig(databasePath string, config *Config) (*Writer, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := openWriter(databasePath, config.Blocksize, config.Password, config.pragmas(), config.KDF)
+	if err != nil {
+		return writer, err
+	}
+	return writer, writer.applyLimits(config)
+}
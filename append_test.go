@@ -0,0 +1,101 @@
+package arc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAppendDictionary(t *testing.T) {
+	path := testContainerPath(t)
+	dict := []byte(`{"level": "info", "message": ""}`)
+	writer, err := NewWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.AddDictionary(ContentJSON, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "a.json", Compression: 3}, []byte(`{"level": "info"}`))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err = OpenWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.AddDictionary(ContentJSON, dict)
+	if err != nil {
+		t.Fatalf("adding the stored dictionary again: %v", err)
+	}
+	err = writer.AddDictionary(ContentJSON, []byte(`{"other": ""}`))
+	if !errors.Is(err, ErrDictionaryExists) {
+		t.Fatalf("got %v, want %v", err, ErrDictionaryExists)
+	}
+	writeTestFile(t, writer, Header{Name: "b.json", Compression: 3}, []byte(`{"level": "warn"}`))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFiles(t, readTestContainer(t, path, nil), map[string]string{
+		"a.json": `{"level": "info"}`,
+		"b.json": `{"level": "warn"}`,
+	})
+}
+
+func TestWrongPasswordWithoutEncryptedFiles(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{}, map[string]string{"a": "contents"})
+	wrongPassword := []byte("wrong")
+
+	_, err := openTestWriter(path, 0, wrongPassword)
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("OpenWriter: got %v, want %v", err, ErrWrongPassword)
+	}
+	_, err = NewReader(path, wrongPassword)
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("NewReader: got %v, want %v", err, ErrWrongPassword)
+	}
+	_, err = OpenEditor(path, wrongPassword)
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("OpenEditor: got %v, want %v", err, ErrWrongPassword)
+	}
+
+	writer, err := openTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "b", Encryption: true}, []byte("secret"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{
+		"a": "contents",
+		"b": "secret",
+	})
+}
+
+func TestKeyCheckStoredOnceMigrated(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{"a": "contents"})
+	execTestContainer(t, path, `DELETE FROM key_check`)
+
+	writer, err := openTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	execTestContainer(t, path, `DELETE FROM encryption_metadata`, `DELETE FROM metadata`)
+
+	_, err = openTestWriter(path, 0, []byte("wrong"))
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("got %v, want %v", err, ErrWrongPassword)
+	}
+}
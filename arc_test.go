@@ -0,0 +1,152 @@
+package arc
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var testPassword = []byte("password")
+
+// testKDF are the params deriving the keys of the test containers, as
+// the default ones allocate gigabytes for each key derived.
+var testKDF = KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+// newTestWriter creates a new container at path, as [NewWriter],
+// deriving its keys with testKDF.
+func newTestWriter(path string, blocksize int, password []byte) (*Writer, error) {
+	return NewWriterConfig(path, &Config{Blocksize: blocksize, Password: password, KDF: testKDF})
+}
+
+// openTestWriter opens the container at path for adding files, as
+// [OpenWriter], deriving its new keys with testKDF.
+func openTestWriter(path string, blocksize int, password []byte) (*Writer, error) {
+	return OpenWriterConfig(path, &Config{Blocksize: blocksize, Password: password, KDF: testKDF})
+}
+
+// testContainerPath returns the path of a new container
+// in a temporary directory removed once t ends.
+func testContainerPath(t testing.TB) string {
+	t.Helper()
+	return filepath.Join(t.TempDir(), "test.arc")
+}
+
+// testSourceFile writes contents to a new file in a temporary
+// directory, for writing it with [Writer.WriteFile].
+func testSourceFile(t testing.TB, contents []byte) string {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.Write(contents)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+// writeTestFile writes the file described by header, with contents,
+// through writer, failing t otherwise.
+func writeTestFile(t testing.TB, writer *Writer, header Header, contents []byte) {
+	t.Helper()
+	err := writer.WriteFrom(&header, bytes.NewReader(contents))
+	if err != nil {
+		t.Fatalf("writing %s: %v", header.Name, err)
+	}
+}
+
+// writeTestContainer writes a new container at path with files, by name,
+// each described by header but for its name.
+func writeTestContainer(t testing.TB, path string, password []byte, header Header, files map[string]string) {
+	t.Helper()
+	writer, err := newTestWriter(path, 0, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		header.Name = name
+		writeTestFile(t, writer, header, []byte(contents))
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFiles returns the contents of the files of the reader, by name.
+func readTestFiles(t testing.TB, reader *Reader) map[string]string {
+	t.Helper()
+	files, err := reader.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := make(map[string]string)
+	for name, header := range files {
+		if header.Type != TypeFile {
+			continue
+		}
+		var buffer bytes.Buffer
+		_, err = reader.ReadTo(header.Id, &buffer)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		contents[name] = buffer.String()
+	}
+	return contents
+}
+
+// readTestContainer returns the contents of the files
+// of the container at path, by name.
+func readTestContainer(t testing.TB, path string, password []byte) map[string]string {
+	t.Helper()
+	reader, err := NewReader(path, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	return readTestFiles(t, reader)
+}
+
+// execTestContainer runs the statements on the container at path,
+// as to tamper with it, or drop the schema of features.
+func execTestContainer(t testing.TB, path string, statements ...string) {
+	t.Helper()
+	db, err := sql.Open(DefaultDriver, "file:"+path+databaseArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range statements {
+		_, err = db.Exec(statement)
+		if err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+}
+
+// checkFiles checks the contents of the files, by name, are want.
+func checkFiles(t testing.TB, got map[string]string, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("got %d files, want %d", len(got), len(want))
+	}
+	for name, contents := range want {
+		gotContents, ok := got[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if gotContents != contents {
+			t.Errorf("%s: got %q, want %q", name, gotContents, contents)
+		}
+	}
+}
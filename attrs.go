@@ -0,0 +1,108 @@
+package arc
+
+import "errors"
+
+const (
+	queryInsertAttr = `INSERT INTO attrs VALUES (?, ?, ?)`
+
+	queryAttrsById = `SELECT key, value FROM attrs WHERE id = ?`
+
+	queryAllAttrs = `SELECT id, key, value FROM attrs`
+)
+
+// ErrEmptyAttrKey is returned when writing a file with
+// an attribute, in [Header.Attrs], whose key is empty.
+var ErrEmptyAttrKey = errors.New("empty attribute key")
+
+// insertAttrs stores the attributes of the file described by header in db.
+func (writer *Writer) insertAttrs(db execQuerier, header *Header) error {
+	if len(header.Attrs) == 0 {
+		return nil
+	}
+	if !writer.capabilities.Has(FeatureUserAttrs) {
+		return FeatureUserAttrs.missingError()
+	}
+
+	for key, value := range header.Attrs {
+		if key == "" {
+			return ErrEmptyAttrKey
+		}
+		_, err := db.Exec(queryInsertAttr, header.Id, key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attrs returns the attributes of the file id, set by [Header.Attrs] when
+// written, without reading its data blocks. It returns nil if the file has
+// none, or the container doesn't support [FeatureUserAttrs].
+func (reader *Reader) Attrs(id int) (attrs map[string]string, err error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+	if !reader.capabilities.Has(FeatureUserAttrs) {
+		return nil, nil
+	}
+
+	rows, err := reader.db.Query(queryAttrsById, id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		attrs[key] = value
+	}
+	return attrs, rows.Err()
+}
+
+// loadAttrs sets the attributes of headers, keyed by id, at once.
+func (reader *Reader) loadAttrs(headers map[int]*Header) (err error) {
+	if !reader.capabilities.Has(FeatureUserAttrs) {
+		return nil
+	}
+
+	rows, err := reader.db.Query(queryAllAttrs)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var id int
+		var key, value string
+		err = rows.Scan(&id, &key, &value)
+		if err != nil {
+			return err
+		}
+		header, ok := headers[id]
+		if !ok {
+			continue
+		}
+		if header.Attrs == nil {
+			header.Attrs = make(map[string]string)
+		}
+		header.Attrs[key] = value
+	}
+	return rows.Err()
+}
@@ -0,0 +1,125 @@
+package arc
+
+import (
+	"context"
+	"database/sql"
+)
+
+// batch is the transaction shared by the files written
+// by a Writer in batch mode, set by [Writer.SetCommitEvery].
+type batch struct {
+	transaction *sql.Tx
+
+	// statement inserts the data blocks of the files.
+	statement *sql.Stmt
+
+	// files is the number of files completed within the transaction.
+	files int
+}
+
+// SetCommitEvery groups the files written afterwards into transactions of n
+// files, instead of one transaction per file, which dominates the time of
+// writing many small files. The statement inserting data blocks is prepared
+// once per transaction too. n <= 0 disables batching, committing the files
+// written so far.
+//
+// The files of the pending transaction are only stored once committed, when
+// n files are completed, or the Writer is closed, so an error, or a crash,
+// discards them along with the file being written. The [ParallelWriter]
+// commits each file on its own regardless.
+func (writer *Writer) SetCommitEvery(n int) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if writer.flush() != nil {
+		return writer.err
+	}
+
+	writer.commitEvery = max(n, 0)
+	if writer.commitEvery == 0 {
+		writer.err = writer.commitBatch()
+	}
+	return writer.err
+}
+
+// fileQuerier returns where the queries of the files being written run:
+// the pending batch transaction, if any, or the database.
+func (writer *Writer) fileQuerier(ctx context.Context) execQuerier {
+	if writer.batch != nil {
+		return writer.batch.transaction
+	}
+	return contextQuerier{ctx: ctx, db: writer.db}
+}
+
+// beginBatch begins the batch transaction of the next file,
+// in batch mode, if not already begun.
+func (writer *Writer) beginBatch() error {
+	if writer.commitEvery == 0 || writer.batch != nil {
+		return nil
+	}
+
+	transaction, err := writer.db.Begin()
+	if err != nil {
+		return err
+	}
+	statement, err := transaction.Prepare(insertDataQuery(writer.capabilities))
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	writer.batch = &batch{transaction: transaction, statement: statement}
+	return nil
+}
+
+// batchFileDone counts a completed file in the batch transaction,
+// committing it once it holds the number of files set.
+func (writer *Writer) batchFileDone() error {
+	if writer.batch == nil {
+		return nil
+	}
+
+	writer.batch.files++
+	if writer.batch.files < writer.commitEvery {
+		return nil
+	}
+	return writer.commitBatch()
+}
+
+// commitBatch commits the pending batch transaction, if any.
+func (writer *Writer) commitBatch() error {
+	if writer.batch == nil {
+		return nil
+	}
+
+	pending := writer.batch
+	writer.batch = nil
+	err := pending.statement.Close()
+	if err != nil {
+		pending.transaction.Rollback()
+		return err
+	}
+	return pending.transaction.Commit()
+}
+
+// newBatchDataWriter creates a dataWriter inserting the blocks of
+// the file id within the batch transaction, which it doesn't end.
+func newBatchDataWriter(ctx context.Context, db *sql.DB, batch *batch, id int, blocksize int, capabilities Capabilities) *dataWriter {
+	dwriter := &dataWriter{
+		ctx:          ctx,
+		db:           db,
+		transaction:  batch.transaction,
+		statement:    batch.statement,
+		shared:       true,
+		id:           id,
+		blockSize:    blocksize,
+		capabilities: capabilities,
+	}
+	dwriter.buffer.Grow(dwriter.blockSize)
+	return dwriter
+}
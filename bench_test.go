@@ -0,0 +1,149 @@
+package arc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// benchSize is the size of the contents written and read by the benchmarks.
+const benchSize = 4 << 20
+
+// benchBlocksizes and benchLevels are swept by the benchmarks, as by the
+// matrix of the bench command, where level zero stores the files
+// uncompressed.
+var (
+	benchBlocksizes = []int{DefaultBlocksize, 64 << 10, 1 << 20}
+	benchLevels     = []zstd.EncoderLevel{0, zstd.SpeedFastest, zstd.SpeedDefault, zstd.SpeedBestCompression}
+)
+
+// benchCase is a configuration of the containers of the benchmarks.
+type benchCase struct {
+	blocksize int
+	level     zstd.EncoderLevel
+	encrypt   bool
+}
+
+// name names the case as the bench command, e.g. "64KiB/fastest/plain".
+func (bcase benchCase) name() string {
+	level := "stored"
+	if bcase.level != 0 {
+		level = bcase.level.String()
+	}
+	encryption := "plain"
+	if bcase.encrypt {
+		encryption = "encrypted"
+	}
+	return fmt.Sprintf("%dKiB/%s/%s", bcase.blocksize>>10, level, encryption)
+}
+
+func (bcase benchCase) password() []byte {
+	if bcase.encrypt {
+		return testPassword
+	}
+	return nil
+}
+
+func benchCases() []benchCase {
+	var cases []benchCase
+	for _, blocksize := range benchBlocksizes {
+		for _, level := range benchLevels {
+			for _, encrypt := range []bool{false, true} {
+				cases = append(cases, benchCase{blocksize: blocksize, level: level, encrypt: encrypt})
+			}
+		}
+	}
+	return cases
+}
+
+// benchData returns n bytes alternating runs of text, compressing
+// well, and random bytes, not compressing at all.
+func benchData(n int) []byte {
+	random := rand.New(rand.NewSource(1))
+	var data bytes.Buffer
+	for data.Len() < n {
+		if random.Intn(2) == 0 {
+			for i := random.Intn(200); i >= 0; i-- {
+				fmt.Fprintf(&data, "line %d of the benchmark contents\n", random.Intn(1000))
+			}
+			continue
+		}
+		chunk := make([]byte, random.Intn(4096))
+		random.Read(chunk)
+		data.Write(chunk)
+	}
+	return data.Bytes()[:n]
+}
+
+// writeBenchContainer writes data as one file to a new container at
+// path configured by bcase.
+func writeBenchContainer(b *testing.B, path string, bcase benchCase, data []byte) {
+	writer, err := newTestWriter(path, bcase.blocksize, bcase.password())
+	if err != nil {
+		b.Fatal(err)
+	}
+	header := Header{Name: "file", Compression: bcase.level, Encryption: bcase.encrypt}
+	err = writer.WriteFrom(&header, bytes.NewReader(data))
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	data := benchData(benchSize)
+	for _, bcase := range benchCases() {
+		b.Run(bcase.name(), func(b *testing.B) {
+			path := testContainerPath(b)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				writeBenchContainer(b, path, bcase, data)
+
+				b.StopTimer()
+				err := os.Remove(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	data := benchData(benchSize)
+	for _, bcase := range benchCases() {
+		b.Run(bcase.name(), func(b *testing.B) {
+			path := testContainerPath(b)
+			writeBenchContainer(b, path, bcase, data)
+			reader, err := NewReader(path, bcase.password())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer reader.Close()
+			info, err := reader.StatByName("file")
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = reader.Open(info.Id, true)
+				if err == nil {
+					_, err = io.Copy(io.Discard, reader)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
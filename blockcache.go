@@ -0,0 +1,125 @@
+package arc
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// blockKey identifies a block of a file in the block cache. Depending on how
+// the file is stored, block is the index of its stored block, its encrypted
+// chunk or its compressed segment, as each file is only read by one of them.
+type blockKey struct {
+	id    int
+	block int64
+}
+
+// blockEntry is a block held by the block cache.
+type blockEntry struct {
+	key  blockKey
+	data []byte
+}
+
+// blockCache holds the blocks last read, as plaintext, up to size bytes,
+// evicting the least recently used ones. It's safe for concurrent use.
+type blockCache struct {
+	mutex   sync.Mutex
+	size    int64
+	used    int64
+	order   *list.List
+	entries map[blockKey]*list.Element
+}
+
+func newBlockCache(size int64) *blockCache {
+	return &blockCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[blockKey]*list.Element),
+	}
+}
+
+// load returns the block key from the cache, or else reads it by read,
+// keeping it for the next loads. The block returned mustn't be modified.
+// A nil cache always reads the block.
+func (cache *blockCache) load(key blockKey, read func() ([]byte, error)) ([]byte, error) {
+	if cache == nil {
+		return read()
+	}
+
+	cache.mutex.Lock()
+	element, ok := cache.entries[key]
+	if ok {
+		cache.order.MoveToFront(element)
+		cache.mutex.Unlock()
+		return element.Value.(*blockEntry).data, nil
+	}
+	cache.mutex.Unlock()
+
+	data, err := read()
+	if err != nil {
+		return nil, err
+	}
+	cache.add(key, data)
+	return data, nil
+}
+
+// add keeps data as the block key, evicting the least recently used
+// blocks over the size of the cache. Blocks larger than the whole
+// cache aren't kept.
+func (cache *blockCache) add(key blockKey, data []byte) {
+	if int64(len(data)) > cache.size {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if _, ok := cache.entries[key]; ok {
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&blockEntry{key: key, data: data})
+	cache.used += int64(len(data))
+	for cache.used > cache.size {
+		oldest := cache.order.Back()
+		entry := cache.order.Remove(oldest).(*blockEntry)
+		delete(cache.entries, entry.key)
+		cache.used -= int64(len(entry.data))
+	}
+}
+
+// SetBlockCache enables, or disables, if size is 0, caching the blocks last
+// read by the [FileReader]s of the Reader, up to size bytes, as plaintext.
+// Serving the same ranges repeatedly, as over HTTP by [ServeFile], then
+// reads, decrypts and decompresses them once, as long as they're cached. The
+// cache is shared by the FileReaders, but not by other Readers of the same
+// container. Files compressed without segments (see [Writer.SetSegmentSize])
+// and sparse files are decompressed as a whole, so they aren't cached.
+func (reader *Reader) SetBlockCache(size int64) {
+	if size <= 0 {
+		reader.blockCache = nil
+		return
+	}
+	reader.blockCache = newBlockCache(size)
+}
+
+// cachedRange reads the range of an unencrypted and uncompressed file
+// block by block, through the block cache.
+func (file *FileReader) cachedRange(query string, offset int64, length int64) ([]byte, error) {
+	buffer := make([]byte, 0, length)
+	for block := offset / file.blocksize; int64(len(buffer)) < length; block++ {
+		data, err := file.reader.blockCache.load(blockKey{id: file.id, block: block}, func() ([]byte, error) {
+			return storedRange(file.reader.db, query, file.id, file.blocksize, block*file.blocksize, file.blocksize)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		start := max(offset-block*file.blocksize, 0)
+		if start >= int64(len(data)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		end := min(int64(len(data)), start+length-int64(len(buffer)))
+		buffer = append(buffer, data[start:end]...)
+	}
+
+	return buffer, nil
+}
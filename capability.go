@@ -0,0 +1,434 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	queryTables = `SELECT name FROM sqlite_master WHERE type = 'table'`
+
+	queryTableColumns = `SELECT name FROM pragma_table_info(?)`
+)
+
+var (
+	// ErrInvalidContainer is returned when opening a database that
+	// lacks the tables every container has.
+	ErrInvalidContainer = errors.New("not an arc container")
+
+	// ErrMissingFeature is returned when an operation needs a feature
+	// the container was created without.
+	ErrMissingFeature = errors.New("feature not supported by container")
+)
+
+// requiredTables are the tables present in all containers.
+var requiredTables = []string{"metadata", "data"}
+
+// Feature is an optional feature of the container format. Each feature
+// is backed by tables or columns that containers created by older versions
+// of the library may lack.
+type Feature int
+
+const (
+	// FeatureEncryption indicates the container has the tables holding
+	// the encryption keys, being able to store encrypted files.
+	FeatureEncryption Feature = iota
+
+	// FeatureUUID indicates the container has a random identifier,
+	// assigned when it was created.
+	FeatureUUID
+
+	// FeatureDictionaries indicates the container can store compression
+	// dictionaries, selected per file by its content class.
+	FeatureDictionaries
+
+	// FeatureDirectories indicates the container can store directory
+	// entries, besides files.
+	FeatureDirectories
+
+	// FeatureChecksums indicates the container stores the checksum
+	// of the contents of unencrypted files.
+	FeatureChecksums
+
+	// FeatureAttributes indicates the container stores the permission
+	// bits and ownership of files, and can store symbolic links.
+	FeatureAttributes
+
+	// FeatureFilePasswords indicates the container can store files
+	// encrypted with their own password, instead of the container key.
+	FeatureFilePasswords
+
+	// FeatureDeduplication indicates the container can store data blocks
+	// by the hash of their contents, storing identical blocks once.
+	FeatureDeduplication
+
+	// FeatureBlocksizes indicates the container records
+	// the blocksize of each file.
+	FeatureBlocksizes
+
+	// FeatureManifest indicates the container stores a MAC of the
+	// metadata of all files, keyed by the container key, detecting
+	// files dropped or altered without the password.
+	FeatureManifest
+
+	// FeatureRecipients indicates the container can have its key wrapped
+	// for X25519 public keys, instead of derived from a password.
+	FeatureRecipients
+
+	// FeatureBlockChecksums indicates the container stores the CRC-32
+	// of each data block, detecting corrupted blocks when read.
+	FeatureBlockChecksums
+
+	// FeaturePendingFiles indicates the container records the files
+	// being written, so builds interrupted by a crash are recovered
+	// by [Resume].
+	FeaturePendingFiles
+
+	// FeatureCodecs indicates the container records the compression codec
+	// of each file, so codecs other than zstd can be used. See [Codec].
+	FeatureCodecs
+
+	// FeatureCipherSuites indicates the container records the cipher
+	// suite encrypting its files, so suites other than ChaCha20-Poly1305
+	// can be used. See [CipherSuite].
+	FeatureCipherSuites
+
+	// FeatureSparse indicates the container can store the blocks of zeros
+	// of files as holes, instead of in their data. See [Writer.SetSparse].
+	FeatureSparse
+
+	// FeatureSealedMetadata indicates the container can store the size,
+	// modification time and attributes of encrypted files encrypted.
+	// See [Writer.SetMetadataEncryption].
+	FeatureSealedMetadata
+
+	// FeatureUserAttrs indicates the container can store key/value
+	// attributes attached to files by applications. See [Header.Attrs].
+	FeatureUserAttrs
+
+	// FeatureIncremental indicates the container can be incremental over
+	// a previous container, recording it and the files deleted since.
+	// See [Writer.SetBase].
+	FeatureIncremental
+
+	// FeatureStoredSizes indicates the container records the size of the
+	// data blocks of each file, as stored. See [Header.StoredSize].
+	FeatureStoredSizes
+
+	// FeatureSegments indicates the container can store compressed files
+	// as independently compressed segments, recording where each starts.
+	// See [Writer.SetSegmentSize].
+	FeatureSegments
+
+	// FeatureNameIndex indicates the container indexes the names of the
+	// encrypted files by their MAC under a key derived from the container
+	// key, so they're found without decrypting every name, and encrypts
+	// names with random nonces.
+	FeatureNameIndex
+
+	// FeatureCompressionLevels indicates the container records the
+	// compression level of each compressed file, besides whether it's
+	// compressed. See [Header.Compression].
+	FeatureCompressionLevels
+
+	// FeatureHardlinks indicates the container can store files as hard
+	// links to other files, sharing their data. See [Writer.WriteHardlink].
+	FeatureHardlinks
+
+	// FeatureTimestamps indicates the container records the modification
+	// time of files in nanoseconds, and their access, change and birth
+	// times, when known. See [Header.AccessTime].
+	FeatureTimestamps
+
+	// FeatureSummary indicates the container stores the number and total
+	// size of its files, and a Merkle root over their checksums, once
+	// closed, detecting truncated containers when opened. See [Summary].
+	FeatureSummary
+
+	// FeatureKeyCheck indicates the container stores a MAC keyed by the
+	// container key derived from its password, so a wrong password is
+	// refused even before any file is encrypted with the key.
+	FeatureKeyCheck
+
+	featureCount
+)
+
+type featureSchema struct {
+	name    string
+	tables  []string
+	columns map[string][]string
+}
+
+var featureSchemas = [featureCount]featureSchema{
+	FeatureEncryption: {
+		name:   "encryption",
+		tables: []string{"encryption_metadata", "encryption_key_params"},
+	},
+	FeatureUUID: {
+		name:   "uuid",
+		tables: []string{"container"},
+	},
+	FeatureDictionaries: {
+		name:    "dictionaries",
+		tables:  []string{"dictionaries"},
+		columns: map[string][]string{"metadata": {"dictionary_id"}},
+	},
+	FeatureDirectories: {
+		name:    "directories",
+		columns: map[string][]string{"metadata": {"type"}},
+	},
+	FeatureChecksums: {
+		name:    "checksums",
+		columns: map[string][]string{"metadata": {"checksum"}},
+	},
+	FeatureAttributes: {
+		name:    "attributes",
+		columns: map[string][]string{"metadata": {"mode", "uid", "gid"}},
+	},
+	FeatureFilePasswords: {
+		name:   "file-passwords",
+		tables: []string{"file_key_params"},
+	},
+	FeatureDeduplication: {
+		name:   "deduplication",
+		tables: []string{"blocks", "block_refs"},
+	},
+	FeatureBlocksizes: {
+		name:    "blocksizes",
+		columns: map[string][]string{"metadata": {"blocksize"}},
+	},
+	FeatureManifest: {
+		name:   "manifest",
+		tables: []string{"manifest"},
+	},
+	FeatureRecipients: {
+		name:   "recipients",
+		tables: []string{"recipients"},
+	},
+	FeatureBlockChecksums: {
+		name:    "block-checksums",
+		columns: map[string][]string{"data": {"crc"}},
+	},
+	FeaturePendingFiles: {
+		name:   "pending-files",
+		tables: []string{"pending_files"},
+	},
+	FeatureCodecs: {
+		name:    "codecs",
+		columns: map[string][]string{"metadata": {"codec"}},
+	},
+	FeatureCipherSuites: {
+		name:    "cipher-suites",
+		columns: map[string][]string{"encryption_key_params": {"suite"}},
+	},
+	FeatureSparse: {
+		name:   "sparse-files",
+		tables: []string{"holes"},
+	},
+	FeatureSealedMetadata: {
+		name:   "sealed-metadata",
+		tables: []string{"sealed_metadata"},
+	},
+	FeatureUserAttrs: {
+		name:   "user-attrs",
+		tables: []string{"attrs"},
+	},
+	FeatureIncremental: {
+		name:   "incremental",
+		tables: []string{"base", "deleted"},
+	},
+	FeatureStoredSizes: {
+		name:    "stored-sizes",
+		columns: map[string][]string{"metadata": {"stored_size"}},
+	},
+	FeatureSegments: {
+		name:   "segments",
+		tables: []string{"segments"},
+	},
+	FeatureNameIndex: {
+		name:   "name-index",
+		tables: []string{"name_index"},
+	},
+	FeatureCompressionLevels: {
+		name:    "compression-levels",
+		columns: map[string][]string{"metadata": {"compression_level"}},
+	},
+	FeatureHardlinks: {
+		name:   "hardlinks",
+		tables: []string{"links"},
+	},
+	FeatureTimestamps: {
+		name:    "timestamps",
+		columns: map[string][]string{"metadata": {"mod_time_ns", "access_time", "change_time", "birth_time"}},
+	},
+	FeatureSummary: {
+		name:   "summary",
+		tables: []string{"summary"},
+	},
+	FeatureKeyCheck: {
+		name:   "key-check",
+		tables: []string{"key_check"},
+	},
+}
+
+func (feature Feature) String() string {
+	if feature < 0 || feature >= featureCount {
+		return fmt.Sprintf("Feature(%d)", int(feature))
+	}
+	return featureSchemas[feature].name
+}
+
+func (feature Feature) missingError() error {
+	return fmt.Errorf("%w: %s", ErrMissingFeature, feature)
+}
+
+// Capabilities reports which optional features a container supports.
+type Capabilities struct {
+	supported [featureCount]bool
+}
+
+// Has reports whether the container supports feature.
+func (capabilities Capabilities) Has(feature Feature) bool {
+	if feature < 0 || feature >= featureCount {
+		return false
+	}
+	return capabilities.supported[feature]
+}
+
+// Missing returns the features the container lacks.
+func (capabilities Capabilities) Missing() []Feature {
+	var missing []Feature
+	for feature := Feature(0); feature < featureCount; feature++ {
+		if !capabilities.supported[feature] {
+			missing = append(missing, feature)
+		}
+	}
+	return missing
+}
+
+func (capabilities Capabilities) String() string {
+	var names []string
+	for feature := Feature(0); feature < featureCount; feature++ {
+		if capabilities.supported[feature] {
+			names = append(names, feature.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+type schemaQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func queryNames(db schemaQuerier, query string, args ...any) (names map[string]bool, err error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	names = make(map[string]bool)
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+
+	return names, rows.Err()
+}
+
+// detectCapabilities inspects the schema of the container opened in db.
+func detectCapabilities(db schemaQuerier) (Capabilities, error) {
+	var capabilities Capabilities
+	tables, err := queryNames(db, queryTables)
+	if err != nil {
+		return capabilities, err
+	}
+	for _, table := range requiredTables {
+		if !tables[table] {
+			return capabilities, ErrInvalidContainer
+		}
+	}
+	_, err = readFormatVersion(db, tables)
+	if err != nil {
+		return capabilities, err
+	}
+
+	columnsCache := make(map[string]map[string]bool)
+	return schemaCapabilities(tables, func(table string) (map[string]bool, error) {
+		columns, ok := columnsCache[table]
+		if !ok {
+			columns, err = queryNames(db, queryTableColumns, table)
+			if err != nil {
+				return nil, err
+			}
+			columnsCache[table] = columns
+		}
+		return columns, nil
+	})
+}
+
+// capabilities inspects the schema of the container read by file.
+func (file *sqliteFile) capabilities() (Capabilities, error) {
+	tables := make(map[string]bool, len(file.tables))
+	for name := range file.tables {
+		tables[name] = true
+	}
+	return schemaCapabilities(tables, func(table string) (map[string]bool, error) {
+		columns := make(map[string]bool)
+		for _, column := range file.tables[table].columns {
+			columns[column] = true
+		}
+		return columns, nil
+	})
+}
+
+// schemaCapabilities returns the features backed by the tables, and by
+// the columns of each table, as returned by columns.
+func schemaCapabilities(tables map[string]bool, columns func(table string) (map[string]bool, error)) (Capabilities, error) {
+	var capabilities Capabilities
+	for feature, schema := range featureSchemas {
+		supported := true
+		for _, table := range schema.tables {
+			if !tables[table] {
+				supported = false
+				break
+			}
+		}
+
+		for table, featureColumns := range schema.columns {
+			if !supported {
+				break
+			}
+			if !tables[table] {
+				supported = false
+				break
+			}
+
+			tableColumns, err := columns(table)
+			if err != nil {
+				return capabilities, err
+			}
+			for _, column := range featureColumns {
+				if !tableColumns[column] {
+					supported = false
+					break
+				}
+			}
+		}
+
+		capabilities.supported[feature] = supported
+	}
+
+	return capabilities, nil
+}
@@ -0,0 +1,285 @@
+package arc
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+const (
+	queryCatalogInsertContainer = `INSERT INTO containers(path, indexed_time) VALUES (?, ?)
+		ON CONFLICT(path) DO UPDATE SET indexed_time = excluded.indexed_time`
+
+	queryCatalogContainerIdByPath = `SELECT id FROM containers WHERE path = ?`
+
+	queryCatalogDeleteEntries = `DELETE FROM entries WHERE container_id = ?`
+
+	queryCatalogDeleteContainer = `DELETE FROM containers WHERE path = ?`
+
+	queryCatalogInsertEntry = `INSERT INTO entries VALUES (?, ?, ?, ?, ?, ?)`
+
+	queryCatalogEntries = `SELECT
+		containers.path,
+		entries.file_id,
+		entries.name,
+		entries.size,
+		entries.mod_time,
+		entries.checksum
+	FROM entries JOIN containers ON entries.container_id = containers.id`
+
+	queryCatalogWhich = queryCatalogEntries + `
+	WHERE entries.name = ?1 OR (
+		length(entries.name) > length(?1) AND
+		substr(entries.name, -length(?1) - 1) = '/' || ?1
+	)
+	ORDER BY containers.path, entries.name`
+
+	queryCatalogSearch = queryCatalogEntries + `
+	WHERE entries.name GLOB ?
+	ORDER BY containers.path, entries.name`
+)
+
+//go:embed catalog.sql
+var queryCatalogDDL []byte
+
+// ErrCatalogClosed is returned when Catalog is used after closed.
+var ErrCatalogClosed = errors.New("catalog closed")
+
+// CatalogEntry represents a file indexed in a [Catalog].
+type CatalogEntry struct {
+	// Container is the absolute path of the container holding the file.
+	Container string
+
+	// Id of the file in the container.
+	Id int
+
+	// Name of the file.
+	Name string
+
+	// Size, in bytes, of the file, outside the container.
+	Size int64
+
+	// ModTime is the last time the file was modified.
+	ModTime time.Time
+
+	// Checksum of the file contents, nil when the container
+	// does not store checksums.
+	Checksum []byte
+}
+
+// Catalog is an index of the files stored in many containers, allowing
+// to search which container holds a given file without opening each one.
+type Catalog struct {
+	db  *sql.DB
+	err error
+}
+
+// OpenCatalog opens the catalog at catalogPath, creating it if it
+// doesn't exist.
+func OpenCatalog(catalogPath string) (*Catalog, error) {
+	catalog := new(Catalog)
+	catalog.db, catalog.err = openDB("file:"+catalogPath+databaseArgs, nil)
+	if catalog.err != nil {
+		return nil, catalog.err
+	}
+
+	_, catalog.err = catalog.db.Exec(string(queryCatalogDDL))
+	if catalog.err != nil {
+		catalog.db.Close()
+		return nil, catalog.err
+	}
+
+	return catalog, nil
+}
+
+// CatalogAdd indexes the files of the container containerPath in the
+// catalog at catalogPath. See [Catalog.Add].
+func CatalogAdd(catalogPath string, containerPath string, password []byte) (err error) {
+	catalog, err := OpenCatalog(catalogPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := catalog.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	return catalog.Add(containerPath, password)
+}
+
+func readContainerFiles(containerPath string, password []byte) (files map[string]*Header, err error) {
+	reader, err := NewReader(containerPath, password)
+	if errors.Is(err, ErrNotEncrypted) {
+		reader.Close()
+		reader, err = NewReader(containerPath, nil)
+	}
+	if reader != nil {
+		defer func() {
+			err2 := reader.Close()
+			if err2 != nil && err == nil {
+				err = err2
+			}
+		}()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reader.Files()
+}
+
+// Add indexes the files of the container containerPath, replacing any
+// entries of a previous indexing of the same container.
+//
+// The password is only used if the container has encrypted files, and may
+// be nil. Encrypted files are not indexed when the password is not provided.
+func (catalog *Catalog) Add(containerPath string, password []byte) (err error) {
+	if catalog.err != nil {
+		return catalog.err
+	}
+
+	containerPath, err = filepath.Abs(containerPath)
+	if err != nil {
+		return err
+	}
+
+	files, err := readContainerFiles(containerPath, password)
+	if err != nil {
+		return err
+	}
+
+	transaction, err := catalog.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	_, err = transaction.Exec(queryCatalogInsertContainer, containerPath, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	var containerId int
+	err = transaction.QueryRow(queryCatalogContainerIdByPath, containerPath).Scan(&containerId)
+	if err != nil {
+		return err
+	}
+	_, err = transaction.Exec(queryCatalogDeleteEntries, containerId)
+	if err != nil {
+		return err
+	}
+
+	statement, err := transaction.Prepare(queryCatalogInsertEntry)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, header := range files {
+		if header.Encryption && password == nil {
+			continue
+		}
+
+		_, err = statement.Exec(
+			containerId,
+			header.Id,
+			header.Name,
+			header.Size,
+			header.ModTime.Unix(),
+			header.Checksum,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+// Remove deletes all entries of the container containerPath from the catalog.
+func (catalog *Catalog) Remove(containerPath string) error {
+	if catalog.err != nil {
+		return catalog.err
+	}
+
+	containerPath, err := filepath.Abs(containerPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = catalog.db.Exec(queryCatalogDeleteContainer, containerPath)
+	return err
+}
+
+func (catalog *Catalog) queryEntries(query string, arg string) (entries []CatalogEntry, err error) {
+	if catalog.err != nil {
+		return nil, catalog.err
+	}
+
+	rows, err := catalog.db.Query(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var entry CatalogEntry
+		var modTime int64
+		err = rows.Scan(
+			&entry.Container,
+			&entry.Id,
+			&entry.Name,
+			&entry.Size,
+			&modTime,
+			&entry.Checksum,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.ModTime = time.Unix(modTime, 0)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Which returns the entries whose name is filename, or that have
+// filename as their last path elements.
+func (catalog *Catalog) Which(filename string) ([]CatalogEntry, error) {
+	return catalog.queryEntries(queryCatalogWhich, filename)
+}
+
+// Search returns the entries whose name matches the shell pattern,
+// using the syntax of SQLite GLOB operator.
+func (catalog *Catalog) Search(pattern string) ([]CatalogEntry, error) {
+	return catalog.queryEntries(queryCatalogSearch, pattern)
+}
+
+// Close closes the catalog.
+// Subsequently calls to Close or any other method will yield [ErrCatalogClosed]
+func (catalog *Catalog) Close() error {
+	if catalog.err != nil {
+		return catalog.err
+	}
+
+	catalog.err = catalog.db.Close()
+	if catalog.err != nil {
+		return catalog.err
+	}
+
+	catalog.err = ErrCatalogClosed
+	return nil
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS containers(
+	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
+	path TEXT NOT NULL UNIQUE CHECK(typeof(path) = "text"),
+	indexed_time INTEGER NOT NULL CHECK(typeof(indexed_time) = "integer")
+);
+
+CREATE TABLE IF NOT EXISTS entries(
+	container_id INTEGER CHECK(typeof(container_id) = "integer"),
+	file_id INTEGER CHECK(typeof(file_id) = "integer"),
+	name TEXT NOT NULL CHECK(typeof(name) = "text"),
+	size INTEGER NOT NULL CHECK(typeof(size) = "integer"),
+	mod_time INTEGER NOT NULL CHECK(typeof(mod_time) = "integer"),
+	checksum BLOB,
+	FOREIGN KEY (container_id) REFERENCES containers(id) ON DELETE CASCADE,
+	PRIMARY KEY (container_id, file_id)
+);
+
+CREATE INDEX IF NOT EXISTS entries_name ON entries(name);
@@ -0,0 +1,125 @@
+package arc
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// catalogNames returns the container base names and names of entries.
+func catalogNames(entries []CatalogEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = filepath.Base(entry.Container) + ":" + entry.Name
+	}
+	return names
+}
+
+func checkCatalogNames(t *testing.T, entries []CatalogEntry, err error, want ...string) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := catalogNames(entries)
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.arc")
+	second := filepath.Join(dir, "second.arc")
+	writeTestContainer(t, first, nil, Header{}, map[string]string{
+		"docs/notes.txt": "first notes",
+		"photo.jpg":      "photo",
+	})
+	writeTestContainer(t, second, nil, Header{}, map[string]string{
+		"notes.txt":    "second notes",
+		"notes.txt.gz": "compressed",
+	})
+
+	catalog, err := OpenCatalog(filepath.Join(dir, "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Close()
+	for _, path := range []string{first, second} {
+		err = catalog.Add(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := catalog.Which("notes.txt")
+	checkCatalogNames(t, entries, err, "first.arc:docs/notes.txt", "second.arc:notes.txt")
+	if entries[1].Container != second || entries[1].Size != int64(len("second notes")) {
+		t.Errorf("got entry %+v", entries[1])
+	}
+	entries, err = catalog.Search("*.txt*")
+	checkCatalogNames(t, entries, err, "first.arc:docs/notes.txt", "second.arc:notes.txt", "second.arc:notes.txt.gz")
+
+	// Adding a container again replaces its entries.
+	writeTestContainer(t, first, nil, Header{}, map[string]string{"other.txt": "other"})
+	err = catalog.Add(first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = catalog.Search("*.txt")
+	checkCatalogNames(t, entries, err, "first.arc:other.txt", "second.arc:notes.txt")
+
+	err = catalog.Remove(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = catalog.Search("*")
+	checkCatalogNames(t, entries, err, "first.arc:other.txt")
+}
+
+func TestCatalogEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.arc")
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "plain"}, []byte("plain"))
+	writeTestFile(t, writer, Header{Name: "secret", Encryption: true}, []byte("secret"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	catalogPath := filepath.Join(dir, "catalog.db")
+	err = CatalogAdd(catalogPath, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := OpenCatalog(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := catalog.Search("*")
+	checkCatalogNames(t, entries, err, "test.arc:plain")
+
+	err = catalog.Add(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = catalog.Search("*")
+	checkCatalogNames(t, entries, err, "test.arc:plain", "test.arc:secret")
+
+	err = catalog.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = catalog.Which("plain")
+	if !errors.Is(err, ErrCatalogClosed) {
+		t.Errorf("got %v, want %v", err, ErrCatalogClosed)
+	}
+}
@@ -0,0 +1,308 @@
+package arc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bernardo1r/encdec"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	queryCipherSuite = `SELECT suite FROM encryption_key_params`
+
+	queryUpdateCipherSuite = `UPDATE encryption_key_params SET suite = ?`
+)
+
+var (
+	// ErrUnknownCipherSuite is returned when a container
+	// records a cipher suite unknown to this version.
+	ErrUnknownCipherSuite = errors.New("unknown cipher suite")
+
+	// ErrCipherSuiteInUse is returned when changing the cipher
+	// suite of a container already holding encrypted files.
+	ErrCipherSuiteInUse = errors.New("cipher suite already in use by encrypted files")
+)
+
+// CipherSuite selects the AEAD encrypting the contents of the files of a
+// container. The suite is recorded in the container, along with the
+// password key params, and selected by the [Reader] automatically. File
+// keys and names, being short, are always encrypted with ChaCha20-Poly1305.
+type CipherSuite int
+
+const (
+	// CipherChaCha20Poly1305 is the default suite,
+	// the only one of containers without [FeatureCipherSuites].
+	CipherChaCha20Poly1305 CipherSuite = iota
+
+	// CipherAES256GCM is faster than ChaCha20-Poly1305
+	// on processors with AES instructions.
+	CipherAES256GCM
+
+	// CipherXChaCha20Poly1305 is ChaCha20-Poly1305 with extended nonces.
+	CipherXChaCha20Poly1305
+
+	cipherSuiteCount
+)
+
+var cipherSuiteNames = [cipherSuiteCount]string{
+	CipherChaCha20Poly1305:  "chacha20poly1305",
+	CipherAES256GCM:         "aes256gcm",
+	CipherXChaCha20Poly1305: "xchacha20poly1305",
+}
+
+func (suite CipherSuite) String() string {
+	if suite < 0 || suite >= cipherSuiteCount {
+		return fmt.Sprintf("CipherSuite(%d)", int(suite))
+	}
+	return cipherSuiteNames[suite]
+}
+
+// ParseCipherSuite returns the suite named name, as returned by
+// [CipherSuite.String], or [ErrUnknownCipherSuite].
+func ParseCipherSuite(name string) (CipherSuite, error) {
+	for suite, suiteName := range cipherSuiteNames {
+		if name == suiteName {
+			return CipherSuite(suite), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownCipherSuite, name)
+}
+
+// newAEAD returns the AEAD of the suite keyed by key.
+func (suite CipherSuite) newAEAD(key []byte) (cipher.AEAD, error) {
+	switch suite {
+	case CipherChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCipherSuite, suite)
+	}
+}
+
+// readCipherSuite returns the cipher suite of the container opened in db,
+// the default one if the container records none.
+func readCipherSuite(db execQuerier, capabilities Capabilities) (CipherSuite, error) {
+	if !capabilities.Has(FeatureCipherSuites) {
+		return CipherChaCha20Poly1305, nil
+	}
+
+	var name sql.NullString
+	err := db.QueryRow(queryCipherSuite).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !name.Valid {
+		return CipherChaCha20Poly1305, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return ParseCipherSuite(name.String)
+}
+
+// SetCipherSuite selects the suite encrypting the contents of the files
+// of a container encrypted with a password, before any file is encrypted.
+// [ErrCipherSuiteInUse] is returned once there are encrypted files. Choosing
+// a suite other than the default requires [FeatureCipherSuites].
+func (writer *Writer) SetCipherSuite(suite CipherSuite) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if suite == writer.suite {
+		return nil
+	}
+	if !writer.capabilities.Has(FeatureCipherSuites) {
+		return FeatureCipherSuites.missingError()
+	}
+	if suite < 0 || suite >= cipherSuiteCount {
+		return fmt.Errorf("%w: %s", ErrUnknownCipherSuite, suite)
+	}
+	if writer.flush() != nil {
+		return writer.err
+	}
+	writer.err = writer.commitBatch()
+	if writer.err != nil {
+		return writer.err
+	}
+
+	err := writer.db.QueryRow(queryFileEncryptionKeyAny).Scan(new(int), new([]byte))
+	if err == nil {
+		return ErrCipherSuiteInUse
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	result, err := writer.db.Exec(queryUpdateCipherSuite, suite.String())
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrNotEncrypted
+	}
+
+	writer.suite = suite
+	return nil
+}
+
+// newEncrypter returns a writer encrypting, with suite keyed by key, what's
+// written to it into dst, split into chunks of [encdec.ChunkSize] bytes.
+// The default suite is written by encdec, and the others in the same
+// format: each chunk sealed with its index as nonce, the last chunk,
+// possibly empty, being shorter than the others.
+func newEncrypter(suite CipherSuite, key []byte, dst io.Writer) (io.WriteCloser, error) {
+	if suite == CipherChaCha20Poly1305 {
+		var params encdec.Params
+		return encdec.NewWriter(key, dst, &params)
+	}
+
+	aead, err := suite.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkWriter{aead: aead, dst: dst}, nil
+}
+
+// newDecrypter returns a reader decrypting src,
+// written by [newEncrypter] with suite and key.
+func newDecrypter(suite CipherSuite, key []byte, src io.Reader) (io.Reader, error) {
+	if suite == CipherChaCha20Poly1305 {
+		var params encdec.Params
+		return encdec.NewReader(key, src, &params)
+	}
+
+	aead, err := suite.newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{aead: aead, src: src}, nil
+}
+
+// chunkNonce returns the nonce, of size bytes, sealing the chunk of
+// index chunk, the index in big endian order in the trailing bytes.
+func chunkNonce(size int, chunk int64) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(chunk))
+	return nonce
+}
+
+// chunkWriter encrypts in the format of encdec with any AEAD.
+type chunkWriter struct {
+	aead  cipher.AEAD
+	dst   io.Writer
+	chunk int64
+	buff  []byte
+	err   error
+}
+
+func (writer *chunkWriter) flush() error {
+	sealed := writer.aead.Seal(writer.buff[:0], chunkNonce(writer.aead.NonceSize(), writer.chunk), writer.buff, nil)
+	_, err := writer.dst.Write(sealed)
+	writer.buff = sealed[:0]
+	writer.chunk++
+	return err
+}
+
+func (writer *chunkWriter) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	if writer.buff == nil {
+		writer.buff = make([]byte, 0, encdec.ChunkSize+writer.aead.Overhead())
+	}
+
+	total := len(p)
+	for len(p) > 0 {
+		n := min(encdec.ChunkSize-len(writer.buff), len(p))
+		writer.buff = append(writer.buff, p[:n]...)
+		p = p[n:]
+		if len(writer.buff) == encdec.ChunkSize {
+			writer.err = writer.flush()
+			if writer.err != nil {
+				return 0, writer.err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (writer *chunkWriter) Close() error {
+	if writer.err != nil {
+		return writer.err
+	}
+
+	writer.err = writer.flush()
+	if writer.err != nil {
+		return writer.err
+	}
+	writer.err = errors.New("operation on closed writer")
+	return nil
+}
+
+// chunkReader decrypts what's written by chunkWriter.
+type chunkReader struct {
+	aead  cipher.AEAD
+	src   io.Reader
+	chunk int64
+	buff  bytes.Buffer
+	last  bool
+	err   error
+}
+
+// readChunk reads and decrypts the next chunk.
+func (reader *chunkReader) readChunk() error {
+	sealedSize := int64(encdec.ChunkSize + reader.aead.Overhead())
+	reader.buff.Reset()
+	n, err := io.CopyN(&reader.buff, reader.src, sealedSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	reader.last = n < sealedSize
+
+	sealed := reader.buff.Bytes()
+	plaintext, err := reader.aead.Open(sealed[:0], chunkNonce(reader.aead.NonceSize(), reader.chunk), sealed, nil)
+	if err != nil {
+		return err
+	}
+	reader.buff.Truncate(len(plaintext))
+	reader.chunk++
+	return nil
+}
+
+func (reader *chunkReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+
+	for reader.buff.Len() == 0 {
+		if reader.last {
+			reader.err = io.EOF
+			return 0, reader.err
+		}
+		reader.err = reader.readChunk()
+		if reader.err != nil {
+			return 0, reader.err
+		}
+	}
+	return reader.buff.Read(p)
+}
@@ -0,0 +1,124 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/bernardo1r/encdec"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestCipherSuites(t *testing.T) {
+	for suite := range cipherSuiteCount {
+		parsed, err := ParseCipherSuite(suite.String())
+		if err != nil || parsed != suite {
+			t.Errorf("%s: parsed as %v, %v", suite, parsed, err)
+		}
+
+		path := testContainerPath(t)
+		config := &Config{Encryption: true, CipherSuite: suite, Password: testPassword, KDF: testKDF}
+		writer, err := NewWriterConfig(path, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		for i, size := range []int{0, encdec.ChunkSize, 2*encdec.ChunkSize + 1} {
+			name := fmt.Sprintf("file%d", i)
+			files[name] = string(bytes.Repeat([]byte{byte(i)}, size))
+			writeTestFile(t, writer, Header{Name: name, Encryption: true}, []byte(files[name]))
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := NewReader(path, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reader.suite != suite {
+			t.Errorf("%s: read as %s", suite, reader.suite)
+		}
+		checkFiles(t, readTestFiles(t, reader), files)
+
+		// Read across the chunks, each sealed on its own.
+		info, err := reader.StatByName("file2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := reader.ReadRange(info.Id, encdec.ChunkSize-1, encdec.ChunkSize+2)
+		if err != nil || len(got) != encdec.ChunkSize+2 {
+			t.Errorf("%s: read %d bytes across chunks, %v", suite, len(got), err)
+		}
+		reader.Close()
+	}
+}
+
+// TestChunkWriterFormat checks chunkWriter writes the format of encdec.
+func TestChunkWriterFormat(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, chacha20poly1305.KeySize)
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, encdec.ChunkSize, 2*encdec.ChunkSize + 1} {
+		plaintext := bytes.Repeat([]byte("plaintext"), size/9+1)[:size]
+
+		var want bytes.Buffer
+		var params encdec.Params
+		encrypter, err := encdec.NewWriter(key, &want, &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypter.Write(plaintext)
+		encrypter.Close()
+
+		var got bytes.Buffer
+		writer := &chunkWriter{aead: aead, dst: &got}
+		writer.Write(plaintext)
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%d bytes: differs from encdec", size)
+		}
+
+		decrypted, err := io.ReadAll(&chunkReader{aead: aead, src: &want})
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%d bytes: decrypted %d bytes, %v", size, len(decrypted), err)
+		}
+	}
+}
+
+func TestSetCipherSuite(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	err = writer.SetCipherSuite(cipherSuiteCount)
+	if !errors.Is(err, ErrUnknownCipherSuite) {
+		t.Errorf("unknown suite: got %v, want %v", err, ErrUnknownCipherSuite)
+	}
+	writeTestFile(t, writer, Header{Name: "file", Encryption: true}, []byte("contents"))
+	err = writer.SetCipherSuite(CipherAES256GCM)
+	if !errors.Is(err, ErrCipherSuiteInUse) {
+		t.Errorf("in use: got %v, want %v", err, ErrCipherSuiteInUse)
+	}
+
+	path = testContainerPath(t)
+	writer, err = newTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	err = writer.SetCipherSuite(CipherAES256GCM)
+	if !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("not encrypted: got %v, want %v", err, ErrNotEncrypted)
+	}
+}
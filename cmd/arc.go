@@ -5,27 +5,72 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
-	"runtime/pprof"
-	"time"
+	"strings"
 
 	"github.com/bernardo1r/arc"
-	"github.com/bernardo1r/arc/internal/builder"
-
-	"github.com/klauspost/compress/zstd"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
 	dbExtesion = ".arc"
-)
 
-const usage = `Usage: arc [INPUT_FOLDER]
+	// notDatabaseMessage is the message of sqlite's SQLITE_NOTADB error,
+	// shared by the drivers, returned when reading a database whose pages
+	// are encrypted without their key.
+	notDatabaseMessage = "file is not a database"
+)
 
-This executable is a demo of the library. It will put all files of the provided
-directory into an arc container, only files in the root directory will be added.
-Then, it 'extracts' the container to a new folder.`
+const usage = `Usage: arc COMMAND [OPTIONS] ARGS...
+
+Commands:
+	create   write the files of a folder to a new container
+	add      add the files of a folder to an existing container
+	list     list the files of a container
+	info     print statistics of a container
+	diff     compare the files of two containers
+	extract  extract the files of a container to a folder
+	cat      write files of a container to the standard output
+	rm       delete files from a container
+	mv       rename a file of a container
+	mount    mount the files of a container read-only at a folder
+	verify   check the files of a container against their checksums
+	passwd   change the password of a container
+	index    add the files of containers to the catalog
+	which    report the containers holding a file
+	join     join the volumes of a split container
+	import   store a container read from the standard input
+	migrate  upgrade containers to the current format
+	fsck     check containers for orphaned and mismatched rows
+	bench    compare arc against tar and zip, or its configurations
+
+Run "arc COMMAND -h" for the options of each command. The password of
+encrypted containers is prompted for with -password, or read from the file
+given by -password-file, or from the ARC_PASSWORD environment variable.`
+
+// commands are the subcommands, by name, run with the remaining arguments.
+var commands = map[string]func(args []string){
+	"create":  runCreate,
+	"add":     runAdd,
+	"list":    runList,
+	"info":    runInfo,
+	"diff":    runDiff,
+	"extract": runExtract,
+	"cat":     runCat,
+	"rm":      runRm,
+	"mv":      runMv,
+	"mount":   runMount,
+	"verify":  runVerify,
+	"passwd":  runPasswd,
+	"index":   runIndex,
+	"which":   runWhich,
+	"join":    runJoin,
+	"import":  runImport,
+	"migrate": runMigrate,
+	"fsck":    runFsck,
+	"bench":   runBench,
+}
 
 func checkError(err error) {
 	if err != nil {
@@ -33,11 +78,6 @@ func checkError(err error) {
 	}
 }
 
-func fatalUsage() {
-	flag.Usage()
-	os.Exit(1)
-}
-
 func mustBeFolder(folderpath string) {
 	info, err := os.Stat(folderpath)
 	if err != nil {
@@ -49,89 +89,76 @@ func mustBeFolder(folderpath string) {
 	}
 }
 
-func createOrTruncateFolder(folderpath string) error {
+// openReader opens the container at path, unlocking it
+// with password, if not nil.
+func openReader(path string, password []byte) *arc.Reader {
+	reader, err := arc.NewReader(path, password)
+	if err != nil && password != nil && strings.Contains(err.Error(), notDatabaseMessage) {
+		// The whole database may be encrypted, so unreadable without the key.
+		config := &arc.Config{Encryption: true, PageEncryption: true, Password: password}
+		pageReader, pageErr := arc.NewReaderConfig(path, config)
+		if pageErr != nil {
+			checkError(errors.Join(err, fmt.Errorf("opening with page encryption: %w", pageErr)))
+		}
+		return pageReader
+	}
+	checkError(err)
+	return reader
+}
 
-	err := os.Mkdir(folderpath, 0775)
-	if err == nil {
-		return nil
+// openEditor opens the container at path for editing, with password,
+// if not nil, needed for finding encrypted files by name.
+func openEditor(path string, password []byte) *arc.Editor {
+	editor, err := arc.OpenEditor(path, password)
+	if errors.Is(err, arc.ErrNotEncrypted) {
+		editor, err = arc.OpenEditor(path, nil)
 	}
+	checkError(err)
+	return editor
+}
 
-	if errors.Is(err, os.ErrExist) {
-		err = os.RemoveAll(folderpath)
-		if err != nil {
-			return err
+// containerFolder returns the default folder the container
+// at path is extracted to: its name without the extension.
+func containerFolder(path string) string {
+	if isURL(path) {
+		if parsed, err := url.Parse(path); err == nil {
+			path = parsed.Path
 		}
-
-		err = os.Mkdir(folderpath, 0775)
 	}
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
 
-	return err
+// isURL reports whether path is the URL of a container served through
+// HTTP, such as a presigned URL of an object storage bucket.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
 }
 
-func main() {
-	file, err := os.Create("cmd/default.pgo")
+// openRemote opens the container served at url for reading, with
+// password, if not nil, fetching only the pages read.
+func openRemote(url string, password []byte) *arc.RemoteReader {
+	reader, err := arc.NewReaderHTTP(url, nil, password)
 	checkError(err)
-	defer file.Close()
-	err = pprof.StartCPUProfile(file)
-	checkError(err)
-	defer pprof.StopCPUProfile()
+	return reader
+}
 
+func main() {
 	log.SetFlags(0)
 	flag.Usage = func() {
 		log.Println(usage)
-		flag.PrintDefaults()
-	}
-	if len(os.Args) == 1 {
-		fatalUsage()
 	}
 	flag.Parse()
-	switch nFlags := flag.NArg(); {
-	case nFlags == 0:
-		log.Fatalln("One folder path is required")
-	case nFlags > 1:
-		log.Fatalln("Only one folder path can be provided")
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	folderPath := filepath.Clean(flag.Arg(0))
-	mustBeFolder(folderPath)
-
-	start := time.Now()
-	arcBuilder, err := builder.NewBuilder(
-		filepath.Base(folderPath)+dbExtesion,
-		builder.WithCompressionLevel(zstd.SpeedBetterCompression),
-		builder.WithPassword([]byte("hello motto")),
-	)
-	checkError(err)
-
-	err = arcBuilder.InsertDir(folderPath)
-	checkError(err)
-
-	err = arcBuilder.Close()
-	checkError(err)
-	tot := time.Since(start)
-	fmt.Printf("Time to write to container: %v\n\n", tot)
-
-	newFolderPath := filepath.Base(folderPath) + "_opened"
-	err = createOrTruncateFolder(newFolderPath)
-	checkError(err)
-
-	start = time.Now()
-	reader, err := arc.NewReader(
-		filepath.Base(folderPath)+dbExtesion,
-		[]byte("hello motto"),
-	)
-	checkError(err)
-
-	files, err := reader.Files()
-	checkError(err)
-
-	for filename, header := range files {
-		filename = filepath.Join(newFolderPath, filename)
-		fmt.Printf("Putting %s\n", filename)
-		err = reader.ReadToFile(header.Id, filename)
-		checkError(err)
+	run, ok := commands[flag.Arg(0)]
+	if !ok {
+		log.Printf("Unknown command %s\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(1)
 	}
-	tot = time.Since(start)
-
-	fmt.Printf("Time to write files from container: %v\n", tot)
+	run(flag.Args()[1:])
 }
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bernardo1r/arc"
+	"github.com/klauspost/compress/zstd"
+)
+
+const benchUsage = `Usage: arc bench [-compression LEVEL] [-encrypt] INPUT_FOLDER
+       arc bench -matrix [-save FILE] [-baseline FILE] [-threshold PERCENT] INPUT_FOLDER
+
+bench archives the files in the root of INPUT_FOLDER with arc, tar+zstd and
+zip, reporting the size of each archive and the time taken to write and read
+it back. All archives are written to a temporary folder and removed afterwards.
+
+With -matrix, the files are instead written to arc containers of every
+combination of blocksizes, compression levels, and with and without
+encryption, reporting the throughput of writing and reading each, so the
+configurations can be compared on the hardware at hand. -save stores the
+results in FILE, as a baseline for later runs: given it by -baseline, the
+cases whose throughput fell more than -threshold percent are reported as
+regressions, and bench exits with status 1.`
+
+// benchPassword encrypts the arc container written by bench.
+const benchPassword = "arc bench"
+
+type benchResult struct {
+	format    string
+	size      int64
+	writeTime time.Duration
+	readTime  time.Duration
+}
+
+func benchFiles(folderPath string) []string {
+	entries, err := os.ReadDir(folderPath)
+	checkError(err)
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(folderPath, entry.Name()))
+		}
+	}
+	return files
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	checkError(err)
+	return info.Size()
+}
+
+func benchArc(files []string, outPath string, level zstd.EncoderLevel, encrypt bool) benchResult {
+	var password []byte
+	if encrypt {
+		password = []byte(benchPassword)
+	}
+
+	start := time.Now()
+	writer, err := arc.NewWriter(outPath, arc.DefaultBlocksize, password)
+	checkError(err)
+	for _, path := range files {
+		err = writer.WriteFile(
+			&arc.Header{
+				Name:        filepath.Base(path),
+				Compression: level,
+				Encryption:  encrypt,
+			},
+			path,
+		)
+		checkError(err)
+	}
+	err = writer.Close()
+	checkError(err)
+	writeTime := time.Since(start)
+
+	start = time.Now()
+	reader, err := arc.NewReader(outPath, password)
+	checkError(err)
+	headers, err := reader.Files()
+	checkError(err)
+	for _, header := range headers {
+		err = reader.Open(header.Id, true)
+		checkError(err)
+		_, err = io.Copy(io.Discard, reader)
+		checkError(err)
+	}
+	checkError(reader.Close())
+
+	return benchResult{
+		format:    "arc",
+		size:      fileSize(outPath),
+		writeTime: writeTime,
+		readTime:  time.Since(start),
+	}
+}
+
+func copyFile(dst io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(dst, file)
+	return err
+}
+
+func benchTarZstd(files []string, outPath string, level zstd.EncoderLevel) benchResult {
+	start := time.Now()
+	out, err := os.Create(outPath)
+	checkError(err)
+	encoder, err := zstd.NewWriter(out, zstd.WithEncoderLevel(level))
+	checkError(err)
+	tarWriter := tar.NewWriter(encoder)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		checkError(err)
+		header, err := tar.FileInfoHeader(info, "")
+		checkError(err)
+		err = tarWriter.WriteHeader(header)
+		checkError(err)
+		err = copyFile(tarWriter, path)
+		checkError(err)
+	}
+	checkError(tarWriter.Close())
+	checkError(encoder.Close())
+	checkError(out.Close())
+	writeTime := time.Since(start)
+
+	start = time.Now()
+	in, err := os.Open(outPath)
+	checkError(err)
+	decoder, err := zstd.NewReader(in)
+	checkError(err)
+	tarReader := tar.NewReader(decoder)
+	for {
+		_, err = tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		checkError(err)
+		_, err = io.Copy(io.Discard, tarReader)
+		checkError(err)
+	}
+	decoder.Close()
+	checkError(in.Close())
+
+	return benchResult{
+		format:    "tar+zstd",
+		size:      fileSize(outPath),
+		writeTime: writeTime,
+		readTime:  time.Since(start),
+	}
+}
+
+func benchZip(files []string, outPath string) benchResult {
+	start := time.Now()
+	out, err := os.Create(outPath)
+	checkError(err)
+	zipWriter := zip.NewWriter(out)
+	zipWriter.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	})
+	for _, path := range files {
+		info, err := os.Stat(path)
+		checkError(err)
+		header, err := zip.FileInfoHeader(info)
+		checkError(err)
+		header.Method = zip.Deflate
+		entry, err := zipWriter.CreateHeader(header)
+		checkError(err)
+		err = copyFile(entry, path)
+		checkError(err)
+	}
+	checkError(zipWriter.Close())
+	checkError(out.Close())
+	writeTime := time.Since(start)
+
+	start = time.Now()
+	zipReader, err := zip.OpenReader(outPath)
+	checkError(err)
+	for _, file := range zipReader.File {
+		entry, err := file.Open()
+		checkError(err)
+		_, err = io.Copy(io.Discard, entry)
+		checkError(err)
+		checkError(entry.Close())
+	}
+	checkError(zipReader.Close())
+
+	return benchResult{
+		format:    "zip",
+		size:      fileSize(outPath),
+		writeTime: writeTime,
+		readTime:  time.Since(start),
+	}
+}
+
+func delta(value float64, reference float64) string {
+	if reference == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", (value/reference-1)*100)
+}
+
+func printBenchResults(results []benchResult) {
+	reference := results[0]
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FORMAT\tSIZE\tΔSIZE\tWRITE\tΔWRITE\tREAD\tΔREAD")
+	for _, result := range results {
+		fmt.Fprintf(
+			table,
+			"%s\t%d\t%s\t%v\t%s\t%v\t%s\n",
+			result.format,
+			result.size,
+			delta(float64(result.size), float64(reference.size)),
+			result.writeTime.Round(time.Millisecond),
+			delta(float64(result.writeTime), float64(reference.writeTime)),
+			result.readTime.Round(time.Millisecond),
+			delta(float64(result.readTime), float64(reference.readTime)),
+		)
+	}
+	table.Flush()
+}
+
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(benchUsage)
+		flags.PrintDefaults()
+	}
+	levelName := flags.String("compression", "default", "zstd compression `level` (fastest, default, better, best)")
+	encrypt := flags.Bool("encrypt", false, "encrypt the files in the arc container")
+	matrix := flags.Bool("matrix", false, "sweep the blocksizes, compression levels and encryption of arc")
+	savePath := flags.String("save", "", "store the results of -matrix in `file`")
+	baselinePath := flags.String("baseline", "", "compare the results of -matrix with the baseline `file`")
+	threshold := flags.Float64("threshold", 10, "`percent` of throughput lost reported as a regression")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One folder path is required")
+	}
+
+	ok, level := zstd.EncoderLevelFromString(*levelName)
+	if !ok {
+		log.Fatalf("unknown compression level %s\n", *levelName)
+	}
+
+	folderPath := filepath.Clean(flags.Arg(0))
+	mustBeFolder(folderPath)
+	files := benchFiles(folderPath)
+
+	tempDir, err := os.MkdirTemp("", "arc-bench-")
+	checkError(err)
+	defer os.RemoveAll(tempDir)
+
+	if *matrix {
+		var baseline map[string]matrixResult
+		if *baselinePath != "" {
+			baseline = readBaseline(*baselinePath)
+		}
+		results := runMatrix(files, tempDir)
+		fmt.Printf("%d files from %s\n\n", len(files), folderPath)
+		regressions := printMatrixResults(results, baseline, *threshold)
+		if *savePath != "" {
+			writeBaseline(*savePath, results)
+		}
+		if regressions > 0 {
+			os.RemoveAll(tempDir)
+			log.Fatalf("%d cases regressed more than %.0f%%\n", regressions, *threshold)
+		}
+		return
+	}
+
+	results := []benchResult{
+		benchArc(files, filepath.Join(tempDir, "bench"+dbExtesion), level, *encrypt),
+		benchTarZstd(files, filepath.Join(tempDir, "bench.tar.zst"), level),
+		benchZip(files, filepath.Join(tempDir, "bench.zip")),
+	}
+
+	fmt.Printf("%d files from %s\n\n", len(files), folderPath)
+	printBenchResults(results)
+}
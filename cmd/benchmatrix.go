@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bernardo1r/arc"
+	"github.com/klauspost/compress/zstd"
+)
+
+// matrixBlocksizes are the blocksizes swept by the matrix of bench.
+var matrixBlocksizes = []int{arc.DefaultBlocksize, 64 << 10, 1 << 20}
+
+// matrixLevels are the compression levels swept by the matrix of
+// bench, where zero stores the files uncompressed.
+var matrixLevels = []zstd.EncoderLevel{0, zstd.SpeedFastest, zstd.SpeedDefault, zstd.SpeedBestCompression}
+
+// matrixCase is a configuration of the containers written by the
+// matrix of bench.
+type matrixCase struct {
+	blocksize int
+	level     zstd.EncoderLevel
+	encrypt   bool
+}
+
+// name names the case in the reports and baselines, as "64KiB/fastest/plain".
+func (bcase matrixCase) name() string {
+	level := "stored"
+	if bcase.level != 0 {
+		level = bcase.level.String()
+	}
+	encryption := "plain"
+	if bcase.encrypt {
+		encryption = "encrypted"
+	}
+	return fmt.Sprintf("%dKiB/%s/%s", bcase.blocksize>>10, level, encryption)
+}
+
+// matrixResult is the outcome of a case, as stored in baselines.
+type matrixResult struct {
+	Case      string  `json:"case"`
+	Size      int64   `json:"size"`
+	WriteMBps float64 `json:"write_mbps"`
+	ReadMBps  float64 `json:"read_mbps"`
+}
+
+func matrixCases() []matrixCase {
+	var cases []matrixCase
+	for _, blocksize := range matrixBlocksizes {
+		for _, level := range matrixLevels {
+			for _, encrypt := range []bool{false, true} {
+				cases = append(cases, matrixCase{blocksize: blocksize, level: level, encrypt: encrypt})
+			}
+		}
+	}
+	return cases
+}
+
+// throughput returns the throughput, in MB/s, of
+// processing size bytes in elapsed.
+func throughput(size int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(size) / 1e6 / elapsed.Seconds()
+}
+
+// benchCase writes files, of total size bytes, to a container at outPath
+// configured by bcase, and reads them back, measuring both.
+func benchCase(files []string, total int64, outPath string, bcase matrixCase) matrixResult {
+	var password []byte
+	if bcase.encrypt {
+		password = []byte(benchPassword)
+	}
+
+	start := time.Now()
+	writer, err := arc.NewWriter(outPath, bcase.blocksize, password)
+	checkError(err)
+	for _, path := range files {
+		err = writer.WriteFile(
+			&arc.Header{
+				Name:        filepath.Base(path),
+				Compression: bcase.level,
+				Encryption:  bcase.encrypt,
+			},
+			path,
+		)
+		checkError(err)
+	}
+	checkError(writer.Close())
+	writeTime := time.Since(start)
+
+	start = time.Now()
+	reader, err := arc.NewReader(outPath, password)
+	checkError(err)
+	headers, err := reader.Files()
+	checkError(err)
+	for _, header := range headers {
+		err = reader.Open(header.Id, true)
+		checkError(err)
+		_, err = io.Copy(io.Discard, reader)
+		checkError(err)
+	}
+	checkError(reader.Close())
+	readTime := time.Since(start)
+
+	result := matrixResult{
+		Case:      bcase.name(),
+		Size:      fileSize(outPath),
+		WriteMBps: throughput(total, writeTime),
+		ReadMBps:  throughput(total, readTime),
+	}
+	checkError(os.Remove(outPath))
+	return result
+}
+
+// runMatrix runs every case of the matrix over files, in tempDir.
+func runMatrix(files []string, tempDir string) []matrixResult {
+	var total int64
+	for _, path := range files {
+		total += fileSize(path)
+	}
+
+	var results []matrixResult
+	for i, bcase := range matrixCases() {
+		outPath := filepath.Join(tempDir, fmt.Sprintf("matrix%d%s", i, dbExtesion))
+		results = append(results, benchCase(files, total, outPath, bcase))
+	}
+	return results
+}
+
+func readBaseline(path string) map[string]matrixResult {
+	data, err := os.ReadFile(path)
+	checkError(err)
+	var results []matrixResult
+	checkError(json.Unmarshal(data, &results))
+
+	baseline := make(map[string]matrixResult, len(results))
+	for _, result := range results {
+		baseline[result.Case] = result
+	}
+	return baseline
+}
+
+func writeBaseline(path string, results []matrixResult) {
+	data, err := json.MarshalIndent(results, "", "  ")
+	checkError(err)
+	checkError(os.WriteFile(path, append(data, '\n'), 0664))
+}
+
+// regressed reports whether value fell more than threshold
+// percent below reference.
+func regressed(value float64, reference float64, threshold float64) bool {
+	return reference > 0 && value < reference*(1-threshold/100)
+}
+
+// printMatrixResults prints results, compared to baseline, if not nil,
+// returning how many cases regressed more than threshold percent.
+func printMatrixResults(results []matrixResult, baseline map[string]matrixResult, threshold float64) int {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CASE\tSIZE\tWRITE MB/s\tΔWRITE\tREAD MB/s\tΔREAD\t")
+	regressions := 0
+	for _, result := range results {
+		reference, ok := baseline[result.Case]
+		writeDelta, readDelta, mark := "-", "-", ""
+		if ok {
+			writeDelta = delta(result.WriteMBps, reference.WriteMBps)
+			readDelta = delta(result.ReadMBps, reference.ReadMBps)
+			if regressed(result.WriteMBps, reference.WriteMBps, threshold) ||
+				regressed(result.ReadMBps, reference.ReadMBps, threshold) {
+				mark = "REGRESSION"
+				regressions++
+			}
+		}
+		fmt.Fprintf(
+			table,
+			"%s\t%d\t%.1f\t%s\t%.1f\t%s\t%s\n",
+			result.Case,
+			result.Size,
+			result.WriteMBps,
+			writeDelta,
+			result.ReadMBps,
+			readDelta,
+			mark,
+		)
+	}
+	table.Flush()
+	return regressions
+}
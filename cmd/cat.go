@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/bernardo1r/arc"
+)
+
+const catUsage = `Usage: arc cat [-password | -password-file FILE] CONTAINER NAME...
+
+cat writes the contents of the files NAME of CONTAINER, one after another,
+to the standard output, without extracting them to disk, so they can be
+piped into other commands. Encrypted files are only read with -password.`
+
+func runCat(args []string) {
+	flags := flag.NewFlagSet("cat", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(catUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		log.Fatalln("A container path and at least one file name are required")
+	}
+
+	password := passwordSource.password()
+	reader := openReader(flags.Arg(0), password)
+	defer reader.Close()
+
+	stdout := bufio.NewWriter(os.Stdout)
+	for _, name := range flags.Args()[1:] {
+		info, err := reader.StatByName(name)
+		checkError(err)
+		if info.Type == arc.TypeDir {
+			log.Fatalf("%s is a directory\n", name)
+		}
+
+		_, err = reader.ReadTo(info.Id, stdout)
+		checkError(err)
+	}
+	checkError(stdout.Flush())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bernardo1r/arc"
+)
+
+const catalogUsage = `Usage: arc index [-catalog FILE] [-password | -password-file FILE] CONTAINER...
+       arc which [-catalog FILE] FILENAME
+
+index adds the files of the containers to the catalog, and which reports
+the containers holding a file named FILENAME.`
+
+func defaultCatalogPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "catalog" + dbExtesion
+	}
+
+	return filepath.Join(dir, "arc", "catalog"+dbExtesion)
+}
+
+func catalogFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(catalogUsage)
+		flags.PrintDefaults()
+	}
+	catalogPath := flags.String("catalog", defaultCatalogPath(), "path of the catalog `file`")
+	return flags, catalogPath
+}
+
+func openCatalog(catalogPath string) *arc.Catalog {
+	err := os.MkdirAll(filepath.Dir(catalogPath), 0775)
+	checkError(err)
+
+	catalog, err := arc.OpenCatalog(catalogPath)
+	checkError(err)
+	return catalog
+}
+
+func runIndex(args []string) {
+	flags, catalogPath := catalogFlags("index")
+	passwordSource := passwordFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalln("At least one container path is required")
+	}
+
+	password := passwordSource.password()
+
+	catalog := openCatalog(*catalogPath)
+	for _, containerPath := range flags.Args() {
+		fmt.Printf("Indexing %s\n", containerPath)
+		err := catalog.Add(containerPath, password)
+		checkError(err)
+	}
+
+	err := catalog.Close()
+	checkError(err)
+}
+
+func runWhich(args []string) {
+	flags, catalogPath := catalogFlags("which")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One filename is required")
+	}
+
+	catalog := openCatalog(*catalogPath)
+	entries, err := catalog.Which(flags.Arg(0))
+	checkError(err)
+	err = catalog.Close()
+	checkError(err)
+
+	if len(entries) == 0 {
+		log.Fatalf("%s not found in any indexed container\n", flags.Arg(0))
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s\t%s\t%d\n", entry.Container, entry.Name, entry.Size)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bernardo1r/arc"
+	"github.com/bernardo1r/arc/internal/builder"
+	"github.com/klauspost/compress/zstd"
+)
+
+const createUsage = `Usage: arc create [-config FILE] [-compression LEVEL] [-codec CODEC] [-cipher SUITE] [-password | -password-file FILE] [-recursive] [-prefix FOLDER] [-workers N] [-volume-size BYTES] [-pragmas PRESET] [-base CONTAINER] [-store-media] [-times] [-detect-incompressible] [-segment-size BYTES] [-window-size BYTES] [-long] [-train-dictionary] [-compress-rule PATTERN=LEVEL]... CONTAINER INPUT_FOLDER
+       arc add [-config FILE] [-compression LEVEL] [-codec CODEC] [-cipher SUITE] [-password | -password-file FILE] [-recursive] [-prefix FOLDER] [-workers N] [-volume-size BYTES] [-pragmas PRESET] [-store-media] [-times] [-detect-incompressible] [-segment-size BYTES] [-window-size BYTES] [-long] [-train-dictionary] [-compress-rule PATTERN=LEVEL]... CONTAINER INPUT_FOLDER
+
+create writes the files of INPUT_FOLDER to a new container, and add appends
+them to an existing one. Only the files in the root of INPUT_FOLDER are
+written, unless -recursive is given. The files are encrypted when a
+password is given, by -password, -password-file or the ARC_PASSWORD
+environment variable, or the config enables encryption. With -volume-size,
+the container is split into volumes, CONTAINER.001, CONTAINER.002 and so
+on, joined back by "arc join". With -base, only the files changed since the
+base container are written, along with the names of the files deleted since,
+and "arc extract" restores the files of the base and incremental containers
+given together, in order. With - as CONTAINER, create writes the container
+to the standard output, once complete, so it can be piped elsewhere and
+stored back by "arc import".
+
+The compression level of the files matching a pattern is set with
+-compress-rule, e.g. -compress-rule '*.txt=best' or -compress-rule .iso=none,
+and -store-media stores media and archives, already compressed, uncompressed.
+With -detect-incompressible, the start of each file is trial-compressed, and
+the files barely shrinking are stored uncompressed. With -segment-size, the
+files are compressed in segments of BYTES bytes on all cores, and reading a
+range of a file only decompresses the segments holding it. With
+-train-dictionary, a zstd dictionary is trained over the start of the files
+of INPUT_FOLDER, and all files are compressed with it, which helps folders
+of many small similar files, such as JSON documents or logs. Large redundant
+files compress better with a larger zstd window, set by -window-size, a
+power of two, or by -long, enlarging it to 128 MiB. Modification times are
+kept in nanoseconds, and -times records the access, change and birth times
+of the files too, restoring the access times on extraction.
+
+The container options can be loaded from a JSON config file, e.g.:
+
+	{"blocksize": 8192, "compression": "better", "codec": "zstd", "encryption": true}
+
+With "page_encryption": true, the whole database is encrypted with the
+password too, hiding the number and sizes of the files, which requires arc
+built against SQLCipher.`
+
+// parseCompression parses the compression level name,
+// or "none" for no compression.
+func parseCompression(name string) zstd.EncoderLevel {
+	if name == "none" {
+		return 0
+	}
+
+	ok, level := zstd.EncoderLevelFromString(name)
+	if !ok {
+		log.Fatalf("Unknown compression level %s\n", name)
+	}
+	return level
+}
+
+// parseRule parses a compression rule, as PATTERN=LEVEL.
+func parseRule(rule string) builder.CompressionRule {
+	pattern, levelName, ok := strings.Cut(rule, "=")
+	if !ok || pattern == "" {
+		log.Fatalf("Malformed compression rule %s, expected PATTERN=LEVEL\n", rule)
+	}
+	return builder.CompressionRule{Pattern: pattern, Level: parseCompression(levelName)}
+}
+
+func runCreate(args []string) {
+	runBuild("create", args, false)
+}
+
+func runAdd(args []string) {
+	runBuild("add", args, true)
+}
+
+// runBuild writes the files of a folder to a container,
+// appended to the existing one if appendFiles is set.
+func runBuild(name string, args []string, appendFiles bool) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(createUsage)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", "", "load the container options from a JSON `file`")
+	levelName := flags.String("compression", "", "zstd compression `level` (none, fastest, default, better, best), overriding the config")
+	codec := flags.String("codec", "", "compression `codec` (zstd, gzip, s2, lz4), overriding the config")
+	cipherName := flags.String("cipher", "", "cipher `suite` of new encrypted containers (chacha20poly1305, aes256gcm, xchacha20poly1305), overriding the config")
+	passwordSource := passwordFlags(flags)
+	recursive := flags.Bool("recursive", false, "add the files of the subdirectories too")
+	prefix := flags.String("prefix", "", "store the files under the `folder` within the container")
+	workers := flags.Int("workers", 0, "write the files with `n` workers concurrently")
+	preset := flags.String("pragmas", "", "tune the database with the `preset` fast or durable, overriding the config")
+	volumeSize := flags.Int64("volume-size", 0, "split the container into volumes of `bytes` bytes")
+	commitEvery := flags.Int("commit-every", 0, "commit the files in transactions of `n` files")
+	var rules patternsFlag
+	flags.Var(&rules, "compress-rule", "compress the files matching `pattern=level` at level, repeatable")
+	storeMedia := flags.Bool("store-media", false, "store media and archives uncompressed")
+	times := flags.Bool("times", false, "record the access, change and birth times of the files too")
+	detect := flags.Bool("detect-incompressible", false, "store the files whose start barely compresses uncompressed")
+	segmentSize := flags.Int("segment-size", 0, "compress the files in segments of `bytes` bytes, concurrently")
+	windowSize := flags.Int("window-size", 0, "zstd window size, in `bytes`, a power of two")
+	long := flags.Bool("long", false, "enlarge the zstd window to 128 MiB, for large redundant files")
+	train := flags.Bool("train-dictionary", false, "train a zstd dictionary over the files, compressing all of them with it")
+	basePath := flags.String("base", "", "only write the files changed since the `container`, making the container incremental over it")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		log.Fatalln("One container path and one folder path are required")
+	}
+
+	containerPath := flags.Arg(0)
+	folderPath := filepath.Clean(flags.Arg(1))
+	mustBeFolder(folderPath)
+
+	// The container streamed to the standard output is written to a
+	// temporary file first, and the progress is printed to the standard
+	// error instead.
+	stdout := os.Stdout
+	streaming := containerPath == "-"
+	if streaming {
+		if appendFiles || *volumeSize > 0 {
+			log.Fatalln("Only new containers, not split into volumes, can be written to the standard output")
+		}
+		dir, err := os.MkdirTemp("", "arc-")
+		checkError(err)
+		defer os.RemoveAll(dir)
+		containerPath = filepath.Join(dir, "container"+dbExtesion)
+		os.Stdout = os.Stderr
+	}
+
+	config := &arc.Config{Compression: zstd.SpeedBetterCompression}
+	if *configPath != "" {
+		var err error
+		config, err = arc.LoadConfig(*configPath)
+		checkError(err)
+	}
+	if *levelName != "" {
+		config.Compression = parseCompression(*levelName)
+	}
+	if *codec != "" {
+		config.Codec = *codec
+	}
+	if *cipherName != "" {
+		suite, err := arc.ParseCipherSuite(*cipherName)
+		checkError(err)
+		config.CipherSuite = suite
+	}
+	switch *preset {
+	case "":
+	case "fast":
+		config.Pragmas = &arc.FastWrite
+	case "durable":
+		config.Pragmas = &arc.Durable
+	default:
+		log.Fatalf("Unknown pragmas preset %s\n", *preset)
+	}
+	password := passwordSource.password()
+	if password == nil && config.Encryption {
+		password = promptPassword("Password: ")
+	}
+	if password != nil {
+		config.Encryption = true
+		config.Password = password
+	}
+	checkError(config.Validate())
+
+	start := time.Now()
+	options := []builder.BuilderOption{
+		builder.WithConfig(config),
+		builder.WithProgress(func(name string, written int64, total int64) {
+			if written == 0 {
+				fmt.Println(name)
+			}
+		}),
+	}
+	if appendFiles {
+		options = append(options, builder.WithAppend())
+	}
+	if *recursive {
+		options = append(options, builder.WithRecursive())
+	}
+	if *prefix != "" {
+		options = append(options, builder.WithPathPrefix(*prefix))
+	}
+	if *workers > 0 {
+		options = append(options, builder.WithWorkers(*workers))
+	}
+	if *volumeSize > 0 {
+		options = append(options, builder.WithVolumeSize(*volumeSize))
+	}
+	if *commitEvery > 0 {
+		options = append(options, builder.WithCommitEvery(*commitEvery))
+	}
+	for _, rule := range rules {
+		options = append(options, builder.WithCompressionRules(parseRule(rule)))
+	}
+	if *storeMedia {
+		options = append(options, builder.WithCompressionRules(builder.MediaRules...))
+	}
+	if *times {
+		options = append(options, builder.WithTimestamps())
+	}
+	if *detect {
+		options = append(options, builder.WithIncompressibleDetection())
+	}
+	if *segmentSize > 0 {
+		options = append(options, builder.WithSegmentSize(*segmentSize))
+	}
+	if *windowSize > 0 || *long {
+		options = append(options, builder.WithZstdOptions(arc.ZstdOptions{
+			WindowSize:   *windowSize,
+			LongDistance: *long,
+		}))
+	}
+	if *train {
+		options = append(options, builder.WithTrainedDictionary(folderPath, 0))
+	}
+	if *basePath != "" {
+		options = append(options, builder.WithBaseContainer(*basePath))
+	}
+	arcBuilder, err := builder.NewBuilder(containerPath, options...)
+	checkError(err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = arcBuilder.InsertDirContext(ctx, folderPath)
+	if errors.Is(err, context.Canceled) {
+		checkError(arcBuilder.Close())
+		if streaming {
+			os.RemoveAll(filepath.Dir(containerPath))
+			log.Fatalln("Interrupted")
+		}
+		log.Fatalln("Interrupted, keeping the files already added")
+	}
+	checkError(err)
+
+	done := arcBuilder.CloseAsync(ctx, func(step arc.FinalizeStep) {
+		fmt.Printf("Finalizing container: %v\n", step)
+	})
+	checkError(<-done)
+	if streaming {
+		_, err = arc.WriteContainer(stdout, containerPath)
+		checkError(err)
+	}
+	fmt.Printf("Wrote %s to %s in %v\n", folderPath, flags.Arg(0), time.Since(start))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bernardo1r/arc"
+)
+
+const diffUsage = `Usage: arc diff [-password | -password-file FILE] OLD NEW
+
+diff prints the files added to, modified in and deleted from NEW since OLD,
+marked by +, M and -, and exits with status 1 if any. Files are modified
+when their type, permission bits, size or checksum, or else modification
+time, differ. Encrypted files are only compared with -password, the
+password of both containers.`
+
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(diffUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		log.Fatalln("Two container paths are required")
+	}
+
+	password := passwordSource.password()
+	base := openReader(flags.Arg(0), password)
+	defer base.Close()
+	target := openReader(flags.Arg(1), password)
+	defer target.Close()
+
+	changes, err := arc.Diff(base, target)
+	checkError(err)
+	for _, group := range []struct {
+		mark  string
+		names []string
+	}{
+		{"+", changes.Added},
+		{"M", changes.Modified},
+		{"-", changes.Deleted},
+	} {
+		for _, name := range group.names {
+			fmt.Printf("%s %s\n", group.mark, name)
+		}
+	}
+
+	if len(changes.Added)+len(changes.Modified)+len(changes.Deleted) > 0 {
+		base.Close()
+		target.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !modernc
+
+package main
+
+import _ "github.com/mattn/go-sqlite3"
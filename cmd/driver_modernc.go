@@ -0,0 +1,16 @@
+//go:build modernc
+
+// Built with -tags modernc, arc opens the containers with the pure Go
+// driver of modernc.org/sqlite, so it's built with CGO_ENABLED=0.
+
+package main
+
+import (
+	"github.com/bernardo1r/arc"
+
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	checkError(arc.SetDriver(arc.ModerncDriver))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+)
+
+const rmUsage = `Usage: arc rm [-password | -password-file FILE] [-vacuum] CONTAINER FILENAME...
+
+rm deletes the files named FILENAME from CONTAINER. With -vacuum, the
+container is rebuilt afterwards to reclaim the space of the deleted files.`
+
+func runRm(args []string) {
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(rmUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	vacuum := flags.Bool("vacuum", false, "reclaim the space of the deleted files")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		log.Fatalln("One container path and at least one filename are required")
+	}
+
+	password := passwordSource.password()
+	editor := openEditor(flags.Arg(0), password)
+	for _, name := range flags.Args()[1:] {
+		err := editor.DeleteByName(name)
+		checkError(err)
+		fmt.Printf("Deleted %s\n", name)
+	}
+
+	if *vacuum {
+		err := editor.Vacuum()
+		checkError(err)
+	}
+	err := editor.Close()
+	checkError(err)
+}
+
+const mvUsage = `Usage: arc mv [-password | -password-file FILE] [-vacuum] CONTAINER OLDNAME NEWNAME
+
+mv renames the file OLDNAME of CONTAINER to NEWNAME, moving the files within
+it along if it's a directory. With -vacuum, the container is rebuilt
+afterwards to drop the old names of encrypted files from its free space.`
+
+func runMv(args []string) {
+	flags := flag.NewFlagSet("mv", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(mvUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	vacuum := flags.Bool("vacuum", false, "drop the old names from the free space of the container")
+	flags.Parse(args)
+	if flags.NArg() != 3 {
+		log.Fatalln("One container path, the old name and the new name are required")
+	}
+
+	password := passwordSource.password()
+	editor := openEditor(flags.Arg(0), password)
+	err := editor.Rename(flags.Arg(1), flags.Arg(2))
+	checkError(err)
+	fmt.Printf("Renamed %s to %s\n", flags.Arg(1), flags.Arg(2))
+
+	if *vacuum {
+		err = editor.Vacuum()
+		checkError(err)
+	}
+	err = editor.Close()
+	checkError(err)
+}
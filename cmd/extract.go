@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bernardo1r/arc"
+)
+
+const extractUsage = `Usage: arc extract [-o FOLDER] [-password | -password-file FILE] [-include PATTERN]... [-exclude PATTERN]... [-resume] [-journal FOLDER] [-j N] CONTAINER [INCREMENT]...
+
+extract writes all files of CONTAINER to a folder, named as CONTAINER
+without its extension unless -o is given. With -resume, the
+extracted files are recorded in a journal, so running the same command
+again after an interruption skips the files already extracted.
+
+With -include, only the files matching any of the patterns are extracted,
+and with -exclude, the files matching any of them are not, e.g.
+-include '*.log' or -include 'photos/2023/**'.
+
+With -j, N files are extracted at once, each reading the container through
+a connection of its own, which speeds up extracting many files to fast
+disks. It's ignored by -resume, incremental and remote containers.
+
+Given the containers made incremental over CONTAINER, in order, with
+"arc create -base", extract writes the files of CONTAINER as updated
+by each of them.
+
+CONTAINER can be the http or https URL of a container, such as a presigned
+URL of an object storage bucket, whose server supports range requests. Only
+the parts of the container holding the files extracted are downloaded, so
+-include extracts a few files of large containers quickly.`
+
+// patternsFlag collects the patterns of a repeated flag.
+type patternsFlag []string
+
+func (patterns *patternsFlag) String() string {
+	return strings.Join(*patterns, ",")
+}
+
+func (patterns *patternsFlag) Set(pattern string) error {
+	*patterns = append(*patterns, pattern)
+	return nil
+}
+
+func defaultJournalDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "."
+	}
+
+	return filepath.Join(dir, "arc", "journal")
+}
+
+func runExtract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(extractUsage)
+		flags.PrintDefaults()
+	}
+	outputFolder := flags.String("o", "", "extract to `folder`")
+	passwordSource := passwordFlags(flags)
+	var include, exclude patternsFlag
+	flags.Var(&include, "include", "only extract the files matching `pattern`, repeatable")
+	flags.Var(&exclude, "exclude", "skip the files matching `pattern`, repeatable")
+	resume := flags.Bool("resume", false, "skip the files extracted by an interrupted run")
+	journalDir := flags.String("journal", defaultJournalDir(), "`folder` holding the extraction journals")
+	jobs := flags.Int("j", 1, "extract `N` files at once")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		log.Fatalln("One container path is required")
+	}
+	filtered := len(include) > 0 || len(exclude) > 0
+	if *resume && filtered {
+		log.Fatalln("-resume can't be combined with -include or -exclude")
+	}
+	layered := flags.NArg() > 1
+	if layered && (*resume || filtered) {
+		log.Fatalln("Incremental containers can't be extracted with -resume, -include or -exclude")
+	}
+
+	remote := isURL(flags.Arg(0))
+	if remote && (layered || *resume) {
+		log.Fatalln("Remote containers can't be extracted with -resume, or with incremental containers")
+	}
+
+	password := passwordSource.password()
+	outputPath := containerFolder(flags.Arg(0))
+	if *outputFolder != "" {
+		outputPath = filepath.Clean(*outputFolder)
+	}
+	err := os.MkdirAll(outputPath, 0775)
+	checkError(err)
+	target := arc.NewDirTarget(outputPath)
+
+	if remote {
+		reader := openRemote(flags.Arg(0), password)
+		defer reader.Close()
+		checkError(reader.ExtractMatchingTo(target, include, exclude))
+		fmt.Printf("Extracted %s to %s\n", flags.Arg(0), outputPath)
+		return
+	}
+
+	reader := openReader(flags.Arg(0), password)
+	defer reader.Close()
+	reader.SetExtractWorkers(*jobs)
+
+	switch {
+	case layered:
+		readers := []*arc.Reader{reader}
+		for _, path := range flags.Args()[1:] {
+			increment := openReader(path, password)
+			defer increment.Close()
+			readers = append(readers, increment)
+		}
+		var layers *arc.Layers
+		layers, err = arc.NewLayers(readers...)
+		checkError(err)
+		err = layers.ExtractAllTo(target)
+	case *resume:
+		err = os.MkdirAll(*journalDir, 0775)
+		checkError(err)
+		err = reader.ExtractAllResumable(target, *journalDir)
+	case filtered:
+		err = reader.ExtractMatchingTo(target, include, exclude)
+	default:
+		err = reader.ExtractAllTo(target)
+	}
+	checkError(err)
+	fmt.Printf("Extracted %s to %s\n", flags.Arg(0), outputPath)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/bernardo1r/arc"
+)
+
+const fsckUsage = `Usage: arc fsck [-repair] CONTAINER...
+
+fsck checks each CONTAINER for rows belonging to files no longer in it,
+as data blocks and keys, and for files whose blocks don't match their
+recorded number of blocks or stored size, reporting what it finds. With
+-repair, the rows belonging to no file are purged. Damaged files are only
+reported, and can be deleted with "arc rm".`
+
+func runFsck(args []string) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(fsckUsage)
+		flags.PrintDefaults()
+	}
+	repair := flags.Bool("repair", false, "purge the rows belonging to no file")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalln("At least one container path is required")
+	}
+
+	ok := true
+	for _, path := range flags.Args() {
+		report, err := arc.Fsck(path, *repair)
+		checkError(err)
+		printFsckReport(path, report)
+		ok = ok && report.Ok()
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// printFsckReport prints what fsck found in the container path.
+func printFsckReport(path string, report *arc.FsckReport) {
+	action := "found"
+	if report.Repaired {
+		action = "purged"
+	}
+
+	tables := make([]string, 0, len(report.Orphans))
+	for table := range report.Orphans {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("%s: %d orphan rows of %s %s\n", path, report.Orphans[table], table, action)
+	}
+	if report.UnreferencedBlocks > 0 {
+		fmt.Printf("%s: %d unreferenced blocks %s\n", path, report.UnreferencedBlocks, action)
+	}
+	for _, mismatch := range report.Mismatches {
+		fmt.Printf(
+			"%s: file %d (%s): %d of %d blocks stored, %d bytes stored\n",
+			path,
+			mismatch.Id,
+			mismatch.Name,
+			mismatch.StoredBlocks,
+			mismatch.Blocks,
+			mismatch.ActualStoredSize,
+		)
+	}
+	if report.Ok() {
+		fmt.Printf("%s: ok\n", path)
+	}
+}
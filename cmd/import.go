@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/bernardo1r/arc"
+)
+
+const importUsage = `Usage: arc import CONTAINER
+
+import stores the container read from the standard input, as written by
+"arc create -", in the new file CONTAINER, e.g.:
+
+	arc create - folder | ssh host arc import backup.arc`
+
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(importUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One container path is required")
+	}
+
+	checkError(arc.ReadContainer(os.Stdin, flags.Arg(0)))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bernardo1r/arc"
+)
+
+const infoUsage = `Usage: arc info [-json] CONTAINER
+
+info prints the number of files of CONTAINER, their size before and after
+compression, the space left unused by deleted files and the features the
+container supports, along with how encrypted containers are unlocked. With
+-json, they're printed as a JSON object.`
+
+// infoOutput is the container information printed by "arc info -json".
+type infoOutput struct {
+	UUID           string            `json:"uuid,omitempty"`
+	Encrypted      bool              `json:"encrypted"`
+	Key            string            `json:"key,omitempty"`
+	KDF            *kdfOutput        `json:"kdf,omitempty"`
+	Cipher         string            `json:"cipher,omitempty"`
+	EncryptedFiles int               `json:"encrypted_files"`
+	PasswordFiles  int               `json:"password_files"`
+	Features       []string          `json:"features"`
+	Files          int               `json:"files"`
+	Size           int64             `json:"size"`
+	StoredSize     int64             `json:"stored_size"`
+	Ratio          float64           `json:"ratio"`
+	Compressed     compressionOutput `json:"compressed"`
+	Uncompressed   compressionOutput `json:"uncompressed"`
+	DatabaseSize   int64             `json:"database_size"`
+	FreeSize       int64             `json:"free_size"`
+}
+
+// kdfOutput are the key derivation parameters printed by "arc info -json".
+type kdfOutput struct {
+	Algorithm string `json:"algorithm"`
+	Version   uint8  `json:"version"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"`
+	Threads   uint8  `json:"threads"`
+}
+
+// compressionOutput are the compression stats printed by "arc info -json".
+type compressionOutput struct {
+	Files      int   `json:"files"`
+	Size       int64 `json:"size"`
+	StoredSize int64 `json:"stored_size"`
+}
+
+func isComma(r rune) bool {
+	return r == ','
+}
+
+// printInfoJSON prints the information of the container of reader,
+// with stats, as JSON.
+func printInfoJSON(reader *arc.Reader, stats *arc.Stats) {
+	output := infoOutput{
+		Encrypted:    reader.IsEncrypted(),
+		Features:     strings.FieldsFunc(reader.Capabilities().String(), isComma),
+		Files:        stats.Files,
+		Size:         stats.Size,
+		StoredSize:   stats.StoredSize,
+		Ratio:        stats.Ratio(),
+		Compressed:   compressionOutput(stats.Compressed),
+		Uncompressed: compressionOutput(stats.Uncompressed),
+		DatabaseSize: stats.DatabaseSize,
+		FreeSize:     stats.FreeSize,
+	}
+	output.UUID, _ = reader.UUID()
+	if output.Encrypted {
+		info, err := reader.ContainerInfo()
+		checkError(err)
+		output.Key = info.KeySource.String()
+		if info.KDF != nil {
+			output.KDF = &kdfOutput{
+				Algorithm: info.KDF.Algorithm,
+				Version:   info.KDF.Version,
+				Time:      info.KDF.Time,
+				Memory:    info.KDF.Memory,
+				Threads:   info.KDF.Threads,
+			}
+		}
+		output.Cipher = info.CipherSuite.String()
+		output.EncryptedFiles = info.EncryptedFiles
+		output.PasswordFiles = info.PasswordFiles
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+	checkError(encoder.Encode(output))
+}
+
+func runInfo(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(infoUsage)
+		flags.PrintDefaults()
+	}
+	jsonOutput := flags.Bool("json", false, "print the information as a JSON object")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One container path is required")
+	}
+
+	reader := openReader(flags.Arg(0), nil)
+	defer reader.Close()
+	stats, err := reader.Stats()
+	checkError(err)
+	if *jsonOutput {
+		printInfoJSON(reader, stats)
+		return
+	}
+
+	output := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	uuid, err := reader.UUID()
+	if err == nil {
+		fmt.Fprintf(output, "UUID:\t%s\n", uuid)
+	}
+	fmt.Fprintf(output, "Encrypted:\t%t\n", reader.IsEncrypted())
+	if reader.IsEncrypted() {
+		info, err := reader.ContainerInfo()
+		checkError(err)
+		fmt.Fprintf(output, "Key:\t%s\n", info.KeySource)
+		if info.KDF != nil {
+			fmt.Fprintf(
+				output,
+				"KDF:\t%s v%d, %d passes, %d KiB, %d threads\n",
+				info.KDF.Algorithm,
+				info.KDF.Version,
+				info.KDF.Time,
+				info.KDF.Memory,
+				info.KDF.Threads,
+			)
+		}
+		fmt.Fprintf(output, "Cipher:\t%s\n", info.CipherSuite)
+		fmt.Fprintf(
+			output,
+			"Encrypted files:\t%d, %d with their own password\n",
+			info.EncryptedFiles,
+			info.PasswordFiles,
+		)
+	}
+	fmt.Fprintf(output, "Features:\t%s\n", reader.Capabilities())
+	fmt.Fprintf(output, "Files:\t%d\n", stats.Files)
+	fmt.Fprintf(output, "Size:\t%d\n", stats.Size)
+	fmt.Fprintf(output, "Stored size:\t%d\n", stats.StoredSize)
+	fmt.Fprintf(output, "Ratio:\t%.2f\n", stats.Ratio())
+	for _, group := range []struct {
+		name  string
+		stats arc.CompressionStats
+	}{
+		{"Compressed", stats.Compressed},
+		{"Uncompressed", stats.Uncompressed},
+	} {
+		fmt.Fprintf(
+			output,
+			"%s:\t%d files, %d bytes, %d stored\n",
+			group.name,
+			group.stats.Files,
+			group.stats.Size,
+			group.stats.StoredSize,
+		)
+	}
+	fmt.Fprintf(output, "Database size:\t%d\n", stats.DatabaseSize)
+	fmt.Fprintf(output, "Free space:\t%d\n", stats.FreeSize)
+	checkError(output.Flush())
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/bernardo1r/arc"
+)
+
+const joinUsage = `Usage: arc join CONTAINER
+
+join joins the volumes CONTAINER.001, CONTAINER.002 and so on, written by
+"arc create -volume-size", back into CONTAINER, removing them.`
+
+func runJoin(args []string) {
+	flags := flag.NewFlagSet("join", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(joinUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One container path is required")
+	}
+
+	checkError(arc.JoinVolumes(flags.Arg(0)))
+}
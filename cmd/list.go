@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bernardo1r/arc"
+)
+
+const listUsage = `Usage: arc list [-password | -password-file FILE] [-prefix PREFIX] [-stored] [-json] CONTAINER
+
+list prints the name, size and modification time of the files of
+CONTAINER. Encrypted names are only shown with -password. With -stored,
+the size of the files as stored, after compression, is printed too. With
+-json, each file is printed as a JSON object per line, with its name, type,
+size, stored size, modification time, whether it's encrypted and compressed,
+and its checksum, if stored. CONTAINER can be the http or https URL of a
+container, as with "arc extract", listed without downloading its data.`
+
+// listEntry is a file printed by "arc list -json".
+type listEntry struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Size       int64     `json:"size"`
+	StoredSize int64     `json:"stored_size"`
+	ModTime    time.Time `json:"mtime"`
+	Encrypted  bool      `json:"encrypted"`
+	Compressed bool      `json:"compressed"`
+	Checksum   string    `json:"checksum,omitempty"`
+}
+
+// typeName returns the name of the type of the file of header.
+func typeName(header *arc.Header) string {
+	switch header.Type {
+	case arc.TypeDir:
+		return "dir"
+	case arc.TypeSymlink:
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// newListEntry returns the entry of the file of header.
+func newListEntry(header *arc.Header) listEntry {
+	return listEntry{
+		Name:       header.Name,
+		Type:       typeName(header),
+		Size:       header.Size,
+		StoredSize: header.StoredSize,
+		ModTime:    header.ModTime.UTC(),
+		Encrypted:  header.Encryption,
+		Compressed: header.Compression != 0,
+		Checksum:   hex.EncodeToString(header.Checksum),
+	}
+}
+
+// typeSuffix returns the suffix marking the type of the file of header.
+func typeSuffix(header *arc.Header) string {
+	switch header.Type {
+	case arc.TypeDir:
+		return "/"
+	case arc.TypeSymlink:
+		return "@"
+	default:
+		return ""
+	}
+}
+
+func runList(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(listUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	prefix := flags.String("prefix", "", "only list the files whose names start with `prefix`")
+	stored := flags.Bool("stored", false, "print the stored size of the files too")
+	jsonOutput := flags.Bool("json", false, "print the files as JSON objects, one per line")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One container path is required")
+	}
+
+	password := passwordSource.password()
+	if isURL(flags.Arg(0)) {
+		listRemote(flags.Arg(0), password, *prefix, *stored, *jsonOutput)
+		return
+	}
+	reader := openReader(flags.Arg(0), password)
+	defer reader.Close()
+
+	files, err := reader.Iterate(*prefix)
+	checkError(err)
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		for files.Next() {
+			checkError(encoder.Encode(newListEntry(files.Header())))
+		}
+		checkError(files.Err())
+		checkError(files.Close())
+		return
+	}
+
+	output := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for files.Next() {
+		printListLine(output, files.Header(), *stored)
+	}
+	checkError(files.Err())
+	checkError(files.Close())
+	checkError(output.Flush())
+}
+
+// printListLine prints the line of the file of header, with
+// its stored size, if stored, to output.
+func printListLine(output io.Writer, header *arc.Header, stored bool) {
+	if stored {
+		fmt.Fprintf(output, "%d\t", header.StoredSize)
+	}
+	fmt.Fprintf(
+		output,
+		"%d\t%s\t %s%s\n",
+		header.Size,
+		header.ModTime.Local().Format(time.DateTime),
+		header.Name,
+		typeSuffix(header),
+	)
+}
+
+// listRemote lists the files of the container served at url,
+// whose names start with prefix, in name order.
+func listRemote(url string, password []byte, prefix string, stored bool, jsonOutput bool) {
+	reader := openRemote(url, password)
+	defer reader.Close()
+
+	files, err := reader.Files()
+	checkError(err)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, name := range names {
+			checkError(encoder.Encode(newListEntry(files[name])))
+		}
+		return
+	}
+	output := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, name := range names {
+		printListLine(output, files[name], stored)
+	}
+	checkError(output.Flush())
+}
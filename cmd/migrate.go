@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/bernardo1r/arc"
+)
+
+const migrateUsage = `Usage: arc migrate CONTAINER...
+
+migrate upgrades each CONTAINER, created by an older version of arc, in
+place to the current container format, so it supports all features.`
+
+func runMigrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(migrateUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalln("At least one container path is required")
+	}
+
+	for _, path := range flags.Args() {
+		checkError(arc.Migrate(path))
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/bernardo1r/arc"
+)
+
+const mountUsage = `Usage: arc mount [-password | -password-file FILE] CONTAINER FOLDER
+
+mount mounts the files of CONTAINER read-only at FOLDER, until interrupted
+or unmounted with "fusermount -u FOLDER". Encrypted files are only listed
+with -password. Mounting needs FUSE, and is only supported on Linux.`
+
+func runMount(args []string) {
+	flags := flag.NewFlagSet("mount", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(mountUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		log.Fatalln("One container path and one folder are required")
+	}
+	mustBeFolder(flags.Arg(1))
+
+	password := passwordSource.password()
+	reader := openReader(flags.Arg(0), password)
+	defer reader.Close()
+	fsys, err := reader.FS()
+	checkError(err)
+
+	mount, err := arc.MountFS(flags.Arg(1), fsys)
+	checkError(err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		err := mount.Unmount()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	checkError(mount.Serve())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/bernardo1r/arc"
+	"golang.org/x/term"
+)
+
+const passwdUsage = `Usage: arc passwd CONTAINER
+
+passwd changes the password of CONTAINER. The old and the new passwords
+are prompted for, without being echoed, or read from the first two lines
+of the standard input when it's not a terminal, so they don't show up in
+the process list. The file data isn't re-encrypted.`
+
+func runPasswd(args []string) {
+	flags := flag.NewFlagSet("passwd", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(passwdUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One container path is required")
+	}
+
+	oldPassword := promptPassword("Old password: ")
+	newPassword := promptPassword("New password: ")
+	if term.IsTerminal(int(os.Stdin.Fd())) && !bytes.Equal(newPassword, promptPassword("Repeat new password: ")) {
+		log.Fatalln("The new passwords don't match")
+	}
+
+	editor, err := arc.OpenEditor(flags.Arg(0), nil)
+	checkError(err)
+
+	err = editor.ChangePassword(oldPassword, newPassword)
+	checkError(err)
+	err = editor.Close()
+	checkError(err)
+	fmt.Printf("Password of %s changed\n", flags.Arg(0))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// passwordEnv is the environment variable holding the container
+// password, for scripts.
+const passwordEnv = "ARC_PASSWORD"
+
+// stdin buffers the standard input, so passwords read one per line
+// don't lose the lines buffered after them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// passwordOptions are the flags selecting where the container password
+// is read from.
+type passwordOptions struct {
+	prompt *bool
+	file   *string
+}
+
+// passwordFlags defines the -password and -password-file flags of flags.
+func passwordFlags(flags *flag.FlagSet) *passwordOptions {
+	return &passwordOptions{
+		prompt: flags.Bool("password", false, "prompt for the container password"),
+		file:   flags.String("password-file", "", "read the container password from the first line of `file`"),
+	}
+}
+
+// password returns the container password: read from the password file,
+// if given, or from the ARC_PASSWORD environment variable, if set, or
+// prompted for, with -password. It returns nil otherwise.
+func (options *passwordOptions) password() []byte {
+	if *options.file != "" {
+		content, err := os.ReadFile(*options.file)
+		checkError(err)
+		line, _, _ := bytes.Cut(content, []byte("\n"))
+		return bytes.TrimSuffix(line, []byte("\r"))
+	}
+
+	if password, ok := os.LookupEnv(passwordEnv); ok {
+		return []byte(password)
+	}
+
+	if *options.prompt {
+		return promptPassword("Password: ")
+	}
+	return nil
+}
+
+// promptPassword prompts for a password, without echoing it when the
+// standard input is a terminal, or else reads it from the next line
+// of the standard input.
+func promptPassword(prompt string) []byte {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine()
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	checkError(err)
+	return password
+}
+
+// readLine reads the next line of the standard input.
+func readLine() []byte {
+	line, err := stdin.ReadBytes('\n')
+	if errors.Is(err, io.EOF) && len(line) == 0 {
+		log.Fatalln("Expected a password in the standard input")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		checkError(err)
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
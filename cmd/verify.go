@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+)
+
+const verifyUsage = `Usage: arc verify [-password | -password-file FILE] CONTAINER
+
+verify reads all files of CONTAINER, checking them against their stored
+size, number of blocks and checksum, and reports the damaged files.
+Encrypted files are only verified with -password.`
+
+func runVerify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		log.Println(verifyUsage)
+		flags.PrintDefaults()
+	}
+	passwordSource := passwordFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("One container path is required")
+	}
+
+	password := passwordSource.password()
+	reader := openReader(flags.Arg(0), password)
+	defer reader.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := reader.VerifyAll(ctx)
+	checkError(err)
+
+	for _, name := range report.Skipped {
+		fmt.Printf("%s: skipped, encrypted\n", name)
+	}
+	for _, damaged := range report.Damaged {
+		fmt.Printf("%s: %v\n", damaged.Name, damaged.Err)
+	}
+	if !report.Ok() {
+		log.Fatalf("%d of %d files of %s damaged\n", len(report.Damaged), report.Verified, flags.Arg(0))
+	}
+	fmt.Printf("%d files of %s verified\n", report.Verified, flags.Arg(0))
+}
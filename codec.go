@@ -0,0 +1,226 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bernardo1r/arc/internal/lz4"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	queryCodecById = `SELECT codec FROM metadata WHERE id = ?`
+
+	queryUpdateCodec = `UPDATE metadata SET codec = ? WHERE id = ?`
+)
+
+// ErrUnknownCodec is returned when a file is written, or read, with
+// a compression codec not registered by [RegisterCodec].
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+// Names of the built-in codecs.
+const (
+	// CodecZstd is the default codec, the only one using
+	// the compression dictionaries of the container.
+	CodecZstd = "zstd"
+
+	// CodecGzip compresses with gzip, for interoperability.
+	CodecGzip = "gzip"
+
+	// CodecS2 compresses with S2, an extension of Snappy, trading
+	// compression ratio for speed.
+	CodecS2 = "s2"
+
+	// CodecLZ4 compresses with the LZ4 frame format, trading compression
+	// ratio for speed, readable by the lz4 command.
+	CodecLZ4 = "lz4"
+)
+
+// Codec compresses and decompresses the contents of files. The codec of
+// a file is recorded by name in the container, so it's selected again when
+// reading, and must be registered by [RegisterCodec] by both the writer
+// and the reader. Other algorithms, as xz, are supported by
+// registering a Codec wrapping them.
+type Codec interface {
+	// NewWriter returns a writer compressing what's written to it into dst,
+	// at level, mapped to the closest level of the codec. Closing it
+	// flushes the compressed data, without closing dst.
+	NewWriter(dst io.Writer, level zstd.EncoderLevel) (io.WriteCloser, error)
+
+	// NewReader returns a reader decompressing src.
+	// Closing it releases its resources.
+	NewReader(src io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		CodecZstd: zstdCodec{},
+		CodecGzip: gzipCodec{},
+		CodecS2:   s2Codec{},
+		CodecLZ4:  lz4Codec{},
+	}
+)
+
+// RegisterCodec makes codec available by name for writing and reading
+// files. As [sql.Register], it panics if codec is nil, or if a codec
+// is already registered by name.
+func RegisterCodec(name string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if codec == nil {
+		panic("arc: RegisterCodec codec is nil")
+	}
+	if _, dup := codecs[name]; dup || name == "" {
+		panic("arc: RegisterCodec called twice for codec " + name)
+	}
+	codecs[name] = codec
+}
+
+// isZstd reports whether the codec name, as in [Header.Codec], is zstd.
+func isZstd(name string) bool {
+	return name == "" || name == CodecZstd
+}
+
+// fileCodec returns the codec name, as in [Header.Codec]. The compression
+// dictionary dict, if not nil, is only used by zstd.
+func fileCodec(name string, dict *dictionary) (Codec, error) {
+	if isZstd(name) {
+		return zstdCodec{dict: dict}, nil
+	}
+
+	codecsMu.RLock()
+	codec, ok := codecs[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+	return codec, nil
+}
+
+// fileCodec returns the codec of the compressed file id.
+func (reader *Reader) fileCodec(id int) (Codec, error) {
+	var name sql.NullString
+	if reader.capabilities.Has(FeatureCodecs) {
+		err := reader.db.QueryRow(queryCodecById, id).Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var dict *dictionary
+	if isZstd(name.String) {
+		var err error
+		dict, err = reader.fileDictionary(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fileCodec(name.String, dict)
+}
+
+// zstdCodec compresses with zstd, using dict, if not nil,
+// and tuned by options, if not nil.
+type zstdCodec struct {
+	dict    *dictionary
+	options *ZstdOptions
+}
+
+func (codec zstdCodec) NewWriter(dst io.Writer, level zstd.EncoderLevel) (io.WriteCloser, error) {
+	options := []zstd.EOption{zstd.WithEncoderLevel(level)}
+	if codec.dict != nil {
+		options = append(options, codec.dict.encoderOption())
+	}
+	if codec.options != nil {
+		options = append(options, codec.options.encoderOptions()...)
+	}
+	return zstd.NewWriter(dst, options...)
+}
+
+func (codec zstdCodec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	var options []zstd.DOption
+	if codec.dict != nil {
+		options = append(options, codec.dict.decoderOption())
+	}
+	decoder, err := zstd.NewReader(src, options...)
+	if err != nil {
+		return nil, err
+	}
+	return zstdReader{decoder}, nil
+}
+
+// zstdReader adapts a [zstd.Decoder], whose Close
+// method returns no error, to [io.ReadCloser].
+type zstdReader struct {
+	decoder *zstd.Decoder
+}
+
+func (reader zstdReader) Read(p []byte) (int, error) {
+	return reader.decoder.Read(p)
+}
+
+func (reader zstdReader) Close() error {
+	reader.decoder.Close()
+	return nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) NewWriter(dst io.Writer, level zstd.EncoderLevel) (io.WriteCloser, error) {
+	gzipLevel := gzip.DefaultCompression
+	switch {
+	case level <= zstd.SpeedFastest:
+		gzipLevel = gzip.BestSpeed
+	case level >= zstd.SpeedBestCompression:
+		gzipLevel = gzip.BestCompression
+	case level == zstd.SpeedBetterCompression:
+		gzipLevel = 7
+	}
+	return gzip.NewWriterLevel(dst, gzipLevel)
+}
+
+func (gzipCodec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(src)
+}
+
+type s2Codec struct{}
+
+func (s2Codec) NewWriter(dst io.Writer, level zstd.EncoderLevel) (io.WriteCloser, error) {
+	var options []s2.WriterOption
+	switch {
+	case level >= zstd.SpeedBestCompression:
+		options = append(options, s2.WriterBestCompression())
+	case level == zstd.SpeedBetterCompression:
+		options = append(options, s2.WriterBetterCompression())
+	}
+	return s2.NewWriter(dst, options...), nil
+}
+
+func (s2Codec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(s2.NewReader(src)), nil
+}
+
+type lz4Codec struct{}
+
+// NewWriter maps level to the depth of the search for matches.
+func (lz4Codec) NewWriter(dst io.Writer, level zstd.EncoderLevel) (io.WriteCloser, error) {
+	depth := 4
+	switch {
+	case level <= zstd.SpeedFastest:
+		depth = 1
+	case level >= zstd.SpeedBestCompression:
+		depth = 64
+	case level == zstd.SpeedBetterCompression:
+		depth = 16
+	}
+	return lz4.NewWriter(dst, depth), nil
+}
+
+func (lz4Codec) NewReader(src io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(src)), nil
+}
@@ -0,0 +1,20 @@
+package arc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestLZ4RoundTrip(t *testing.T) {
+	contents := bytes.Repeat([]byte("compressible contents "), 10000)
+	for _, level := range []zstd.EncoderLevel{zstd.SpeedFastest, zstd.SpeedDefault, zstd.SpeedBestCompression} {
+		path := testContainerPath(t)
+		header := Header{Codec: CodecLZ4, Compression: level}
+		files := map[string]string{"file": string(contents), "empty": ""}
+		writeTestContainer(t, path, testPassword, header, files)
+
+		checkFiles(t, readTestContainer(t, path, testPassword), files)
+	}
+}
@@ -0,0 +1,24 @@
+package arc
+
+import "errors"
+
+// ErrConcurrentUse is returned when a [Writer] method is called while
+// another call on the same Writer is in progress, in another goroutine,
+// or while the Writer is used by a [ParallelWriter]. Writers aren't safe
+// for concurrent use: the call is refused, instead of corrupting the file
+// being written. Files are written concurrently by a ParallelWriter.
+var ErrConcurrentUse = errors.New("writer used concurrently")
+
+// acquire marks the Writer in use by a call, until released,
+// failing with [ErrConcurrentUse] if it's in use already.
+func (writer *Writer) acquire() error {
+	if !writer.busy.CompareAndSwap(false, true) {
+		return ErrConcurrentUse
+	}
+	return nil
+}
+
+// release marks the Writer no longer in use.
+func (writer *Writer) release() {
+	writer.busy.Store(false)
+}
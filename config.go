@@ -0,0 +1,522 @@
+package arc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned when a [Config] has a field with an invalid value.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config holds the options shared by the [Writer], the [Reader], the builder
+// and the command line tool, so all of them are configured through the same path.
+//
+// A Config can be serialized to and from JSON and YAML, with the same
+// field names. The password is never serialized and must be provided
+// separately.
+type Config struct {
+	// Blocksize is the size, in bytes, of a file chunk within
+	// the container, between [MinBlocksize] and [MaxBlocksize].
+	// The zero value means [DefaultBlocksize].
+	Blocksize int
+
+	// Compression is the compression level applied to the files
+	// written in the container.
+	//
+	// The default value (0) indicates that no compression
+	// is applied.
+	Compression zstd.EncoderLevel
+
+	// Codec is the name of the codec compressing the files written in
+	// the container. The empty value selects [CodecZstd].
+	Codec string
+
+	// Encryption indicates if the files written in the container
+	// are encrypted or not.
+	Encryption bool
+
+	// Convergent indicates if encrypted files use convergent encryption.
+	// See [Header.Convergent] for its tradeoffs.
+	Convergent bool
+
+	// CipherSuite is the suite encrypting the contents of the files
+	// of new containers. See [CipherSuite].
+	CipherSuite CipherSuite
+
+	// Pragmas, if not nil, tunes the sqlite database of the container.
+	// See [FastWrite] and [Durable].
+	Pragmas *Pragmas
+
+	// ReadOnly opens the container of a [Reader] read-only, so reading never
+	// takes a write lock, and fails instead of writing to the container.
+	ReadOnly bool
+
+	// Immutable opens the container of a [Reader] as immutable, read-only
+	// and without taking any lock, as for containers on read-only media or
+	// network shares with unreliable locking. The container mustn't be
+	// written while read, or the Reader may read corrupted data.
+	Immutable bool
+
+	// BlockCache is the size, in bytes, of the cache of the blocks read by
+	// the [FileReader]s of a [Reader], where zero disables it.
+	// See [Reader.SetBlockCache].
+	BlockCache int64
+
+	// Prefetch is the number of blocks read ahead, in the background, by
+	// a [Reader] reading files, where zero disables it.
+	// See [Reader.SetPrefetch].
+	Prefetch int
+
+	// Workers is the number of workers extracting the files of a [Reader],
+	// as set by [Reader.SetExtractWorkers], and inserting them by the
+	// builder, through a [ParallelWriter]. Zero works file by file.
+	Workers int
+
+	// VolumeSize, when not zero, splits the container of a [Writer] into
+	// volumes of at most VolumeSize bytes once closed.
+	// See [Writer.SetVolumeSize].
+	VolumeSize int64
+
+	// CommitEvery, when not zero, groups the files written by a [Writer]
+	// into transactions of CommitEvery files. See [Writer.SetCommitEvery].
+	CommitEvery int
+
+	// KDF are the params deriving the keys of new containers, and of
+	// files with their own password, from passwords. See [KDFParams].
+	KDF KDFParams
+
+	// PageEncryption encrypts the whole database file of the container,
+	// page by page, with Password, so its structure, the number of files
+	// and the sizes of their blocks aren't visible either, as file
+	// encryption alone leaves them. It requires Encryption, and the sqlite
+	// driver built against SQLCipher, or else opening the container fails
+	// with [ErrPageEncryptionUnsupported]. The containers are only opened
+	// by the Writers and Readers created with such a Config. As each new
+	// connection is given the password, they keep a copy of it, which
+	// can't be zeroed, until closed.
+	PageEncryption bool
+
+	// Password is used to derive the container encryption key. It's only
+	// read while creating the Writers and Readers, which neither keep it
+	// nor zero it, so callers may zero it once they're created. The keys
+	// derived from it are zeroed, best effort, once the Writers and
+	// Readers are closed.
+	Password []byte
+}
+
+// Option is an option for creating a [Config].
+type Option func(*Config)
+
+// WithBlocksize sets the size, in bytes, of a file chunk within the container.
+func WithBlocksize(blocksize int) Option {
+	return func(config *Config) {
+		config.Blocksize = blocksize
+	}
+}
+
+// WithCompression sets the compression level applied to the files written
+// in the container.
+func WithCompression(level zstd.EncoderLevel) Option {
+	return func(config *Config) {
+		config.Compression = level
+	}
+}
+
+// WithCodec sets the name of the codec compressing the files written
+// in the container. See [Codec].
+func WithCodec(name string) Option {
+	return func(config *Config) {
+		config.Codec = name
+	}
+}
+
+// WithPassword sets the container password and enables encryption
+// of the written files.
+func WithPassword(password []byte) Option {
+	return func(config *Config) {
+		config.Password = password
+		config.Encryption = true
+	}
+}
+
+// WithCipherSuite sets the suite encrypting the contents
+// of the files of new containers.
+func WithCipherSuite(suite CipherSuite) Option {
+	return func(config *Config) {
+		config.CipherSuite = suite
+	}
+}
+
+// WithPragmas sets the pragmas tuning the sqlite database of the container.
+func WithPragmas(pragmas Pragmas) Option {
+	return func(config *Config) {
+		config.Pragmas = &pragmas
+	}
+}
+
+// WithKDFParams sets the params deriving keys from passwords.
+// See [KDFParams].
+func WithKDFParams(params KDFParams) Option {
+	return func(config *Config) {
+		config.KDF = params
+	}
+}
+
+// WithPageEncryption enables the encryption of the whole database
+// file of the container. See [Config.PageEncryption].
+func WithPageEncryption() Option {
+	return func(config *Config) {
+		config.PageEncryption = true
+	}
+}
+
+// WithConvergentEncryption enables convergent encryption of the
+// encrypted files. See [Header.Convergent] for its tradeoffs.
+func WithConvergentEncryption() Option {
+	return func(config *Config) {
+		config.Convergent = true
+	}
+}
+
+// WithReadOnly opens the container of a [Reader] read-only.
+func WithReadOnly() Option {
+	return func(config *Config) {
+		config.ReadOnly = true
+	}
+}
+
+// WithImmutable opens the container of a [Reader] as immutable,
+// without taking any lock. See [Config.Immutable].
+func WithImmutable() Option {
+	return func(config *Config) {
+		config.Immutable = true
+	}
+}
+
+// WithPrefetch sets the number of blocks read ahead by a [Reader]
+// reading files. See [Reader.SetPrefetch].
+func WithPrefetch(depth int) Option {
+	return func(config *Config) {
+		config.Prefetch = depth
+	}
+}
+
+// WithBlockCache sets the size, in bytes, of the cache of the blocks
+// read by the [FileReader]s of a [Reader]. See [Reader.SetBlockCache].
+func WithBlockCache(size int64) Option {
+	return func(config *Config) {
+		config.BlockCache = size
+	}
+}
+
+// WithWorkers sets the number of workers extracting and inserting
+// files. See [Config.Workers].
+func WithWorkers(workers int) Option {
+	return func(config *Config) {
+		config.Workers = workers
+	}
+}
+
+// WithVolumeSize splits the container into volumes of at most size
+// bytes once the [Writer] is closed. See [Writer.SetVolumeSize].
+func WithVolumeSize(size int64) Option {
+	return func(config *Config) {
+		config.VolumeSize = size
+	}
+}
+
+// WithCommitEvery groups the files written into transactions of n
+// files. See [Writer.SetCommitEvery].
+func WithCommitEvery(n int) Option {
+	return func(config *Config) {
+		config.CommitEvery = n
+	}
+}
+
+// WithConfig replaces the whole configuration with config.
+// Options applied after it will override its fields.
+func WithConfig(config *Config) Option {
+	return func(dst *Config) {
+		*dst = *config
+	}
+}
+
+// NewConfig creates a new Config with the provided options applied
+// and validated.
+func NewConfig(options ...Option) (*Config, error) {
+	config := new(Config)
+	for _, option := range options {
+		option(config)
+	}
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks if the Config fields are correctly filled. Correcting them
+// when a field with the zero value is detected or returning an error
+// if a field has an invalid value.
+func (config *Config) Validate() error {
+	blocksize, err := checkBlocksize(config.Blocksize)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	config.Blocksize = blocksize
+
+	if config.Compression < 0 || config.Compression > zstd.SpeedBestCompression {
+		return fmt.Errorf("%w: unknown compression level %d", ErrInvalidConfig, config.Compression)
+	}
+
+	_, err = fileCodec(config.Codec, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if config.CipherSuite < 0 || config.CipherSuite >= cipherSuiteCount {
+		return fmt.Errorf("%w: %w: %s", ErrInvalidConfig, ErrUnknownCipherSuite, config.CipherSuite)
+	}
+
+	if config.BlockCache < 0 {
+		return fmt.Errorf("%w: negative block cache size", ErrInvalidConfig)
+	}
+	if config.Prefetch < 0 {
+		return fmt.Errorf("%w: negative prefetch depth", ErrInvalidConfig)
+	}
+	if config.Workers < 0 {
+		return fmt.Errorf("%w: negative number of workers", ErrInvalidConfig)
+	}
+	if config.VolumeSize < 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, ErrInvalidVolumeSize)
+	}
+	if config.CommitEvery < 0 {
+		return fmt.Errorf("%w: negative number of files per commit", ErrInvalidConfig)
+	}
+
+	_, err = config.Pragmas.statements()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if config.Encryption && len(config.Password) == 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, ErrEmptyPassword)
+	}
+	err = config.KDF.check()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if config.PageEncryption && !config.Encryption {
+		return fmt.Errorf("%w: page encryption requires encryption", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// pragmas returns the pragmas of the databases opened with config,
+// keyed with the password when encrypting the whole database.
+func (config *Config) pragmas() *Pragmas {
+	if !config.PageEncryption {
+		return config.Pragmas
+	}
+
+	var pragmas Pragmas
+	if config.Pragmas != nil {
+		pragmas = *config.Pragmas
+	}
+	pragmas.key = append([]byte(nil), config.Password...)
+	return &pragmas
+}
+
+// configFields are the serialized fields of a [Config],
+// with the same names in JSON and YAML.
+type configFields struct {
+	Blocksize   int      `json:"blocksize,omitempty" yaml:"blocksize,omitempty"`
+	Compression string   `json:"compression,omitempty" yaml:"compression,omitempty"`
+	Codec       string   `json:"codec,omitempty" yaml:"codec,omitempty"`
+	Encryption  bool     `json:"encryption,omitempty" yaml:"encryption,omitempty"`
+	Convergent  bool     `json:"convergent,omitempty" yaml:"convergent,omitempty"`
+	Cipher      string   `json:"cipher,omitempty" yaml:"cipher,omitempty"`
+	Pragmas     *Pragmas `json:"pragmas,omitempty" yaml:"pragmas,omitempty"`
+	ReadOnly    bool     `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+	Immutable   bool     `json:"immutable,omitempty" yaml:"immutable,omitempty"`
+	BlockCache  int64    `json:"block_cache,omitempty" yaml:"block_cache,omitempty"`
+	Prefetch    int      `json:"prefetch,omitempty" yaml:"prefetch,omitempty"`
+	Workers     int      `json:"workers,omitempty" yaml:"workers,omitempty"`
+	VolumeSize  int64    `json:"volume_size,omitempty" yaml:"volume_size,omitempty"`
+	CommitEvery int      `json:"commit_every,omitempty" yaml:"commit_every,omitempty"`
+
+	PageEncryption bool       `json:"page_encryption,omitempty" yaml:"page_encryption,omitempty"`
+	KDF            *KDFParams `json:"kdf,omitempty" yaml:"kdf,omitempty"`
+}
+
+// fields returns the serialized fields of config. The compression level
+// and cipher suite are encoded by their names and the password is omitted.
+func (config *Config) fields() configFields {
+	aux := configFields{
+		Blocksize:   config.Blocksize,
+		Codec:       config.Codec,
+		Encryption:  config.Encryption,
+		Pragmas:     config.Pragmas,
+		Convergent:  config.Convergent,
+		ReadOnly:    config.ReadOnly,
+		Immutable:   config.Immutable,
+		BlockCache:  config.BlockCache,
+		Prefetch:    config.Prefetch,
+		Workers:     config.Workers,
+		VolumeSize:  config.VolumeSize,
+		CommitEvery: config.CommitEvery,
+
+		PageEncryption: config.PageEncryption,
+	}
+	if config.KDF != (KDFParams{}) {
+		aux.KDF = &config.KDF
+	}
+	if config.Compression != 0 {
+		aux.Compression = config.Compression.String()
+	}
+	if config.CipherSuite != CipherChaCha20Poly1305 {
+		aux.Cipher = config.CipherSuite.String()
+	}
+	return aux
+}
+
+// setFields sets the fields of config from their serialized form,
+// leaving the password untouched.
+func (config *Config) setFields(aux configFields) error {
+	config.Blocksize = aux.Blocksize
+	config.Codec = aux.Codec
+	config.Pragmas = aux.Pragmas
+	config.Encryption = aux.Encryption
+	config.Convergent = aux.Convergent
+	config.ReadOnly = aux.ReadOnly
+	config.Immutable = aux.Immutable
+	config.BlockCache = aux.BlockCache
+	config.Prefetch = aux.Prefetch
+	config.Workers = aux.Workers
+	config.VolumeSize = aux.VolumeSize
+	config.CommitEvery = aux.CommitEvery
+	config.PageEncryption = aux.PageEncryption
+	config.KDF = KDFParams{}
+	if aux.KDF != nil {
+		config.KDF = *aux.KDF
+	}
+	config.Compression = 0
+	if aux.Compression != "" {
+		ok, level := zstd.EncoderLevelFromString(aux.Compression)
+		if !ok {
+			return fmt.Errorf("%w: unknown compression level %q", ErrInvalidConfig, aux.Compression)
+		}
+		config.Compression = level
+	}
+
+	config.CipherSuite = CipherChaCha20Poly1305
+	if aux.Cipher != "" {
+		var err error
+		config.CipherSuite, err = ParseCipherSuite(aux.Cipher)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// The compression level and cipher suite are encoded by their
+// names and the password is omitted.
+func (config Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(config.fields())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (config *Config) UnmarshalJSON(data []byte) error {
+	var aux configFields
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&aux)
+	if err != nil {
+		return err
+	}
+
+	return config.setFields(aux)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface,
+// encoding the same fields as [Config.MarshalJSON].
+func (config Config) MarshalYAML() (any, error) {
+	return config.fields(), nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (config *Config) UnmarshalYAML(node *yaml.Node) error {
+	// The node is encoded again, as only a yaml.Decoder
+	// rejects the unknown fields, as UnmarshalJSON does.
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	var aux configFields
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&aux)
+	if err != nil {
+		return err
+	}
+
+	return config.setFields(aux)
+}
+
+// ReadConfig decodes a JSON encoded Config from r. The returned Config
+// is not validated, as the password must be provided before.
+func ReadConfig(r io.Reader) (*Config, error) {
+	config := new(Config)
+	err := json.NewDecoder(r).Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+
+	return config, nil
+}
+
+// ReadConfigYAML decodes a YAML encoded Config from r, as [ReadConfig].
+func ReadConfigYAML(r io.Reader) (*Config, error) {
+	config := new(Config)
+	err := yaml.NewDecoder(r).Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+
+	return config, nil
+}
+
+// LoadConfig reads a Config from the file at path, YAML encoded when
+// its extension is ".yaml" or ".yml", and JSON encoded otherwise.
+func LoadConfig(path string) (config *Config, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := file.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return ReadConfigYAML(file)
+	default:
+		return ReadConfig(file)
+	}
+}
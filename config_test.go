@@ -0,0 +1,121 @@
+package arc
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/yaml.v3"
+)
+
+func testConfig() Config {
+	return Config{
+		Blocksize:   4096,
+		Compression: zstd.SpeedBestCompression,
+		Encryption:  true,
+		CipherSuite: CipherAES256GCM,
+		Pragmas:     &Pragmas{JournalMode: "WAL", CacheSize: -2000},
+		Prefetch:    4,
+		Workers:     8,
+		VolumeSize:  1 << 20,
+		CommitEvery: 100,
+		KDF:         KDFParams{Time: 2, Memory: 1 << 16, Threads: 2},
+		Password:    []byte("secret"),
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	config := testConfig()
+	want := config
+	want.Password = nil
+
+	tests := []struct {
+		name      string
+		marshal   func(any) ([]byte, error)
+		unmarshal func([]byte, any) error
+	}{
+		{"json", json.Marshal, json.Unmarshal},
+		{"yaml", yaml.Marshal, yaml.Unmarshal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.marshal(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "secret") {
+				t.Fatalf("password serialized: %s", data)
+			}
+
+			var got Config
+			err = test.unmarshal(data, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConfigUnknownFields(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{"workers": 2, "threads": 3}`), &config)
+	if err == nil {
+		t.Error("json: unknown field accepted")
+	}
+	err = yaml.Unmarshal([]byte("workers: 2\nthreads: 3\n"), &config)
+	if err == nil {
+		t.Error("yaml: unknown field accepted")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"workers": 4, "volume_size": 65536, "compression": "fastest"}`,
+		"config.yaml": "workers: 4\nvolume_size: 65536\ncompression: fastest\n",
+		"config.yml":  "workers: 4\nvolume_size: 65536\ncompression: fastest\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(contents), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if config.Workers != 4 || config.VolumeSize != 65536 || config.Compression != zstd.SpeedFastest {
+			t.Errorf("%s: got %+v", name, config)
+		}
+	}
+}
+
+func TestConfigValidateInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		option Option
+	}{
+		{"workers", WithWorkers(-1)},
+		{"volume size", WithVolumeSize(-1)},
+		{"commit every", WithCommitEvery(-1)},
+		{"page size", WithPragmas(Pragmas{PageSize: 1000})},
+		{"busy timeout", WithPragmas(Pragmas{BusyTimeout: -2})},
+		{"empty password", WithPassword(nil)},
+	}
+	for _, test := range tests {
+		_, err := NewConfig(test.option)
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidConfig)
+		}
+	}
+}
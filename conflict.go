@@ -0,0 +1,160 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	queryIdExists = `SELECT id FROM metadata WHERE id = ?`
+
+	queryUnencryptedNameById = `SELECT name FROM metadata WHERE id = ? AND encrypted = 0`
+)
+
+// ErrFileExists is returned when writing a file whose name is
+// already in the container, with the [ConflictFail] policy.
+var ErrFileExists = errors.New("file already exists in container")
+
+// ConflictPolicy selects what writing a file does
+// when its name is already in the container.
+type ConflictPolicy int
+
+const (
+	// ConflictFail fails writing the file with [ErrFileExists].
+	ConflictFail ConflictPolicy = iota
+
+	// ConflictOverwrite replaces the existing file. It's only deleted,
+	// along with its data, once the new file is completely written,
+	// so it's kept if writing the new file fails.
+	ConflictOverwrite
+
+	// ConflictKeepBoth keeps the existing file, writing the new one with
+	// the lowest numeric suffix not taken, e.g. "notes.1.txt", which is
+	// set as [Header.Name].
+	ConflictKeepBoth
+)
+
+// replacedFile is the file replaced by the file being
+// written, under the [ConflictOverwrite] policy.
+type replacedFile struct {
+	id int
+
+	// name is the stored name of the file, renamed aside until it's
+	// deleted, as unencrypted names are unique. It's empty for
+	// encrypted files, whose stored names never collide.
+	name string
+}
+
+// replacedName returns the name an unencrypted file
+// is renamed to while being replaced.
+func replacedName(name string, id int) string {
+	return name + ".replaced-" + strconv.Itoa(id)
+}
+
+// loadNames loads the names of the encrypted files the Writer is able to
+// decrypt, with the container key, so conflicts with them are detected.
+func (writer *Writer) loadNames(db execQuerier) error {
+	writer.names = make(map[string]int)
+	if writer.encryptionKey == nil {
+		return nil
+	}
+
+	masterKey := func(int) []byte { return writer.encryptionKey }
+	return decryptNames(db, masterKey, func(id int, name string) bool {
+		writer.names[name] = id
+		return true
+	})
+}
+
+// existingId returns the id of the file name, or zero if there's none.
+// Besides unencrypted names, it compares the names of the files encrypted
+// with the container key, decrypted once on the first lookup, and of the
+// encrypted files written by the Writer.
+func (writer *Writer) existingId(db execQuerier, name string) (int, error) {
+	id, err := findFileId(db, nil, nil, name)
+	if err == nil || !errors.Is(err, ErrFileNotFound) {
+		return id, err
+	}
+
+	if writer.names == nil {
+		err = writer.loadNames(db)
+		if err != nil {
+			return 0, err
+		}
+	}
+	id, ok := writer.names[name]
+	if !ok {
+		return 0, nil
+	}
+
+	// The file may have been discarded since written.
+	err = db.QueryRow(queryIdExists, id).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		delete(writer.names, name)
+		return 0, nil
+	}
+	return id, err
+}
+
+// resolveConflict applies the conflict policy of header, when its name is
+// already in the container, returning the file to be replaced, if any.
+func (writer *Writer) resolveConflict(db execQuerier, header *Header) (replacedFile, error) {
+	id, err := writer.existingId(db, header.Name)
+	if err != nil || id == 0 {
+		return replacedFile{}, err
+	}
+
+	switch header.Conflict {
+	case ConflictOverwrite:
+		replaced := replacedFile{id: id}
+		err = db.QueryRow(queryUnencryptedNameById, id).Scan(&replaced.name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return replaced, nil
+		}
+		if err != nil {
+			return replacedFile{}, err
+		}
+		_, err = db.Exec(queryUpdateFilename, replacedName(replaced.name, id), id)
+		return replaced, err
+
+	case ConflictKeepBoth:
+		for i := 1; ; i++ {
+			candidate := suffixedName(header.Name, i)
+			id, err = writer.existingId(db, candidate)
+			if err != nil {
+				return replacedFile{}, err
+			}
+			if id == 0 {
+				header.Name = candidate
+				return replacedFile{}, nil
+			}
+		}
+
+	default:
+		return replacedFile{}, fmt.Errorf("%w: %s", ErrFileExists, header.Name)
+	}
+}
+
+// finishReplace deletes the replaced file, now that the file
+// replacing it is written. Its data and keys are deleted along.
+func finishReplace(db execQuerier, replaced replacedFile) error {
+	if replaced.id == 0 {
+		return nil
+	}
+
+	_, err := db.Exec(queryDeleteFileById, replaced.id)
+	return err
+}
+
+// restoreReplaced restores the name of the replaced file,
+// as the file replacing it was discarded.
+func restoreReplaced(db execQuerier, replaced replacedFile) error {
+	if replaced.name == "" {
+		return nil
+	}
+
+	_, err := db.Exec(queryUpdateFilename, replaced.name, replaced.id)
+	return err
+}
@@ -0,0 +1,54 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestConflictPolicies(t *testing.T) {
+	for _, encryption := range []bool{false, true} {
+		path := testContainerPath(t)
+		writeTestContainer(t, path, testPassword, Header{Encryption: encryption}, map[string]string{
+			"notes.txt": "old",
+			"other":     "other",
+		})
+
+		writer, err := openTestWriter(path, 0, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := Header{Name: "notes.txt", Encryption: encryption, Conflict: ConflictFail}
+		err = writer.WriteFrom(&header, bytes.NewReader([]byte("failed")))
+		if !errors.Is(err, ErrFileExists) {
+			t.Fatalf("encryption %v: got %v, want %v", encryption, err, ErrFileExists)
+		}
+		header = Header{Name: "notes.txt", Encryption: encryption, Conflict: ConflictKeepBoth}
+		writeTestFile(t, writer, header, []byte("kept"))
+		for range 2 {
+			header = Header{Name: "other", Encryption: encryption, Conflict: ConflictOverwrite}
+			writeTestFile(t, writer, header, []byte("overwritten"))
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := NewReader(path, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFiles(t, readTestFiles(t, reader), map[string]string{
+			"notes.txt":   "old",
+			"notes.1.txt": "kept",
+			"other":       "overwritten",
+		})
+		info, err := reader.StatByName("other")
+		if err != nil {
+			t.Errorf("encryption %v: %v", encryption, err)
+		} else if info.Size != int64(len("overwritten")) {
+			t.Errorf("encryption %v: got size %d", encryption, info.Size)
+		}
+		reader.Close()
+	}
+}
@@ -0,0 +1,231 @@
+package arc
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/bernardo1r/encdec"
+)
+
+const (
+	queryHasRecipients = `SELECT EXISTS(SELECT 1 FROM recipients)`
+
+	queryHasEncryptedFiles = `SELECT EXISTS(SELECT 1 FROM metadata WHERE encrypted = 1)`
+
+	queryFileCounts = `SELECT count(*), coalesce(sum(encrypted), 0) FROM metadata`
+
+	queryEncryptedIds = `SELECT id FROM metadata WHERE encrypted = 1`
+)
+
+// KeySource is where the container key, encrypting the files not
+// encrypted with their own password, comes from.
+type KeySource int
+
+const (
+	// KeyNone indicates the container has no container key, being
+	// unencrypted or having only files encrypted with their own password.
+	KeyNone KeySource = iota
+
+	// KeyPassword indicates the container key is derived from a password,
+	// given to [Reader.SetPassword].
+	KeyPassword
+
+	// KeyRecipients indicates the container key is wrapped for X25519
+	// recipients, one of whose private keys is given to [Reader.SetIdentity].
+	KeyRecipients
+
+	// KeyExternal indicates the keys of the files are wrapped by a
+	// [KeyProvider], given to [Reader.SetKeyProvider].
+	KeyExternal
+)
+
+func (source KeySource) String() string {
+	switch source {
+	case KeyNone:
+		return "none"
+	case KeyPassword:
+		return "password"
+	case KeyRecipients:
+		return "recipients"
+	case KeyExternal:
+		return "key-provider"
+	default:
+		return fmt.Sprintf("KeySource(%d)", int(source))
+	}
+}
+
+// KDFParams are the parameters of the Argon2 key derivation of the key
+// of a container, or of a file, encrypted with a password. They're stored
+// along the key, so keys are always derived again with the parameters
+// they were created with.
+//
+// Given in [Config.KDF], they set the cost of deriving new keys: zero
+// fields take the defaults, of one pass over 2 GiB of memory with 4
+// threads and a salt of 16 bytes. More memory and passes make brute
+// forcing the password slower, and less let devices short of memory
+// derive the key at all.
+type KDFParams struct {
+	// Algorithm is the variant of Argon2, only "argon2id".
+	Algorithm string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+
+	// Version is the version of Argon2, only 19.
+	Version uint8 `json:"version,omitempty" yaml:"version,omitempty"`
+
+	// Time is the number of passes over the memory.
+	Time uint32 `json:"time,omitempty" yaml:"time,omitempty"`
+
+	// Memory is the memory used, in KiB, at least 8 KiB per thread.
+	Memory uint32 `json:"memory,omitempty" yaml:"memory,omitempty"`
+
+	// Threads is the number of threads used.
+	Threads uint8 `json:"threads,omitempty" yaml:"threads,omitempty"`
+
+	// SaltSize is the size, in bytes, of the salt, from 8 to 255.
+	SaltSize int `json:"salt_size,omitempty" yaml:"salt_size,omitempty"`
+}
+
+// ContainerInfo describes the encryption of a container,
+// returned by [Reader.ContainerInfo].
+type ContainerInfo struct {
+	// KeySource is where the container key comes from.
+	KeySource KeySource
+
+	// KDF are the parameters deriving the container key from the
+	// password, nil unless KeySource is [KeyPassword].
+	KDF *KDFParams
+
+	// CipherSuite is the suite encrypting the contents of the files.
+	CipherSuite CipherSuite
+
+	// Unlocked reports whether the container key is known to the Reader.
+	Unlocked bool
+
+	// Files is the number of files of the container, EncryptedFiles of
+	// those encrypted, and PasswordFiles of those encrypted with their
+	// own password. See [Header.Password].
+	Files          int
+	EncryptedFiles int
+	PasswordFiles  int
+
+	// LockedFiles is the number of encrypted files whose key is unknown
+	// to the Reader, so their names and contents can't be read yet.
+	LockedFiles int
+}
+
+// Encrypted reports whether the container has a container
+// key or encrypted files.
+func (info *ContainerInfo) Encrypted() bool {
+	return info.KeySource != KeyNone || info.EncryptedFiles > 0
+}
+
+// keySource returns where the container key of the container opened
+// in db, with capabilities, comes from, along with the parameters
+// deriving it from the password, if any.
+func keySource(db execQuerier, capabilities Capabilities) (KeySource, *encdec.Params, error) {
+	if !capabilities.Has(FeatureEncryption) {
+		return KeyNone, nil, nil
+	}
+
+	var paramsString []byte
+	err := db.QueryRow(queryEncryptionKeyParams).Scan(&paramsString)
+	switch {
+	case err == nil:
+		params, err := encdec.ParseHeader(bytes.NewReader(paramsString))
+		return KeyPassword, params, err
+	case !errors.Is(err, sql.ErrNoRows):
+		return KeyNone, nil, err
+	}
+
+	if capabilities.Has(FeatureRecipients) {
+		var recipients bool
+		err = db.QueryRow(queryHasRecipients).Scan(&recipients)
+		if err != nil || recipients {
+			return KeyRecipients, nil, err
+		}
+	}
+
+	// The keys of the encrypted files of containers with a key provider
+	// are wrapped by it, while the rest have their own password.
+	var encrypted int
+	err = db.QueryRow(fileKeyCountQuery(capabilities)).Scan(&encrypted)
+	if err != nil || encrypted == 0 {
+		return KeyNone, nil, err
+	}
+	return KeyExternal, nil, nil
+}
+
+// fileKeyCountQuery returns the query counting the encrypted
+// files not encrypted with their own password.
+func fileKeyCountQuery(capabilities Capabilities) string {
+	if !capabilities.Has(FeatureFilePasswords) {
+		return `SELECT count(*) FROM encryption_metadata`
+	}
+	return `SELECT count(*) FROM encryption_metadata
+		WHERE id NOT IN (SELECT id FROM file_key_params)`
+}
+
+// hasEncryption reports whether the container opened in db,
+// with capabilities, has a container key or encrypted files.
+func hasEncryption(db execQuerier, capabilities Capabilities) (bool, error) {
+	source, _, err := keySource(db, capabilities)
+	if err != nil || source != KeyNone {
+		return source != KeyNone, err
+	}
+
+	var encrypted bool
+	err = db.QueryRow(queryHasEncryptedFiles).Scan(&encrypted)
+	return encrypted, err
+}
+
+// ContainerInfo describes the encryption of the container: where its key
+// comes from, how many of its files are encrypted, and how many are still
+// locked, without decrypting anything.
+func (reader *Reader) ContainerInfo() (info *ContainerInfo, err error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	info = &ContainerInfo{
+		CipherSuite: reader.suite,
+		Unlocked:    reader.containerKey() != nil,
+	}
+	var params *encdec.Params
+	info.KeySource, params, err = keySource(reader.db, reader.capabilities)
+	if err != nil {
+		return nil, err
+	}
+	if params != nil {
+		kdf := kdfParams(params)
+		info.KDF = &kdf
+	}
+
+	err = reader.db.QueryRow(queryFileCounts).Scan(&info.Files, &info.EncryptedFiles)
+	if err != nil {
+		return nil, err
+	}
+	info.PasswordFiles = len(reader.filePasswordIds)
+
+	rows, err := reader.db.Query(queryEncryptedIds)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		if !reader.canDecrypt(id) {
+			info.LockedFiles++
+		}
+	}
+	return info, rows.Err()
+}
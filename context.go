@@ -0,0 +1,65 @@
+package arc
+
+import (
+	"context"
+	"database/sql"
+	"io"
+)
+
+// contextDB is a database, or a connection to it, running queries with a context.
+type contextDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// contextQuerier runs the queries of an [execQuerier] on db with ctx.
+type contextQuerier struct {
+	ctx context.Context
+	db  contextDB
+}
+
+func (querier contextQuerier) Exec(query string, args ...any) (sql.Result, error) {
+	return querier.db.ExecContext(querier.ctx, query, args...)
+}
+
+func (querier contextQuerier) QueryRow(query string, args ...any) *sql.Row {
+	return querier.db.QueryRowContext(querier.ctx, query, args...)
+}
+
+func (querier contextQuerier) Query(query string, args ...any) (*sql.Rows, error) {
+	return querier.db.QueryContext(querier.ctx, query, args...)
+}
+
+// contextReader fails reading reader with the error of ctx once it's done.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (reader contextReader) Read(p []byte) (int, error) {
+	err := reader.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return reader.reader.Read(p)
+}
+
+// cancel discards the file id, whose insertion was canceled with err,
+// rolling back its transaction and removing its metadata. id is zero if
+// the metadata wasn't inserted. The Writer is left usable unless
+// discarding fails.
+func (writer *Writer) cancel(id int, err error) error {
+	if writer.currDataWriter != nil {
+		writer.err = writer.abort()
+	} else if id != 0 {
+		_, writer.err = writer.fileQuerier(context.Background()).Exec(queryDeleteFileById, id)
+	} else {
+		writer.err = nil
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+
+	return err
+}
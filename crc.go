@@ -0,0 +1,71 @@
+package arc
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	queryInsertDataCRC = `INSERT INTO data(id, block_id, data, crc) VALUES (?, ?, ?, ?)`
+
+	queryDataCRCById = `SELECT data, crc FROM data WHERE id = ? ORDER BY block_id ASC`
+
+	queryDataCRCByIdDedup = `SELECT data, crc FROM file_blocks WHERE id = ? ORDER BY block_id ASC`
+)
+
+// ErrBlockCorrupted is returned, wrapped by a [BlockCorruptedError],
+// when a data block doesn't match its stored CRC-32.
+var ErrBlockCorrupted = errors.New("corrupted data block")
+
+// BlockCorruptedError reports the data block that
+// doesn't match its stored CRC-32.
+type BlockCorruptedError struct {
+	// Id is the id of the file, and Block the index of
+	// the block within the file.
+	Id    int
+	Block int
+}
+
+func (err *BlockCorruptedError) Error() string {
+	return fmt.Sprintf("%v: file %d, block %d", ErrBlockCorrupted, err.Id, err.Block)
+}
+
+func (err *BlockCorruptedError) Unwrap() error {
+	return ErrBlockCorrupted
+}
+
+// blockCRC returns the CRC-32 stored along block.
+func blockCRC(block []byte) int64 {
+	return int64(crc32.ChecksumIEEE(block))
+}
+
+// insertDataQuery returns the query inserting a data block,
+// along with its CRC-32 if the container stores them.
+func insertDataQuery(capabilities Capabilities) string {
+	if capabilities.Has(FeatureBlockChecksums) {
+		return queryInsertDataCRC
+	}
+	return queryInsertData
+}
+
+// insertDataArgs returns the arguments of the query
+// returned by insertDataQuery.
+func insertDataArgs(capabilities Capabilities, id int, blockId int, block []byte) []any {
+	if capabilities.Has(FeatureBlockChecksums) {
+		return []any{id, blockId, block, blockCRC(block)}
+	}
+	return []any{id, blockId, block}
+}
+
+// dataQuery returns the query selecting the data blocks of a file,
+// along with their CRC-32 if the container stores them.
+func (reader *Reader) dataQuery() string {
+	if !reader.capabilities.Has(FeatureBlockChecksums) {
+		return reader.blocksQuery(queryDataById)
+	}
+	if reader.capabilities.Has(FeatureDeduplication) {
+		return queryDataCRCByIdDedup
+	}
+	return queryDataCRCById
+}
@@ -0,0 +1,82 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// readTestFile reads the file name of the container at path.
+func readTestFile(t *testing.T, path string, password []byte, name string) (id int, contents []byte, err error) {
+	t.Helper()
+	reader, err := NewReader(path, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	info, err := reader.StatByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	_, err = reader.ReadTo(info.Id, &buffer)
+	return info.Id, buffer.Bytes(), err
+}
+
+// writeTestBlocks writes a container at path with a file of 3 blocks.
+func writeTestBlocks(t *testing.T, path string, password []byte, header Header) []byte {
+	t.Helper()
+	writer, err := newTestWriter(path, MinBlocksize, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := bytes.Repeat([]byte("block contents "), 3*MinBlocksize/15)
+	header.Name = "file"
+	writeTestFile(t, writer, header, contents)
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestBlockCorrupted(t *testing.T) {
+	for _, encryption := range []bool{false, true} {
+		path := testContainerPath(t)
+		writeTestBlocks(t, path, testPassword, Header{Encryption: encryption})
+		execTestContainer(t, path, `UPDATE data SET data = zeroblob(length(data)) WHERE block_id = 1`)
+
+		id, _, err := readTestFile(t, path, testPassword, "file")
+		var corrupted *BlockCorruptedError
+		if !errors.As(err, &corrupted) || corrupted.Id != id || corrupted.Block != 1 {
+			t.Errorf("encryption %v: got %v, want %v of block 1", encryption, err, ErrBlockCorrupted)
+		}
+	}
+}
+
+func TestBlockWithoutCRC(t *testing.T) {
+	path := testContainerPath(t)
+	contents := writeTestBlocks(t, path, nil, Header{})
+	execTestContainer(t, path, `UPDATE data SET crc = NULL`)
+
+	_, got, err := readTestFile(t, path, nil, "file")
+	if err != nil || !bytes.Equal(got, contents) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestBlockScanFailed(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestBlocks(t, path, nil, Header{})
+	execTestContainer(t, path,
+		`PRAGMA ignore_check_constraints = ON`,
+		`UPDATE data SET crc = 'not a number' WHERE block_id = 1`,
+	)
+
+	// The read fails instead of returning the contents up to the block.
+	id, got, err := readTestFile(t, path, nil, "file")
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) || blockErr.Id != id || blockErr.Block != 1 {
+		t.Fatalf("got %d bytes, %v, want an error reading block 1", len(got), err)
+	}
+}
@@ -2,9 +2,13 @@ package arc
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
+	"strings"
 
 	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/sha3"
@@ -12,6 +16,8 @@ import (
 
 const padBlocksize = 100 // PKCS #7 padding range between [1, 155]
 
+const convergentSecretLabel = "arc convergent secret"
+
 func generateFileMasterKey(masterKey []byte, id int) (encryptedKey []byte, fileMasterKey []byte, err error) {
 	fileMasterKey = make([]byte, encryptionKeysize)
 	_, err = rand.Read(fileMasterKey)
@@ -19,19 +25,66 @@ func generateFileMasterKey(masterKey []byte, id int) (encryptedKey []byte, fileM
 		return nil, nil, err
 	}
 
-	aead, err := chacha20poly1305.New(masterKey)
+	encryptedKey, err = sealFileMasterKey(masterKey, id, fileMasterKey)
+	return encryptedKey, fileMasterKey, err
+}
+
+// convergentFileMasterKey derives the file master key from the hash of the
+// file contents, keyed by a secret derived from the container master key.
+func convergentFileMasterKey(masterKey []byte, contentHash []byte) []byte {
+	secret := make([]byte, encryptionKeysize)
+	input := append([]byte(convergentSecretLabel), masterKey...)
+	sha3.ShakeSum256(secret, input)
+	wipe(input)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(contentHash)
+	fileMasterKey := mac.Sum(nil)
+	wipe(secret)
+	return fileMasterKey
+}
+
+// sealedKeySize is the size of the master keys of files sealed with a
+// random nonce, stored in front of them.
+const sealedKeySize = chacha20poly1305.NonceSizeX + encryptionKeysize + chacha20poly1305.Overhead
+
+// sealFileMasterKey seals the master key of the file id with masterKey. The
+// ids of deleted files are reused, so the key is sealed with
+// XChaCha20-Poly1305 and a random nonce, stored in front of it, and is
+// bound to id as additional data.
+func sealFileMasterKey(masterKey []byte, id int, fileMasterKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(masterKey)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	nonce := make([]byte, chacha20poly1305.NonceSize)
-	binary.BigEndian.PutUint64(nonce, uint64(id))
-	encryptedKey = aead.Seal(nil, nonce, fileMasterKey, nil)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX, sealedKeySize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, fileMasterKey, fileKeyData(id)), nil
+}
 
-	return encryptedKey, fileMasterKey, nil
+// fileKeyData returns the additional data binding
+// the sealed master key of a file to its id.
+func fileKeyData(id int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
 }
 
+// readFileKey unseals the master key of the file id with masterKey. Keys
+// sealed by older versions of the library, with ChaCha20-Poly1305 and the
+// id as nonce, are told apart by their size.
 func readFileKey(encryptedKey []byte, id int, masterKey []byte) ([]byte, error) {
+	if len(encryptedKey) == sealedKeySize {
+		aead, err := chacha20poly1305.NewX(masterKey)
+		if err != nil {
+			return nil, err
+		}
+		nonce, sealed := encryptedKey[:aead.NonceSize()], encryptedKey[aead.NonceSize():]
+		return aead.Open(nil, nonce, sealed, fileKeyData(id))
+	}
+
 	aead, err := chacha20poly1305.New(masterKey)
 	if err != nil {
 		return nil, err
@@ -43,12 +96,31 @@ func readFileKey(encryptedKey []byte, id int, masterKey []byte) ([]byte, error)
 	return fileMasterKey, err
 }
 
+// stretchKey derives the filename and data keys of a file from its master
+// key, zeroing it, as the master key is of no use once stretched.
 func stretchKey(key []byte) (filenameKey []byte, fileDataKey []byte) {
 	keys := make([]byte, 64)
 	sha3.ShakeSum256(keys, key)
+	wipe(key)
 	return keys[:32], keys[32:]
 }
 
+// wipe zeroes keys, once of no use, so they don't linger in memory until
+// garbage collected. It's best effort: Go may have copied them already,
+// when growing slices, converting them to strings, or moving stacks, and
+// the ciphers built from them keep expanded copies of their own. Neither
+// are the passwords given by callers zeroed, as they belong to them, but
+// neither are they retained: they're only read during the calls given
+// them, except for the keys of databases encrypted with
+// [Config.PageEncryption].
+func wipe(keys ...[]byte) {
+	for _, key := range keys {
+		for i := range key {
+			key[i] = 0
+		}
+	}
+}
+
 func padFilename(buffer []byte) []byte {
 	padSize := padBlocksize - (len(buffer) % padBlocksize)
 	pad := bytes.Repeat([]byte{byte(padSize)}, padSize)
@@ -75,30 +147,68 @@ func unpadFilename(buffer []byte) ([]byte, error) {
 	return buffer[:len(buffer)-int(padSize)], nil
 }
 
-func encryptFilename(filename string, filenameKey []byte) (encryptedFilename string, err error) {
-	aead, err := chacha20poly1305.New(filenameKey)
+// randomNoncePrefix prefixes the names encrypted with a random nonce. It
+// isn't in the base64 alphabet, so names encrypted with the zero nonce, by
+// containers without [FeatureNameIndex], never start with it.
+const randomNoncePrefix = "n:"
+
+// encryptFilename encrypts filename with filenameKey. The names of files
+// sharing their key, as convergent files with equal contents, or renamed
+// files, mustn't be encrypted with the same nonce, so they're encrypted with
+// XChaCha20-Poly1305 and a random nonce, stored in front of them, if random.
+// Otherwise they're encrypted with the zero nonce, as read by older readers,
+// which is only safe for the first name encrypted with a random file key:
+// convergent files and renames need random nonces.
+func encryptFilename(filename string, filenameKey []byte, random bool) (encryptedFilename string, err error) {
+	filenamePadded := padFilename([]byte(filename))
+	if !random {
+		aead, err := chacha20poly1305.New(filenameKey)
+		if err != nil {
+			return "", err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		encryptedFilenameBin := aead.Seal(nil, nonce, filenamePadded, nil)
+		return base64.StdEncoding.EncodeToString(encryptedFilenameBin), nil
+	}
+
+	aead, err := chacha20poly1305.NewX(filenameKey)
 	if err != nil {
 		return "", err
 	}
-
-	filenamePadded := padFilename([]byte(filename))
 	nonce := make([]byte, aead.NonceSize())
-	encryptedFilenameBin := aead.Seal(nil, nonce, filenamePadded, nil)
-	return base64.StdEncoding.EncodeToString(encryptedFilenameBin), nil
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	encryptedFilenameBin := aead.Seal(nonce, nonce, filenamePadded, nil)
+	return randomNoncePrefix + base64.StdEncoding.EncodeToString(encryptedFilenameBin), nil
 }
 
 func decryptFilename(filenameEncrypted string, filenameKey []byte) (string, error) {
-	filenameEncryptedBin, err := base64.StdEncoding.DecodeString(filenameEncrypted)
+	encoded, random := strings.CutPrefix(filenameEncrypted, randomNoncePrefix)
+	filenameEncryptedBin, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", err
 	}
 
-	aead, err := chacha20poly1305.New(filenameKey)
+	var aead cipher.AEAD
+	if random {
+		aead, err = chacha20poly1305.NewX(filenameKey)
+	} else {
+		aead, err = chacha20poly1305.New(filenameKey)
+	}
 	if err != nil {
 		return "", err
 	}
 
 	nonce := make([]byte, aead.NonceSize())
+	if random {
+		if len(filenameEncryptedBin) < len(nonce) {
+			return "", ErrPadding
+		}
+		nonce, filenameEncryptedBin = filenameEncryptedBin[:len(nonce)], filenameEncryptedBin[len(nonce):]
+	}
 	filename, err := aead.Open(nil, nonce, filenameEncryptedBin, nil)
 	if err != nil {
 		return "", err
@@ -0,0 +1,364 @@
+package arc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestConvergentRoundTrip(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, MinBlocksize, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.SetDeduplication(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := strings.Repeat("same contents, ", MinBlocksize/4)
+	source := testSourceFile(t, []byte(contents))
+	for _, name := range []string{"a", "b"} {
+		header := &Header{Name: name, Encryption: true, Convergent: true}
+		err = writer.WriteFile(header, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{
+		"a": contents,
+		"b": contents,
+	})
+
+	// The identical plaintexts are encrypted to identical blocks,
+	// stored once.
+	reader, err := NewReader(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	files, err := reader.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored [][][]byte
+	for _, name := range []string{"a", "b"} {
+		var blocks [][]byte
+		rows, err := reader.db.Query(queryDataByIdDedup, files[name].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var block []byte
+			err = rows.Scan(&block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks = append(blocks, block)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored = append(stored, blocks)
+	}
+	if len(stored[0]) < 2 {
+		t.Fatalf("got %d blocks, want several", len(stored[0]))
+	}
+	if len(stored[0]) != len(stored[1]) {
+		t.Fatalf("got %d and %d blocks", len(stored[0]), len(stored[1]))
+	}
+	for i := range stored[0] {
+		if !bytes.Equal(stored[0][i], stored[1][i]) {
+			t.Errorf("block %d differs", i)
+		}
+	}
+
+	var blocks, data int
+	err = reader.db.QueryRow(`SELECT (SELECT count(*) FROM blocks), (SELECT count(*) FROM data)`).Scan(&blocks, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks != len(stored[0]) || data != 0 {
+		t.Errorf("got %d deduplicated blocks and %d others, want %d and 0", blocks, data, len(stored[0]))
+	}
+}
+
+func TestConvergentNamesRandomNonce(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := testSourceFile(t, []byte("same contents"))
+	for _, name := range []string{"first", "second"} {
+		err = writer.WriteFile(&Header{Name: name, Encryption: true, Convergent: true}, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	rows, err := reader.db.Query(`SELECT name FROM metadata`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(name, randomNoncePrefix) {
+			t.Errorf("name %q of a convergent file not encrypted with a random nonce", name)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvergentRequiresNameIndex(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{"a": "contents"})
+	execTestContainer(t, path, `DROP TABLE name_index`)
+
+	writer, err := openTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	header := &Header{Name: "b", Encryption: true, Convergent: true}
+	err = writer.WriteFile(header, testSourceFile(t, []byte("contents")))
+	if !errors.Is(err, ErrMissingFeature) {
+		t.Fatalf("got %v, want %v", err, ErrMissingFeature)
+	}
+}
+
+func TestRenameEncryptedRequiresNameIndex(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{"a": "contents"})
+	execTestContainer(t, path, `DROP TABLE name_index`)
+
+	editor, err := OpenEditor(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer editor.Close()
+	err = editor.Rename("a", "b")
+	if !errors.Is(err, ErrMissingFeature) {
+		t.Fatalf("got %v, want %v", err, ErrMissingFeature)
+	}
+}
+
+func TestFilenameRoundTrip(t *testing.T) {
+	key := make([]byte, encryptionKeysize)
+	for _, random := range []bool{false, true} {
+		for _, name := range []string{"a", strings.Repeat("x", padBlocksize), "dir/file.txt"} {
+			encrypted, err := encryptFilename(name, key, random)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(encrypted, randomNoncePrefix) != random {
+				t.Errorf("%q: random nonce prefix of %q, want %v", name, encrypted, random)
+			}
+			decrypted, err := decryptFilename(encrypted, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decrypted != name {
+				t.Errorf("got %q, want %q", decrypted, name)
+			}
+		}
+	}
+}
+
+func TestSealFileMasterKey(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{1}, encryptionKeysize)
+	fileMasterKey := bytes.Repeat([]byte{2}, encryptionKeysize)
+
+	first, err := sealFileMasterKey(masterKey, 1, fileMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := sealFileMasterKey(masterKey, 1, fileMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first[:chacha20poly1305.NonceSizeX], second[:chacha20poly1305.NonceSizeX]) {
+		t.Fatal("keys of files with the same id sealed with the same nonce")
+	}
+
+	got, err := readFileKey(first, 1, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fileMasterKey) {
+		t.Errorf("got %x, want %x", got, fileMasterKey)
+	}
+	_, err = readFileKey(first, 2, masterKey)
+	if err == nil {
+		t.Error("key sealed for file 1 unsealed as the key of file 2")
+	}
+
+	// Keys sealed by older versions, with the id as nonce.
+	aead, err := chacha20poly1305.New(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce, 1)
+	got, err = readFileKey(aead.Seal(nil, nonce, fileMasterKey, nil), 1, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fileMasterKey) {
+		t.Errorf("legacy key: got %x, want %x", got, fileMasterKey)
+	}
+}
+
+func TestReusedIdNewNonce(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{"a": "first"})
+	sealedKey := func() []byte {
+		reader, err := NewReader(path, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		var key []byte
+		err = reader.db.QueryRow(`SELECT key FROM encryption_metadata WHERE id = 1`).Scan(&key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	first := sealedKey()
+
+	editor, err := OpenEditor(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.DeleteByName("a")
+	if err == nil {
+		err = editor.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := openTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "b", Encryption: true}, []byte("second"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := sealedKey()
+	if bytes.Equal(first[:chacha20poly1305.NonceSizeX], second[:chacha20poly1305.NonceSizeX]) {
+		t.Error("key of a file reusing the id of a deleted one sealed with the same nonce")
+	}
+	checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{"b": "second"})
+}
+
+func TestSealedMetadataRandomNonce(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.SetMetadataEncryption(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files with the same contents share the filename key.
+	source := testSourceFile(t, []byte("same contents"))
+	for _, name := range []string{"first", "second"} {
+		err = writer.WriteFile(&Header{Name: name, Encryption: true, Convergent: true}, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := reader.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, header := range files {
+		if header.Size != int64(len("same contents")) {
+			t.Errorf("%s: got size %d", name, header.Size)
+		}
+	}
+	var first, second []byte
+	err = reader.db.QueryRow(`SELECT data FROM sealed_metadata WHERE id = 1`).Scan(&first)
+	if err == nil {
+		err = reader.db.QueryRow(`SELECT data FROM sealed_metadata WHERE id = 2`).Scan(&second)
+	}
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first[:chacha20poly1305.NonceSizeX], second[:chacha20poly1305.NonceSizeX]) {
+		t.Fatal("metadata of files with the same key sealed with the same nonce")
+	}
+
+	// The metadata of a file isn't accepted as the metadata of another.
+	execTestContainer(t, path, `UPDATE sealed_metadata SET data = (SELECT data FROM sealed_metadata WHERE id = 2) WHERE id = 1`)
+	reader, err = NewReader(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	_, err = reader.Files()
+	if err == nil {
+		t.Error("metadata sealed for file 2 opened as the metadata of file 1")
+	}
+}
+
+func TestOpenLegacySealedMetadata(t *testing.T) {
+	filenameKey := bytes.Repeat([]byte{1}, encryptionKeysize)
+	uid := 1000
+	metadata := sealedMetadata{size: 42, modTime: 1700000000, uid: &uid}
+
+	// Metadata sealed by older versions, with a fixed nonce.
+	aead, err := chacha20poly1305.New(filenameKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := openSealedMetadata(aead.Seal(nil, metadataNonce(), metadata.marshal(), nil), 1, filenameKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.size != 42 || got.modTime != metadata.modTime || got.uid == nil || *got.uid != uid {
+		t.Errorf("got %+v", got)
+	}
+}
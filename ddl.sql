@@ -5,23 +5,159 @@ CREATE TABLE metadata(
 	blocks INTEGER NOT NULL CHECK(typeof(blocks) = "integer"),
 	mod_time INTEGER NOT NULL CHECK(typeof(mod_time) = "integer"),
 	compressed INTEGER NOT NULL CHECK(compressed IN (0, 1)),
-	encrypted INTEGER NOT NULL CHECK(encrypted IN (0, 1))
+	encrypted INTEGER NOT NULL CHECK(encrypted IN (0, 1)),
+	dictionary_id INTEGER CHECK(dictionary_id IS NULL OR typeof(dictionary_id) = "integer"),
+	type INTEGER NOT NULL DEFAULT 0 CHECK(type IN (0, 1, 2)),
+	checksum BLOB CHECK(checksum IS NULL OR typeof(checksum) = "blob"),
+	mode INTEGER CHECK(mode IS NULL OR typeof(mode) = "integer"),
+	uid INTEGER CHECK(uid IS NULL OR typeof(uid) = "integer"),
+	gid INTEGER CHECK(gid IS NULL OR typeof(gid) = "integer"),
+	blocksize INTEGER CHECK(blocksize IS NULL OR (typeof(blocksize) = "integer" AND blocksize > 0)),
+	codec TEXT CHECK(codec IS NULL OR typeof(codec) = "text"),
+	stored_size INTEGER CHECK(stored_size IS NULL OR typeof(stored_size) = "integer"),
+	compression_level INTEGER CHECK(compression_level IS NULL OR typeof(compression_level) = "integer"),
+	mod_time_ns INTEGER CHECK(mod_time_ns IS NULL OR typeof(mod_time_ns) = "integer"),
+	access_time INTEGER CHECK(access_time IS NULL OR typeof(access_time) = "integer"),
+	change_time INTEGER CHECK(change_time IS NULL OR typeof(change_time) = "integer"),
+	birth_time INTEGER CHECK(birth_time IS NULL OR typeof(birth_time) = "integer"),
+	FOREIGN KEY (dictionary_id) REFERENCES dictionaries(id)
 );
 
 CREATE TABLE data(
 	id INTEGER CHECK(typeof(id) = "integer"),
 	block_id INTEGER CHECK(typeof(block_id) = "integer"),
 	data BLOB NOT NULL CHECK(typeof(data) = "blob"),
+	crc INTEGER CHECK(crc IS NULL OR typeof(crc) = "integer"),
 	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE,
 	PRIMARY KEY (id, block_id)
 );
 
+CREATE TABLE blocks(
+	hash BLOB PRIMARY KEY CHECK(typeof(hash) = "blob" AND length(hash) = 32),
+	data BLOB NOT NULL CHECK(typeof(data) = "blob")
+);
+
+CREATE TABLE block_refs(
+	id INTEGER CHECK(typeof(id) = "integer"),
+	block_id INTEGER CHECK(typeof(block_id) = "integer"),
+	hash BLOB NOT NULL,
+	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE,
+	FOREIGN KEY (hash) REFERENCES blocks(hash),
+	PRIMARY KEY (id, block_id)
+);
+
+CREATE TABLE attrs(
+	id INTEGER CHECK(typeof(id) = "integer"),
+	key TEXT CHECK(typeof(key) = "text" AND length(key) > 0),
+	value TEXT NOT NULL CHECK(typeof(value) = "text"),
+	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE,
+	PRIMARY KEY (id, key)
+);
+
+CREATE TABLE holes(
+	id INTEGER CHECK(typeof(id) = "integer"),
+	start INTEGER CHECK(typeof(start) = "integer" AND start >= 0),
+	size INTEGER NOT NULL CHECK(typeof(size) = "integer" AND size > 0),
+	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE,
+	PRIMARY KEY (id, start)
+);
+
+CREATE TABLE segments(
+	id INTEGER CHECK(typeof(id) = "integer"),
+	start INTEGER CHECK(typeof(start) = "integer" AND start >= 0),
+	frame_offset INTEGER NOT NULL CHECK(typeof(frame_offset) = "integer" AND frame_offset >= 0),
+	frame_size INTEGER NOT NULL CHECK(typeof(frame_size) = "integer" AND frame_size > 0),
+	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE,
+	PRIMARY KEY (id, start)
+);
+
+CREATE VIEW file_blocks AS
+	SELECT id, block_id, data, crc FROM data
+	UNION ALL
+	SELECT block_refs.id, block_refs.block_id, blocks.data, NULL
+	FROM block_refs JOIN blocks ON blocks.hash = block_refs.hash;
+
 CREATE TABLE encryption_metadata(
 	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
 	key BLOB UNIQUE NOT NULL CHECK(typeof(key) = "blob"),
 	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE
 );
 
+CREATE TABLE sealed_metadata(
+	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
+	data BLOB NOT NULL CHECK(typeof(data) = "blob"),
+	FOREIGN KEY (id) REFERENCES encryption_metadata(id) ON DELETE CASCADE
+);
+
+CREATE TABLE file_key_params(
+	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
+	params BLOB NOT NULL CHECK(typeof(params) = "blob"),
+	FOREIGN KEY (id) REFERENCES encryption_metadata(id) ON DELETE CASCADE
+);
+
+CREATE TABLE name_index(
+	mac BLOB PRIMARY KEY CHECK(typeof(mac) = "blob" AND length(mac) = 32),
+	id INTEGER NOT NULL UNIQUE CHECK(typeof(id) = "integer"),
+	FOREIGN KEY (id) REFERENCES encryption_metadata(id) ON DELETE CASCADE
+);
+
+CREATE TABLE links(
+	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
+	target INTEGER NOT NULL CHECK(typeof(target) = "integer"),
+	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE,
+	FOREIGN KEY (target) REFERENCES metadata(id)
+);
+
 CREATE TABLE encryption_key_params(
-	params BLOB PRIMARY KEY CHECK(typeof(params) = "blob")
+	params BLOB PRIMARY KEY CHECK(typeof(params) = "blob"),
+	suite TEXT CHECK(suite IS NULL OR typeof(suite) = "text")
+);
+
+CREATE TABLE pending_files(
+	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
+	replaced_id INTEGER CHECK(replaced_id IS NULL OR typeof(replaced_id) = "integer"),
+	replaced_name TEXT CHECK(replaced_name IS NULL OR typeof(replaced_name) = "text"),
+	FOREIGN KEY (id) REFERENCES metadata(id) ON DELETE CASCADE
+);
+
+CREATE TABLE recipients(
+	ephemeral BLOB NOT NULL CHECK(typeof(ephemeral) = "blob" AND length(ephemeral) = 32),
+	wrapped BLOB NOT NULL CHECK(typeof(wrapped) = "blob")
+);
+
+CREATE TABLE manifest(
+	mac BLOB NOT NULL CHECK(typeof(mac) = "blob" AND length(mac) = 32)
+);
+
+CREATE TABLE summary(
+	files INTEGER NOT NULL CHECK(typeof(files) = "integer"),
+	size INTEGER NOT NULL CHECK(typeof(size) = "integer"),
+	created INTEGER NOT NULL CHECK(typeof(created) = "integer"),
+	root BLOB CHECK(root IS NULL OR (typeof(root) = "blob" AND length(root) = 32))
+);
+
+CREATE TABLE base(
+	uuid TEXT PRIMARY KEY CHECK(typeof(uuid) = "text" AND length(uuid) = 36)
+);
+
+CREATE TABLE deleted(
+	name TEXT PRIMARY KEY CHECK(typeof(name) = "text")
+);
+
+CREATE TABLE format(
+	version INTEGER NOT NULL CHECK(typeof(version) = "integer")
+);
+
+CREATE TABLE container(
+	uuid TEXT PRIMARY KEY CHECK(typeof(uuid) = "text" AND length(uuid) = 36)
+);
+
+CREATE TABLE dictionaries(
+	id INTEGER PRIMARY KEY CHECK(typeof(id) = "integer"),
+	class TEXT NOT NULL UNIQUE CHECK(typeof(class) = "text"),
+	dict BLOB NOT NULL CHECK(typeof(dict) = "blob")
+);
+
+CREATE TABLE key_check(
+	mac BLOB NOT NULL CHECK(typeof(mac) = "blob" AND length(mac) = 32)
 );
\ No newline at end of file
@@ -0,0 +1,98 @@
+package arc
+
+import (
+	"crypto/sha256"
+	"database/sql"
+)
+
+const (
+	queryInsertBlock = `INSERT OR IGNORE INTO blocks VALUES (?, ?)`
+
+	queryInsertBlockRef = `INSERT INTO block_refs VALUES (?, ?, ?)`
+
+	queryDeleteUnreferencedBlocks = `DELETE FROM blocks
+		WHERE hash NOT IN (SELECT hash FROM block_refs)`
+
+	queryDataByIdDedup = `SELECT data FROM file_blocks WHERE id = ? ORDER BY block_id ASC`
+
+	queryBlocksizeByIdDedup = `SELECT length(data) FROM file_blocks WHERE id = ? AND block_id = 0`
+
+	queryDataRangeByIdDedup = `SELECT data FROM file_blocks
+		WHERE id = ? AND block_id BETWEEN ? AND ?
+		ORDER BY block_id ASC`
+
+	queryStoredSizeByIdDedup = `SELECT count(*), coalesce(sum(length(data)), 0) FROM file_blocks WHERE id = ?`
+
+	queryStoredSizeByCompressionDedup = `SELECT metadata.compressed, coalesce(sum(length(file_blocks.data)), 0)
+		FROM file_blocks JOIN metadata ON metadata.id = file_blocks.id GROUP BY metadata.compressed`
+)
+
+// dedupQueries maps the queries reading the data table to their
+// equivalents reading the file_blocks view, which also holds the blocks
+// of deduplicated files.
+var dedupQueries = map[string]string{
+	queryDataById:                queryDataByIdDedup,
+	queryBlocksizeById:           queryBlocksizeByIdDedup,
+	queryDataRangeById:           queryDataRangeByIdDedup,
+	queryStoredSizeById:          queryStoredSizeByIdDedup,
+	queryStoredSizeByCompression: queryStoredSizeByCompressionDedup,
+}
+
+// blocksQuery returns query, reading the data table, or its equivalent
+// reading the deduplicated blocks too, if the container supports them.
+func (reader *Reader) blocksQuery(query string) string {
+	if reader.capabilities.Has(FeatureDeduplication) {
+		return dedupQueries[query]
+	}
+	return query
+}
+
+// insertDedupBlock inserts block as the block blockId of the file id,
+// storing its data keyed by its hash, only if not stored yet.
+func insertDedupBlock(db execQuerier, id int, blockId int, block []byte) error {
+	hash := sha256.Sum256(block)
+	_, err := db.Exec(queryInsertBlock, hash[:], block)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(queryInsertBlockRef, id, blockId, hash[:])
+	return err
+}
+
+// SetDeduplication enables, or disables, the deduplication of the data
+// blocks of the files written afterwards. Deduplicated blocks are stored
+// once per distinct contents, which shrinks containers whose files share
+// large identical regions, at the cost of hashing each block.
+//
+// Blocks are compared after compression and encryption, so only files with
+// identical leading contents and compression, or encrypted with
+// [Header.Convergent], share blocks. The container must support
+// [FeatureDeduplication].
+func (writer *Writer) SetDeduplication(enabled bool) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if enabled && !writer.capabilities.Has(FeatureDeduplication) {
+		return FeatureDeduplication.missingError()
+	}
+
+	writer.dedup = enabled
+	return nil
+}
+
+// deleteUnreferencedBlocks deletes the deduplicated blocks
+// no longer referenced by any file.
+func deleteUnreferencedBlocks(db *sql.DB, capabilities Capabilities) error {
+	if !capabilities.Has(FeatureDeduplication) {
+		return nil
+	}
+
+	_, err := db.Exec(queryDeleteUnreferencedBlocks)
+	return err
+}
@@ -0,0 +1,133 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// countTestBlocks returns the number of deduplicated blocks stored,
+// and of their references, in the container at path.
+func countTestBlocks(t *testing.T, path string) (blocks int, refs int) {
+	t.Helper()
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	err = reader.db.QueryRow(`SELECT (SELECT count(*) FROM blocks), (SELECT count(*) FROM block_refs)`).Scan(&blocks, &refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks, refs
+}
+
+func TestDeduplication(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, MinBlocksize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.SetDeduplication(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files of 3 blocks, of which the last ends in a block of its own.
+	contents := make([]byte, 3*MinBlocksize)
+	rand.New(rand.NewSource(1)).Read(contents)
+	changed := bytes.Clone(contents)
+	changed[len(changed)-1] ^= 1
+	files := map[string]string{
+		"first":   string(contents),
+		"copy":    string(contents),
+		"changed": string(changed),
+	}
+	for _, name := range []string{"first", "copy", "changed"} {
+		writeTestFile(t, writer, Header{Name: name}, []byte(files[name]))
+	}
+	err = writer.SetDeduplication(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "not deduplicated"}, contents)
+	files["not deduplicated"] = string(contents)
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFiles(t, readTestContainer(t, path, nil), files)
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := reader.StatByName("copy")
+	if err == nil {
+		var got []byte
+		got, err = reader.ReadRange(header.Id, MinBlocksize-1, 2)
+		if err == nil && !bytes.Equal(got, contents[MinBlocksize-1:MinBlocksize+1]) {
+			t.Errorf("range: got %x, want %x", got, contents[MinBlocksize-1:MinBlocksize+1])
+		}
+	}
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, refs := countTestBlocks(t, path)
+	if blocks != 4 || refs != 9 {
+		t.Fatalf("got %d blocks, %d references, want 4, 9", blocks, refs)
+	}
+
+	// Blocks are kept while referenced by any file.
+	editor, err := OpenEditor(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.DeleteByName("first")
+	if err == nil {
+		err = editor.Vacuum()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, refs = countTestBlocks(t, path)
+	if blocks != 4 || refs != 6 {
+		t.Fatalf("first deleted: got %d blocks, %d references, want 4, 6", blocks, refs)
+	}
+	for _, name := range []string{"copy", "changed"} {
+		err = editor.DeleteByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = editor.Vacuum()
+	if err == nil {
+		err = editor.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, refs = countTestBlocks(t, path)
+	if blocks != 0 || refs != 0 {
+		t.Fatalf("all deleted: got %d blocks, %d references, want none", blocks, refs)
+	}
+	checkFiles(t, readTestContainer(t, path, nil), map[string]string{"not deduplicated": string(contents)})
+}
+
+func TestDeduplicationUnsupported(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, nil)
+	execTestContainer(t, path, `DROP VIEW file_blocks`, `DROP TABLE block_refs`, `DROP TABLE blocks`)
+
+	writer, err := openTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	err = writer.SetDeduplication(true)
+	if !errors.Is(err, ErrMissingFeature) {
+		t.Fatalf("got %v, want %v", err, ErrMissingFeature)
+	}
+}
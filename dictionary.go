@@ -0,0 +1,213 @@
+package arc
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	queryInsertDictionary = `INSERT INTO dictionaries(class, dict) VALUES (?, ?)`
+
+	queryUpdateDictionaryId = `UPDATE metadata SET dictionary_id = ? WHERE id = ?`
+
+	queryDictionaryById = `SELECT dictionaries.id, dictionaries.dict FROM metadata
+		JOIN dictionaries ON metadata.dictionary_id = dictionaries.id
+		WHERE metadata.id = ?`
+)
+
+// contentSniffSize is the number of bytes inspected to detect the content class.
+const contentSniffSize = 512
+
+// DefaultDictionarySize is the size of the dictionaries trained by
+// [TrainDictionary] when no size is given, as zstd's own default.
+const DefaultDictionarySize = 110 << 10
+
+var (
+	// ErrNoContentClass is returned when adding a dictionary with no content class.
+	ErrNoContentClass = errors.New("dictionary with no content class")
+
+	// ErrNoSamples is returned when training a dictionary with no samples.
+	ErrNoSamples = errors.New("no samples to train the dictionary")
+
+	// ErrDictionaryExists is returned when adding a dictionary for a content
+	// class the container already has another dictionary for.
+	ErrDictionaryExists = errors.New("container has another dictionary for the content class")
+)
+
+// ContentClass is a class of file contents sharing a compression dictionary.
+type ContentClass string
+
+const (
+	ContentJSON ContentClass = "json"
+	ContentHTML ContentClass = "html"
+	ContentXML  ContentClass = "xml"
+	ContentLog  ContentClass = "log"
+
+	// ContentAny is the class whose dictionary is shared by the compressed
+	// files of any class with no dictionary of their own, including
+	// those of no class.
+	ContentAny ContentClass = "*"
+)
+
+// DetectContentClass detects the class of the contents starting with
+// sample, returning the empty class when none applies. Plain text
+// not looking like JSON is taken as logs.
+func DetectContentClass(sample []byte) ContentClass {
+	contentType, _, _ := strings.Cut(http.DetectContentType(sample), ";")
+	switch contentType {
+	case "text/html":
+		return ContentHTML
+	case "text/xml":
+		return ContentXML
+	case "text/plain":
+	default:
+		return ""
+	}
+
+	trimmed := bytes.TrimSpace(sample)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return ContentJSON
+	}
+	return ContentLog
+}
+
+// detectFileClass detects the content class of file, rewinding it afterwards.
+func detectFileClass(file *os.File) (ContentClass, error) {
+	sample := make([]byte, contentSniffSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	return DetectContentClass(sample[:n]), err
+}
+
+// dictionary is a compression dictionary stored in the container.
+type dictionary struct {
+	id   int
+	dict []byte
+}
+
+// isZstdDictionary reports whether dict is in the zstd dictionary format, as
+// produced by "zstd --train", instead of raw content.
+func isZstdDictionary(dict []byte) bool {
+	_, err := zstd.InspectDictionary(dict)
+	return err == nil
+}
+
+func (dict dictionary) encoderOption() zstd.EOption {
+	if isZstdDictionary(dict.dict) {
+		return zstd.WithEncoderDict(dict.dict)
+	}
+	return zstd.WithEncoderDictRaw(uint32(dict.id), dict.dict)
+}
+
+func (dict dictionary) decoderOption() zstd.DOption {
+	if isZstdDictionary(dict.dict) {
+		return zstd.WithDecoderDicts(dict.dict)
+	}
+	return zstd.WithDecoderDictRaw(uint32(dict.id), dict.dict)
+}
+
+// TrainDictionary trains a zstd dictionary of up to size bytes, or
+// [DefaultDictionarySize] if 0, over samples, typically the contents, or
+// their start, of some of the files to be compressed with it. Dictionaries
+// mostly help compressing many small files of similar contents, such as JSON
+// documents or logs, which compress poorly on their own.
+func TrainDictionary(samples [][]byte, size int) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, ErrNoSamples
+	}
+	if size == 0 {
+		size = DefaultDictionarySize
+	}
+
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: size,
+		HashBytes:   6,
+	})
+}
+
+// AddDictionary stores dict in the container as the compression dictionary
+// of class. Compressed files whose contents are detected as class, or whose
+// [Header.ContentClass] is class, are then compressed with dict. The
+// dictionary of [ContentAny] is shared by the rest of the compressed files.
+//
+// dict may be a dictionary trained by zstd, as by [TrainDictionary],
+// or raw content typical of class.
+//
+// A container has one dictionary per class, kept once stored, as its files
+// were compressed with it: adding the dictionary of a class again, as when
+// appending with [OpenWriter], does nothing if dict is the same, and fails
+// with [ErrDictionaryExists] otherwise.
+func (writer *Writer) AddDictionary(class ContentClass, dict []byte) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if class == "" {
+		return ErrNoContentClass
+	}
+	if stored, ok := writer.dictionaries[class]; ok {
+		if !bytes.Equal(stored.dict, dict) {
+			return fmt.Errorf("%w: %s", ErrDictionaryExists, class)
+		}
+		return nil
+	}
+	if writer.flush() != nil {
+		return writer.err
+	}
+	writer.err = writer.commitBatch()
+	if writer.err != nil {
+		return writer.err
+	}
+
+	var result sql.Result
+	result, writer.err = writer.db.Exec(queryInsertDictionary, string(class), dict)
+	if writer.err != nil {
+		return writer.err
+	}
+	var id int64
+	id, writer.err = result.LastInsertId()
+	if writer.err != nil {
+		return writer.err
+	}
+
+	if writer.dictionaries == nil {
+		writer.dictionaries = make(map[ContentClass]dictionary)
+	}
+	writer.dictionaries[class] = dictionary{id: int(id), dict: dict}
+	return nil
+}
+
+// fileDictionary returns the dictionary the file id was compressed with,
+// or nil if none.
+func (reader *Reader) fileDictionary(id int) (*dictionary, error) {
+	if !reader.capabilities.Has(FeatureDictionaries) {
+		return nil, nil
+	}
+
+	dict := new(dictionary)
+	err := reader.db.QueryRow(queryDictionaryById, id).Scan(&dict.id, &dict.dict)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dict, nil
+}
@@ -0,0 +1,65 @@
+package arc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDetectedContentClassNotKept(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := NewWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.AddDictionary(ContentJSON, []byte(`{"level": "info", "message": ""}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := Header{Compression: zstd.SpeedDefault}
+	files := map[string]string{
+		"a.json": `{"level": "info", "message": "started"}`,
+		"b.txt":  "plain text",
+	}
+	for _, name := range []string{"a.json", "b.txt"} {
+		header.Name = name
+		err = writer.WriteFile(&header, testSourceFile(t, []byte(files[name])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.ContentClass != "" {
+			t.Errorf("WriteFile: content class of %s kept as %q", name, header.ContentClass)
+		}
+		header.Name = "from/" + name
+		err = writer.WriteFrom(&header, bytes.NewReader([]byte(files[name])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.ContentClass != "" {
+			t.Errorf("WriteFrom: content class of %s kept as %q", name, header.ContentClass)
+		}
+		_, err = writer.WriteStream(&header, strings.NewReader(files[name]), StreamNamespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.ContentClass != "" {
+			t.Errorf("WriteStream: content class of %s kept as %q", name, header.ContentClass)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := readTestContainer(t, path, nil)
+	for name, want := range files {
+		for _, name := range []string{name, "from/" + name} {
+			if contents[name] != want {
+				t.Errorf("%s: got %q, want %q", name, contents[name], want)
+			}
+		}
+	}
+}
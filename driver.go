@@ -0,0 +1,55 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// DefaultDriver is the name of the database/sql driver opening the
+// containers by default, registered by github.com/mattn/go-sqlite3.
+const DefaultDriver = "sqlite3"
+
+// ModerncDriver is the name of the database/sql driver registered by
+// modernc.org/sqlite, a pure Go translation of sqlite, needing no cgo.
+const ModerncDriver = "sqlite"
+
+// ErrUnknownDriver is returned by [SetDriver] for a driver
+// not registered with database/sql.
+var ErrUnknownDriver = errors.New("unknown sqlite driver")
+
+// queryForeignKeys enables the foreign keys on each connection of the
+// drivers not enabling them by the data source name, as DefaultDriver.
+const queryForeignKeys = `PRAGMA foreign_keys = ON`
+
+var (
+	driverMu   sync.Mutex
+	driverName = DefaultDriver
+)
+
+// SetDriver selects the database/sql driver, registered as name, opening
+// the containers afterwards, such as [ModerncDriver] for programs built
+// without cgo. The program imports the driver, registering it, and the
+// driver must be a build of sqlite, any of them reading the containers
+// written by the others. Containers in memory (see [NewMemoryWriter]) are
+// only serialized by drivers able to, as [DefaultDriver], and
+// [Config.PageEncryption] requires a driver built against SQLCipher.
+func SetDriver(name string) error {
+	if !slices.Contains(sql.Drivers(), name) {
+		return fmt.Errorf("%w: %s", ErrUnknownDriver, name)
+	}
+
+	driverMu.Lock()
+	driverName = name
+	driverMu.Unlock()
+	return nil
+}
+
+// currentDriver returns the name of the driver selected by [SetDriver].
+func currentDriver() string {
+	driverMu.Lock()
+	defer driverMu.Unlock()
+	return driverName
+}
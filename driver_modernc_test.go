@@ -0,0 +1,112 @@
+//go:build modernc
+
+package arc
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// dependentTables are the tables whose rows of a file are removed
+// along with it, some by the foreign keys cascading.
+var dependentTables = []string{
+	"data", "block_refs", "attrs", "holes", "segments", "links",
+	"encryption_metadata", "sealed_metadata", "file_key_params", "name_index",
+}
+
+// countTestRows returns the rows of each of dependentTables
+// for the file id, in the container at path.
+func countTestRows(t *testing.T, path string, id int) map[string]int {
+	t.Helper()
+	db, err := sql.Open(ModerncDriver, "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	counts := make(map[string]int)
+	for _, table := range dependentTables {
+		var count int
+		err = db.QueryRow(`SELECT count(*) FROM `+table+` WHERE id = ?`, id).Scan(&count)
+		if err != nil {
+			t.Fatalf("%s: %v", table, err)
+		}
+		counts[table] = count
+	}
+	return counts
+}
+
+func TestModerncDriver(t *testing.T) {
+	err := SetDriver(ModerncDriver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetDriver(DefaultDriver) })
+
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := map[string]string{"key": "value"}
+	writeTestFile(t, writer, Header{Name: "plain", Attrs: attrs}, []byte("plain contents"))
+	writeTestFile(t, writer, Header{Name: "secret", Attrs: attrs, Encryption: true}, []byte("secret contents"))
+	writeTestFile(t, writer, Header{Name: "kept"}, []byte("kept contents"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{
+		"plain":  "plain contents",
+		"secret": "secret contents",
+		"kept":   "kept contents",
+	})
+
+	reader, err := NewReader(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := reader.Files()
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainId, secretId := files["plain"].Id, files["secret"].Id
+
+	// Rows only removed by cascading, for the test to check something.
+	for id, tables := range map[int][]string{plainId: {"attrs"}, secretId: {"attrs", "name_index"}} {
+		counts := countTestRows(t, path, id)
+		for _, table := range tables {
+			if counts[table] == 0 {
+				t.Fatalf("file %d: no rows in %s", id, table)
+			}
+		}
+	}
+
+	editor, err := OpenEditor(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.DeleteByName("plain")
+	if err == nil {
+		err = editor.DeleteByName("secret")
+	}
+	err2 := editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+
+	for _, id := range []int{plainId, secretId} {
+		for table, count := range countTestRows(t, path, id) {
+			if count != 0 {
+				t.Errorf("file %d: %d rows left in %s", id, count, table)
+			}
+		}
+	}
+	checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{"kept": "kept contents"})
+}
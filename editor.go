@@ -0,0 +1,286 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+)
+
+const (
+	queryEncryptedNames = `SELECT metadata.id, metadata.name, encryption_metadata.key
+		FROM metadata JOIN encryption_metadata ON metadata.id = encryption_metadata.id
+		WHERE metadata.encrypted = 1`
+
+	queryDeleteDataById = `DELETE FROM data WHERE id = ?`
+
+	queryDeleteEncryptedMetadataById = `DELETE FROM encryption_metadata WHERE id = ?`
+
+	queryVacuum = `VACUUM`
+)
+
+var (
+	// ErrFileNotFound is returned when a file isn't in the container.
+	ErrFileNotFound = errors.New("file not found in container")
+
+	// ErrEditorClosed is returned when Editor is used after closed.
+	ErrEditorClosed = errors.New("editor closed")
+)
+
+// findFileId returns the id of the file name. The names of encrypted files
+// are compared when masterKey, returning the key sealing the master key of
+// a file, or nil if unknown, isn't nil. The lookup of unencrypted names
+// uses the index of the unique name column, and the lookup of encrypted
+// names the name index, if indexKey, the key of its MACs, isn't nil, while
+// the encrypted names not indexed, encrypted with a key per file, are
+// decrypted one by one.
+func findFileId(db execQuerier, masterKey func(id int) []byte, indexKey []byte, name string) (id int, err error) {
+	err = db.QueryRow(queryIdByName, name).Scan(&id)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+	if masterKey == nil {
+		return 0, ErrFileNotFound
+	}
+	if indexKey != nil {
+		id, complete, err := findIndexedId(db, indexKey, name)
+		if err != nil {
+			return 0, err
+		}
+		if id != 0 {
+			return id, nil
+		}
+		if complete {
+			return 0, ErrFileNotFound
+		}
+	}
+
+	id = 0
+	err = decryptNames(db, masterKey, func(fileId int, filename string) bool {
+		if filename == name {
+			id = fileId
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, ErrFileNotFound
+	}
+	return id, nil
+}
+
+// decryptNames decrypts the names of the encrypted files whose key is
+// returned by masterKey, calling visit with each of them until it
+// returns false.
+func decryptNames(db execQuerier, masterKey func(id int) []byte, visit func(id int, name string) bool) (err error) {
+	rows, err := db.Query(queryEncryptedNames)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var id int
+		var encryptedName string
+		var keyEncrypted []byte
+		err = rows.Scan(&id, &encryptedName, &keyEncrypted)
+		if err != nil {
+			return err
+		}
+
+		key := masterKey(id)
+		if key == nil {
+			continue
+		}
+		fileMasterKey, err := readFileKey(keyEncrypted, id, key)
+		if err != nil {
+			// Encrypted with its own password, as the keys are verified.
+			continue
+		}
+		filenameKey, fileDataKey := stretchKey(fileMasterKey)
+		filename, err := decryptFilename(encryptedName, filenameKey)
+		wipe(filenameKey, fileDataKey)
+		if err != nil {
+			return err
+		}
+		if !visit(id, filename) {
+			return nil
+		}
+	}
+
+	return rows.Err()
+}
+
+// Editor modifies the files already stored in a container.
+type Editor struct {
+	encryptionKey []byte
+	db            *sql.DB
+	capabilities  Capabilities
+	err           error
+}
+
+// OpenEditor opens the existing container databasePath for editing.
+// password is needed for finding encrypted files by name, and may be nil.
+func OpenEditor(databasePath string, password []byte) (*Editor, error) {
+	_, err := os.Stat(databasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	editor := new(Editor)
+	editor.db, editor.err = openDB("file:"+databasePath+openDatabaseArgs, nil)
+	if editor.err != nil {
+		return nil, editor.err
+	}
+
+	editor.capabilities, err = detectCapabilities(editor.db)
+	if err == nil && password != nil {
+		editor.encryptionKey, err = readContainerKey(editor.db, editor.capabilities, password)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrNotEncrypted
+		}
+	}
+	if err != nil {
+		editor.db.Close()
+		return nil, err
+	}
+
+	return editor, nil
+}
+
+// Delete removes the file id, along with its data and keys, from
+// the container. The space it used is only reclaimed by [Editor.Vacuum].
+// Containers storing a manifest need the password, so it's updated.
+func (editor *Editor) Delete(id int) (err error) {
+	if editor.err != nil {
+		return editor.err
+	}
+	err = editor.checkManifestKey()
+	if err != nil {
+		return err
+	}
+
+	transaction, err := editor.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	result, err := transaction.Exec(queryDeleteFileById, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrFileNotFound
+	}
+
+	for _, query := range []string{queryDeleteDataById, queryDeleteEncryptedMetadataById} {
+		_, err = transaction.Exec(query, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = storeSummary(transaction, editor.capabilities)
+	if err != nil {
+		return err
+	}
+	err = storeManifest(transaction, editor.capabilities, editor.encryptionKey)
+	if err != nil {
+		return err
+	}
+	return transaction.Commit()
+}
+
+// DeleteByName removes the file name from the container, as [Editor.Delete].
+func (editor *Editor) DeleteByName(name string) error {
+	if editor.err != nil {
+		return editor.err
+	}
+
+	id, err := findFileId(editor.db, editor.masterKey(), editor.nameIndexKey(), name)
+	if err != nil {
+		return err
+	}
+	return editor.Delete(id)
+}
+
+// nameIndexKey returns the indexKey of findFileId, nil when
+// the container key isn't known.
+func (editor *Editor) nameIndexKey() []byte {
+	return nameIndexKey(editor.capabilities, editor.encryptionKey)
+}
+
+// masterKey returns the masterKey function of findFileId and decryptNames,
+// nil when the container key isn't known.
+func (editor *Editor) masterKey() func(id int) []byte {
+	if editor.encryptionKey == nil {
+		return nil
+	}
+	return func(int) []byte { return editor.encryptionKey }
+}
+
+// checkManifestKey returns [ErrEmptyPassword] if the container stores
+// a manifest, which edits must update, but the password wasn't given.
+func (editor *Editor) checkManifestKey() error {
+	if editor.encryptionKey != nil {
+		return nil
+	}
+
+	manifest, err := hasManifest(editor.db, editor.capabilities)
+	if err != nil {
+		return err
+	}
+	if manifest {
+		return ErrEmptyPassword
+	}
+	return nil
+}
+
+// Vacuum rebuilds the container, reclaiming the space
+// left by deleted files, and their deduplicated blocks.
+func (editor *Editor) Vacuum() error {
+	if editor.err != nil {
+		return editor.err
+	}
+
+	err := deleteUnreferencedBlocks(editor.db, editor.capabilities)
+	if err != nil {
+		return err
+	}
+	_, err = editor.db.Exec(queryVacuum)
+	return err
+}
+
+// Close closes the container.
+// Subsequently calls to Close or any other method will yield [ErrEditorClosed]
+func (editor *Editor) Close() error {
+	if editor.err != nil {
+		return editor.err
+	}
+
+	wipe(editor.encryptionKey)
+	editor.encryptionKey = nil
+	editor.err = editor.db.Close()
+	if editor.err != nil {
+		return editor.err
+	}
+
+	editor.err = ErrEditorClosed
+	return nil
+}
@@ -0,0 +1,92 @@
+package arc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FileError records the file whose operation failed, and why, so callers
+// can tell which file failed, while errors.Is and errors.As still match
+// the underlying error, such as [ErrWrongPassword] or a database error.
+type FileError struct {
+	// Op is the operation that failed, as "write", "open", "read"
+	// or "extract".
+	Op string
+
+	// Name is the name of the file, empty when not known, as for
+	// encrypted files opened by id, and Id its id, zero when the
+	// file wasn't inserted yet.
+	Name string
+	Id   int
+
+	Err error
+}
+
+func (err *FileError) Error() string {
+	file := err.Name
+	if file == "" {
+		file = "file " + strconv.Itoa(err.Id)
+	}
+	return err.Op + " " + file + ": " + err.Err.Error()
+}
+
+func (err *FileError) Unwrap() error {
+	return err.Err
+}
+
+// BlockError records the data block whose reading
+// or writing failed, and why.
+type BlockError struct {
+	// Op is the operation that failed, "read" or "write".
+	Op string
+
+	// Id is the id of the file, and Block the index of
+	// the block within the file.
+	Id    int
+	Block int
+
+	Err error
+}
+
+func (err *BlockError) Error() string {
+	return fmt.Sprintf("%s file %d, block %d: %v", err.Op, err.Id, err.Block, err.Err)
+}
+
+func (err *BlockError) Unwrap() error {
+	return err.Err
+}
+
+// fileError wraps err, if not nil, in a [FileError]. Errors already
+// wrapped keep their operation, only gaining the name if they lacked it,
+// while io.EOF is returned as is, being no failure.
+func fileError(op string, name string, id int, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+
+	var fileErr *FileError
+	if errors.As(err, &fileErr) {
+		if fileErr.Name == "" && fileErr.Id == id {
+			fileErr.Name = name
+		}
+		return err
+	}
+	return &FileError{Op: op, Name: name, Id: id, Err: err}
+}
+
+// blockError wraps err, if not nil, in a [BlockError], unless
+// it's already one, or a [BlockCorruptedError].
+func blockError(op string, id int, block int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var blockErr *BlockError
+	var corrupted *BlockCorruptedError
+	if errors.As(err, &blockErr) || errors.As(err, &corrupted) {
+		return err
+	}
+	return &BlockError{Op: op, Id: id, Block: block, Err: err}
+}
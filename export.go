@@ -0,0 +1,170 @@
+package arc
+
+import (
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Formats of the manifests exported by [Reader.ExportManifest].
+const (
+	ManifestJSON = "json"
+	ManifestGob  = "gob"
+)
+
+// ErrUnknownManifestFormat is returned when exporting, or reading, a
+// manifest in a format other than [ManifestJSON] and [ManifestGob].
+var ErrUnknownManifestFormat = errors.New("unknown manifest format")
+
+// ManifestEntry describes a file in an [ExportedManifest].
+type ManifestEntry struct {
+	Name       string            `json:"name"`
+	Type       FileType          `json:"type"`
+	Size       int64             `json:"size"`
+	StoredSize int64             `json:"stored_size,omitempty"`
+	ModTime    time.Time         `json:"mtime"`
+	Mode       fs.FileMode       `json:"mode,omitempty"`
+	Encrypted  bool              `json:"encrypted,omitempty"`
+	Compressed bool              `json:"compressed,omitempty"`
+	Codec      string            `json:"codec,omitempty"`
+	Attrs      map[string]string `json:"attrs,omitempty"`
+
+	// Checksum is the SHA-256 checksum of the contents of the file,
+	// hex encoded, or empty if the container doesn't store it.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// ExportedManifest is a portable snapshot of the metadata of the files of
+// a container, exported by [Reader.ExportManifest], so the container can be
+// indexed, audited, or compared by [DiffManifests], without opening it.
+type ExportedManifest struct {
+	// UUID is the identifier of the container, if it has one.
+	UUID string `json:"uuid,omitempty"`
+
+	// Exported is when the manifest was exported.
+	Exported time.Time `json:"exported"`
+
+	// Files are the files of the container, sorted by name.
+	Files []ManifestEntry `json:"files"`
+}
+
+// header returns the header described by entry.
+func (entry *ManifestEntry) header() *Header {
+	checksum, _ := hex.DecodeString(entry.Checksum)
+	return &Header{
+		Name:       entry.Name,
+		Type:       entry.Type,
+		Size:       entry.Size,
+		ModTime:    entry.ModTime,
+		Mode:       entry.Mode,
+		Encryption: entry.Encrypted,
+		Checksum:   checksum,
+	}
+}
+
+// ExportManifest writes a manifest of the files of the container to w, in
+// format, [ManifestJSON] or [ManifestGob]: their names, types, sizes,
+// modification times, permission bits, attributes and checksums, as an
+// [ExportedManifest]. Encrypted files whose key isn't known are left out.
+func (reader *Reader) ExportManifest(w io.Writer, format string) error {
+	if format != ManifestJSON && format != ManifestGob {
+		return fmt.Errorf("%w: %s", ErrUnknownManifestFormat, format)
+	}
+
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+	manifest := ExportedManifest{Exported: time.Now().UTC()}
+	if reader.capabilities.Has(FeatureUUID) {
+		manifest.UUID, err = reader.UUID()
+		if err != nil {
+			return err
+		}
+	}
+	for _, header := range files {
+		if header.Encryption && !reader.canDecrypt(header.Id) {
+			continue
+		}
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Name:       header.Name,
+			Type:       header.Type,
+			Size:       header.Size,
+			StoredSize: header.StoredSize,
+			ModTime:    header.ModTime.UTC(),
+			Mode:       header.Mode,
+			Encrypted:  header.Encryption,
+			Compressed: header.Compression != 0,
+			Codec:      header.Codec,
+			Attrs:      header.Attrs,
+			Checksum:   hex.EncodeToString(header.Checksum),
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Name < manifest.Files[j].Name
+	})
+
+	if format == ManifestGob {
+		return gob.NewEncoder(w).Encode(manifest)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(manifest)
+}
+
+// ReadManifest reads a manifest written by [Reader.ExportManifest] in format.
+func ReadManifest(r io.Reader, format string) (*ExportedManifest, error) {
+	manifest := new(ExportedManifest)
+	var err error
+	switch format {
+	case ManifestJSON:
+		err = json.NewDecoder(r).Decode(manifest)
+	case ManifestGob:
+		err = gob.NewDecoder(r).Decode(manifest)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownManifestFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// DiffManifests compares the files of the manifests base and target,
+// returning the changes from base to target, sorted by name, as [Diff].
+func DiffManifests(base *ExportedManifest, target *ExportedManifest) *Changes {
+	oldFiles := make(map[string]*Header, len(base.Files))
+	for i := range base.Files {
+		oldFiles[base.Files[i].Name] = base.Files[i].header()
+	}
+
+	changes := new(Changes)
+	newFiles := make(map[string]bool, len(target.Files))
+	for i := range target.Files {
+		header := target.Files[i].header()
+		newFiles[header.Name] = true
+		old, ok := oldFiles[header.Name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, header.Name)
+		case modified(old, header):
+			changes.Modified = append(changes.Modified, header.Name)
+		}
+	}
+	for name := range oldFiles {
+		if !newFiles[name] {
+			changes.Deleted = append(changes.Deleted, name)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	return changes
+}
@@ -0,0 +1,713 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	extractFileMode fs.FileMode = 0664
+	extractDirMode  fs.FileMode = 0775
+)
+
+// ErrUnsafePath is returned when extracting a file whose name is absolute
+// or escapes the extraction target, as through a symbolic link.
+var ErrUnsafePath = errors.New("file name escapes the extraction target")
+
+// ExtractTarget is the destination of an extraction. Names are
+// slash-separated paths relative to the root of the target, so
+// containers can be extracted to memory filesystems, remote mounts
+// or test fakes, besides the local disk.
+type ExtractTarget interface {
+	// CreateFile creates, or truncates, the file name for writing.
+	CreateFile(name string, perm fs.FileMode) (io.WriteCloser, error)
+
+	// MkdirAll creates the directory name along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+
+	// Chtimes changes the access and modification times of name.
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+
+	// Symlink creates newname as a symbolic link to oldname.
+	Symlink(oldname string, newname string) error
+}
+
+// readableTarget is implemented by targets whose files can be read back,
+// allowing resumed extractions to verify the files already extracted.
+type readableTarget interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+// chmodTarget is implemented by targets able to restore the
+// permission bits stored along the files.
+type chmodTarget interface {
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// lchownTarget is implemented by targets able to restore the ownership
+// stored along the files, not following symbolic links.
+type lchownTarget interface {
+	Lchown(name string, uid int, gid int) error
+}
+
+// linkTarget is implemented by targets able to create hard links,
+// so files hardlinked in the container are extracted hardlinked.
+type linkTarget interface {
+	Link(oldname string, newname string) error
+}
+
+// dirTarget extracts to a directory of the local filesystem.
+type dirTarget struct {
+	root string
+}
+
+// NewDirTarget returns an [ExtractTarget] writing to the directory root of
+// the local filesystem. Names that aren't local, or whose parents within
+// root are symbolic links, as left by an earlier extraction, are refused
+// with [ErrUnsafePath], so nothing is written outside of root.
+func NewDirTarget(root string) ExtractTarget {
+	return &dirTarget{root: root}
+}
+
+// path returns the path of name within the root, checking it doesn't
+// escape it: name must be local, and its parents mustn't be symbolic
+// links, nor name itself if final, as it's followed by the operation.
+func (target *dirTarget) path(op string, name string, final bool) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", &fs.PathError{Op: op, Path: name, Err: ErrUnsafePath}
+	}
+
+	components := strings.Split(path.Clean(name), "/")
+	if !final {
+		components = components[:len(components)-1]
+	}
+	dir := target.root
+	for _, component := range components {
+		dir = filepath.Join(dir, component)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", &fs.PathError{Op: op, Path: name, Err: ErrUnsafePath}
+		}
+	}
+	return filepath.Join(target.root, filepath.FromSlash(name)), nil
+}
+
+// removeSymlink removes the symbolic link at path, if any, as
+// files are replaced, instead of written through them.
+func removeSymlink(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// CreateFile replaces any symbolic link already at name.
+func (target *dirTarget) CreateFile(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	path, err := target.path("open", name, false)
+	if err != nil {
+		return nil, err
+	}
+	err = removeSymlink(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (target *dirTarget) MkdirAll(name string, perm fs.FileMode) error {
+	path, err := target.path("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, perm)
+}
+
+func (target *dirTarget) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	path, err := target.path("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, atime, mtime)
+}
+
+// Symlink replaces any file already at newname, so extractions can be repeated.
+func (target *dirTarget) Symlink(oldname string, newname string) error {
+	path, err := target.path("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(oldname, path)
+}
+
+// Link replaces any file already at newname, as Symlink.
+func (target *dirTarget) Link(oldname string, newname string) error {
+	oldpath, err := target.path("link", oldname, true)
+	if err != nil {
+		return err
+	}
+	newpath, err := target.path("link", newname, false)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(newpath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Link(oldpath, newpath)
+}
+
+func (target *dirTarget) Chmod(name string, mode fs.FileMode) error {
+	path, err := target.path("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+func (target *dirTarget) Lchown(name string, uid int, gid int) error {
+	path, err := target.path("lchown", name, false)
+	if err != nil {
+		return err
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+func (target *dirTarget) Open(name string) (io.ReadCloser, error) {
+	path, err := target.path("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// MemEntry is a file, directory or symbolic link of a [MemTarget].
+type MemEntry struct {
+	Mode    fs.FileMode
+	ModTime time.Time
+	Data    []byte
+	Link    string
+}
+
+// MemTarget is an [ExtractTarget] keeping the extracted files in memory.
+// It is safe for concurrent use.
+type MemTarget struct {
+	mu      sync.Mutex
+	entries map[string]*MemEntry
+}
+
+// NewMemTarget returns an empty [MemTarget].
+func NewMemTarget() *MemTarget {
+	return &MemTarget{entries: make(map[string]*MemEntry)}
+}
+
+// Names returns the sorted names of all entries of target.
+func (target *MemTarget) Names() []string {
+	target.mu.Lock()
+	defer target.mu.Unlock()
+
+	names := make([]string, 0, len(target.entries))
+	for name := range target.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entry returns the entry name of target.
+func (target *MemTarget) Entry(name string) (*MemEntry, bool) {
+	target.mu.Lock()
+	defer target.mu.Unlock()
+
+	entry, ok := target.entries[path.Clean(name)]
+	return entry, ok
+}
+
+func (target *MemTarget) set(name string, entry *MemEntry) {
+	target.mu.Lock()
+	target.entries[path.Clean(name)] = entry
+	target.mu.Unlock()
+}
+
+// memFile buffers the content of a file until it's closed.
+type memFile struct {
+	bytes.Buffer
+	target *MemTarget
+	name   string
+	perm   fs.FileMode
+}
+
+func (file *memFile) Close() error {
+	file.target.set(file.name, &MemEntry{
+		Mode:    file.perm,
+		ModTime: time.Now(),
+		Data:    file.Bytes(),
+	})
+	return nil
+}
+
+func (target *MemTarget) CreateFile(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	return &memFile{target: target, name: name, perm: perm}, nil
+}
+
+func (target *MemTarget) MkdirAll(name string, perm fs.FileMode) error {
+	for dir := path.Clean(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, ok := target.Entry(dir); !ok {
+			target.set(dir, &MemEntry{Mode: fs.ModeDir | perm, ModTime: time.Now()})
+		}
+	}
+	return nil
+}
+
+func (target *MemTarget) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	target.mu.Lock()
+	defer target.mu.Unlock()
+
+	entry, ok := target.entries[path.Clean(name)]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	entry.ModTime = mtime
+	return nil
+}
+
+func (target *MemTarget) Open(name string) (io.ReadCloser, error) {
+	entry, ok := target.Entry(name)
+	if !ok || !entry.Mode.IsRegular() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(entry.Data)), nil
+}
+
+func (target *MemTarget) Chmod(name string, mode fs.FileMode) error {
+	target.mu.Lock()
+	defer target.mu.Unlock()
+
+	entry, ok := target.entries[path.Clean(name)]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	entry.Mode = entry.Mode&fs.ModeType | mode
+	return nil
+}
+
+func (target *MemTarget) Symlink(oldname string, newname string) error {
+	target.set(newname, &MemEntry{
+		Mode:    fs.ModeSymlink | fs.ModePerm,
+		ModTime: time.Now(),
+		Link:    oldname,
+	})
+	return nil
+}
+
+// Link makes newname share the entry of oldname, so
+// changes to either are seen by both.
+func (target *MemTarget) Link(oldname string, newname string) error {
+	entry, ok := target.Entry(oldname)
+	if !ok || !entry.Mode.IsRegular() {
+		return &fs.PathError{Op: "link", Path: oldname, Err: fs.ErrNotExist}
+	}
+	target.set(newname, entry)
+	return nil
+}
+
+// extractedFiles are the names the regular files were extracted as, by
+// id, so the hard links to them are extracted as hard links too. They're
+// safe for concurrent use, as files are extracted by many workers.
+type extractedFiles struct {
+	mu    sync.Mutex
+	names map[int]string
+}
+
+func newExtractedFiles() *extractedFiles {
+	return &extractedFiles{names: make(map[int]string)}
+}
+
+// add records the file id as extracted as name.
+func (extracted *extractedFiles) add(id int, name string) {
+	extracted.mu.Lock()
+	extracted.names[id] = name
+	extracted.mu.Unlock()
+}
+
+// name returns the name the file id was extracted as, if it was.
+func (extracted *extractedFiles) name(id int) (string, bool) {
+	if extracted == nil {
+		return "", false
+	}
+
+	extracted.mu.Lock()
+	defer extracted.mu.Unlock()
+	name, ok := extracted.names[id]
+	return name, ok
+}
+
+// extractHardlink extracts the file of header, a hard link, as a hard
+// link to the file it links to, if target supports them and it was
+// extracted, reporting whether it was. Targets whose Link method fails
+// with [errors.ErrUnsupported] don't support them.
+func extractHardlink(target ExtractTarget, header *Header, extracted *extractedFiles) (bool, error) {
+	linker, ok := target.(linkTarget)
+	if !ok {
+		return false, nil
+	}
+	name, ok := extracted.name(header.LinkId)
+	if !ok {
+		return false, nil
+	}
+	err := linker.Link(name, header.Name)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return false, nil
+	}
+	return true, err
+}
+
+// restoreAttributes restores the permission bits and ownership stored along
+// the file header, when supported by target. Ownership is only restored if
+// permitted, as only privileged users can give files away.
+func restoreAttributes(target ExtractTarget, header *Header) error {
+	if chmodder, ok := target.(chmodTarget); ok && header.Mode != 0 && header.Type != TypeSymlink {
+		err := chmodder.Chmod(header.Name, header.Mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if chowner, ok := target.(lchownTarget); ok && (header.Uid != nil || header.Gid != nil) {
+		uid, gid := -1, -1
+		if header.Uid != nil {
+			uid = *header.Uid
+		}
+		if header.Gid != nil {
+			gid = *header.Gid
+		}
+		err := chowner.Lchown(header.Name, uid, gid)
+		if err != nil && !errors.Is(err, fs.ErrPermission) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractSymlink creates the symbolic link header in target.
+func (reader *Reader) extractSymlink(target ExtractTarget, header *Header, sum io.Writer) error {
+	stream, err := reader.openReader(header.Id, true)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	linkTarget, err := io.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	if sum != nil {
+		sum.Write(linkTarget)
+	}
+
+	err = target.Symlink(string(linkTarget), header.Name)
+	if err != nil {
+		return err
+	}
+	return restoreAttributes(target, header)
+}
+
+// extractFile writes the file header to target, creating its parent
+// directories and restoring its modification time and attributes.
+// Directories are only created, as their modification time changes while
+// the files within them are extracted, being restored by restoreDirs.
+// When sum isn't nil, the extracted contents are also written to it.
+func (reader *Reader) extractFile(target ExtractTarget, header *Header, sum io.Writer, extracted *extractedFiles) (err error) {
+	defer func() {
+		err = fileError("extract", header.Name, header.Id, err)
+	}()
+
+	if !filepath.IsLocal(filepath.FromSlash(header.Name)) {
+		return ErrUnsafePath
+	}
+
+	if header.Type == TypeDir {
+		return target.MkdirAll(header.Name, extractDirMode)
+	}
+
+	dir := path.Dir(header.Name)
+	if dir != "." {
+		err = target.MkdirAll(dir, extractDirMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if header.Type == TypeSymlink {
+		return reader.extractSymlink(target, header, sum)
+	}
+	if header.LinkId != 0 {
+		linked, err := extractHardlink(target, header, extracted)
+		if linked || err != nil {
+			return err
+		}
+	}
+
+	stream, err := reader.openReader(header.Id, true)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	file, err := target.CreateFile(header.Name, extractFileMode)
+	if err != nil {
+		return err
+	}
+	osFile, isOSFile := file.(*os.File)
+	if _, sparse := stream.Reader.(*sparseReader); sparse && isOSFile {
+		var src io.Reader = stream
+		if sum != nil {
+			src = io.TeeReader(stream, sum)
+		}
+		_, err = copySparse(osFile, src)
+	} else {
+		var dst io.Writer = file
+		if sum != nil {
+			dst = io.MultiWriter(file, sum)
+		}
+		_, err = io.Copy(dst, stream)
+	}
+	err2 := file.Close()
+	if err2 != nil && err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	err = restoreAttributes(target, header)
+	if err != nil {
+		return err
+	}
+	err = target.Chtimes(header.Name, header.accessTime(), header.ModTime)
+	if err == nil && extracted != nil && header.LinkId == 0 {
+		extracted.add(header.Id, header.Name)
+	}
+	return err
+}
+
+// extractRank orders the files of header when extracted: files first,
+// then the hard links to them, then symbolic links.
+func extractRank(header *Header) int {
+	switch {
+	case header.Type == TypeSymlink:
+		return 2
+	case header.LinkId != 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// checkSymlinkParents returns [ErrUnsafePath] for the first of files, in name
+// order, within a symbolic link among files, as it would be extracted
+// through the link, wherever it points. Names are compared regardless of
+// case, as they're the same in case-insensitive filesystems.
+func checkSymlinkParents(files map[string]*Header) error {
+	links := make(map[string]bool)
+	for name, header := range files {
+		if header.Type == TypeSymlink {
+			links[strings.ToLower(path.Clean(name))] = true
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for dir := path.Dir(path.Clean(name)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if links[strings.ToLower(dir)] {
+				header := files[name]
+				return fileError("extract", header.Name, header.Id, ErrUnsafePath)
+			}
+		}
+	}
+	return nil
+}
+
+// extractOrder returns the names of files in the order they are extracted:
+// sorted, but with hard links after the files they link to, and symbolic
+// links last, so no file is extracted through a symbolic link extracted
+// before it.
+func extractOrder(files map[string]*Header) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sort.SliceStable(names, func(i, j int) bool {
+		return extractRank(files[names[i]]) < extractRank(files[names[j]])
+	})
+
+	return names
+}
+
+// ExtractAllTo extracts all files of the container to target, in
+// name order, followed by the hard links and symbolic links. Hard links
+// are extracted as such when target has a Link method, as the targets of
+// [NewDirTarget], [NewFSTarget] and [MemTarget], and as copies otherwise,
+// or when it fails with [errors.ErrUnsupported]. Files whose
+// names would escape target are rejected with [ErrUnsafePath], as are
+// the containers with files within their symbolic links, before
+// extracting anything.
+func (reader *Reader) ExtractAllTo(target ExtractTarget) error {
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+	return reader.extractFilesTo(target, files)
+}
+
+// extractFilesTo extracts files to target, as [Reader.ExtractAllTo].
+func (reader *Reader) extractFilesTo(target ExtractTarget, files map[string]*Header) error {
+	err := checkSymlinkParents(files)
+	if err != nil {
+		return err
+	}
+
+	names := extractOrder(files)
+	headers := make([]*Header, len(names))
+	for i, name := range names {
+		headers[i] = files[name]
+	}
+	reader.err = reader.extractHeaders(target, headers)
+	if reader.err != nil {
+		return reader.err
+	}
+
+	return restoreDirs(target, files, names)
+}
+
+// ExtractAll extracts all files of the container to the directory destDir
+// of the local filesystem, creating it and the directories of the files,
+// and restoring their modification times, permission bits and, if
+// permitted, ownership. Files already in destDir are overwritten.
+//
+// Names of files colliding with a file already extracted, such as names
+// only differing in case, which are the same file in case-insensitive
+// filesystems, are extracted with a numeric suffix before their extension,
+// as "name.1.ext".
+//
+// Files within the symbolic links of the container are rejected with
+// [ErrUnsafePath], before extracting anything, as are files whose parents
+// in destDir are symbolic links, so nothing is written outside destDir.
+func (reader *Reader) ExtractAll(destDir string) error {
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+	err = checkSymlinkParents(files)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(destDir, extractDirMode)
+	if err != nil {
+		return err
+	}
+
+	names := extractOrder(files)
+	target := NewDirTarget(destDir)
+	used := make(map[string]bool, len(names))
+	headers := make([]*Header, len(names))
+	for i, name := range names {
+		header := files[name]
+		if header.Type != TypeDir {
+			unique := uniqueName(used, header.Name)
+			if unique != header.Name {
+				renamed := *header
+				renamed.Name = unique
+				header = &renamed
+			}
+		}
+		used[strings.ToLower(path.Clean(header.Name))] = true
+		headers[i] = header
+	}
+
+	reader.err = reader.extractHeaders(target, headers)
+	if reader.err != nil {
+		return reader.err
+	}
+
+	return restoreDirs(target, files, names)
+}
+
+// suffixedName returns name with the suffix ".n" before its extension.
+func suffixedName(name string, n int) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + strconv.Itoa(n) + ext
+}
+
+// uniqueName returns name, or name with the lowest numeric suffix,
+// such that it's not in used, compared by its cleaned lowercase form.
+func uniqueName(used map[string]bool, name string) string {
+	if !used[strings.ToLower(path.Clean(name))] {
+		return name
+	}
+
+	for i := 1; ; i++ {
+		candidate := suffixedName(name, i)
+		if !used[strings.ToLower(path.Clean(candidate))] {
+			return candidate
+		}
+	}
+}
+
+// restoreDirs restores the modification time and attributes of the
+// directories among files, once all files are extracted, as they could
+// forbid extracting the files within them. names are the sorted names
+// of files, and are visited backwards so directories are restored after
+// the directories within them.
+func restoreDirs(target ExtractTarget, files map[string]*Header, names []string) error {
+	for i := len(names) - 1; i >= 0; i-- {
+		header := files[names[i]]
+		if header.Type != TypeDir {
+			continue
+		}
+
+		err := restoreAttributes(target, header)
+		if err != nil {
+			return err
+		}
+		err = target.Chtimes(header.Name, header.accessTime(), header.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeEscapingContainer writes a container with a symbolic link "a"
+// to dir, and a file "a/b" within it.
+func writeEscapingContainer(t *testing.T, dir string) string {
+	t.Helper()
+	path := testContainerPath(t)
+	writer, err := NewWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteSymlink(&Header{Name: "a"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "a/b"}, []byte("escaped"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractRejectsFilesWithinSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	reader, err := NewReader(writeEscapingContainer(t, outside), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	extractions := map[string]func() error{
+		"ExtractAll": func() error {
+			return reader.ExtractAll(t.TempDir())
+		},
+		"ExtractAllTo": func() error {
+			return reader.ExtractAllTo(NewDirTarget(t.TempDir()))
+		},
+		"ExtractMatchingTo": func() error {
+			return reader.ExtractMatchingTo(NewDirTarget(t.TempDir()), nil, []string{"a"})
+		},
+		"ExtractAllResumable": func() error {
+			return reader.ExtractAllResumable(NewDirTarget(t.TempDir()), t.TempDir())
+		},
+	}
+	for name, extract := range extractions {
+		err := extract()
+		if !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrUnsafePath)
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "b")); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: file written outside of the target", name)
+		}
+	}
+}
+
+func TestExtractThroughLeftoverSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim")
+	err := os.WriteFile(victim, []byte("untouched"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Symbolic links left by an earlier extraction, or planted.
+	dest := t.TempDir()
+	err = os.Symlink(outside, filepath.Join(dest, "dir"))
+	if err == nil {
+		err = os.Symlink(victim, filepath.Join(dest, "file"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, map[string]string{"file": "replaced"})
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reader.ExtractAll(dest)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(victim)
+	if err != nil || !bytes.Equal(data, []byte("untouched")) {
+		t.Fatalf("written through a symbolic link: %q, %v", data, err)
+	}
+	info, err := os.Lstat(filepath.Join(dest, "file"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("symbolic link not replaced: %v, %v", info, err)
+	}
+
+	path = testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, map[string]string{"dir/victim": "replaced"})
+	reader, err = NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	err = reader.ExtractAll(dest)
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("got %v, want %v", err, ErrUnsafePath)
+	}
+	data, err = os.ReadFile(victim)
+	if err != nil || !bytes.Equal(data, []byte("untouched")) {
+		t.Fatalf("written through a symbolic link: %q, %v", data, err)
+	}
+}
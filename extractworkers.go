@@ -0,0 +1,89 @@
+package arc
+
+import "sync"
+
+// SetExtractWorkers sets the number of workers extracting files, as by
+// [Reader.ExtractAll], [Reader.ExtractAllTo] and [Reader.ExtractMatchingTo],
+// each reading the files through a connection of its own to the database,
+// so extracting many files saturates the disks instead of waiting on each
+// file in turn. The files are then extracted in no particular order, but
+// still before the hard links and symbolic links, and the target must be
+// safe for concurrent use, as the targets of [NewDirTarget] and
+// [MemTarget]. One or less, the default, extracts the files one by one.
+func (reader *Reader) SetExtractWorkers(workers int) {
+	reader.extractWorkers = max(workers, 1)
+}
+
+// extractHeaders extracts the files of headers to target, ordered by
+// [extractOrder], by the workers set by [Reader.SetExtractWorkers]. It
+// leaves reader.err unset, as the workers extract them concurrently.
+func (reader *Reader) extractHeaders(target ExtractTarget, headers []*Header) error {
+	extracted := newExtractedFiles()
+	if reader.extractWorkers <= 1 {
+		for _, header := range headers {
+			err := reader.extractFile(target, header, nil, extracted)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The files of each rank are extracted once those of the
+	// previous ranks are, so hard links find their files.
+	for start := 0; start < len(headers); {
+		end := start + 1
+		for end < len(headers) && extractRank(headers[end]) == extractRank(headers[start]) {
+			end++
+		}
+		err := reader.extractConcurrently(target, headers[start:end], extracted)
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// extractConcurrently extracts the files of headers to target by the
+// workers of the Reader, returning the first error, after which no
+// more files are extracted.
+func (reader *Reader) extractConcurrently(target ExtractTarget, headers []*Header, extracted *extractedFiles) error {
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	jobs := make(chan *Header)
+	var workers sync.WaitGroup
+	for range min(reader.extractWorkers, len(headers)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for header := range jobs {
+				err := reader.extractFile(target, header, nil, extracted)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, header := range headers {
+		if failed() {
+			break
+		}
+		jobs <- header
+	}
+	close(jobs)
+	workers.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,223 @@
+package arc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/bernardo1r/encdec"
+)
+
+const (
+	queryInsertFileKeyParams = `INSERT INTO file_key_params VALUES (?, ?)`
+
+	queryFilePasswordIds = `SELECT id FROM file_key_params`
+
+	queryFileKeyParams = `SELECT file_key_params.id, params, key
+		FROM file_key_params
+		JOIN encryption_metadata ON encryption_metadata.id = file_key_params.id`
+
+	queryContainerKeyAny = `SELECT id, key FROM encryption_metadata
+		WHERE id NOT IN (SELECT id FROM file_key_params) LIMIT 1`
+)
+
+// ErrFileLocked is returned when reading a file encrypted with its own
+// password, which wasn't given by [Reader.AddFilePassword].
+var ErrFileLocked = errors.New("file encrypted with its own password")
+
+// filePasswordKey is a key derived from a file password,
+// along with the marshaled params used to derive it.
+type filePasswordKey struct {
+	key    []byte
+	params []byte
+}
+
+// containerKeyQuery returns the query selecting the id and sealed key of
+// any file encrypted with the container key, ignoring the files encrypted
+// with their own password.
+func containerKeyQuery(capabilities Capabilities) string {
+	if capabilities.Has(FeatureFilePasswords) {
+		return queryContainerKeyAny
+	}
+	return queryFileEncryptionKeyAny
+}
+
+// filePasswordKey returns the key derived from password. The key is derived
+// once per Writer, so files sharing a password share the params too, and
+// readers derive it once for all of them. The keys are looked up by the
+// digest of their password, so the Writer doesn't keep the password.
+func (writer *Writer) filePasswordKey(password []byte) (filePasswordKey, error) {
+	digest := sha256.Sum256(password)
+	derived, ok := writer.filePasswords[digest]
+	if ok {
+		return derived, nil
+	}
+
+	key, paramsString, err := deriveKey(password, writer.kdf)
+	if err != nil {
+		return derived, err
+	}
+
+	derived = filePasswordKey{key: key, params: paramsString}
+	if writer.filePasswords == nil {
+		writer.filePasswords = make(map[[sha256.Size]byte]filePasswordKey)
+	}
+	writer.filePasswords[digest] = derived
+	return derived, nil
+}
+
+// loadFilePasswordIds loads the ids of the files encrypted
+// with their own password.
+func (reader *Reader) loadFilePasswordIds() (err error) {
+	rows, err := reader.db.Query(queryFilePasswordIds)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	reader.filePasswordIds = make(map[int]bool)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return err
+		}
+		reader.filePasswordIds[id] = true
+	}
+
+	return rows.Err()
+}
+
+// masterKey returns the key sealing the master key of the encrypted
+// file id: its password key, if unlocked, or the container key. It
+// returns nil if the key isn't known.
+func (reader *Reader) masterKey(id int) []byte {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	reader.resetLockTimer()
+	if key := reader.fileKeys[id]; key != nil {
+		return key
+	}
+	if reader.filePasswordIds[id] {
+		return nil
+	}
+	return reader.encryptionKey
+}
+
+// canDecrypt reports whether the key of the encrypted file id is known.
+func (reader *Reader) canDecrypt(id int) bool {
+	return reader.masterKey(id) != nil
+}
+
+// decryptError returns the error of reading the encrypted
+// file id, whose key is unknown.
+func (reader *Reader) decryptError(id int) error {
+	if reader.filePasswordIds[id] {
+		return ErrFileLocked
+	}
+	return ErrEmptyPassword
+}
+
+// AddFilePassword unlocks the files encrypted with password as their own
+// password (see [Header.Password]), returning how many were unlocked.
+// Their names are then decrypted by [Reader.Files], and they can be read.
+//
+// The key is derived once for each distinct set of params, which files
+// written by the same [Writer] with the same password share.
+// [ErrWrongPassword] is returned if no file was unlocked. As with
+// [Reader.SetPassword], password isn't kept, and the keys unlocking no
+// file are zeroed.
+func (reader *Reader) AddFilePassword(password []byte) (unlocked int, err error) {
+	if reader.checkError() {
+		return 0, reader.err
+	}
+	if !reader.capabilities.Has(FeatureFilePasswords) {
+		return 0, FeatureFilePasswords.missingError()
+	}
+
+	rows, err := reader.db.Query(queryFileKeyParams)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+	reader.resetLockTimer()
+
+	if reader.fileKeys == nil {
+		reader.fileKeys = make(map[int][]byte)
+	}
+	derived := make(map[string][]byte)
+	used := make(map[string]bool)
+	defer func() {
+		for params, key := range derived {
+			if !used[params] {
+				wipe(key)
+			}
+		}
+	}()
+	for rows.Next() {
+		var id int
+		var paramsString, keyEncrypted []byte
+		err = rows.Scan(&id, &paramsString, &keyEncrypted)
+		if err != nil {
+			return unlocked, err
+		}
+		if reader.fileKeys[id] != nil {
+			continue
+		}
+
+		key, ok := derived[string(paramsString)]
+		if !ok {
+			params, err := encdec.ParseHeader(bytes.NewReader(paramsString))
+			if err != nil {
+				return unlocked, err
+			}
+			key, err = encdec.Key(password, params)
+			if err != nil {
+				return unlocked, err
+			}
+			derived[string(paramsString)] = key
+		}
+
+		_, err = readFileKey(keyEncrypted, id, key)
+		if err != nil {
+			continue
+		}
+		reader.fileKeys[id] = key
+		used[string(paramsString)] = true
+		unlocked++
+	}
+	err = rows.Err()
+	if err != nil {
+		return unlocked, err
+	}
+
+	if unlocked == 0 {
+		return 0, ErrWrongPassword
+	}
+	return unlocked, nil
+}
+
+// hasFilePassword reports whether the file id is encrypted with its own password.
+func (reader *RemoteReader) hasFilePassword(id int) bool {
+	table, ok := reader.file.tables["file_key_params"]
+	if !ok {
+		return false
+	}
+
+	_, err := reader.file.lookupRowid(table.root, int64(id))
+	return err == nil
+}
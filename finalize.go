@@ -0,0 +1,171 @@
+package arc
+
+import (
+	"context"
+	"fmt"
+)
+
+const queryDeleteFileById = `DELETE FROM metadata WHERE id = ?`
+
+// FinalizeStep is a step of closing a [Writer], reported by [Writer.CloseAsync].
+type FinalizeStep int
+
+const (
+	// FinalizeFlush writes the remaining data of the current
+	// file and commits its transaction.
+	FinalizeFlush FinalizeStep = iota
+
+	// FinalizeManifest stores the summary of the files, and the
+	// manifest authenticating the metadata of encrypted containers.
+	FinalizeManifest
+
+	// FinalizeClose closes the container database.
+	FinalizeClose
+
+	// FinalizeSplit splits the container into volumes,
+	// if set by [Writer.SetVolumeSize].
+	FinalizeSplit
+
+	// FinalizeDone is reported once the container is closed.
+	FinalizeDone
+)
+
+func (step FinalizeStep) String() string {
+	switch step {
+	case FinalizeFlush:
+		return "flushing current file"
+	case FinalizeManifest:
+		return "storing manifest"
+	case FinalizeClose:
+		return "closing container"
+	case FinalizeSplit:
+		return "splitting into volumes"
+	case FinalizeDone:
+		return "done"
+	default:
+		return fmt.Sprintf("FinalizeStep(%d)", int(step))
+	}
+}
+
+// abort discards the file being written, rolling back its transaction
+// and removing what was written outside of it, and restores the file
+// it was replacing.
+func (writer *Writer) abort() error {
+	if writer.currDataWriter == nil {
+		return nil
+	}
+
+	writer.currDataWriter.cleanup()
+	db := writer.fileQuerier(context.Background())
+	_, err := db.Exec(queryDeleteFileById, writer.currDataWriter.id)
+	if err == nil {
+		err = restoreReplaced(db, writer.currReplaced)
+	}
+	writer.currWriters = nil
+	writer.currDataWriter = nil
+	writer.currHash = nil
+	writer.currReplaced = replacedFile{}
+	return err
+}
+
+// close closes the container, reporting each step to progress, if not nil.
+// If ctx is done before flushing, the current file is discarded instead.
+// The keys are zeroed either way, as the Writer is of no use afterwards.
+func (writer *Writer) close(ctx context.Context, progress func(FinalizeStep)) error {
+	defer writer.wipeKeys()
+	if writer.err != nil {
+		return writer.err
+	}
+
+	report := func(step FinalizeStep) {
+		if progress != nil {
+			progress(step)
+		}
+	}
+
+	report(FinalizeFlush)
+	if err := ctx.Err(); err != nil {
+		writer.err = writer.abort()
+		if writer.err == nil {
+			writer.err = writer.commitBatch()
+		}
+		if writer.err == nil {
+			writer.err = err
+		}
+		writer.db.Close()
+		return writer.err
+	}
+	writer.err = writer.flush()
+	if writer.err == nil {
+		writer.err = writer.commitBatch()
+	}
+	if writer.err == nil {
+		writer.err = writer.storeDeleted()
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+
+	report(FinalizeManifest)
+	writer.err = storeSummary(writer.db, writer.capabilities)
+	if writer.err == nil {
+		writer.err = storeManifest(writer.db, writer.capabilities, writer.encryptionKey)
+	}
+	if writer.err != nil {
+		return writer.err
+	}
+
+	report(FinalizeClose)
+	writer.err = writer.db.Close()
+	if writer.err != nil {
+		return writer.err
+	}
+
+	if writer.volumeSize > 0 {
+		report(FinalizeSplit)
+		_, writer.err = SplitVolumes(writer.path, writer.volumeSize)
+		if writer.err != nil {
+			return writer.err
+		}
+	}
+
+	writer.err = ErrWriterClosed
+	report(FinalizeDone)
+	return nil
+}
+
+// wipeKeys zeroes the container key and the keys derived
+// from the passwords of the files.
+func (writer *Writer) wipeKeys() {
+	wipe(writer.encryptionKey)
+	writer.encryptionKey = nil
+	for digest, derived := range writer.filePasswords {
+		wipe(derived.key)
+		delete(writer.filePasswords, digest)
+	}
+}
+
+// CloseAsync closes the container as [Writer.Close], but in the background,
+// so callers can report the finalization of large containers. Each step is
+// reported to progress, if not nil, from the background goroutine. The
+// returned channel receives the result of closing, and is then closed.
+//
+// If ctx is done before the current file is flushed, the file is discarded
+// and the error of ctx is returned. The Writer must not be used
+// until the channel receives.
+func (writer *Writer) CloseAsync(ctx context.Context, progress func(FinalizeStep)) <-chan error {
+	done := make(chan error, 1)
+	if err := writer.acquire(); err != nil {
+		done <- err
+		close(done)
+		return done
+	}
+	go func() {
+		err := writer.close(ctx, progress)
+		writer.release()
+		done <- err
+		close(done)
+	}()
+
+	return done
+}
@@ -0,0 +1,358 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+const (
+	fsFileMode fs.FileMode = 0444
+	fsDirMode  fs.FileMode = fs.ModeDir | 0555
+)
+
+// fsNode is a file or directory of a [FS].
+type fsNode struct {
+	name    string
+	header  *Header
+	dir     bool
+	modTime time.Time
+	entries []*fsNode
+}
+
+func (node *fsNode) isDir() bool {
+	return node.dir
+}
+
+func (node *fsNode) Name() string {
+	return node.name
+}
+
+func (node *fsNode) Size() int64 {
+	if node.isDir() {
+		return 0
+	}
+	return node.header.Size
+}
+
+func (node *fsNode) Mode() fs.FileMode {
+	if node.isDir() {
+		return fsDirMode
+	}
+	if node.header.Type == TypeSymlink {
+		return fs.ModeSymlink | fsFileMode
+	}
+	return fsFileMode
+}
+
+func (node *fsNode) ModTime() time.Time {
+	return node.modTime
+}
+
+func (node *fsNode) IsDir() bool {
+	return node.isDir()
+}
+
+func (node *fsNode) Sys() any {
+	if node.header == nil {
+		return nil
+	}
+	return node.header
+}
+
+// FS presents the files of a container as a read-only [fs.FS], also
+// implementing [fs.ReadDirFS] and [fs.StatFS]. Names containing slashes
+// are presented as files within directories.
+//
+// Encrypted files are left out when the [Reader] has no password.
+type FS struct {
+	reader *Reader
+	nodes  map[string]*fsNode
+}
+
+// FS returns the files of the container as a [FS]. The files are listed
+// once, so files added to the container afterwards aren't seen.
+//
+// Files opened through FS read the container independently of
+// [Reader.Open], and each other, while the Reader isn't closed.
+func (reader *Reader) FS() (*FS, error) {
+	files, err := reader.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := &FS{
+		reader: reader,
+		nodes:  map[string]*fsNode{".": {name: ".", dir: true}},
+	}
+	for name, header := range files {
+		if header.Encryption && !reader.canDecrypt(header.Id) {
+			continue
+		}
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		node := &fsNode{
+			name:    path.Base(name),
+			header:  header,
+			dir:     header.Type == TypeDir,
+			modTime: header.ModTime,
+		}
+		fsys.add(name, node)
+	}
+
+	for _, node := range fsys.nodes {
+		sort.Slice(node.entries, func(i, j int) bool {
+			return node.entries[i].name < node.entries[j].name
+		})
+	}
+	return fsys, nil
+}
+
+// add adds node as name, creating its missing parent directories. Nodes
+// whose parent is a file, instead of a directory, aren't added.
+func (fsys *FS) add(name string, node *fsNode) bool {
+	if existing, ok := fsys.nodes[name]; ok {
+		if existing.isDir() && node.isDir() && existing.header == nil {
+			existing.header = node.header
+			existing.modTime = node.modTime
+			return true
+		}
+		return false
+	}
+
+	dir := path.Dir(name)
+	parent, ok := fsys.nodes[dir]
+	if !ok {
+		parent = &fsNode{name: path.Base(dir), dir: true}
+		if !fsys.add(dir, parent) {
+			return false
+		}
+	}
+	if !parent.isDir() {
+		return false
+	}
+
+	fsys.nodes[name] = node
+	parent.entries = append(parent.entries, node)
+	if parent.header == nil && node.modTime.After(parent.modTime) {
+		parent.modTime = node.modTime
+	}
+	return true
+}
+
+func (fsys *FS) lookup(op string, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	node, ok := fsys.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return node, nil
+}
+
+// Open opens the file, or directory, name.
+// Files implement [io.Seeker], as needed by [net/http.FileServer].
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if fsys.reader.closed() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrReaderClosed}
+	}
+	node, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.isDir() {
+		return &fsDir{node: node}, nil
+	}
+	return &fsFile{reader: fsys.reader, node: node}, nil
+}
+
+// Stat returns the [fs.FileInfo] of name. Its Sys method returns the
+// [*Header] of the file, or nil for directories with no entry of their own.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.lookup("stat", name)
+}
+
+// ReadDir reads the directory name, returning its entries sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	entries := make([]fs.DirEntry, len(node.entries))
+	for i, entry := range node.entries {
+		entries[i] = fs.FileInfoToDirEntry(entry)
+	}
+	return entries, nil
+}
+
+// fsDir is a directory opened from a [FS].
+type fsDir struct {
+	node   *fsNode
+	offset int
+}
+
+func (dir *fsDir) Stat() (fs.FileInfo, error) {
+	return dir.node, nil
+}
+
+func (dir *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.node.name, Err: errors.New("is a directory")}
+}
+
+func (dir *fsDir) Close() error {
+	return nil
+}
+
+func (dir *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := dir.node.entries[dir.offset:]
+	if count > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(remaining) {
+		remaining = remaining[:count]
+	}
+
+	entries := make([]fs.DirEntry, len(remaining))
+	for i, entry := range remaining {
+		entries[i] = fs.FileInfoToDirEntry(entry)
+	}
+	dir.offset += len(remaining)
+	return entries, nil
+}
+
+// fsFile is a file opened from a [FS]. The file is only read from
+// the container when first read, and seeking backwards reads it again
+// from the start.
+type fsFile struct {
+	reader *Reader
+	node   *fsNode
+	stream *fileStream
+	// streamOffset is the offset of stream, and offset the one
+	// to be read next.
+	streamOffset int64
+	offset       int64
+	closed       bool
+}
+
+func (file *fsFile) Stat() (fs.FileInfo, error) {
+	return file.node, nil
+}
+
+func (file *fsFile) pathError(op string, err error) error {
+	return &fs.PathError{Op: op, Path: file.node.name, Err: err}
+}
+
+// sync positions the stream at the offset to be read next.
+func (file *fsFile) sync() error {
+	if file.stream != nil && file.offset < file.streamOffset {
+		file.stream.Close()
+		file.stream = nil
+	}
+
+	if file.stream == nil {
+		var err error
+		file.stream, err = file.reader.openReader(file.node.header.Id, false)
+		if err != nil {
+			return err
+		}
+		file.streamOffset = 0
+	}
+
+	skipped, err := io.CopyN(io.Discard, file.stream, file.offset-file.streamOffset)
+	file.streamOffset += skipped
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func (file *fsFile) Read(p []byte) (int, error) {
+	if file.closed {
+		return 0, file.pathError("read", fs.ErrClosed)
+	}
+	if file.offset >= file.node.Size() {
+		return 0, io.EOF
+	}
+
+	err := file.sync()
+	if err != nil {
+		return 0, file.pathError("read", err)
+	}
+
+	n, err := file.stream.Read(p)
+	file.offset += int64(n)
+	file.streamOffset += int64(n)
+	return n, err
+}
+
+func (file *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if file.closed {
+		return 0, file.pathError("seek", fs.ErrClosed)
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += file.node.Size()
+	default:
+		return 0, file.pathError("seek", fs.ErrInvalid)
+	}
+	if offset < 0 {
+		return 0, file.pathError("seek", ErrInvalidRange)
+	}
+
+	file.offset = offset
+	return offset, nil
+}
+
+func (file *fsFile) Close() error {
+	if file.closed {
+		return file.pathError("close", fs.ErrClosed)
+	}
+
+	file.closed = true
+	if file.stream != nil {
+		return file.stream.Close()
+	}
+	return nil
+}
+
+// ReadFile reads the whole file name.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	if fsys.reader.closed() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrReaderClosed}
+	}
+	node, err := fsys.lookup("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.isDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+
+	stream, err := fsys.reader.openReader(node.header.Id, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	defer stream.Close()
+
+	buffer := bytes.NewBuffer(make([]byte, 0, node.Size()))
+	_, err = io.Copy(buffer, stream)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,257 @@
+package arc
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+const (
+	queryCountUnreferencedBlocks = `SELECT count(*) FROM blocks
+		WHERE hash NOT IN (SELECT hash FROM block_refs)`
+
+	// queryBlockMismatches is formatted with the table of the blocks,
+	// the condition excluding the pending files, and the stored size.
+	queryBlockMismatches = `SELECT metadata.id, metadata.name, metadata.blocks,
+		count(stored.id), coalesce(sum(length(stored.data)), 0), %[3]s
+		FROM metadata LEFT JOIN %[1]s AS stored ON stored.id = metadata.id
+		%[2]s
+		GROUP BY metadata.id
+		HAVING metadata.blocks != count(stored.id)
+		OR coalesce(%[3]s != coalesce(sum(length(stored.data)), 0), 0)
+		ORDER BY metadata.id ASC`
+)
+
+// ownedTable is a table whose rows belong to a file, by its id, as rows of
+// parent, if the container supports feature, or always.
+type ownedTable struct {
+	name    string
+	parent  string
+	feature Feature
+	always  bool
+}
+
+// ownedTables are the tables whose rows belong to a file, in the order
+// their orphans are purged, so the rows of the children go first.
+var ownedTables = []ownedTable{
+	{name: "data", parent: "metadata", always: true},
+	{name: "block_refs", parent: "metadata", feature: FeatureDeduplication},
+	{name: "attrs", parent: "metadata", feature: FeatureUserAttrs},
+	{name: "holes", parent: "metadata", feature: FeatureSparse},
+	{name: "segments", parent: "metadata", feature: FeatureSegments},
+	{name: "links", parent: "metadata", feature: FeatureHardlinks},
+	{name: "pending_files", parent: "metadata", feature: FeaturePendingFiles},
+	{name: "sealed_metadata", parent: "encryption_metadata", feature: FeatureSealedMetadata},
+	{name: "file_key_params", parent: "encryption_metadata", feature: FeatureFilePasswords},
+	{name: "name_index", parent: "encryption_metadata", feature: FeatureNameIndex},
+	{name: "encryption_metadata", parent: "metadata", feature: FeatureEncryption},
+}
+
+func (table ownedTable) supported(capabilities Capabilities) bool {
+	return table.always || capabilities.Has(table.feature)
+}
+
+func (table ownedTable) countQuery() string {
+	return `SELECT count(*) FROM ` + table.name +
+		` WHERE id NOT IN (SELECT id FROM ` + table.parent + `)`
+}
+
+func (table ownedTable) deleteQuery() string {
+	return `DELETE FROM ` + table.name +
+		` WHERE id NOT IN (SELECT id FROM ` + table.parent + `)`
+}
+
+// BlockMismatch is a file whose stored data blocks don't match its metadata.
+type BlockMismatch struct {
+	Id int
+
+	// Name is the name of the file, as stored, so encrypted.
+	Name string
+
+	// Blocks and StoredBlocks are the number of blocks of the
+	// file, as recorded, and as stored.
+	Blocks       int
+	StoredBlocks int
+
+	// StoredSize and ActualStoredSize are the size of the blocks of the
+	// file, as recorded, or -1 if not, and as stored.
+	StoredSize       int64
+	ActualStoredSize int64
+}
+
+// FsckReport is the outcome of [Fsck].
+type FsckReport struct {
+	// Orphans are the number of rows of each table
+	// belonging to no file, by table, if any.
+	Orphans map[string]int64
+
+	// UnreferencedBlocks is the number of deduplicated
+	// blocks belonging to no file.
+	UnreferencedBlocks int64
+
+	// Mismatches are the files whose data blocks don't match
+	// their recorded number of blocks, or stored size, in id order.
+	Mismatches []BlockMismatch
+
+	// Repaired reports whether the orphans and
+	// unreferenced blocks were purged.
+	Repaired bool
+}
+
+// Ok reports whether the container is consistent,
+// or was left consistent by the repair.
+func (report *FsckReport) Ok() bool {
+	if report.Repaired {
+		return len(report.Mismatches) == 0
+	}
+	return len(report.Orphans) == 0 && report.UnreferencedBlocks == 0 && len(report.Mismatches) == 0
+}
+
+// Fsck checks the consistency of the container databasePath: the rows of
+// data blocks, keys, attributes and the rest belonging to files no longer
+// in the container, the deduplicated blocks no file refers to, and the files
+// whose blocks don't match their recorded number of blocks or stored size.
+// Such rows are left by containers written with foreign keys disabled, as
+// by other SQLite clients, or by older versions of the library. If repair,
+// the orphans and unreferenced blocks are purged, within a transaction.
+// Mismatched files are only reported, as their contents can't be recovered,
+// and are deleted with [Editor.Delete]. The files being written, recorded as
+// pending, aren't checked, as they're completed by [Writer.Resume].
+func Fsck(databasePath string, repair bool) (report *FsckReport, err error) {
+	_, err = os.Stat(databasePath)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDB("file:"+databasePath+openDatabaseArgs, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := db.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	capabilities, err := detectCapabilities(db)
+	if err != nil {
+		return nil, err
+	}
+
+	report = &FsckReport{Orphans: make(map[string]int64)}
+	for _, table := range ownedTables {
+		if !table.supported(capabilities) {
+			continue
+		}
+		var count int64
+		err = db.QueryRow(table.countQuery()).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			report.Orphans[table.name] = count
+		}
+	}
+	if capabilities.Has(FeatureDeduplication) {
+		err = db.QueryRow(queryCountUnreferencedBlocks).Scan(&report.UnreferencedBlocks)
+		if err != nil {
+			return nil, err
+		}
+	}
+	report.Mismatches, err = blockMismatches(db, capabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	if !repair || (len(report.Orphans) == 0 && report.UnreferencedBlocks == 0) {
+		return report, nil
+	}
+	err = purgeOrphans(db, capabilities)
+	if err != nil {
+		return nil, err
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// blockMismatches returns the files, not pending, of the container
+// opened in db whose blocks don't match their metadata.
+func blockMismatches(db *sql.DB, capabilities Capabilities) (mismatches []BlockMismatch, err error) {
+	blocks := "data"
+	if capabilities.Has(FeatureDeduplication) {
+		blocks = "file_blocks"
+	}
+	pending := ""
+	if capabilities.Has(FeaturePendingFiles) {
+		pending = "WHERE metadata.id NOT IN (SELECT id FROM pending_files)"
+	}
+	storedSize := "NULL"
+	if capabilities.Has(FeatureStoredSizes) {
+		storedSize = "metadata.stored_size"
+	}
+	query := fmt.Sprintf(queryBlockMismatches, blocks, pending, storedSize)
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var mismatch BlockMismatch
+		var storedSize sql.NullInt64
+		err = rows.Scan(
+			&mismatch.Id,
+			&mismatch.Name,
+			&mismatch.Blocks,
+			&mismatch.StoredBlocks,
+			&mismatch.ActualStoredSize,
+			&storedSize,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mismatch.StoredSize = -1
+		if storedSize.Valid {
+			mismatch.StoredSize = storedSize.Int64
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	return mismatches, rows.Err()
+}
+
+// purgeOrphans deletes the rows belonging to no file, and the
+// deduplicated blocks no file refers to, within a transaction.
+func purgeOrphans(db *sql.DB, capabilities Capabilities) (err error) {
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	for _, table := range ownedTables {
+		if !table.supported(capabilities) {
+			continue
+		}
+		_, err = transaction.Exec(table.deleteQuery())
+		if err != nil {
+			return err
+		}
+	}
+	if capabilities.Has(FeatureDeduplication) {
+		_, err = transaction.Exec(queryDeleteUnreferencedBlocks)
+		if err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
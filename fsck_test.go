@@ -0,0 +1,82 @@
+package arc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFsckConsistent(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{"file": "contents"})
+	// Files being written aren't checked.
+	writeFailingTestFile(t, path, testPassword, Header{Name: "partial", Encryption: true})
+
+	report, err := Fsck(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Ok() || len(report.Orphans) != 0 || len(report.Mismatches) != 0 {
+		t.Fatalf("got report %+v", report)
+	}
+}
+
+func TestFsckOrphans(t *testing.T) {
+	path := testContainerPath(t)
+	files := map[string]string{"kept": "kept contents", "deleted": "deleted contents"}
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, files)
+	execTestContainer(t, path,
+		`PRAGMA foreign_keys = OFF`,
+		`DELETE FROM metadata WHERE id = (SELECT max(id) FROM metadata)`,
+		`INSERT INTO blocks VALUES (zeroblob(32), X'00')`,
+	)
+
+	report, err := Fsck(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ok() || report.Orphans["data"] != 1 || report.Orphans["encryption_metadata"] != 1 || report.UnreferencedBlocks != 1 {
+		t.Fatalf("got report %+v", report)
+	}
+
+	report, err = Fsck(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Repaired || !report.Ok() {
+		t.Fatalf("repairing: got report %+v", report)
+	}
+	report, err = Fsck(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Ok() {
+		t.Fatalf("repaired: got report %+v", report)
+	}
+}
+
+func TestFsckMismatches(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, MinBlocksize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "file"}, bytes.Repeat([]byte("x"), 3*MinBlocksize))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	execTestContainer(t, path, `DELETE FROM data WHERE block_id = 1`)
+
+	// Mismatched files are only reported, even when repairing.
+	report, err := Fsck(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ok() || report.Repaired || len(report.Mismatches) != 1 {
+		t.Fatalf("got report %+v", report)
+	}
+	mismatch := report.Mismatches[0]
+	if mismatch.Name != "file" || mismatch.Blocks != 3 || mismatch.StoredBlocks != 2 || mismatch.ActualStoredSize != 2*MinBlocksize {
+		t.Errorf("got mismatch %+v", mismatch)
+	}
+}
@@ -0,0 +1,115 @@
+package arc
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// ErrSymlinkUnsupported is returned when extracting a symbolic link
+// to a [WritableFS] without a Symlink method.
+var ErrSymlinkUnsupported = errors.New("symbolic links not supported by the filesystem")
+
+// WritableFS is a writable filesystem, such as a memory filesystem, an SFTP
+// client or a test fake, extracted to through [NewFSTarget]. Names are
+// slash-separated paths, relative to the root the filesystem chooses.
+//
+// It's the subset of the filesystems of packages as afero and go-billy the
+// extraction needs, which they satisfy through a thin wrapper returning
+// their files from OpenFile as an [io.WriteCloser]. Besides its methods,
+// the filesystem may have any of these, used when present:
+//
+//	Symlink(oldname string, newname string) error
+//	Link(oldname string, newname string) error
+//	Chmod(name string, mode fs.FileMode) error
+//	Lchown(name string, uid int, gid int) error
+//	Open(name string) (io.ReadCloser, error)
+//
+// Without a Symlink method, symbolic links fail to be extracted with
+// [ErrSymlinkUnsupported], and without the others, hard links are
+// extracted as copies, attributes aren't restored and resumed extractions
+// can't verify the files already extracted.
+type WritableFS interface {
+	// OpenFile opens the file name with flag, as [os.OpenFile],
+	// creating it with perm.
+	OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error)
+
+	// MkdirAll creates the directory name along with any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+
+	// Chtimes changes the access and modification times of name.
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// fsTarget extracts to a [WritableFS].
+type fsTarget struct {
+	fsys WritableFS
+}
+
+// NewFSTarget returns an [ExtractTarget] writing to fsys, using the
+// optional methods of fsys described by [WritableFS] when present.
+func NewFSTarget(fsys WritableFS) ExtractTarget {
+	return &fsTarget{fsys: fsys}
+}
+
+func (target *fsTarget) CreateFile(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	return target.fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (target *fsTarget) MkdirAll(name string, perm fs.FileMode) error {
+	return target.fsys.MkdirAll(name, perm)
+}
+
+func (target *fsTarget) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return target.fsys.Chtimes(name, atime, mtime)
+}
+
+func (target *fsTarget) Symlink(oldname string, newname string) error {
+	linker, ok := target.fsys.(interface {
+		Symlink(oldname string, newname string) error
+	})
+	if !ok {
+		return &fs.PathError{Op: "symlink", Path: newname, Err: ErrSymlinkUnsupported}
+	}
+	return linker.Symlink(oldname, newname)
+}
+
+// Link fails with [errors.ErrUnsupported] when fsys has no Link
+// method, so the hard link is extracted as a copy instead.
+func (target *fsTarget) Link(oldname string, newname string) error {
+	linker, ok := target.fsys.(linkTarget)
+	if !ok {
+		return &fs.PathError{Op: "link", Path: newname, Err: errors.ErrUnsupported}
+	}
+	return linker.Link(oldname, newname)
+}
+
+// Chmod does nothing when fsys has no Chmod method.
+func (target *fsTarget) Chmod(name string, mode fs.FileMode) error {
+	chmodder, ok := target.fsys.(chmodTarget)
+	if !ok {
+		return nil
+	}
+	return chmodder.Chmod(name, mode)
+}
+
+// Lchown does nothing when fsys has no Lchown method.
+func (target *fsTarget) Lchown(name string, uid int, gid int) error {
+	chowner, ok := target.fsys.(lchownTarget)
+	if !ok {
+		return nil
+	}
+	return chowner.Lchown(name, uid, gid)
+}
+
+// Open fails with [errors.ErrUnsupported] when fsys has no Open
+// method, so the files already extracted aren't verified.
+func (target *fsTarget) Open(name string) (io.ReadCloser, error) {
+	readable, ok := target.fsys.(readableTarget)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.ErrUnsupported}
+	}
+	return readable.Open(name)
+}
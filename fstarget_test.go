@@ -0,0 +1,121 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+// fakeFS is a [WritableFS] with no optional methods, keeping its files
+// in a [MemTarget].
+type fakeFS struct {
+	mem *MemTarget
+}
+
+func (fsys fakeFS) OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error) {
+	return fsys.mem.CreateFile(name, perm)
+}
+
+func (fsys fakeFS) MkdirAll(name string, perm fs.FileMode) error {
+	return fsys.mem.MkdirAll(name, perm)
+}
+
+func (fsys fakeFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fsys.mem.Chtimes(name, atime, mtime)
+}
+
+// fakeLinkFS is a [fakeFS] with symbolic and hard links.
+type fakeLinkFS struct {
+	fakeFS
+}
+
+func (fsys fakeLinkFS) Symlink(oldname string, newname string) error {
+	return fsys.mem.Symlink(oldname, newname)
+}
+
+func (fsys fakeLinkFS) Link(oldname string, newname string) error {
+	return fsys.mem.Link(oldname, newname)
+}
+
+// writeLinksContainer writes a container with a file, a hard link
+// to it and a symbolic link to it.
+func writeLinksContainer(t *testing.T) string {
+	t.Helper()
+	path := testContainerPath(t)
+	writer, err := NewWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := Header{Name: "dir/file"}
+	err = writer.WriteFrom(&file, bytes.NewReader([]byte("contents")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteHardlink(&Header{Name: "dir/hardlink"}, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteSymlink(&Header{Name: "symlink"}, "dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractFSTarget(t *testing.T) {
+	reader, err := NewReader(writeLinksContainer(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	fsys := fakeLinkFS{fakeFS{NewMemTarget()}}
+	err = reader.ExtractAllTo(NewFSTarget(fsys))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"dir/file", "dir/hardlink"} {
+		entry, ok := fsys.mem.Entry(name)
+		if !ok || string(entry.Data) != "contents" {
+			t.Errorf("%s: got %+v", name, entry)
+		}
+	}
+	file, _ := fsys.mem.Entry("dir/file")
+	link, _ := fsys.mem.Entry("dir/hardlink")
+	if file != link {
+		t.Error("hard link extracted as a copy")
+	}
+	entry, ok := fsys.mem.Entry("symlink")
+	if !ok || entry.Link != "dir/file" {
+		t.Errorf("symlink: got %+v", entry)
+	}
+}
+
+func TestExtractFSTargetWithoutLinks(t *testing.T) {
+	reader, err := NewReader(writeLinksContainer(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	fsys := fakeFS{NewMemTarget()}
+	err = reader.ExtractAllTo(NewFSTarget(fsys))
+	if !errors.Is(err, ErrSymlinkUnsupported) {
+		t.Fatalf("got %v, want %v", err, ErrSymlinkUnsupported)
+	}
+
+	// The hard link, extracted before the symbolic link, is a copy.
+	file, _ := fsys.mem.Entry("dir/file")
+	link, ok := fsys.mem.Entry("dir/hardlink")
+	if !ok || string(link.Data) != "contents" || link == file {
+		t.Errorf("hard link: got %+v", link)
+	}
+}
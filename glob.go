@@ -0,0 +1,181 @@
+package arc
+
+import (
+	"path"
+	"strings"
+)
+
+// validateGlob reports [path.ErrBadPattern] if pattern is malformed.
+func validateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "**" {
+			continue
+		}
+		_, err := path.Match(segment, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether name matches pattern, as described by
+// [Reader.Glob]. pattern must be valid.
+func matchGlob(pattern string, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(name))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// MatchGlob reports whether name matches pattern, as matched by
+// [Reader.Glob], or [path.ErrBadPattern] if pattern is malformed.
+func MatchGlob(pattern string, name string) (bool, error) {
+	err := validateGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+	return matchGlob(pattern, name), nil
+}
+
+// matchSegments matches the slash-separated segments of a name against
+// those of a pattern, where "**" matches any number of segments.
+func matchSegments(patterns []string, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			patterns = patterns[1:]
+			if len(patterns) == 0 {
+				return true
+			}
+			for i := range len(names) + 1 {
+				if matchSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+		matched, _ := path.Match(patterns[0], names[0])
+		if !matched {
+			return false
+		}
+		patterns = patterns[1:]
+		names = names[1:]
+	}
+
+	return len(names) == 0
+}
+
+// globPrefix returns the literal prefix of the names matching pattern,
+// before its first special character, so it's filtered by the database.
+// Patterns without a slash match base names, so they have no prefix.
+func globPrefix(pattern string) string {
+	if !strings.Contains(pattern, "/") {
+		return ""
+	}
+
+	end := strings.IndexAny(pattern, `*?[\`)
+	if end < 0 {
+		return pattern
+	}
+	return pattern[:end]
+}
+
+// Glob returns the files whose names match pattern, by name. Patterns are
+// matched as by [path.Match], segment by segment, where a "**" segment
+// matches any number of segments, as "photos/2023/**". Patterns with no
+// slash match the base names of files in any directory, so "*.log" matches
+// all log files. [path.ErrBadPattern] is returned for malformed patterns.
+//
+// Encrypted files are only matched if their key is known.
+func (reader *Reader) Glob(pattern string) (files map[string]*Header, err error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+	err = validateGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := reader.Iterate(globPrefix(pattern))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := iterator.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	files = make(map[string]*Header)
+	for iterator.Next() {
+		header := iterator.Header()
+		if header.Encryption && !reader.canDecrypt(header.Id) {
+			continue
+		}
+		if matchGlob(pattern, header.Name) {
+			files[header.Name] = header
+		}
+	}
+
+	return files, iterator.Err()
+}
+
+// ExtractMatchingTo extracts the files of the container matching any of
+// the patterns include, or all files if include is empty, and none of the
+// patterns exclude, to target, as [Reader.ExtractAllTo]. Patterns are
+// matched as by [Reader.Glob].
+func (reader *Reader) ExtractMatchingTo(target ExtractTarget, include []string, exclude []string) error {
+	for _, patterns := range [][]string{include, exclude} {
+		for _, pattern := range patterns {
+			err := validateGlob(pattern)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+	// The symbolic links excluded may have been extracted before.
+	err = checkSymlinkParents(files)
+	if err != nil {
+		return err
+	}
+
+	for name := range files {
+		if !selectedByGlobs(name, include, exclude) {
+			delete(files, name)
+		}
+	}
+	return reader.extractFilesTo(target, files)
+}
+
+// selectedByGlobs reports whether name matches any of the patterns
+// include, or include is empty, and none of the patterns exclude.
+func selectedByGlobs(name string, include []string, exclude []string) bool {
+	included := len(include) == 0
+	for _, pattern := range include {
+		if matchGlob(pattern, name) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+
+	for _, pattern := range exclude {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package arc
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// probeSize is the number of bytes from the start of a file
+	// trial-compressed to detect whether it's compressible.
+	probeSize = 64 << 10
+
+	// minProbeSize is the size of the smallest sample probed, as
+	// smaller files compress poorly regardless of their contents.
+	minProbeSize = 4 << 10
+
+	// incompressibleRatio is the ratio of the compressed to the original
+	// size of the sample from which the file is deemed incompressible.
+	incompressibleRatio = 0.97
+)
+
+var (
+	probeEncoderOnce sync.Once
+	probeEncoder     *zstd.Encoder
+	probeEncoderErr  error
+)
+
+// SetIncompressibleDetection enables, or disables, detecting incompressible
+// files written afterwards, such as media or archives: the start of each
+// file to be compressed is trial-compressed, at the fastest level, and the
+// file is stored uncompressed if it barely shrinks, so archiving mixed
+// contents doesn't spend time compressing what can't be. The decision is
+// recorded as for any uncompressed file, so [Header.Compression] is read as
+// zero for them.
+func (writer *Writer) SetIncompressibleDetection(enabled bool) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+
+	writer.probe = enabled
+	return nil
+}
+
+// incompressible reports whether the contents starting with sample
+// are deemed incompressible.
+func incompressible(sample []byte) (bool, error) {
+	if len(sample) < minProbeSize {
+		return false, nil
+	}
+
+	probeEncoderOnce.Do(func() {
+		probeEncoder, probeEncoderErr = zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.SpeedFastest),
+			zstd.WithEncoderConcurrency(1),
+		)
+	})
+	if probeEncoderErr != nil {
+		return false, probeEncoderErr
+	}
+
+	compressed := probeEncoder.EncodeAll(sample, make([]byte, 0, len(sample)))
+	return float64(len(compressed)) >= incompressibleRatio*float64(len(sample)), nil
+}
+
+// probeCompression disables the compression of the file described by
+// header, starting with sample, if detected as incompressible.
+func (writer *Writer) probeCompression(header *Header, sample []byte) error {
+	if !writer.probe || header.Compression == 0 {
+		return nil
+	}
+
+	skip, err := incompressible(sample)
+	if skip {
+		header.Compression = 0
+	}
+	return err
+}
+
+// probeFile is like probeCompression, sampling the start of file.
+func (writer *Writer) probeFile(header *Header, file *os.File) error {
+	if !writer.probe || header.Compression == 0 {
+		return nil
+	}
+
+	sample := make([]byte, probeSize)
+	n, err := file.ReadAt(sample, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return writer.probeCompression(header, sample[:n])
+}
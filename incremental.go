@@ -0,0 +1,432 @@
+package arc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	queryBaseUUID = `SELECT uuid FROM base`
+
+	queryInsertBase = `INSERT INTO base VALUES (?)`
+
+	queryDeletedNames = `SELECT name FROM deleted ORDER BY name`
+
+	queryInsertDeleted = `INSERT INTO deleted VALUES (?)`
+)
+
+// ErrBaseMismatch is returned when layering a container
+// over a container other than the one it was based on.
+var ErrBaseMismatch = errors.New("container not based on the container below it")
+
+// baseLayer holds the files of the base container of an incremental
+// container, and the names of those written, or kept unchanged, since.
+type baseLayer struct {
+	mutex sync.Mutex
+	files map[string]*Header
+	seen  map[string]bool
+}
+
+// see records name as present in the container being written.
+func (base *baseLayer) see(name string) {
+	base.mutex.Lock()
+	base.seen[name] = true
+	base.mutex.Unlock()
+}
+
+// SetBase makes the container incremental over base, a previous container
+// of the same files: [Writer.Unchanged] reports the files unchanged since
+// base, which are then left out, and the files of base neither written nor
+// reported unchanged are recorded as deleted once the Writer is closed.
+// The container, along with base and its own base containers, if any, is
+// read back as one by [NewLayers].
+//
+// Only the files of base whose names it can decrypt are compared. The names
+// of the deleted files are stored in the clear, even if encrypted in base.
+// It requires [FeatureIncremental], and base must have [FeatureUUID].
+func (writer *Writer) SetBase(base *Reader) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if !writer.capabilities.Has(FeatureIncremental) {
+		return FeatureIncremental.missingError()
+	}
+
+	uuid, err := base.UUID()
+	if err != nil {
+		return err
+	}
+	files, err := base.Files()
+	if err != nil {
+		return err
+	}
+	for name, header := range files {
+		if header.Encryption && !base.canDecrypt(header.Id) {
+			delete(files, name)
+		}
+	}
+
+	_, writer.err = writer.db.Exec(queryInsertBase, uuid)
+	if writer.err != nil {
+		return writer.err
+	}
+	writer.base = &baseLayer{
+		files: files,
+		seen:  make(map[string]bool),
+	}
+	return nil
+}
+
+// Unchanged reports whether the file at path of the local filesystem,
+// described by header, is unchanged since the base container, so it needn't
+// be written. Files are unchanged when of the same type, permission bits and
+// size as in base, and either of the same modification time or, for files
+// whose checksum base stores, of the same contents. Either way, the file is
+// no longer recorded as deleted. See [Writer.SetBase].
+func (writer *Writer) Unchanged(header *Header, path string) (bool, error) {
+	if writer.base == nil {
+		return false, nil
+	}
+	writer.base.see(header.Name)
+
+	old, ok := writer.base.files[header.Name]
+	if !ok || old.Type != header.Type {
+		return false, nil
+	}
+	if header.Mode != 0 && old.Mode != 0 && header.Mode != old.Mode {
+		return false, nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	if header.Type != TypeDir && info.Size() != old.Size {
+		return false, nil
+	}
+	if header.ModTime.Unix() == old.ModTime.Unix() {
+		return true, nil
+	}
+	if header.Type != TypeFile || old.Checksum == nil {
+		return false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash.Sum(nil), old.Checksum), nil
+}
+
+// storeDeleted records the files of the base container
+// neither written nor kept unchanged as deleted.
+func (writer *Writer) storeDeleted() (err error) {
+	if writer.base == nil {
+		return nil
+	}
+
+	transaction, err := writer.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+	for name := range writer.base.files {
+		if writer.base.seen[name] {
+			continue
+		}
+		_, err = transaction.Exec(queryInsertDeleted, name)
+		if err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+// Base returns the UUID of the container the container is incremental
+// over, or the empty string if it's not incremental. See [Writer.SetBase].
+func (reader *Reader) Base() (string, error) {
+	if reader.checkError() {
+		return "", reader.err
+	}
+	if !reader.capabilities.Has(FeatureIncremental) {
+		return "", nil
+	}
+
+	var uuid string
+	err := reader.db.QueryRow(queryBaseUUID).Scan(&uuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return uuid, err
+}
+
+// Deleted returns the names of the files of the base container deleted
+// since, in sorted order, for incremental containers. See [Writer.SetBase].
+func (reader *Reader) Deleted() (names []string, err error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+	if !reader.capabilities.Has(FeatureIncremental) {
+		return nil, nil
+	}
+
+	rows, err := reader.db.Query(queryDeletedNames)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Changes are the differences between the files of two containers.
+type Changes struct {
+	// Added are the names of the files only in the newer container.
+	Added []string
+
+	// Modified are the names of the files in both containers,
+	// but changed in the newer one.
+	Modified []string
+
+	// Deleted are the names of the files only in the older container.
+	Deleted []string
+}
+
+// Diff compares the files of the containers read by base and target,
+// returning the changes from base to target, sorted by name. Files are
+// modified when their type, permission bits or size changed, or either
+// their checksums, when both are stored, or else their modification times
+// differ. Encrypted files are only compared when their names are known.
+func Diff(base *Reader, target *Reader) (*Changes, error) {
+	oldFiles, err := base.Files()
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := target.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := new(Changes)
+	for name, header := range newFiles {
+		if header.Encryption && !target.canDecrypt(header.Id) {
+			continue
+		}
+		old, ok := oldFiles[name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, name)
+		case modified(old, header):
+			changes.Modified = append(changes.Modified, name)
+		}
+	}
+	for name, header := range oldFiles {
+		if header.Encryption && !base.canDecrypt(header.Id) {
+			continue
+		}
+		if _, ok := newFiles[name]; !ok {
+			changes.Deleted = append(changes.Deleted, name)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	return changes, nil
+}
+
+// Compare compares the containers at the paths a and b, as [Diff], returning
+// the changes from a to b. The containers are opened with no password, so
+// only their unencrypted files are compared; encrypted containers are
+// compared by [Diff], with readers unlocked.
+func Compare(a string, b string) (changes *Changes, err error) {
+	base, err := NewReader(a, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := base.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	target, err := NewReader(b, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := target.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	return Diff(base, target)
+}
+
+// modified reports whether the file described by header
+// changed from the one described by old, as [Diff].
+func modified(old *Header, header *Header) bool {
+	if old.Type != header.Type || old.Size != header.Size {
+		return true
+	}
+	if old.Mode != 0 && header.Mode != 0 && old.Mode != header.Mode {
+		return true
+	}
+	if old.Checksum != nil && header.Checksum != nil {
+		return !bytes.Equal(old.Checksum, header.Checksum)
+	}
+	return !old.ModTime.Equal(header.ModTime)
+}
+
+// layerFile is a file of a layered container,
+// along with the reader of the container holding it.
+type layerFile struct {
+	reader *Reader
+	header *Header
+}
+
+// Layers reads a container along with the containers incremental over it
+// as one container, each file being read from the newest container holding
+// it, while the files deleted by an increment are left out.
+type Layers struct {
+	readers []*Reader
+}
+
+// NewLayers layers readers, the first reading the full container and each
+// of the rest a container incremental over the one before it, else
+// [ErrBaseMismatch] is returned. See [Writer.SetBase].
+func NewLayers(readers ...*Reader) (*Layers, error) {
+	for i := 1; i < len(readers); i++ {
+		base, err := readers[i].Base()
+		if err != nil {
+			return nil, err
+		}
+		uuid, err := readers[i-1].UUID()
+		if err != nil {
+			return nil, err
+		}
+		if base != uuid {
+			return nil, fmt.Errorf("%w: layer %d", ErrBaseMismatch, i)
+		}
+	}
+
+	return &Layers{readers: readers}, nil
+}
+
+// files returns the files of the layered container, by name.
+func (layers *Layers) files() (map[string]layerFile, error) {
+	files := make(map[string]layerFile)
+	for _, reader := range layers.readers {
+		deleted, err := reader.Deleted()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range deleted {
+			delete(files, name)
+		}
+
+		headers, err := reader.Files()
+		if err != nil {
+			return nil, err
+		}
+		for name, header := range headers {
+			files[name] = layerFile{reader: reader, header: header}
+		}
+	}
+	return files, nil
+}
+
+// Files returns the headers of the files of the layered container, by
+// name, each from the newest container holding the file, so its Id is only
+// meaningful to that container. See [Reader.Files].
+func (layers *Layers) Files() (map[string]*Header, error) {
+	files, err := layers.files()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]*Header, len(files))
+	for name, file := range files {
+		headers[name] = file.header
+	}
+	return headers, nil
+}
+
+// Open opens the file name of the layered container
+// for reading. See [Reader.OpenAt].
+func (layers *Layers) Open(name string) (*FileReader, error) {
+	files, err := layers.files()
+	if err != nil {
+		return nil, err
+	}
+
+	file, ok := files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrFileNotFound}
+	}
+	return file.reader.OpenAt(file.header.Id)
+}
+
+// ExtractAllTo extracts all files of the layered container
+// to target, as [Reader.ExtractAllTo].
+func (layers *Layers) ExtractAllTo(target ExtractTarget) error {
+	files, err := layers.files()
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]*Header, len(files))
+	for name, file := range files {
+		headers[name] = file.header
+	}
+	err = checkSymlinkParents(headers)
+	if err != nil {
+		return err
+	}
+	names := extractOrder(headers)
+	for _, name := range names {
+		file := files[name]
+		err = file.reader.extractFile(target, file.header, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return restoreDirs(target, headers, names)
+}
@@ -0,0 +1,204 @@
+package arc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testBaseTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// writeTestSources writes the files, by name, to dir, modified at modTime.
+func writeTestSources(t *testing.T, dir string, files map[string]string, modTime time.Time) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(contents), 0o600)
+		if err == nil {
+			err = os.Chtimes(path, modTime, modTime)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeTestIncrement writes the files of dir to a new container at path,
+// incremental over the container at basePath, if not empty, returning the
+// names written.
+func writeTestIncrement(t *testing.T, path string, basePath string, dir string) []string {
+	t.Helper()
+	writer, err := newTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if basePath != "" {
+		base, err := NewReader(basePath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer base.Close()
+		err = writer.SetBase(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := filepath.Join(dir, entry.Name())
+		header := &Header{Name: entry.Name(), ModTime: info.ModTime()}
+		unchanged, err := writer.Unchanged(header, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if unchanged {
+			continue
+		}
+		err = writer.WriteFile(header, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, entry.Name())
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return written
+}
+
+func TestIncremental(t *testing.T) {
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.arc")
+	sources := filepath.Join(dir, "sources")
+	err := os.Mkdir(sources, 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestSources(t, sources, map[string]string{
+		"kept":    "kept contents",
+		"touched": "touched contents",
+		"changed": "old contents",
+		"deleted": "deleted contents",
+	}, testBaseTime)
+	written := writeTestIncrement(t, basePath, "", sources)
+	if len(written) != 4 {
+		t.Fatalf("wrote %q to the base", written)
+	}
+
+	// Files of the same modification time, or else contents, are unchanged.
+	err = os.Remove(filepath.Join(sources, "deleted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestSources(t, sources, map[string]string{"touched": "touched contents"}, testBaseTime.Add(time.Hour))
+	writeTestSources(t, sources, map[string]string{"changed": "new contents", "added": "added contents"}, testBaseTime.Add(time.Hour))
+	path := filepath.Join(dir, "increment.arc")
+	written = writeTestIncrement(t, path, basePath, sources)
+	if !slices.Equal(written, []string{"added", "changed"}) {
+		t.Errorf("wrote %q, want [added changed]", written)
+	}
+
+	base, err := NewReader(basePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	increment, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer increment.Close()
+	uuid, err := base.UUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseUUID, err := increment.Base()
+	if err != nil || baseUUID != uuid {
+		t.Errorf("got base %q, %v, want %q", baseUUID, err, uuid)
+	}
+	deleted, err := increment.Deleted()
+	if err != nil || !slices.Equal(deleted, []string{"deleted"}) {
+		t.Errorf("got deleted %q, %v, want [deleted]", deleted, err)
+	}
+
+	_, err = NewLayers(increment, base)
+	if !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("reversed layers: got %v, want %v", err, ErrBaseMismatch)
+	}
+	layers, err := NewLayers(base, increment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"kept":    "kept contents",
+		"touched": "touched contents",
+		"changed": "new contents",
+		"added":   "added contents",
+	}
+	got := make(map[string]string)
+	files, err := layers.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		file, err := layers.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[name] = string(contents)
+	}
+	checkFiles(t, got, want)
+
+	target := NewMemTarget()
+	err = layers.ExtractAllTo(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := target.Names(); !slices.Equal(names, []string{"added", "changed", "kept", "touched"}) {
+		t.Errorf("extracted %q", names)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.arc")
+	b := filepath.Join(dir, "b.arc")
+	writeTestContainer(t, a, nil, Header{ModTime: testBaseTime}, map[string]string{
+		"kept":    "kept",
+		"changed": "old",
+		"deleted": "deleted",
+	})
+	writeTestContainer(t, b, nil, Header{ModTime: testBaseTime}, map[string]string{
+		"kept":    "kept",
+		"changed": "new",
+		"added":   "added",
+	})
+
+	changes, err := Compare(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changes.Added, []string{"added"}) || !slices.Equal(changes.Modified, []string{"changed"}) ||
+		!slices.Equal(changes.Deleted, []string{"deleted"}) {
+		t.Errorf("got changes %+v", changes)
+	}
+}
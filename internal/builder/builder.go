@@ -1,25 +1,64 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/bernardo1r/arc"
 	"github.com/klauspost/compress/zstd"
 )
 
+var (
+	errBuilderClosed = errors.New("builder already closed")
+	errStreamWorkers = errors.New("streams can't be inserted with workers")
+	errFSWorkers     = errors.New("fs.FS files can't be inserted with workers")
+	errNoReadLink    = errors.New("symbolic links of the fs.FS can't be read")
+)
+
 // Builder extend [Writer] providing an simpler
 // way to write files to a container.
 type Builder struct {
-	writer      *arc.Writer
-	blockSize   int
-	compression zstd.EncoderLevel
-	password    []byte
-	err         error
+	writer       *arc.Writer
+	blockSize    int
+	compression  zstd.EncoderLevel
+	codec        string
+	rules        []CompressionRule
+	password     []byte
+	pageEncrypt  bool
+	kdf          arc.KDFParams
+	convergent   bool
+	suite        arc.CipherSuite
+	dictionaries map[arc.ContentClass][]byte
+	trainPath    string
+	trainSize    int
+	append       bool
+	recursive    bool
+	prefix       string
+	workers      int
+	dedup        bool
+	sparse       bool
+	probe        bool
+	segmentSize  int
+	zstdOptions  *arc.ZstdOptions
+	sealMetadata bool
+	times        bool
+	volumeSize   int64
+	commitEvery  int
+	basePath     string
+	pragmas      *arc.Pragmas
+	progress     arc.ProgressFunc
+	metrics      arc.Metrics
+	conflict     arc.ConflictPolicy
+	parallel     *arc.ParallelWriter
+	links        map[fileKey]int
+	err          error
 }
 
 // BuilderOption is an option for creating an builder.
@@ -33,6 +72,31 @@ func WithCompressionLevel(level zstd.EncoderLevel) BuilderOption {
 	}
 }
 
+// WithCompressionRules selects the compression of the files matching
+// the rules, overriding the compression level and codec of the builder.
+// Each file is compressed as the first rule it matches, e.g. [MediaRules].
+func WithCompressionRules(rules ...CompressionRule) BuilderOption {
+	return func(builder *Builder) {
+		builder.rules = append(builder.rules, rules...)
+	}
+}
+
+// WithCodec specifies the name of the codec compressing
+// all files written in the container. See [arc.Codec].
+func WithCodec(name string) BuilderOption {
+	return func(builder *Builder) {
+		builder.codec = name
+	}
+}
+
+// WithBlocksize specifies the size, in bytes, of the blocks
+// the files written in the container are split into.
+func WithBlocksize(blocksize int) BuilderOption {
+	return func(builder *Builder) {
+		builder.blockSize = blocksize
+	}
+}
+
 // WithPassword will use password as the password for
 // all files written in the container
 func WithPassword(password []byte) BuilderOption {
@@ -41,6 +105,219 @@ func WithPassword(password []byte) BuilderOption {
 	}
 }
 
+// WithConvergentEncryption enables convergent encryption for
+// all files written in the container. See [arc.Header.Convergent]
+// for its tradeoffs.
+func WithConvergentEncryption() BuilderOption {
+	return func(builder *Builder) {
+		builder.convergent = true
+	}
+}
+
+// WithCipherSuite specifies the suite encrypting the contents of
+// the files of a new container. See [arc.CipherSuite].
+func WithCipherSuite(suite arc.CipherSuite) BuilderOption {
+	return func(builder *Builder) {
+		builder.suite = suite
+	}
+}
+
+// WithDictionary adds dict as the compression dictionary for the
+// files whose contents are detected as class. See [arc.Writer.AddDictionary].
+func WithDictionary(class arc.ContentClass, dict []byte) BuilderOption {
+	return func(builder *Builder) {
+		if builder.dictionaries == nil {
+			builder.dictionaries = make(map[arc.ContentClass][]byte)
+		}
+		builder.dictionaries[class] = dict
+	}
+}
+
+// WithAppend opens the existing container for adding
+// files, instead of creating a new one.
+func WithAppend() BuilderOption {
+	return func(builder *Builder) {
+		builder.append = true
+	}
+}
+
+// WithRecursive makes [Builder.InsertDir] insert the subdirectories,
+// naming the files by their path relative to the inserted folder.
+func WithRecursive() BuilderOption {
+	return func(builder *Builder) {
+		builder.recursive = true
+	}
+}
+
+// WithPathPrefix stores the inserted files under the directory prefix,
+// as "prefix/name", so files from several folders can be kept apart.
+func WithPathPrefix(prefix string) BuilderOption {
+	return func(builder *Builder) {
+		builder.prefix = filepath.ToSlash(prefix)
+	}
+}
+
+// WithWorkers writes the files with n workers concurrently, through an
+// [arc.ParallelWriter]. Files are then inserted in no particular order,
+// and streams can't be inserted.
+func WithWorkers(n int) BuilderOption {
+	return func(builder *Builder) {
+		builder.workers = n
+	}
+}
+
+// WithVolumeSize splits the container into volumes of size bytes
+// once closed. See [arc.Writer.SetVolumeSize].
+func WithVolumeSize(size int64) BuilderOption {
+	return func(builder *Builder) {
+		builder.volumeSize = size
+	}
+}
+
+// WithCommitEvery commits the files written in transactions of n files.
+// See [arc.Writer.SetCommitEvery].
+func WithCommitEvery(n int) BuilderOption {
+	return func(builder *Builder) {
+		builder.commitEvery = n
+	}
+}
+
+// WithBaseContainer makes the container incremental over the container at
+// path, opened with the builder's password, if encrypted, so only the files
+// changed since are inserted. See [arc.Writer.SetBase].
+func WithBaseContainer(path string) BuilderOption {
+	return func(builder *Builder) {
+		builder.basePath = path
+	}
+}
+
+// WithSparse stores the blocks of zeros of the files as holes.
+// See [arc.Writer.SetSparse].
+func WithSparse() BuilderOption {
+	return func(builder *Builder) {
+		builder.sparse = true
+	}
+}
+
+// WithIncompressibleDetection stores the files detected as incompressible
+// uncompressed. See [arc.Writer.SetIncompressibleDetection].
+func WithIncompressibleDetection() BuilderOption {
+	return func(builder *Builder) {
+		builder.probe = true
+	}
+}
+
+// WithSegmentSize compresses the files in segments of size bytes,
+// concurrently. See [arc.Writer.SetSegmentSize].
+func WithSegmentSize(size int) BuilderOption {
+	return func(builder *Builder) {
+		builder.segmentSize = size
+	}
+}
+
+// WithZstdOptions tunes the zstd encoder of the files with options.
+// See [arc.Writer.SetZstdOptions].
+func WithZstdOptions(options arc.ZstdOptions) BuilderOption {
+	return func(builder *Builder) {
+		builder.zstdOptions = &options
+	}
+}
+
+// WithMetadataEncryption encrypts the size, modification time and
+// attributes of the encrypted files. See [arc.Writer.SetMetadataEncryption].
+func WithMetadataEncryption() BuilderOption {
+	return func(builder *Builder) {
+		builder.sealMetadata = true
+	}
+}
+
+// WithTimestamps records the access, change and birth times of the
+// files, when known, besides their modification time. See
+// [arc.Header.AccessTime].
+func WithTimestamps() BuilderOption {
+	return func(builder *Builder) {
+		builder.times = true
+	}
+}
+
+// WithKDFParams sets the cost of deriving the container key from the
+// password. See [arc.KDFParams].
+func WithKDFParams(params arc.KDFParams) BuilderOption {
+	return func(builder *Builder) {
+		builder.kdf = params
+	}
+}
+
+// WithPragmas tunes the sqlite database of the container,
+// e.g. with [arc.FastWrite]. See [arc.Pragmas].
+func WithPragmas(pragmas arc.Pragmas) BuilderOption {
+	return func(builder *Builder) {
+		builder.pragmas = &pragmas
+	}
+}
+
+// WithDeduplication stores identical data blocks once.
+// See [arc.Writer.SetDeduplication].
+func WithDeduplication() BuilderOption {
+	return func(builder *Builder) {
+		builder.dedup = true
+	}
+}
+
+// WithProgress reports the progress of writing each file to progress.
+// The files found walking a directory are reported first with nothing
+// written, once found, as to list them. See [arc.Writer.SetProgress].
+func WithProgress(progress arc.ProgressFunc) BuilderOption {
+	return func(builder *Builder) {
+		builder.progress = progress
+	}
+}
+
+// WithMetrics instruments writing the files with metrics.
+// See [arc.Writer.SetMetrics].
+func WithMetrics(metrics arc.Metrics) BuilderOption {
+	return func(builder *Builder) {
+		builder.metrics = metrics
+	}
+}
+
+// WithConflictPolicy selects what inserting a file does when its
+// name is already in the container, e.g. when appending files.
+// See [arc.ConflictPolicy].
+func WithConflictPolicy(policy arc.ConflictPolicy) BuilderOption {
+	return func(builder *Builder) {
+		builder.conflict = policy
+	}
+}
+
+// WithConfig applies the blocksize, compression level, codec, workers,
+// volume size, files per commit and, when encryption is enabled, the
+// password, key derivation params, cipher suite and page encryption of
+// config, along with its pragmas, to the builder.
+func WithConfig(config *arc.Config) BuilderOption {
+	return func(builder *Builder) {
+		if config.Blocksize != 0 {
+			builder.blockSize = config.Blocksize
+		}
+		builder.workers = config.Workers
+		builder.volumeSize = config.VolumeSize
+		builder.commitEvery = config.CommitEvery
+		builder.compression = config.Compression
+		builder.codec = config.Codec
+		builder.convergent = config.Convergent
+		builder.suite = config.CipherSuite
+		builder.pragmas = config.Pragmas
+		builder.password = nil
+		builder.pageEncrypt = false
+		builder.kdf = arc.KDFParams{}
+		if config.Encryption {
+			builder.password = config.Password
+			builder.pageEncrypt = config.PageEncryption
+			builder.kdf = config.KDF
+		}
+	}
+}
+
 // NewBuilder creates a new Builder and a container with name databasePath
 // and the provided options.
 func NewBuilder(databasePath string, options ...BuilderOption) (*Builder, error) {
@@ -49,27 +326,290 @@ func NewBuilder(databasePath string, options ...BuilderOption) (*Builder, error)
 	for _, option := range options {
 		option(builder)
 	}
+	err := builder.checkRules()
+	if err != nil {
+		return builder, err
+	}
+
+	config := &arc.Config{
+		Blocksize:   builder.blockSize,
+		Encryption:  builder.password != nil,
+		CipherSuite: builder.suite,
+		Pragmas:     builder.pragmas,
+		Password:    builder.password,
+		KDF:         builder.kdf,
+
+		PageEncryption: builder.pageEncrypt,
+	}
+	if builder.append {
+		builder.writer, err = arc.OpenWriterConfig(databasePath, config)
+	} else {
+		builder.writer, err = arc.NewWriterConfig(databasePath, config)
+	}
+	if err != nil {
+		return builder, err
+	}
 
-	var err error
-	builder.writer, err = arc.NewWriter(databasePath, arc.DefaultBlocksize, builder.password)
-	return builder, err
+	builder.writer.SetProgress(builder.progress)
+	builder.writer.SetMetrics(builder.metrics)
+	if builder.volumeSize > 0 {
+		err = builder.writer.SetVolumeSize(builder.volumeSize)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.commitEvery > 0 {
+		err = builder.writer.SetCommitEvery(builder.commitEvery)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.dedup {
+		err = builder.writer.SetDeduplication(true)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.sparse {
+		err = builder.writer.SetSparse(true)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.probe {
+		err = builder.writer.SetIncompressibleDetection(true)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.segmentSize > 0 {
+		err = builder.writer.SetSegmentSize(builder.segmentSize)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.zstdOptions != nil {
+		err = builder.writer.SetZstdOptions(*builder.zstdOptions)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.sealMetadata {
+		err = builder.writer.SetMetadataEncryption(true)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.basePath != "" {
+		err = builder.setBase()
+		if err != nil {
+			return builder, err
+		}
+	}
+	for class, dict := range builder.dictionaries {
+		err = builder.writer.AddDictionary(class, dict)
+		if err != nil {
+			return builder, err
+		}
+	}
+	if builder.trainPath != "" {
+		dict, err := builder.trainDictionary()
+		if err != nil {
+			return builder, err
+		}
+		err = builder.writer.AddDictionary(arc.ContentAny, dict)
+		if err != nil && !errors.Is(err, arc.ErrDictionaryExists) {
+			return builder, err
+		}
+	}
+	if builder.workers > 0 {
+		builder.parallel = arc.NewParallelWriter(builder.writer, builder.workers)
+	} else {
+		builder.links = make(map[fileKey]int)
+	}
+	return builder, nil
+}
+
+// setBase opens the base container and sets it as the writer's base.
+func (builder *Builder) setBase() error {
+	base, err := arc.NewReader(builder.basePath, builder.password)
+	if errors.Is(err, arc.ErrNotEncrypted) {
+		base.Close()
+		base, err = arc.NewReader(builder.basePath, nil)
+	}
+	if err != nil {
+		return err
+	}
+	err = builder.writer.SetBase(base)
+	err2 := base.Close()
+	if err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
+
+// unchanged reports whether the file path, inserted as described by
+// header, is unchanged since the base container, so it's skipped.
+func (builder Builder) unchanged(header *arc.Header, path string) (bool, error) {
+	if builder.basePath == "" || path == "" {
+		return false, nil
+	}
+	return builder.writer.Unchanged(header, path)
 }
 
-// InsertFile inserts the path file in the container, using
-// the builder's configuration.
+// InsertFile inserts the path file in the container, named by its base
+// name, using the builder's configuration.
 func (builder Builder) InsertFile(path string) error {
-	return builder.writer.WriteFile(
+	return builder.InsertFileAs(path, filepath.Base(path))
+}
+
+// InsertFileAs inserts the path file in the container as the file name,
+// a slash-separated path within the container, so files with the same
+// base name can be told apart, using the builder's configuration.
+func (builder Builder) InsertFileAs(path string, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return builder.insertFile(context.Background(), path, name, info)
+}
+
+// archiveName returns the name the file name is stored as,
+// under the path prefix of the builder, if any.
+func (builder Builder) archiveName(name string) string {
+	if builder.prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(builder.prefix, "/") + "/" + name
+}
+
+// header returns the header of the file name, described by info,
+// using the builder's configuration.
+func (builder Builder) header(name string, info fs.FileInfo) *arc.Header {
+	uid, gid := fileOwner(info)
+	header := &arc.Header{
+		Name:        builder.archiveName(name),
+		ModTime:     info.ModTime().UTC(),
+		Compression: builder.compression,
+		Codec:       builder.codec,
+		Encryption:  builder.password != nil,
+		Convergent:  builder.convergent,
+		Mode:        info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky),
+		Uid:         uid,
+		Gid:         gid,
+		Conflict:    builder.conflict,
+	}
+	if builder.times {
+		header.AccessTime, header.ChangeTime, header.BirthTime = fileTimes(info)
+	}
+	return builder.applyRules(header)
+}
+
+func (builder Builder) insertFile(ctx context.Context, path string, name string, info fs.FileInfo) error {
+	header := builder.header(name, info)
+	unchanged, err := builder.unchanged(header, path)
+	if err != nil || unchanged {
+		return err
+	}
+	if builder.parallel != nil {
+		return builder.parallel.WriteFile(header, path)
+	}
+
+	// Hard links to a file already inserted are stored once, when the
+	// container supports them. The ids of files aren't known to workers.
+	key, linked := fileLink(info)
+	if target, ok := builder.links[key]; linked && ok {
+		err = builder.writer.WriteHardlink(header, target)
+		if !errors.Is(err, arc.ErrMissingFeature) {
+			return err
+		}
+	}
+	err = builder.writer.WriteFileContext(ctx, header, path)
+	if err == nil && linked && builder.links != nil {
+		builder.links[key] = header.Id
+	}
+	return err
+}
+
+// InsertReader inserts the contents of src in the container as the
+// file name, using the builder's configuration. See [arc.Writer.WriteFrom].
+func (builder Builder) InsertReader(name string, src io.Reader) error {
+	if builder.parallel != nil {
+		return errStreamWorkers
+	}
+	return builder.writer.WriteFrom(
+		builder.applyRules(&arc.Header{
+			Name:        builder.archiveName(name),
+			Compression: builder.compression,
+			Codec:       builder.codec,
+			Encryption:  builder.password != nil,
+			Conflict:    builder.conflict,
+		}),
+		src,
+	)
+}
+
+// InsertStream inserts the contents of src in the container under
+// [arc.StreamNamespace], using the builder's configuration, and
+// returns the generated name.
+func (builder Builder) InsertStream(src io.Reader) (string, error) {
+	if builder.parallel != nil {
+		return "", errStreamWorkers
+	}
+	return builder.writer.WriteStream(
 		&arc.Header{
-			Name:        filepath.Base(path),
 			Compression: builder.compression,
+			Codec:       builder.codec,
 			Encryption:  builder.password != nil,
+			Convergent:  builder.convergent,
 		},
-		path,
+		src,
+		arc.StreamNamespace,
 	)
 }
 
-func (builder Builder) walkDir(folderPath string) fs.WalkDirFunc {
+// readLinkFS is a filesystem able to read its symbolic links,
+// as [os.DirFS] since Go 1.25.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// walkSource is a tree of files inserted by the builder, either a
+// folder of the local filesystem or any [fs.FS].
+type walkSource struct {
+	fsys fs.FS
+
+	// folderPath is the local folder fsys is rooted at,
+	// or empty when fsys isn't the local filesystem.
+	folderPath string
+}
+
+// localPath returns the path of the file path of source in the
+// local filesystem, or the empty string if source isn't local.
+func (source walkSource) localPath(path string) string {
+	if source.folderPath == "" {
+		return ""
+	}
+	return source.folderPath + "/" + path
+}
+
+// readLink returns the target of the symbolic link path of source.
+func (source walkSource) readLink(path string) (string, error) {
+	if source.folderPath != "" {
+		return os.Readlink(source.localPath(path))
+	}
+	linkFS, ok := source.fsys.(readLinkFS)
+	if !ok {
+		return "", errNoReadLink
+	}
+	return linkFS.ReadLink(path)
+}
+
+func (builder Builder) walkDir(ctx context.Context, source walkSource) fs.WalkDirFunc {
 	return func(path string, dir fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if path == "." {
 			return nil
 		}
@@ -77,35 +617,183 @@ func (builder Builder) walkDir(folderPath string) fs.WalkDirFunc {
 			log.Printf("not adding %s: %v\n", path, err)
 			return nil
 		}
+		filePath := source.localPath(path)
 		if dir.IsDir() {
-			return filepath.SkipDir
+			if !builder.recursive {
+				return filepath.SkipDir
+			}
+			return builder.insertDirEntry(dir, filePath, path)
+		}
+
+		info, err := dir.Info()
+		if err != nil {
+			return err
+		}
+		builder.reportFound(path, info)
+		if dir.Type()&fs.ModeSymlink != 0 {
+			return builder.insertSymlink(source, path, info)
 		}
+		if filePath == "" {
+			return builder.insertFSFile(ctx, source.fsys, path, info)
+		}
+		return builder.insertFile(ctx, filePath, path, info)
+	}
+}
+
+// reportFound reports the file name, found walking a directory, to the
+// progress of the builder before inserting it, with nothing written yet.
+func (builder Builder) reportFound(name string, info fs.FileInfo) {
+	if builder.progress != nil {
+		builder.progress(builder.archiveName(name), 0, info.Size())
+	}
+}
+
+// insertSymlink inserts the symbolic link name of source,
+// instead of the file it points to.
+func (builder Builder) insertSymlink(source walkSource, name string, info fs.FileInfo) error {
+	linkTarget, err := source.readLink(name)
+	if errors.Is(err, errNoReadLink) {
+		log.Printf("not adding %s: %v\n", name, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-		filePath := folderPath + "/" + path
-		fmt.Println(filePath)
-		return builder.InsertFile(filePath)
+	header := builder.header(name, info)
+	header.Type = arc.TypeSymlink
+	unchanged, err := builder.unchanged(header, source.localPath(name))
+	if err != nil || unchanged {
+		return err
 	}
+	if builder.parallel != nil {
+		return builder.parallel.WriteSymlink(header, linkTarget)
+	}
+	return builder.writer.WriteSymlink(header, linkTarget)
+}
+
+// insertFSFile inserts the file name of fsys, described by info.
+func (builder Builder) insertFSFile(ctx context.Context, fsys fs.FS, name string, info fs.FileInfo) (err error) {
+	if builder.parallel != nil {
+		return errFSWorkers
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := file.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	header := builder.header(name, info)
+	return builder.writer.WriteFromContext(ctx, header, file)
 }
 
-// InsertDir inserts all files from folderPath, ignoring subdirectories.
+func (builder Builder) insertDirEntry(dir fs.DirEntry, path string, name string) error {
+	info, err := dir.Info()
+	if err != nil {
+		return err
+	}
+
+	header := builder.header(name, info)
+	header.Type = arc.TypeDir
+	unchanged, err := builder.unchanged(header, path)
+	if err != nil || unchanged {
+		return err
+	}
+	if builder.parallel != nil {
+		return builder.parallel.WriteDir(header)
+	}
+	return builder.writer.WriteDir(header)
+}
+
+// InsertDir inserts all files from folderPath, ignoring subdirectories
+// unless [WithRecursive] is given.
 func (builder Builder) InsertDir(folderPath string) error {
+	return builder.InsertDirContext(context.Background(), folderPath)
+}
+
+// InsertDirContext is like [Builder.InsertDir], but stops inserting files
+// once ctx is done, discarding the file being inserted. The files already
+// inserted are kept.
+func (builder Builder) InsertDirContext(ctx context.Context, folderPath string) error {
 	if builder.err != nil {
 		return builder.err
 	}
 
-	rootFs := os.DirFS(folderPath)
-	err := fs.WalkDir(rootFs, ".", builder.walkDir(folderPath))
+	source := walkSource{fsys: os.DirFS(folderPath), folderPath: folderPath}
+	err := fs.WalkDir(source.fsys, ".", builder.walkDir(ctx, source))
 	if err != nil {
 		return fmt.Errorf("walking dir %s: %w", folderPath, err)
 	}
 	return nil
 }
 
-func (builder *Builder) Close() error {
+// InsertFS inserts all files from the directory root of fsys, as
+// [Builder.InsertDir] does for folders of the local filesystem, so embedded
+// filesystems, zip archives and other [fs.FS] are inserted directly. The
+// files are named by their path relative to root. Symbolic links are only
+// inserted from filesystems with a ReadLink method, as [os.DirFS], nor are
+// the files compared with the base container, and workers aren't supported.
+func (builder Builder) InsertFS(fsys fs.FS, root string) error {
+	return builder.InsertFSContext(context.Background(), fsys, root)
+}
+
+// InsertFSContext is like [Builder.InsertFS], but stops inserting files
+// once ctx is done, as [Builder.InsertDirContext].
+func (builder Builder) InsertFSContext(ctx context.Context, fsys fs.FS, root string) error {
 	if builder.err != nil {
 		return builder.err
 	}
 
-	builder.err = errors.New("builder already closed")
+	if root != "." {
+		sub, err := fs.Sub(fsys, root)
+		if err != nil {
+			return err
+		}
+		fsys = sub
+	}
+	err := fs.WalkDir(fsys, ".", builder.walkDir(ctx, walkSource{fsys: fsys}))
+	if err != nil {
+		return fmt.Errorf("walking dir %s: %w", root, err)
+	}
 	return nil
 }
+
+// Close closes the builder and its container.
+func (builder *Builder) Close() error {
+	if builder.err != nil {
+		return builder.err
+	}
+
+	builder.err = errBuilderClosed
+	if builder.parallel != nil {
+		return builder.parallel.Close()
+	}
+	return builder.writer.Close()
+}
+
+// CloseAsync closes the builder and its container in the background.
+// See [arc.Writer.CloseAsync].
+func (builder *Builder) CloseAsync(ctx context.Context, progress func(arc.FinalizeStep)) <-chan error {
+	if builder.err != nil {
+		done := make(chan error, 1)
+		done <- builder.err
+		close(done)
+		return done
+	}
+
+	builder.err = errBuilderClosed
+	if builder.parallel != nil {
+		done := make(chan error, 1)
+		go func() {
+			done <- builder.parallel.Close()
+			close(done)
+		}()
+		return done
+	}
+	return builder.writer.CloseAsync(ctx, progress)
+}
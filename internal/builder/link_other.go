@@ -0,0 +1,13 @@
+//go:build !unix
+
+package builder
+
+import "io/fs"
+
+// fileKey identifies a file of the local filesystem, shared by its hard links.
+type fileKey struct{}
+
+// fileLink reports no hard links, as files have no inode on this platform.
+func fileLink(info fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
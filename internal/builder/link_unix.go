@@ -0,0 +1,24 @@
+//go:build unix
+
+package builder
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileKey identifies a file of the local filesystem, shared by its hard links.
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// fileLink returns the key of the file described by info,
+// and whether it has hard links besides itself.
+func fileLink(info fs.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
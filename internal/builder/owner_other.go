@@ -0,0 +1,10 @@
+//go:build !unix
+
+package builder
+
+import "io/fs"
+
+// fileOwner returns nil ids, as files have no numeric owner on this platform.
+func fileOwner(info fs.FileInfo) (uid *int, gid *int) {
+	return nil, nil
+}
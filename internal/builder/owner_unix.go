@@ -0,0 +1,19 @@
+//go:build unix
+
+package builder
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner returns the owner user and group ids of the file described by info.
+func fileOwner(info fs.FileInfo) (uid *int, gid *int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, nil
+	}
+
+	uidValue, gidValue := int(stat.Uid), int(stat.Gid)
+	return &uidValue, &gidValue
+}
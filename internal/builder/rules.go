@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bernardo1r/arc"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionRule selects the compression of the files whose names match
+// Pattern. Patterns starting with a dot and holding no special characters,
+// as ".jpg", match the extension of names regardless of case, while the
+// rest are matched as by [arc.MatchGlob], so "*.txt" matches text files in
+// any directory and "logs/**" all files under logs.
+type CompressionRule struct {
+	Pattern string
+
+	// Level is the compression level of the matched files,
+	// where zero stores them uncompressed.
+	Level zstd.EncoderLevel
+
+	// Codec is the codec compressing the matched files,
+	// or the builder's codec if empty. See [arc.Codec].
+	Codec string
+}
+
+// MediaRules store the files of the common formats
+// already compressed, as media and archives, uncompressed.
+var MediaRules = []CompressionRule{
+	{Pattern: ".jpg"}, {Pattern: ".jpeg"}, {Pattern: ".png"}, {Pattern: ".gif"},
+	{Pattern: ".webp"}, {Pattern: ".heic"}, {Pattern: ".mp3"}, {Pattern: ".ogg"},
+	{Pattern: ".flac"}, {Pattern: ".mp4"}, {Pattern: ".mkv"}, {Pattern: ".mov"},
+	{Pattern: ".webm"}, {Pattern: ".zip"}, {Pattern: ".gz"}, {Pattern: ".zst"},
+	{Pattern: ".xz"}, {Pattern: ".bz2"}, {Pattern: ".7z"}, {Pattern: ".rar"},
+}
+
+// isExtension reports whether pattern matches an extension.
+func isExtension(pattern string) bool {
+	return strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, `*?[\/`)
+}
+
+// match reports whether the rule applies to the file name.
+func (rule CompressionRule) match(name string) (bool, error) {
+	if isExtension(rule.Pattern) {
+		return strings.EqualFold(path.Ext(name), rule.Pattern), nil
+	}
+	return arc.MatchGlob(rule.Pattern, name)
+}
+
+// checkRules reports the first malformed pattern of the builder's rules.
+func (builder Builder) checkRules() error {
+	for _, rule := range builder.rules {
+		_, err := rule.match("")
+		if err != nil {
+			return fmt.Errorf("compression rule %q: %w", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// applyRules sets the compression of header from the first
+// of the builder's rules matching its name, if any.
+func (builder Builder) applyRules(header *arc.Header) *arc.Header {
+	for _, rule := range builder.rules {
+		matched, _ := rule.match(header.Name)
+		if !matched {
+			continue
+		}
+
+		header.Compression = rule.Level
+		if rule.Codec != "" {
+			header.Codec = rule.Codec
+		}
+		break
+	}
+	return header
+}
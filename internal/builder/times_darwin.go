@@ -0,0 +1,21 @@
+//go:build darwin
+
+package builder
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns the access, change and birth times of the
+// file described by info, zero when unknown.
+func fileTimes(info fs.FileInfo) (atime time.Time, ctime time.Time, btime time.Time) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return atime, ctime, btime
+	}
+	return time.Unix(stat.Atimespec.Unix()).UTC(),
+		time.Unix(stat.Ctimespec.Unix()).UTC(),
+		time.Unix(stat.Birthtimespec.Unix()).UTC()
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package builder
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns the access, change and birth times of the file
+// described by info, zero when unknown, as the birth time on Linux.
+func fileTimes(info fs.FileInfo) (atime time.Time, ctime time.Time, btime time.Time) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return atime, ctime, btime
+	}
+	return time.Unix(stat.Atim.Unix()).UTC(), time.Unix(stat.Ctim.Unix()).UTC(), btime
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package builder
+
+import (
+	"io/fs"
+	"time"
+)
+
+// fileTimes returns zero times, as they aren't read on this platform.
+func fileTimes(info fs.FileInfo) (atime time.Time, ctime time.Time, btime time.Time) {
+	return atime, ctime, btime
+}
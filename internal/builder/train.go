@@ -0,0 +1,92 @@
+package builder
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/bernardo1r/arc"
+)
+
+const (
+	// maxSamples is the number of files sampled for training a dictionary.
+	maxSamples = 2000
+
+	// maxSampleSize is the size of the start of each file sampled.
+	maxSampleSize = 64 << 10
+
+	// maxSamplesSize is the total size of the samples.
+	maxSamplesSize = 32 << 20
+)
+
+// WithTrainedDictionary trains a zstd dictionary of up to size bytes, or
+// [arc.DefaultDictionarySize] if 0, over the files of folderPath, and
+// compresses all files with it, as the dictionary of [arc.ContentAny].
+// Only the files in the root of folderPath are sampled, unless
+// [WithRecursive] is given too. See [arc.TrainDictionary]. When appending
+// to a container which already has a dictionary for [arc.ContentAny], the
+// stored one is kept, as the files already added were compressed with it.
+func WithTrainedDictionary(folderPath string, size int) BuilderOption {
+	return func(builder *Builder) {
+		builder.trainPath = folderPath
+		builder.trainSize = size
+	}
+}
+
+// trainDictionary trains the dictionary over the start
+// of the regular files of the training folder.
+func (builder *Builder) trainDictionary() ([]byte, error) {
+	var samples [][]byte
+	total := 0
+	fsys := os.DirFS(builder.trainPath)
+	err := fs.WalkDir(fsys, ".", func(path string, dir fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dir.IsDir() {
+			if path != "." && !builder.recursive {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !dir.Type().IsRegular() {
+			return nil
+		}
+
+		sample, err := readSample(fsys, path)
+		if err != nil {
+			return err
+		}
+		if len(sample) == 0 {
+			return nil
+		}
+		samples = append(samples, sample)
+		total += len(sample)
+		if len(samples) >= maxSamples || total >= maxSamplesSize {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return arc.TrainDictionary(samples, builder.trainSize)
+}
+
+// readSample reads the start of the file path of fsys.
+func readSample(fsys fs.FS, path string) ([]byte, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sample := make([]byte, maxSampleSize)
+	n, err := io.ReadFull(file, sample)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return sample[:n], err
+}
@@ -0,0 +1,19 @@
+// Package fuse serves a read-only [fs.FS] as a FUSE filesystem, through
+// github.com/hanwen/go-fuse. Only Linux is supported.
+package fuse
+
+import (
+	"errors"
+	"path"
+)
+
+// ErrUnsupported is returned when mounting on systems without FUSE support.
+var ErrUnsupported = errors.New("fuse: mounting not supported on this system")
+
+// child returns the path of the entry name of the directory dir.
+func child(dir string, name string) string {
+	if dir == "." {
+		return name
+	}
+	return path.Join(dir, name)
+}
@@ -0,0 +1,260 @@
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	gofuse "github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// validity is how long the kernel caches entries and attributes.
+const validity = time.Minute
+
+// Server serves the filesystem mounted by [Mount]
+// until it's unmounted.
+type Server struct {
+	server *gofuse.Server
+}
+
+// Mount mounts fsys read-only at the directory dir. Mounting needs root,
+// or else the fusermount3, or fusermount, helper of the FUSE package.
+// The filesystem is only served once [Server.Serve] is called.
+func Mount(dir string, fsys fs.FS) (*Server, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "mount", Path: dir, Err: syscall.ENOTDIR}
+	}
+
+	options := mountOptions()
+	rawFS := gofs.NewNodeFS(newNode(fsys, "."), options)
+	server, err := gofuse.NewServer(rawFS, dir, &options.MountOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{server: server}, nil
+}
+
+// mountOptions returns the options of the filesystems mounted, with
+// the mount system call when allowed to, or else with fusermount.
+func mountOptions() *gofs.Options {
+	timeout := validity
+	return &gofs.Options{
+		MountOptions: gofuse.MountOptions{
+			FsName:      "arc",
+			Name:        "arc",
+			Options:     []string{"ro", "nosuid", "nodev", "default_permissions"},
+			DirectMount: os.Geteuid() == 0,
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+		UID:          uint32(os.Getuid()),
+		GID:          uint32(os.Getgid()),
+	}
+}
+
+// Unmount unmounts the filesystem, ending [Server.Serve].
+func (server *Server) Unmount() error {
+	return server.server.Unmount()
+}
+
+// Serve answers the requests of the kernel, concurrently, until the
+// filesystem is unmounted.
+func (server *Server) Serve() error {
+	server.server.Serve()
+	return nil
+}
+
+// node is the file, or directory, name of the filesystem. Nodes are
+// created as the kernel looks them up, and dropped once it forgets them.
+type node struct {
+	gofs.Inode
+	fsys fs.FS
+	name string
+}
+
+var (
+	_ gofs.NodeLookuper   = (*node)(nil)
+	_ gofs.NodeGetattrer  = (*node)(nil)
+	_ gofs.NodeReadlinker = (*node)(nil)
+	_ gofs.NodeOpener     = (*node)(nil)
+	_ gofs.NodeReaddirer  = (*node)(nil)
+	_ gofs.NodeStatfser   = (*node)(nil)
+)
+
+func newNode(fsys fs.FS, name string) *node {
+	return &node{fsys: fsys, name: name}
+}
+
+// errno returns the error number of err.
+func errno(err error) syscall.Errno {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	default:
+		return syscall.EIO
+	}
+}
+
+// fileMode returns the type and permission bits of the file described
+// by mode, as stat(2) reports them.
+func fileMode(mode fs.FileMode) uint32 {
+	switch {
+	case mode.IsDir():
+		return syscall.S_IFDIR | uint32(mode.Perm())
+	case mode&fs.ModeSymlink != 0:
+		return syscall.S_IFLNK | uint32(mode.Perm())
+	default:
+		return syscall.S_IFREG | uint32(mode.Perm())
+	}
+}
+
+// setAttr sets the attributes described by info.
+func setAttr(attr *gofuse.Attr, info fs.FileInfo) {
+	size := uint64(max(info.Size(), 0))
+	modTime := info.ModTime()
+	if modTime.IsZero() {
+		modTime = time.Unix(0, 0)
+	}
+
+	attr.Mode = fileMode(info.Mode())
+	attr.Nlink = 1
+	if info.IsDir() {
+		attr.Nlink = 2
+	}
+	attr.Size = size
+	attr.Blocks = (size + 511) / 512
+	attr.Blksize = 4096
+	attr.SetTimes(&modTime, &modTime, &modTime)
+}
+
+func (node *node) Lookup(ctx context.Context, name string, out *gofuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	path := child(node.name, name)
+	info, err := fs.Stat(node.fsys, path)
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	setAttr(&out.Attr, info)
+	stable := gofs.StableAttr{Mode: fileMode(info.Mode()) & syscall.S_IFMT}
+	// Nodes looked up again are reused, so the kernel
+	// sees them as the same file until it forgets them.
+	existing := node.GetChild(name)
+	if existing != nil && existing.StableAttr().Mode == stable.Mode {
+		return existing, 0
+	}
+	return node.NewInode(ctx, newNode(node.fsys, path), stable), 0
+}
+
+func (node *node) Getattr(ctx context.Context, handle gofs.FileHandle, out *gofuse.AttrOut) syscall.Errno {
+	info, err := fs.Stat(node.fsys, node.name)
+	if err != nil {
+		return errno(err)
+	}
+	setAttr(&out.Attr, info)
+	return 0
+}
+
+func (node *node) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	info, err := fs.Stat(node.fsys, node.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return nil, syscall.EINVAL
+	}
+
+	target, err := fs.ReadFile(node.fsys, node.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	return target, 0
+}
+
+func (node *node) Open(ctx context.Context, flags uint32) (gofs.FileHandle, uint32, syscall.Errno) {
+	file, err := node.fsys.Open(node.name)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	// The files never change, so the kernel keeps
+	// their cached pages when opened again.
+	return &fileHandle{file: file}, gofuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (node *node) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	entries, err := fs.ReadDir(node.fsys, node.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+
+	list := make([]gofuse.DirEntry, len(entries))
+	for i, entry := range entries {
+		list[i] = gofuse.DirEntry{Name: entry.Name(), Mode: fileMode(entry.Type())}
+	}
+	return gofs.NewListDirStream(list), 0
+}
+
+// Statfs describes the filesystem as full, as nothing can be written.
+func (node *node) Statfs(ctx context.Context, out *gofuse.StatfsOut) syscall.Errno {
+	out.Bsize = 4096
+	out.NameLen = 255
+	out.Frsize = 4096
+	return 0
+}
+
+// fileHandle is an open file. Its reads are serialized, as the kernel
+// may read it concurrently, and files that can't be read at an offset
+// are read by seeking first.
+type fileHandle struct {
+	mu   sync.Mutex
+	file fs.File
+}
+
+var (
+	_ gofs.FileReader   = (*fileHandle)(nil)
+	_ gofs.FileReleaser = (*fileHandle)(nil)
+)
+
+func (handle *fileHandle) Read(ctx context.Context, dest []byte, offset int64) (gofuse.ReadResult, syscall.Errno) {
+	handle.mu.Lock()
+	defer handle.mu.Unlock()
+
+	var n int
+	var err error
+	switch file := handle.file.(type) {
+	case io.ReaderAt:
+		n, err = file.ReadAt(dest, offset)
+	case io.ReadSeeker:
+		_, err = file.Seek(offset, io.SeekStart)
+		if err == nil {
+			n, err = io.ReadFull(file, dest)
+		}
+	default:
+		return nil, syscall.ENOSYS
+	}
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, errno(err)
+	}
+	return gofuse.ReadResultData(dest[:n]), 0
+}
+
+func (handle *fileHandle) Release(ctx context.Context) syscall.Errno {
+	handle.mu.Lock()
+	defer handle.mu.Unlock()
+	err := handle.file.Close()
+	if err != nil {
+		return errno(err)
+	}
+	return 0
+}
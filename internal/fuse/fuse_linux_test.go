@@ -0,0 +1,145 @@
+package fuse
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	gofuse "github.com/hanwen/go-fuse/v2/fuse"
+)
+
+var testModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestFS returns the filesystem serving a few files, as the kernel
+// sees it, along with its root node, without mounting it.
+func newTestFS() (gofuse.RawFileSystem, *node) {
+	fsys := fstest.MapFS{
+		"dir/file": {Data: []byte("contents"), Mode: 0o640, ModTime: testModTime},
+		"other":    {Data: []byte("other contents"), Mode: 0o600},
+	}
+	root := newNode(fsys, ".")
+	return gofs.NewNodeFS(root, mountOptions()), root
+}
+
+// lookupTest looks up name in the directory node id, as the kernel does.
+func lookupTest(t *testing.T, rawFS gofuse.RawFileSystem, dir uint64, name string) *gofuse.EntryOut {
+	t.Helper()
+	var out gofuse.EntryOut
+	status := rawFS.Lookup(nil, &gofuse.InHeader{NodeId: dir}, name, &out)
+	if !status.Ok() {
+		t.Fatalf("lookup %s: %v", name, status)
+	}
+	return &out
+}
+
+func TestLookup(t *testing.T) {
+	rawFS, _ := newTestFS()
+	dir := lookupTest(t, rawFS, 1, "dir")
+	if dir.Mode&syscall.S_IFMT != syscall.S_IFDIR || dir.Nlink != 2 {
+		t.Errorf("dir: got mode %o, %d links", dir.Mode, dir.Nlink)
+	}
+
+	file := lookupTest(t, rawFS, dir.NodeId, "file")
+	if file.Mode != syscall.S_IFREG|0o640 {
+		t.Errorf("file: got mode %o, want %o", file.Mode, syscall.S_IFREG|0o640)
+	}
+	if file.Size != uint64(len("contents")) {
+		t.Errorf("file: got size %d, want %d", file.Size, len("contents"))
+	}
+	if file.Mtime != uint64(testModTime.Unix()) {
+		t.Errorf("file: got modification time %d, want %d", file.Mtime, testModTime.Unix())
+	}
+	if file.Owner.Uid != uint32(syscall.Getuid()) {
+		t.Errorf("file: got owner %d, want %d", file.Owner.Uid, syscall.Getuid())
+	}
+
+	var out gofuse.EntryOut
+	status := rawFS.Lookup(nil, &gofuse.InHeader{NodeId: dir.NodeId}, "missing", &out)
+	if status != gofuse.ENOENT {
+		t.Errorf("missing: got %v, want %v", status, gofuse.ENOENT)
+	}
+}
+
+func TestRead(t *testing.T) {
+	rawFS, _ := newTestFS()
+	dir := lookupTest(t, rawFS, 1, "dir")
+	file := lookupTest(t, rawFS, dir.NodeId, "file")
+
+	var open gofuse.OpenOut
+	status := rawFS.Open(nil, &gofuse.OpenIn{InHeader: gofuse.InHeader{NodeId: file.NodeId}}, &open)
+	if !status.Ok() {
+		t.Fatal(status)
+	}
+	if open.OpenFlags&gofuse.FOPEN_KEEP_CACHE == 0 {
+		t.Error("opened without keeping the cache")
+	}
+
+	// The kernel reads files concurrently.
+	var wg sync.WaitGroup
+	for offset := range len("contents") {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in := &gofuse.ReadIn{InHeader: gofuse.InHeader{NodeId: file.NodeId}, Fh: open.Fh, Offset: uint64(offset), Size: 64}
+			buffer := make([]byte, in.Size)
+			result, status := rawFS.Read(nil, in, buffer)
+			if !status.Ok() {
+				t.Errorf("offset %d: %v", offset, status)
+				return
+			}
+			data, _ := result.Bytes(buffer)
+			if string(data) != "contents"[offset:] {
+				t.Errorf("offset %d: got %q, want %q", offset, data, "contents"[offset:])
+			}
+		}()
+	}
+	wg.Wait()
+
+	rawFS.Release(nil, &gofuse.ReleaseIn{InHeader: gofuse.InHeader{NodeId: file.NodeId}, Fh: open.Fh})
+}
+
+func TestReaddir(t *testing.T) {
+	_, root := newTestFS()
+	stream, errno := root.Readdir(context.Background())
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	defer stream.Close()
+
+	var names []string
+	for stream.HasNext() {
+		entry, errno := stream.Next()
+		if errno != 0 {
+			t.Fatal(errno)
+		}
+		names = append(names, entry.Name)
+	}
+	if len(names) != 2 || names[0] != "dir" || names[1] != "other" {
+		t.Errorf("got entries %q, want [dir other]", names)
+	}
+}
+
+// TestForget checks nodes are dropped once forgotten as many times as
+// they were looked up, so memory doesn't grow with the files listed.
+func TestForget(t *testing.T) {
+	rawFS, root := newTestFS()
+	dir := lookupTest(t, rawFS, 1, "dir")
+	file := lookupTest(t, rawFS, dir.NodeId, "file")
+	if lookupTest(t, rawFS, dir.NodeId, "file").NodeId != file.NodeId {
+		t.Fatal("file looked up again as another node")
+	}
+	dirNode := root.GetChild("dir")
+
+	rawFS.Forget(file.NodeId, 1)
+	if dirNode.GetChild("file") == nil {
+		t.Fatal("file dropped while looked up once more")
+	}
+	rawFS.Forget(file.NodeId, 1)
+	if dirNode.GetChild("file") != nil {
+		t.Error("file kept once forgotten")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package fuse
+
+import "io/fs"
+
+// Server serves the filesystem mounted by [Mount]
+// until it's unmounted.
+type Server struct{}
+
+// Mount returns [ErrUnsupported], as FUSE is only supported on Linux.
+func Mount(dir string, fsys fs.FS) (*Server, error) {
+	return nil, ErrUnsupported
+}
+
+// Unmount returns [ErrUnsupported].
+func (server *Server) Unmount() error {
+	return ErrUnsupported
+}
+
+// Serve returns [ErrUnsupported].
+func (server *Server) Serve() error {
+	return ErrUnsupported
+}
@@ -0,0 +1,228 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	minMatch = 4
+
+	// mfLimit is how far from the end of a block the last match starts,
+	// at least, and lastLiterals how many bytes end it as literals.
+	mfLimit      = 12
+	lastLiterals = 5
+
+	maxOffset = 1<<16 - 1
+
+	hashLog = 16
+)
+
+// ErrCorrupt is returned when reading data that isn't a valid LZ4 frame.
+var ErrCorrupt = errors.New("lz4: corrupt input")
+
+// matcher finds the earlier occurrences of the data of a block, through a
+// table of the last position of each hash, and chains of the positions
+// before them, followed up to depth positions.
+type matcher struct {
+	depth int
+	table []int32
+	chain []int32
+}
+
+func newMatcher(depth int) *matcher {
+	return &matcher{
+		depth: max(depth, 1),
+		table: make([]int32, 1<<hashLog),
+	}
+}
+
+func hash(u uint32) uint32 {
+	return u * prime1 >> (32 - hashLog)
+}
+
+// reset prepares the matcher for a block of size n.
+func (m *matcher) reset(n int) {
+	for i := range m.table {
+		m.table[i] = -1
+	}
+	if m.depth > 1 {
+		if cap(m.chain) < n {
+			m.chain = make([]int32, n)
+		}
+		m.chain = m.chain[:n]
+	}
+}
+
+// insert records the position i of src.
+func (m *matcher) insert(src []byte, i int) {
+	h := hash(binary.LittleEndian.Uint32(src[i:]))
+	if m.depth > 1 {
+		m.chain[i] = m.table[h]
+	}
+	m.table[h] = int32(i)
+}
+
+// find returns the position of the longest earlier match of the data at
+// position i of src, ending by limit, and its length, or zero if none.
+func (m *matcher) find(src []byte, i int, limit int) (ref int, length int) {
+	u := binary.LittleEndian.Uint32(src[i:])
+	candidate := int(m.table[hash(u)])
+	for tries := 0; candidate >= 0 && i-candidate <= maxOffset && tries < m.depth; tries++ {
+		if binary.LittleEndian.Uint32(src[candidate:]) == u {
+			n := minMatch
+			for i+n < limit && src[candidate+n] == src[i+n] {
+				n++
+			}
+			if n > length {
+				ref, length = candidate, n
+			}
+		}
+		if m.depth == 1 {
+			break
+		}
+		candidate = int(m.chain[candidate])
+	}
+	return ref, length
+}
+
+// appendLength appends the part of a length above 15, not
+// fitting in the token, as bytes of 255 followed by the rest.
+func appendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// appendSequence appends the literals followed by a match of length
+// at offset, or only the literals if length is zero.
+func appendSequence(dst []byte, literals []byte, offset int, length int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if length > 0 {
+		token |= byte(min(length-minMatch, 15))
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = appendLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if length == 0 {
+		return dst
+	}
+
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+	if length-minMatch >= 15 {
+		dst = appendLength(dst, length-minMatch-15)
+	}
+	return dst
+}
+
+// compressBlock appends the LZ4 block compressing src to dst.
+func (m *matcher) compressBlock(dst []byte, src []byte) []byte {
+	if len(src) <= mfLimit {
+		return appendSequence(dst, src, 0, 0)
+	}
+
+	m.reset(len(src))
+	anchor := 0
+	limit := len(src) - lastLiterals
+	for i := 0; i <= len(src)-mfLimit; {
+		ref, length := m.find(src, i, limit)
+		if length == 0 {
+			m.insert(src, i)
+			i++
+			continue
+		}
+
+		for i > anchor && ref > 0 && src[i-1] == src[ref-1] {
+			i--
+			ref--
+			length++
+		}
+		dst = appendSequence(dst, src[anchor:i], i-ref, length)
+
+		end := i + length
+		for ; i < end && i <= len(src)-minMatch; i++ {
+			m.insert(src, i)
+		}
+		i = end
+		anchor = end
+	}
+	return appendSequence(dst, src[anchor:], 0, 0)
+}
+
+// readLength reads the rest of a length whose part in the token is 15,
+// from src at i, returning it and the position after it.
+func readLength(src []byte, i int) (int, int, error) {
+	n := 0
+	for {
+		if i >= len(src) {
+			return 0, 0, ErrCorrupt
+		}
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+// decompressBlock appends the decompressed LZ4 block src to dst, whose
+// contents are the history matches may refer to, up to size bytes.
+func decompressBlock(dst []byte, src []byte, size int) ([]byte, error) {
+	start := len(dst)
+	i := 0
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			n, next, err := readLength(src, i)
+			if err != nil {
+				return nil, err
+			}
+			literals += n
+			i = next
+		}
+		if literals > len(src)-i || len(dst)-start+literals > size {
+			return nil, ErrCorrupt
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			return dst, nil
+		}
+
+		if i+2 > len(src) {
+			return nil, ErrCorrupt
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		length := int(token & 15)
+		if length == 15 {
+			n, next, err := readLength(src, i)
+			if err != nil {
+				return nil, err
+			}
+			length += n
+			i = next
+		}
+		length += minMatch
+		if offset == 0 || offset > len(dst) || len(dst)-start+length > size {
+			return nil, ErrCorrupt
+		}
+
+		ref := len(dst) - offset
+		if offset >= length {
+			dst = append(dst, dst[ref:ref+length]...)
+			continue
+		}
+		for n := 0; n < length; n++ {
+			dst = append(dst, dst[ref+n])
+		}
+	}
+	return nil, ErrCorrupt
+}
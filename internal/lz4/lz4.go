@@ -0,0 +1,363 @@
+// Package lz4 implements the LZ4 frame format, as written by the lz4
+// command, compressing with independent blocks and a content checksum,
+// and decompressing any frame not using a dictionary.
+package lz4
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	frameMagic = 0x184D2204
+
+	// Skippable frames have any magic number from skippableMagic
+	// to skippableMagic+15.
+	skippableMagic = 0x184D2A50
+
+	version = 1 << 6
+
+	flagBlockIndependence = 1 << 5
+	flagBlockChecksum     = 1 << 4
+	flagContentSize       = 1 << 3
+	flagContentChecksum   = 1 << 2
+	flagDictId            = 1 << 0
+
+	// blockSizeId is the id of the maximum size of the blocks written,
+	// 64 KiB. Ids 4 to 7 are 64 KiB, 256 KiB, 1 MiB and 4 MiB.
+	blockSizeId = 4
+
+	uncompressedBit = 1 << 31
+
+	// historySize is how far back blocks linked to the previous ones refer.
+	historySize = 64 << 10
+)
+
+// ErrDictionary is returned when reading a frame compressed with a dictionary.
+var ErrDictionary = errors.New("lz4: dictionaries not supported")
+
+func blockSize(id byte) int {
+	return 1 << (8 + 2*int(id))
+}
+
+// headerChecksum returns the checksum of the frame descriptor.
+func headerChecksum(descriptor []byte) byte {
+	return byte(checksum(descriptor) >> 8)
+}
+
+// Writer compresses what's written to it into an LZ4 frame.
+type Writer struct {
+	dst     io.Writer
+	matcher *matcher
+	content *xxh32
+	block   []byte
+	out     []byte
+	started bool
+	closed  bool
+	err     error
+}
+
+// NewWriter returns a writer compressing into dst. Matches are searched
+// among the depth last positions with the same hash, 1 being the fastest.
+func NewWriter(dst io.Writer, depth int) *Writer {
+	return &Writer{
+		dst:     dst,
+		matcher: newMatcher(depth),
+		content: newXXH32(),
+		block:   make([]byte, 0, blockSize(blockSizeId)),
+		out:     make([]byte, 4),
+	}
+}
+
+func (writer *Writer) Write(p []byte) (int, error) {
+	if writer.closed {
+		return 0, errors.New("lz4: write to closed writer")
+	}
+	if writer.err != nil {
+		return 0, writer.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(writer.block[len(writer.block):cap(writer.block)], p)
+		writer.block = writer.block[:len(writer.block)+n]
+		p = p[n:]
+		written += n
+		if len(writer.block) == cap(writer.block) {
+			writer.err = writer.flushBlock()
+			if writer.err != nil {
+				return written, writer.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// writeHeader writes the magic number and frame descriptor,
+// if not written yet.
+func (writer *Writer) writeHeader() error {
+	if writer.started {
+		return nil
+	}
+	writer.started = true
+
+	header := binary.LittleEndian.AppendUint32(nil, frameMagic)
+	descriptor := []byte{version | flagBlockIndependence | flagContentChecksum, blockSizeId << 4}
+	header = append(header, descriptor...)
+	header = append(header, headerChecksum(descriptor))
+	_, err := writer.dst.Write(header)
+	return err
+}
+
+// flushBlock writes the block buffered, stored uncompressed
+// if compressing doesn't make it smaller.
+func (writer *Writer) flushBlock() error {
+	err := writer.writeHeader()
+	if err != nil {
+		return err
+	}
+	if len(writer.block) == 0 {
+		return nil
+	}
+
+	writer.content.Write(writer.block)
+	writer.out = writer.matcher.compressBlock(writer.out[:4], writer.block)
+	size := len(writer.out) - 4
+	if size >= len(writer.block) {
+		writer.out = append(writer.out[:4], writer.block...)
+		size = len(writer.block) | uncompressedBit
+	}
+	binary.LittleEndian.PutUint32(writer.out, uint32(size))
+	writer.block = writer.block[:0]
+
+	_, err = writer.dst.Write(writer.out)
+	return err
+}
+
+// Close flushes the data buffered and ends the frame, without closing
+// the underlying writer.
+func (writer *Writer) Close() error {
+	if writer.closed {
+		return writer.err
+	}
+	writer.closed = true
+	if writer.err != nil {
+		return writer.err
+	}
+
+	writer.err = writer.flushBlock()
+	if writer.err != nil {
+		return writer.err
+	}
+	end := binary.LittleEndian.AppendUint32(nil, 0)
+	end = binary.LittleEndian.AppendUint32(end, writer.content.Sum32())
+	_, writer.err = writer.dst.Write(end)
+	return writer.err
+}
+
+// Reader decompresses a sequence of LZ4 frames, skipping skippable frames.
+type Reader struct {
+	src io.Reader
+
+	// Set while reading the blocks of a frame.
+	inFrame   bool
+	flags     byte
+	blockSize int
+	content   *xxh32
+
+	// history holds the data decompressed, with the block being read
+	// at its end, along with the previous ones linked blocks refer to.
+	history []byte
+	pos     int
+	data    []byte
+
+	frames int
+	err    error
+}
+
+// NewReader returns a reader decompressing src.
+func NewReader(src io.Reader) *Reader {
+	return &Reader{
+		src:     src,
+		content: newXXH32(),
+	}
+}
+
+func (reader *Reader) Read(p []byte) (int, error) {
+	for reader.pos == len(reader.history) {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+		reader.err = reader.next()
+	}
+
+	n := copy(p, reader.history[reader.pos:])
+	reader.pos += n
+	return n, nil
+}
+
+// readFull reads len(p) bytes within a frame, for which the
+// end of the input is unexpected.
+func (reader *Reader) readFull(p []byte) error {
+	_, err := io.ReadFull(reader.src, p)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// next reads the next block, or the end of the frame.
+func (reader *Reader) next() error {
+	if !reader.inFrame {
+		return reader.readHeader()
+	}
+
+	var word [4]byte
+	err := reader.readFull(word[:])
+	if err != nil {
+		return err
+	}
+	size := binary.LittleEndian.Uint32(word[:])
+	if size == 0 {
+		return reader.readEnd()
+	}
+	uncompressed := size&uncompressedBit != 0
+	size &^= uncompressedBit
+	if int(size) > reader.blockSize {
+		return ErrCorrupt
+	}
+
+	if cap(reader.data) < int(size) {
+		reader.data = make([]byte, reader.blockSize)
+	}
+	reader.data = reader.data[:size]
+	err = reader.readFull(reader.data)
+	if err != nil {
+		return err
+	}
+	if reader.flags&flagBlockChecksum != 0 {
+		err = reader.readFull(word[:])
+		if err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(word[:]) != checksum(reader.data) {
+			return ErrCorrupt
+		}
+	}
+
+	if reader.flags&flagBlockIndependence != 0 {
+		reader.history = reader.history[:0]
+	} else if len(reader.history) > historySize {
+		n := copy(reader.history, reader.history[len(reader.history)-historySize:])
+		reader.history = reader.history[:n]
+	}
+	reader.pos = len(reader.history)
+	if uncompressed {
+		reader.history = append(reader.history, reader.data...)
+	} else {
+		reader.history, err = decompressBlock(reader.history, reader.data, reader.blockSize)
+		if err != nil {
+			return err
+		}
+	}
+	if reader.flags&flagContentChecksum != 0 {
+		reader.content.Write(reader.history[reader.pos:])
+	}
+	return nil
+}
+
+// readHeader reads the magic number and descriptor of the next frame,
+// skipping the skippable frames before it.
+func (reader *Reader) readHeader() error {
+	var header [7]byte
+	for {
+		_, err := io.ReadFull(reader.src, header[:4])
+		if err == io.EOF && reader.frames > 0 {
+			return io.EOF
+		}
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		magic := binary.LittleEndian.Uint32(header[:])
+		if magic == frameMagic {
+			break
+		}
+		if magic&^0xF != skippableMagic {
+			return ErrCorrupt
+		}
+		err = reader.readFull(header[:4])
+		if err != nil {
+			return err
+		}
+		skipped, err := io.CopyN(io.Discard, reader.src, int64(binary.LittleEndian.Uint32(header[:])))
+		if err == io.EOF && skipped < int64(binary.LittleEndian.Uint32(header[:])) {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		reader.frames++
+	}
+
+	descriptor := header[:2]
+	err := reader.readFull(descriptor)
+	if err != nil {
+		return err
+	}
+	flags, bd := descriptor[0], descriptor[1]
+	if flags&0xC0 != version || flags&0x02 != 0 || bd&0x8F != 0 || bd>>4 < 4 {
+		return ErrCorrupt
+	}
+
+	n := 0
+	if flags&flagContentSize != 0 {
+		n += 8
+	}
+	if flags&flagDictId != 0 {
+		n += 4
+	}
+	descriptor = make([]byte, 2+n+1)
+	copy(descriptor, header[:2])
+	err = reader.readFull(descriptor[2:])
+	if err != nil {
+		return err
+	}
+	if headerChecksum(descriptor[:2+n]) != descriptor[2+n] {
+		return ErrCorrupt
+	}
+	if flags&flagDictId != 0 {
+		return ErrDictionary
+	}
+
+	reader.inFrame = true
+	reader.flags = flags
+	reader.blockSize = blockSize(bd >> 4)
+	reader.content.Reset()
+	reader.history = reader.history[:0]
+	reader.pos = 0
+	return nil
+}
+
+// readEnd reads the content checksum ending the frame, if any.
+func (reader *Reader) readEnd() error {
+	reader.inFrame = false
+	reader.frames++
+	if reader.flags&flagContentChecksum == 0 {
+		return nil
+	}
+
+	var sum [4]byte
+	err := reader.readFull(sum[:])
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != reader.content.Sum32() {
+		return ErrCorrupt
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package lz4
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestXXH32(t *testing.T) {
+	tests := []struct {
+		data string
+		sum  uint32
+	}{
+		{"", 0x02CC5D05},
+		{"a", 0x550D7456},
+		{"abc", 0x32D153FF},
+		{"Nobody inspects the spammish repetition", 0xE2293B2F},
+	}
+	for _, test := range tests {
+		got := checksum([]byte(test.data))
+		if got != test.sum {
+			t.Errorf("%q: got %08x, want %08x", test.data, got, test.sum)
+		}
+
+		// Written a byte at a time, crossing the stripes.
+		digest := newXXH32()
+		for i := range test.data {
+			digest.Write([]byte{test.data[i]})
+		}
+		if digest.Sum32() != test.sum {
+			t.Errorf("%q by bytes: got %08x, want %08x", test.data, digest.Sum32(), test.sum)
+		}
+	}
+}
+
+func TestEmptyFrame(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewWriter(&buf, 1).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hex.DecodeString("04224d186440a700000000055dcc02")
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x, want %x", buf.Bytes(), want)
+	}
+
+	data, err := io.ReadAll(NewReader(&buf))
+	if err != nil || len(data) != 0 {
+		t.Fatalf("got %q, %v", data, err)
+	}
+}
+
+// testData returns n bytes mixing runs, repeated text and random bytes.
+func testData(n int) []byte {
+	random := rand.New(rand.NewSource(1))
+	data := make([]byte, 0, n)
+	for len(data) < n {
+		switch random.Intn(3) {
+		case 0:
+			data = append(data, bytes.Repeat([]byte{byte(random.Intn(256))}, random.Intn(300))...)
+		case 1:
+			data = append(data, "the quick brown fox jumps over the lazy dog "...)
+		default:
+			for i := random.Intn(100); i > 0; i-- {
+				data = append(data, byte(random.Intn(256)))
+			}
+		}
+	}
+	return data[:n]
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{1, 12, 13, 100, 1 << 16, 1<<16 + 1, 300000} {
+		for _, depth := range []int{1, 4, 64} {
+			data := testData(size)
+			var buf bytes.Buffer
+			writer := NewWriter(&buf, depth)
+			_, err := writer.Write(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := io.ReadAll(NewReader(&buf))
+			if err != nil {
+				t.Fatalf("size %d, depth %d: %v", size, depth, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("size %d, depth %d: contents differ", size, depth)
+			}
+		}
+	}
+}
+
+func TestCompresses(t *testing.T) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 1000)
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, 1)
+	writer.Write(data)
+	writer.Close()
+	if buf.Len() > len(data)/10 {
+		t.Errorf("compressed %d bytes to %d", len(data), buf.Len())
+	}
+}
+
+// TestReadBlockChecksums reads a frame written by the lz4 command
+// with block checksums and a content checksum.
+func TestReadBlockChecksums(t *testing.T) {
+	frame, _ := hex.DecodeString(
+		"04224d187440bd100000006f68656c6c6f2006000650656c6c6f0a1f7af892" +
+			"0000000053ce9936",
+	)
+	want := "hello hello hello hello hello hello\n"
+
+	got, err := io.ReadAll(NewReader(bytes.NewReader(frame)))
+	if err != nil || string(got) != want {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// Concatenated after a skippable frame.
+	skippable := []byte{0x5A, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 1, 2, 3}
+	stream := append(append(append([]byte{}, frame...), skippable...), frame...)
+	got, err = io.ReadAll(NewReader(bytes.NewReader(stream)))
+	if err != nil || string(got) != want+want {
+		t.Fatalf("concatenated: got %q, %v", got, err)
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, 1)
+	writer.Write(testData(100000))
+	writer.Close()
+	frame := buf.Bytes()
+
+	for _, i := range []int{0, 4, 6, 7, 11, len(frame) / 2, len(frame) - 1} {
+		corrupt := bytes.Clone(frame)
+		corrupt[i] ^= 0x55
+		_, err := io.ReadAll(NewReader(bytes.NewReader(corrupt)))
+		if err == nil {
+			t.Errorf("byte %d corrupted: no error", i)
+		}
+	}
+
+	_, err := io.ReadAll(NewReader(bytes.NewReader(frame[:len(frame)-3])))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	_, err = io.ReadAll(NewReader(bytes.NewReader(nil)))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("empty: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDecompressBlockBounds(t *testing.T) {
+	blocks := [][]byte{
+		{0xF0},                       // Literal length missing.
+		{0x50, 'a'},                  // Literals past the end.
+		{0x10, 'a', 0x02, 0x00},      // Offset before the start.
+		{0x10, 'a', 0x00, 0x00},      // Zero offset.
+		{0x1F, 'a', 0x01, 0x00, 255}, // Match length missing.
+		{0x10, 'a', 0x01, 0x00},      // Ending with a match.
+	}
+	for _, block := range blocks {
+		_, err := decompressBlock(nil, block, 1<<16)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%x: got %v, want %v", block, err, ErrCorrupt)
+		}
+	}
+
+	// Overlapping match, within the size, then past it.
+	block := []byte{0x1F, 'a', 0x01, 0x00, 0x00, 0x00}
+	got, err := decompressBlock(nil, block, 20)
+	if err != nil || string(got) != "aaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	_, err = decompressBlock(nil, block, 19)
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("past the size: got %v, want %v", err, ErrCorrupt)
+	}
+}
+
+// TestCommand checks frames are compatible with the lz4 command, if
+// installed, reading its frames with linked blocks and larger blocks.
+func TestCommand(t *testing.T) {
+	command, err := exec.LookPath("lz4")
+	if err != nil {
+		t.Skip("lz4 command not found")
+	}
+	data := testData(500000)
+
+	var buf bytes.Buffer
+	writer := NewWriter(&buf, 4)
+	writer.Write(data)
+	writer.Close()
+	cmd := exec.Command(command, "-d", "-c")
+	cmd.Stdin = &buf
+	got, err := cmd.Output()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("decompressed by lz4: %v", err)
+	}
+
+	input := t.TempDir() + "/data"
+	err = os.WriteFile(input, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"-1"}, {"-9"}, {"-BD", "-BX", "-B4"}, {"-B7", "--content-size"}} {
+		compressed, err := exec.Command(command, append(args, "-c", input)...).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("compressed by lz4 %v: %v", args, err)
+		}
+	}
+}
+
+func FuzzDecompressBlock(f *testing.F) {
+	for _, size := range []int{0, 13, 100, 1000} {
+		data := testData(size)
+		f.Add(newMatcher(4).compressBlock(nil, data), data[:min(size, 64)], len(data))
+	}
+	f.Add([]byte{0x1F, 'a', 0x01, 0x00, 0x00, 0x00}, []byte(nil), 20)
+
+	f.Fuzz(func(t *testing.T, src []byte, history []byte, size int) {
+		if size < 0 || size > blockSize(7) {
+			return
+		}
+		got, err := decompressBlock(bytes.Clone(history), src, size)
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("got error %v, want %v", err, ErrCorrupt)
+			}
+			return
+		}
+		if !bytes.Equal(got[:len(history)], history) {
+			t.Fatal("history changed")
+		}
+		if len(got)-len(history) > size {
+			t.Fatalf("decompressed %d bytes, past the size %d", len(got)-len(history), size)
+		}
+
+		// Whatever is decompressed is compressed back.
+		data := got[len(history):]
+		block := newMatcher(4).compressBlock(nil, data)
+		again, err := decompressBlock(nil, block, len(data))
+		if err != nil || !bytes.Equal(again, data) {
+			t.Fatalf("compressed again: %v", err)
+		}
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	for _, size := range []int{0, 100, 1000} {
+		var buf bytes.Buffer
+		writer := NewWriter(&buf, 4)
+		writer.Write(testData(size))
+		writer.Close()
+		f.Add(buf.Bytes())
+	}
+	frame, _ := hex.DecodeString(
+		"04224d187440bd100000006f68656c6c6f2006000650656c6c6f0a1f7af892" +
+			"0000000053ce9936",
+	)
+	f.Add(frame)
+	f.Add(append([]byte{0x5A, 0x2A, 0x4D, 0x18, 3, 0, 0, 0, 1, 2, 3}, frame...))
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		// Reading stops at an error, never looping, whatever the input.
+		reader := NewReader(bytes.NewReader(stream))
+		buffer := make([]byte, 4096)
+		for {
+			_, err := reader.Read(buffer)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				_, again := reader.Read(buffer)
+				if again != err {
+					t.Fatalf("read again: got %v, want %v", again, err)
+				}
+				return
+			}
+		}
+	})
+}
+
+// TestCommandCorrupt checks corrupted frames written by the lz4
+// command, if installed, are read as it reads them: rejected, or
+// read to the same contents.
+func TestCommandCorrupt(t *testing.T) {
+	command, err := exec.LookPath("lz4")
+	if err != nil {
+		t.Skip("lz4 command not found")
+	}
+	input := t.TempDir() + "/data"
+	err = os.WriteFile(input, testData(20000), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"-BD", "-B4"}, {"-BX", "--no-frame-crc"}} {
+		frame, err := exec.Command(command, append(args, "-c", input)...).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(frame); i += 7 {
+			corrupt := bytes.Clone(frame)
+			corrupt[i] ^= 0x55
+			cmd := exec.Command(command, "-d", "-c")
+			cmd.Stdin = bytes.NewReader(corrupt)
+			want, wantErr := cmd.Output()
+			got, err := io.ReadAll(NewReader(bytes.NewReader(corrupt)))
+			if (err == nil) != (wantErr == nil) || err == nil && !bytes.Equal(got, want) {
+				t.Errorf("lz4 %v, byte %d corrupted: got %v, lz4 got %v", args, i, err, wantErr)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime1 uint32 = 2654435761
+	prime2 uint32 = 2246822519
+	prime3 uint32 = 3266489917
+	prime4 uint32 = 668265263
+	prime5 uint32 = 374761393
+)
+
+// xxh32 computes the 32-bit xxHash, with seed 0, checksumming the
+// frame descriptors, blocks and contents of LZ4 frames.
+type xxh32 struct {
+	v     [4]uint32
+	total uint64
+	buf   [16]byte
+	n     int
+}
+
+func newXXH32() *xxh32 {
+	digest := new(xxh32)
+	digest.Reset()
+	return digest
+}
+
+func (digest *xxh32) Reset() {
+	// The primes overflow as constants, but wrap as variables.
+	p1 := prime1
+	digest.v = [4]uint32{p1 + prime2, prime2, 0, -p1}
+	digest.total = 0
+	digest.n = 0
+}
+
+func xxh32Round(acc uint32, input uint32) uint32 {
+	return bits.RotateLeft32(acc+input*prime2, 13) * prime1
+}
+
+// stripe consumes a 16-byte stripe of the input.
+func (digest *xxh32) stripe(p []byte) {
+	for i := range digest.v {
+		digest.v[i] = xxh32Round(digest.v[i], binary.LittleEndian.Uint32(p[4*i:]))
+	}
+}
+
+func (digest *xxh32) Write(p []byte) (int, error) {
+	written := len(p)
+	digest.total += uint64(len(p))
+	if digest.n > 0 {
+		n := copy(digest.buf[digest.n:], p)
+		digest.n += n
+		p = p[n:]
+		if digest.n < len(digest.buf) {
+			return written, nil
+		}
+		digest.stripe(digest.buf[:])
+		digest.n = 0
+	}
+	for len(p) >= len(digest.buf) {
+		digest.stripe(p)
+		p = p[len(digest.buf):]
+	}
+	digest.n = copy(digest.buf[:], p)
+	return written, nil
+}
+
+func (digest *xxh32) Sum32() uint32 {
+	var h uint32
+	if digest.total >= uint64(len(digest.buf)) {
+		h = bits.RotateLeft32(digest.v[0], 1) + bits.RotateLeft32(digest.v[1], 7) +
+			bits.RotateLeft32(digest.v[2], 12) + bits.RotateLeft32(digest.v[3], 18)
+	} else {
+		h = prime5
+	}
+	h += uint32(digest.total)
+
+	p := digest.buf[:digest.n]
+	for ; len(p) >= 4; p = p[4:] {
+		h += binary.LittleEndian.Uint32(p) * prime3
+		h = bits.RotateLeft32(h, 17) * prime4
+	}
+	for _, b := range p {
+		h += uint32(b) * prime5
+		h = bits.RotateLeft32(h, 11) * prime1
+	}
+
+	h ^= h >> 15
+	h *= prime2
+	h ^= h >> 13
+	h *= prime3
+	h ^= h >> 16
+	return h
+}
+
+// checksum returns the xxHash of p.
+func checksum(p []byte) uint32 {
+	digest := newXXH32()
+	digest.Write(p)
+	return digest.Sum32()
+}
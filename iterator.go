@@ -0,0 +1,205 @@
+package arc
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// queryPrefixCondition selects the files whose unencrypted name starts
+// with a prefix, using the index of the name column, along with all
+// encrypted files, whose names are only compared once decrypted. The
+// upper bound is the prefix followed by the byte 0xff, which never
+// occurs in UTF-8 names.
+const queryPrefixCondition = ` WHERE encrypted = 1 OR (name >= ? AND name < ?)`
+
+const (
+	queryUnencryptedCondition = ` WHERE encrypted = 0`
+
+	queryNameRangeCondition = ` AND name >= ? AND name < ?`
+
+	queryEncryptedCondition = ` WHERE encrypted = 1 ORDER BY id`
+
+	queryCountFiles = `SELECT count(*)`
+
+	queryPage = ` ORDER BY name LIMIT ? OFFSET ?`
+)
+
+// FileIterator iterates over the headers of the files of a container,
+// reading them from the database one at a time, instead of listing all
+// of them as [Reader.Files]. It's used like [sql.Rows]:
+//
+//	files, err := reader.Iterate("")
+//	if err != nil {
+//		return err
+//	}
+//	defer files.Close()
+//	for files.Next() {
+//		header := files.Header()
+//		...
+//	}
+//	err = files.Err()
+type FileIterator struct {
+	reader *Reader
+	rows   *sql.Rows
+	prefix string
+	header *Header
+	err    error
+}
+
+// Iterate returns an iterator over the files whose names start with
+// prefix, or all files if prefix is empty. Unencrypted names are filtered
+// by the database, while encrypted names are filtered once decrypted, so
+// encrypted files whose key isn't known are only iterated with no prefix,
+// as by [Reader.Files].
+//
+// The iterator must be closed, and the Reader may be used while iterating.
+func (reader *Reader) Iterate(prefix string) (*FileIterator, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	query := reader.metadataQuery()
+	var args []any
+	if prefix != "" {
+		query += queryPrefixCondition
+		args = append(args, prefix, prefix+"\xff")
+	}
+
+	rows, err := reader.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileIterator{reader: reader, rows: rows, prefix: prefix}, nil
+}
+
+// Next advances to the next file, returning false once there
+// are no more files, or an error occurs, reported by Err.
+func (iterator *FileIterator) Next() bool {
+	if iterator.err != nil {
+		return false
+	}
+
+	for iterator.rows.Next() {
+		header, err := iterator.reader.scanHeader(iterator.rows.Scan)
+		if err != nil {
+			iterator.err = err
+			return false
+		}
+		if iterator.prefix != "" && header.Encryption && !iterator.reader.canDecrypt(header.Id) {
+			continue
+		}
+		if !strings.HasPrefix(header.Name, iterator.prefix) {
+			continue
+		}
+
+		iterator.header = header
+		return true
+	}
+
+	iterator.err = iterator.rows.Err()
+	iterator.header = nil
+	return false
+}
+
+// Header returns the header of the current file.
+func (iterator *FileIterator) Header() *Header {
+	return iterator.header
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (iterator *FileIterator) Err() error {
+	return iterator.err
+}
+
+// Close stops the iteration, releasing its rows.
+func (iterator *FileIterator) Close() error {
+	iterator.header = nil
+	return iterator.rows.Close()
+}
+
+// collect returns the headers of the files iterated, skipping
+// the first skip files, up to limit files, and closes the iterator.
+func (iterator *FileIterator) collect(skip int, limit int) (headers []*Header, err error) {
+	defer func() {
+		err2 := iterator.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for len(headers) < limit && iterator.Next() {
+		if skip > 0 {
+			skip--
+			continue
+		}
+		headers = append(headers, iterator.Header())
+	}
+	return headers, iterator.Err()
+}
+
+// List returns a page of the files whose names start with prefix, or of
+// all files if prefix is empty: up to limit files, after skipping the first
+// offset files, along with their attributes. It's meant for browsing
+// containers of too many files to load at once by [Reader.Files].
+//
+// Unencrypted files come first, sorted by name, and are paged by the
+// database, so only the files of the page are read. Encrypted files follow,
+// in the order they were written, as their names are only compared once
+// decrypted, so paging through them reads the encrypted files before the
+// page too. Encrypted files whose key isn't known are only listed with no
+// prefix, as by [Reader.Iterate].
+func (reader *Reader) List(prefix string, offset int, limit int) ([]*Header, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+	if offset < 0 || limit < 0 {
+		return nil, ErrInvalidRange
+	}
+
+	condition := queryUnencryptedCondition
+	var args []any
+	if prefix != "" {
+		condition += queryNameRangeCondition
+		args = append(args, prefix, prefix+"\xff")
+	}
+	var unencrypted int
+	err := reader.db.QueryRow(queryCountFiles+reader.metadataSource()+condition, args...).Scan(&unencrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []*Header
+	if offset < unencrypted && limit > 0 {
+		rows, err := reader.db.Query(reader.metadataQuery()+condition+queryPage, append(args, limit, offset)...)
+		if err != nil {
+			return nil, err
+		}
+		iterator := &FileIterator{reader: reader, rows: rows, prefix: prefix}
+		headers, err = iterator.collect(0, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(headers) < limit && reader.encrypted {
+		rows, err := reader.db.Query(reader.metadataQuery() + queryEncryptedCondition)
+		if err != nil {
+			return nil, err
+		}
+		iterator := &FileIterator{reader: reader, rows: rows, prefix: prefix}
+		encrypted, err := iterator.collect(max(offset-unencrypted, 0), limit-len(headers))
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, encrypted...)
+	}
+
+	for _, header := range headers {
+		header.Attrs, err = reader.Attrs(header.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return headers, nil
+}
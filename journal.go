@@ -0,0 +1,217 @@
+package arc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const journalExtension = ".journal"
+
+// journalEntry records a file completely extracted to the target.
+type journalEntry struct {
+	size     int64
+	checksum []byte
+}
+
+// extractJournal persists the progress of an extraction, one line
+// per extracted file, so an interrupted extraction can be resumed.
+type extractJournal struct {
+	file    *os.File
+	entries map[string]journalEntry
+}
+
+// parseJournalLine parses a line with the size, the hex encoded
+// SHA-256 checksum and the quoted name of an extracted file.
+func parseJournalLine(line string) (string, journalEntry, bool) {
+	sizeField, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return "", journalEntry{}, false
+	}
+	checksumField, nameField, ok := strings.Cut(rest, " ")
+	if !ok {
+		return "", journalEntry{}, false
+	}
+
+	size, err := strconv.ParseInt(sizeField, 10, 64)
+	if err != nil {
+		return "", journalEntry{}, false
+	}
+	checksum, err := hex.DecodeString(checksumField)
+	if err != nil || len(checksum) != sha256.Size {
+		return "", journalEntry{}, false
+	}
+	name, err := strconv.Unquote(nameField)
+	if err != nil {
+		return "", journalEntry{}, false
+	}
+
+	return name, journalEntry{size: size, checksum: checksum}, true
+}
+
+// openJournal opens, or creates, the journal at path. Malformed lines,
+// as the last one written when the process was killed, are ignored.
+func openJournal(path string) (*extractJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &extractJournal{
+		file:    file,
+		entries: make(map[string]journalEntry),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, entry, ok := parseJournalLine(scanner.Text())
+		if ok {
+			journal.entries[name] = entry
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// record appends the entry of name to the journal, syncing it to disk
+// so it survives a crash right after. Each line is preceded, instead of
+// followed, by the line break, so a line left partially written starts
+// a line of its own.
+func (journal *extractJournal) record(name string, entry journalEntry) error {
+	_, err := fmt.Fprintf(
+		journal.file,
+		"\n%d %s %s",
+		entry.size,
+		hex.EncodeToString(entry.checksum),
+		strconv.Quote(name),
+	)
+	if err != nil {
+		return err
+	}
+
+	journal.entries[name] = entry
+	return journal.file.Sync()
+}
+
+func (journal *extractJournal) Close() error {
+	return journal.file.Close()
+}
+
+// extracted reports whether the file header was already extracted to
+// target. If target can be read back, its Open method not failing with
+// [errors.ErrUnsupported], the file is verified against the size and
+// checksum recorded in the journal.
+func (journal *extractJournal) extracted(target ExtractTarget, header *Header) (bool, error) {
+	entry, ok := journal.entries[header.Name]
+	if !ok || entry.size != header.Size {
+		return false, nil
+	}
+
+	readable, ok := target.(readableTarget)
+	if !ok {
+		return true, nil
+	}
+	file, err := readable.Open(header.Name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(sum, file)
+	if err != nil {
+		return false, err
+	}
+
+	return size == entry.size && bytes.Equal(sum.Sum(nil), entry.checksum), nil
+}
+
+// ExtractAllResumable extracts all files of the container to target, as
+// [Reader.ExtractAllTo], recording each extracted file in a journal kept in
+// journalDir and named after the container UUID. If a previous extraction
+// was interrupted, the files it already extracted, and still match their
+// recorded size and checksum, are skipped. The journal is removed once all
+// files are extracted. Directories and symbolic links are always extracted
+// again.
+//
+// Containers without a UUID (see [FeatureUUID]) can't be resumed.
+func (reader *Reader) ExtractAllResumable(target ExtractTarget, journalDir string) (err error) {
+	uuid, err := reader.UUID()
+	if err != nil {
+		return err
+	}
+
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+	err = checkSymlinkParents(files)
+	if err != nil {
+		return err
+	}
+
+	journalPath := filepath.Join(journalDir, uuid+journalExtension)
+	journal, err := openJournal(journalPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := journal.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+		if err == nil {
+			err = os.Remove(journalPath)
+		}
+	}()
+
+	names := extractOrder(files)
+	for _, name := range names {
+		header := files[name]
+		if header.Type != TypeFile {
+			reader.err = reader.extractFile(target, header, nil, nil)
+			if reader.err != nil {
+				return reader.err
+			}
+			continue
+		}
+
+		done, err := journal.extracted(target, header)
+		if err != nil {
+			return err
+		}
+		if done {
+			continue
+		}
+
+		sum := sha256.New()
+		reader.err = reader.extractFile(target, header, sum, nil)
+		if reader.err != nil {
+			return reader.err
+		}
+		err = journal.record(name, journalEntry{size: header.Size, checksum: sum.Sum(nil)})
+		if err != nil {
+			return err
+		}
+	}
+
+	return restoreDirs(target, files, names)
+}
@@ -0,0 +1,122 @@
+package arc
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// interruptedTarget is a [MemTarget] recording the files created, and
+// failing to create the file fail, as if the extraction was interrupted.
+type interruptedTarget struct {
+	*MemTarget
+	fail    string
+	created []string
+}
+
+func (target *interruptedTarget) CreateFile(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	if name == target.fail {
+		return nil, errInterrupted
+	}
+	target.created = append(target.created, name)
+	return target.MemTarget.CreateFile(name, perm)
+}
+
+// extractResumable extracts the container at path to target,
+// as [Reader.ExtractAllResumable], with a Reader of its own.
+func extractResumable(t *testing.T, path string, password []byte, target ExtractTarget, journalDir string) error {
+	t.Helper()
+	reader, err := NewReader(path, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	return reader.ExtractAllResumable(target, journalDir)
+}
+
+func TestExtractAllResumable(t *testing.T) {
+	path := testContainerPath(t)
+	files := map[string]string{"a": "first", "b": "second", "c": "third"}
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, files)
+	journalDir := t.TempDir()
+
+	target := &interruptedTarget{MemTarget: NewMemTarget(), fail: "b"}
+	err := extractResumable(t, path, testPassword, target, journalDir)
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("got %v, want %v", err, errInterrupted)
+	}
+	journals, _ := filepath.Glob(filepath.Join(journalDir, "*"+journalExtension))
+	if len(journals) != 1 {
+		t.Fatalf("got journals %q", journals)
+	}
+
+	// A file modified since extracted is extracted again.
+	entry, _ := target.Entry("a")
+	entry.Data = []byte("modified")
+	target.fail, target.created = "", nil
+	err = extractResumable(t, path, testPassword, target, journalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(target.created)
+	if !slices.Equal(target.created, []string{"a", "b", "c"}) {
+		t.Errorf("extracted %q again", target.created)
+	}
+	for name, contents := range files {
+		entry, ok := target.Entry(name)
+		if !ok || string(entry.Data) != contents {
+			t.Errorf("%s: got %+v", name, entry)
+		}
+	}
+	_, err = os.Stat(journals[0])
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal not removed: %v", err)
+	}
+}
+
+func TestExtractAllResumableSkipsExtracted(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, map[string]string{"a": "first", "b": "second"})
+	journalDir := t.TempDir()
+
+	target := &interruptedTarget{MemTarget: NewMemTarget(), fail: "b"}
+	err := extractResumable(t, path, nil, target, journalDir)
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("got %v, want %v", err, errInterrupted)
+	}
+	target.fail, target.created = "", nil
+	err = extractResumable(t, path, nil, target, journalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(target.created, []string{"b"}) {
+		t.Errorf("got %q extracted, want only b", target.created)
+	}
+}
+
+func TestParseJournalLine(t *testing.T) {
+	checksum := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	name, entry, ok := parseJournalLine(`3 ` + checksum + ` "dir/a b"`)
+	if !ok || name != "dir/a b" || entry.size != 3 {
+		t.Errorf("got %q, %+v, %v", name, entry, ok)
+	}
+
+	for _, line := range []string{
+		"",
+		"3 " + checksum,
+		"x " + checksum + ` "a"`,
+		"3 " + checksum[:10] + ` "a"`,
+		"3 " + checksum + ` "a`,
+	} {
+		_, _, ok = parseJournalLine(line)
+		if ok {
+			t.Errorf("%q parsed", line)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package arc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bernardo1r/encdec"
+)
+
+// ErrInvalidKDFParams is returned when [KDFParams] don't
+// describe a valid Argon2id derivation.
+var ErrInvalidKDFParams = errors.New("invalid key derivation params")
+
+// minSaltSize is the smallest salt size accepted by [KDFParams].
+const minSaltSize = 8
+
+// check checks params deriving new keys, once the defaults are applied.
+func (params KDFParams) check() error {
+	if params.SaltSize != 0 && (params.SaltSize < minSaltSize || params.SaltSize > 255) {
+		return fmt.Errorf("%w: salt of %d bytes, not in [%d, 255]",
+			ErrInvalidKDFParams, params.SaltSize, minSaltSize)
+	}
+	encParams := params.encdecParams()
+	err := encParams.Check()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidKDFParams, err)
+	}
+	if encParams.ArgonMemory < 8*uint32(encParams.ArgonThreads) {
+		return fmt.Errorf("%w: %d KiB of memory, less than 8 KiB for each of %d threads",
+			ErrInvalidKDFParams, encParams.ArgonMemory, encParams.ArgonThreads)
+	}
+	return nil
+}
+
+// encdecParams returns the encdec params deriving
+// keys with params and a new salt.
+func (params KDFParams) encdecParams() *encdec.Params {
+	return &encdec.Params{
+		ArgonType:    params.Algorithm,
+		ArgonVersion: params.Version,
+		SaltSize:     uint8(params.SaltSize),
+		ArgonTime:    params.Time,
+		ArgonMemory:  params.Memory,
+		ArgonThreads: params.Threads,
+	}
+}
+
+// kdfParams returns the key derivation params of params.
+func kdfParams(params *encdec.Params) KDFParams {
+	return KDFParams{
+		Algorithm: params.ArgonType,
+		Version:   params.ArgonVersion,
+		Time:      params.ArgonTime,
+		Memory:    params.ArgonMemory,
+		Threads:   params.ArgonThreads,
+		SaltSize:  int(params.SaltSize),
+	}
+}
+
+// deriveKey derives a new key from password with params, returning
+// it along the marshalled params, with the salt, storing them.
+func deriveKey(password []byte, params KDFParams) (key []byte, paramsString []byte, err error) {
+	err = params.check()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encParams := params.encdecParams()
+	key, err = encdec.Key(password, encParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	paramsString, err = encParams.MarshalHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, paramsString, nil
+}
@@ -0,0 +1,66 @@
+package arc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+)
+
+const (
+	queryKeyCheck = `SELECT mac FROM key_check`
+
+	queryInsertKeyCheck = `INSERT INTO key_check VALUES (?)`
+
+	queryDeleteKeyCheck = `DELETE FROM key_check`
+)
+
+const keyCheckLabel = "arc key check"
+
+// keyCheck returns the value checking containerKey: a MAC of a fixed
+// label, keyed by it, so a wrong password is told apart even before
+// any file is encrypted with the container key.
+func keyCheck(containerKey []byte) []byte {
+	mac := hmac.New(sha256.New, containerKey)
+	mac.Write([]byte(keyCheckLabel))
+	return mac.Sum(nil)
+}
+
+// storeKeyCheck replaces the key check of the container opened in db
+// by the one of containerKey. Nothing is stored in containers
+// without [FeatureKeyCheck].
+func storeKeyCheck(db execQuerier, capabilities Capabilities, containerKey []byte) error {
+	if !capabilities.Has(FeatureKeyCheck) {
+		return nil
+	}
+
+	_, err := db.Exec(queryDeleteKeyCheck)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryInsertKeyCheck, keyCheck(containerKey))
+	return err
+}
+
+// verifyKeyCheck checks containerKey against the key check of the container
+// opened in db, returning [ErrWrongPassword] if it doesn't match. checked
+// reports whether the container stores a key check, which containers
+// without [FeatureKeyCheck], or migrated to it, lack.
+func verifyKeyCheck(db execQuerier, capabilities Capabilities, containerKey []byte) (checked bool, err error) {
+	if !capabilities.Has(FeatureKeyCheck) {
+		return false, nil
+	}
+
+	var mac []byte
+	err = db.QueryRow(queryKeyCheck).Scan(&mac)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !hmac.Equal(mac, keyCheck(containerKey)) {
+		return true, ErrWrongPassword
+	}
+	return true, nil
+}
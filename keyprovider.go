@@ -0,0 +1,148 @@
+package arc
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// ErrWrongKeyProvider is returned when a [KeyProvider] fails
+// to unwrap the file keys of a container.
+var ErrWrongKeyProvider = errors.New("key provider can't unwrap the container keys")
+
+// KeyProvider backs the keys of a container with an external key management
+// service, such as AWS KMS, Vault or a hardware token, instead of a password.
+// The master key of each encrypted file is wrapped by the provider, in place
+// of being sealed with a password-derived key, so the container is only read
+// with access to the service. The blocks and names of the files are encrypted
+// as in containers encrypted with a password.
+//
+// Containers backed by a provider are written by [NewWriterKeyProvider] and
+// [OpenWriterKeyProvider], and read after [Reader.SetKeyProvider]. Files
+// encrypted with their own password (see [Header.Password]) are unaffected.
+type KeyProvider interface {
+	// MasterKey returns the 32 byte container key, e.g. a data key
+	// decrypted by the service. The master keys of convergent files
+	// (see [Header.Convergent]) and the manifest key derive from it.
+	MasterKey() ([]byte, error)
+
+	// WrapFileKey wraps the master key of the file id, returning the
+	// wrapped key, stored in the container. fileKey is zeroed once the
+	// call returns, so it must be copied if kept.
+	WrapFileKey(id int, fileKey []byte) ([]byte, error)
+
+	// UnwrapFileKey unwraps the master key of the file id,
+	// as wrapped by WrapFileKey.
+	UnwrapFileKey(id int, wrapped []byte) ([]byte, error)
+}
+
+// NewWriterKeyProvider creates a new Writer and a container file with name
+// databasePath, whose encrypted files have their keys wrapped by provider.
+func NewWriterKeyProvider(databasePath string, blocksize int, provider KeyProvider) (*Writer, error) {
+	writer, err := NewWriter(databasePath, blocksize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.setKeyProvider(provider)
+	if err != nil {
+		writer.db.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// OpenWriterKeyProvider opens the existing container databasePath, created
+// by [NewWriterKeyProvider], for adding files, as [OpenWriter]. Only the
+// encrypted files written by the Writer are compared by [Header.Conflict].
+func OpenWriterKeyProvider(databasePath string, blocksize int, provider KeyProvider) (*Writer, error) {
+	writer, err := OpenWriter(databasePath, blocksize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.setKeyProvider(provider)
+	if err != nil {
+		writer.db.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *Writer) setKeyProvider(provider KeyProvider) error {
+	if !writer.capabilities.Has(FeatureEncryption) {
+		return FeatureEncryption.missingError()
+	}
+
+	var key []byte
+	key, writer.err = provider.MasterKey()
+	if writer.err != nil {
+		return writer.err
+	}
+	// Copied, as the Writer zeroes its keys once closed.
+	writer.encryptionKey = append([]byte(nil), key...)
+	writer.keys = provider
+	return nil
+}
+
+// wrapFileKey creates the master key of the file id, derived from
+// contentHash for convergent files, wrapped by the key provider.
+func (writer *Writer) wrapFileKey(id int, contentHash []byte) (encryptedKey []byte, fileMasterKey []byte, err error) {
+	if contentHash != nil {
+		fileMasterKey = convergentFileMasterKey(writer.encryptionKey, contentHash)
+	} else {
+		fileMasterKey = make([]byte, encryptionKeysize)
+		_, err = rand.Read(fileMasterKey)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	encryptedKey, err = writer.keys.WrapFileKey(id, fileMasterKey)
+	return encryptedKey, fileMasterKey, err
+}
+
+// SetKeyProvider unlocks a container created by [NewWriterKeyProvider]
+// with provider, as [Reader.SetPassword] does for containers encrypted
+// with a password. [ErrWrongKeyProvider] is returned if provider fails
+// to unwrap the file keys.
+func (reader *Reader) SetKeyProvider(provider KeyProvider) error {
+	if reader.checkError() {
+		return reader.err
+	}
+	if !reader.capabilities.Has(FeatureEncryption) {
+		return FeatureEncryption.missingError()
+	}
+
+	var key []byte
+	key, reader.err = provider.MasterKey()
+	if reader.err != nil {
+		return reader.err
+	}
+	// Copied, as the Reader zeroes it once locked.
+	reader.setContainerKey(append([]byte(nil), key...))
+	reader.keys = provider
+
+	if reader.verifyPassword() != nil {
+		if errors.Is(reader.err, ErrWrongPassword) {
+			reader.err = ErrWrongKeyProvider
+		}
+		return reader.err
+	}
+	reader.err = reader.verifyManifest()
+	return reader.err
+}
+
+// readFileMasterKey unseals the master key of the encrypted file id,
+// unwrapped by the key provider unless encrypted with its own password.
+// The key unwrapped by the provider is copied, as the master key is
+// zeroed once stretched, and the provider may keep it.
+func (reader *Reader) readFileMasterKey(id int, keyEncrypted []byte) ([]byte, error) {
+	if reader.keys != nil && !reader.filePasswordIds[id] {
+		key, err := reader.keys.UnwrapFileKey(id, keyEncrypted)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), key...), nil
+	}
+	return readFileKey(keyEncrypted, id, reader.masterKey(id))
+}
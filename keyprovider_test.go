@@ -0,0 +1,116 @@
+package arc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testKeyProvider wraps the file keys with AES-GCM under its key
+// encryption key, standing in for an external key service.
+type testKeyProvider struct {
+	masterKey []byte
+	aead      cipher.AEAD
+	wrapped   int
+}
+
+func newTestKeyProvider(t *testing.T, seed byte) *testKeyProvider {
+	t.Helper()
+	block, err := aes.NewCipher(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKeyProvider{masterKey: bytes.Repeat([]byte{seed + 1}, 32), aead: aead}
+}
+
+func (provider *testKeyProvider) MasterKey() ([]byte, error) {
+	return provider.masterKey, nil
+}
+
+func (provider *testKeyProvider) WrapFileKey(id int, fileKey []byte) ([]byte, error) {
+	provider.wrapped++
+	nonce := make([]byte, provider.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(provider.wrapped))
+	return provider.aead.Seal(nonce, nonce, fileKey, binary.BigEndian.AppendUint64(nil, uint64(id))), nil
+}
+
+func (provider *testKeyProvider) UnwrapFileKey(id int, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < provider.aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	nonce, sealed := wrapped[:provider.aead.NonceSize()], wrapped[provider.aead.NonceSize():]
+	return provider.aead.Open(nil, nonce, sealed, binary.BigEndian.AppendUint64(nil, uint64(id)))
+}
+
+func TestKeyProvider(t *testing.T) {
+	path := testContainerPath(t)
+	provider := newTestKeyProvider(t, 1)
+	writer, err := NewWriterKeyProvider(path, 0, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "first", Encryption: true}, []byte("first contents"))
+	writeTestFile(t, writer, Header{Name: "plain"}, []byte("plain contents"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err = OpenWriterKeyProvider(path, 0, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "second", Encryption: true}, []byte("second contents"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.wrapped != 2 {
+		t.Errorf("wrapped %d keys, want 2", provider.wrapped)
+	}
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	err = reader.SetKeyProvider(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, readTestFiles(t, reader), map[string]string{
+		"first":  "first contents",
+		"second": "second contents",
+		"plain":  "plain contents",
+	})
+}
+
+func TestKeyProviderWrong(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := NewWriterKeyProvider(path, 0, newTestKeyProvider(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "file", Encryption: true}, []byte("contents"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	err = reader.SetKeyProvider(newTestKeyProvider(t, 3))
+	if !errors.Is(err, ErrWrongKeyProvider) {
+		t.Fatalf("got %v, want %v", err, ErrWrongKeyProvider)
+	}
+}
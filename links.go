@@ -0,0 +1,115 @@
+package arc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const (
+	queryInsertLink = `INSERT INTO links VALUES (?, ?)`
+
+	queryLinkTarget = `SELECT target FROM links WHERE id = ?`
+
+	queryLinkTargetFile = `SELECT type, size FROM metadata WHERE id = ?`
+
+	queryUpdateSize = `UPDATE metadata SET size = ? WHERE id = ?`
+
+	// queryLinkColumn selects the target of the hard links
+	// along the metadata of files, NULL for other files.
+	queryLinkColumn = `(SELECT target FROM links WHERE links.id = metadata.id)`
+)
+
+// ErrInvalidLink is returned when writing a hard link
+// to a file that isn't a regular file of the container.
+var ErrInvalidLink = errors.New("hard link target isn't a regular file")
+
+// WriteHardlink adds the file described by header to the container as a
+// hard link to the file target, by its id, so files hardlinked together are
+// stored once. The link shares the data, and size, of target, and is read
+// as target is, while its name, modification time and attributes are its
+// own. The size of targets whose metadata is encrypted isn't shared. Files
+// linked by others can't be deleted, or replaced, before their links. The
+// container must support [FeatureHardlinks].
+func (writer *Writer) WriteHardlink(header *Header, target int) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if !writer.capabilities.Has(FeatureHardlinks) {
+		return FeatureHardlinks.missingError()
+	}
+
+	header.Type = TypeFile
+	header.Compression = 0
+	header.Convergent = false
+	err := writer.writeEntry(context.Background(), header, false, nil, target)
+	if err == nil {
+		header.LinkId = target
+	}
+	return fileError("write", header.Name, header.Id, err)
+}
+
+// insertLink records the file id as a hard link to target, or to the file
+// target links to, if it's a hard link too, so links never chain, and
+// returns the size of the file, recorded as the size of the link too.
+func insertLink(db execQuerier, id int, target int) (size int64, err error) {
+	var linked int
+	err = db.QueryRow(queryLinkTarget, target).Scan(&linked)
+	if err == nil {
+		target = linked
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	var fileType FileType
+	err = db.QueryRow(queryLinkTargetFile, target).Scan(&fileType, &size)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && fileType != TypeFile) {
+		return 0, ErrInvalidLink
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.Exec(queryInsertLink, id, target)
+	if err != nil {
+		return 0, err
+	}
+	_, err = db.Exec(queryUpdateSize, size, id)
+	return size, err
+}
+
+// resolveLink returns the id of the file whose data the file id reads,
+// the file it's a hard link to, or id itself.
+func (reader *Reader) resolveLink(ctx context.Context, id int) (int, error) {
+	if !reader.capabilities.Has(FeatureHardlinks) {
+		return id, nil
+	}
+
+	var target int
+	err := reader.db.QueryRowContext(ctx, queryLinkTarget, id).Scan(&target)
+	if errors.Is(err, sql.ErrNoRows) {
+		return id, nil
+	}
+	return target, err
+}
+
+// idScanner scans a nullable id column into
+// an id, left zero for NULL.
+type idScanner struct {
+	dest *int
+}
+
+func (scanner idScanner) Scan(src any) error {
+	var value sql.NullInt64
+	err := value.Scan(src)
+	if err != nil {
+		return err
+	}
+	*scanner.dest = int(value.Int64)
+	return nil
+}
@@ -0,0 +1,110 @@
+package arc
+
+import (
+	"errors"
+	"time"
+)
+
+// Lock forgets the container key and the keys of the files unlocked by
+// [Reader.AddFilePassword] or a [KeyProvider], zeroing them, so encrypted
+// files can't be read, nor their names decrypted, until unlocked again by
+// [Reader.Unlock]. Long running processes holding containers open lock
+// them once idle, so the keys don't stay in memory.
+func (reader *Reader) Lock() {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	if reader.lockTimer != nil {
+		reader.lockTimer.Stop()
+	}
+	wipe(reader.encryptionKey)
+	reader.encryptionKey = nil
+	for id, key := range reader.fileKeys {
+		wipe(key)
+		delete(reader.fileKeys, id)
+	}
+	reader.keys = nil
+}
+
+// Unlock derives the container key from password again, after
+// [Reader.Lock], as [Reader.SetPassword]. Unlike it, [ErrWrongPassword]
+// leaves the Reader locked, but usable, so the password can be retried.
+func (reader *Reader) Unlock(password []byte) error {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	err := reader.SetPassword(password)
+	if errors.Is(err, ErrWrongPassword) {
+		reader.Lock()
+		reader.err = nil
+		return err
+	}
+	if err == nil {
+		reader.touchKeys()
+	}
+	return err
+}
+
+// SetAutoLock locks the Reader, as [Reader.Lock], once its keys weren't
+// used for idle, or never when idle isn't positive, as by default. The
+// keys are used by reading encrypted files and decrypting their names, so
+// reads in progress when the Reader locks itself fail.
+func (reader *Reader) SetAutoLock(idle time.Duration) {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	if reader.lockTimer != nil {
+		reader.lockTimer.Stop()
+		reader.lockTimer = nil
+	}
+	reader.autoLock = idle
+	if idle > 0 {
+		reader.lockTimer = time.AfterFunc(idle, reader.Lock)
+	}
+}
+
+// touchKeys delays the automatic lock of the Reader, as
+// the keys were just used.
+func (reader *Reader) touchKeys() {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	reader.resetLockTimer()
+}
+
+// resetLockTimer restarts the timer of the automatic lock, if any.
+// The caller holds keyMu.
+func (reader *Reader) resetLockTimer() {
+	if reader.lockTimer != nil {
+		reader.lockTimer.Reset(reader.autoLock)
+	}
+}
+
+// setContainerKey sets the container key, unlocking the Reader.
+func (reader *Reader) setContainerKey(key []byte) {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	reader.resetLockTimer()
+	reader.encryptionKey = key
+}
+
+// containerKey returns the container key, or nil while locked.
+func (reader *Reader) containerKey() []byte {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	reader.resetLockTimer()
+	return reader.encryptionKey
+}
+
+// clearContainerKey forgets the container key, zeroing it, as
+// derived from a wrong password.
+func (reader *Reader) clearContainerKey() {
+	reader.keyMu.Lock()
+	defer reader.keyMu.Unlock()
+
+	wipe(reader.encryptionKey)
+	reader.encryptionKey = nil
+}
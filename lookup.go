@@ -0,0 +1,27 @@
+package arc
+
+// findId returns the id of the file name, decrypting the names of the
+// encrypted files whose key is known.
+func (reader *Reader) findId(name string) (int, error) {
+	containerKey := reader.containerKey()
+	var masterKey func(id int) []byte
+	if containerKey != nil || len(reader.fileKeys) > 0 {
+		masterKey = reader.masterKey
+	}
+	indexKey := nameIndexKey(reader.capabilities, containerKey)
+	return findFileId(reader.db, masterKey, indexKey, name)
+}
+
+// OpenByName selects the file name for reading, as [Reader.Open]
+// with a transaction, finding it as [Reader.StatByName].
+func (reader *Reader) OpenByName(name string) error {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	id, err := reader.findId(name)
+	if err != nil {
+		return err
+	}
+	return reader.Open(id, true)
+}
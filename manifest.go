@@ -0,0 +1,224 @@
+package arc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	queryMetadataRows = `SELECT * FROM metadata ORDER BY id`
+
+	queryManifest = `SELECT mac FROM manifest`
+
+	queryInsertManifest = `INSERT INTO manifest VALUES (?)`
+
+	queryDeleteManifest = `DELETE FROM manifest`
+)
+
+const manifestKeyLabel = "arc manifest key"
+
+// ErrManifestMismatch is returned when the metadata of an encrypted
+// container doesn't match its manifest, as when files were dropped,
+// reordered or had their metadata changed without the container key.
+var ErrManifestMismatch = errors.New("container metadata doesn't match its manifest")
+
+// manifestKey derives the key authenticating the manifest from the container key.
+func manifestKey(containerKey []byte) []byte {
+	key := make([]byte, encryptionKeysize)
+	input := append([]byte(manifestKeyLabel), containerKey...)
+	sha3.ShakeSum256(key, input)
+	wipe(input)
+	return key
+}
+
+// writeManifestValue writes value to mac, tagged by its type and
+// prefixed by its length, so distinct rows never hash alike.
+func writeManifestValue(mac hash.Hash, value any) {
+	var tag byte
+	var data []byte
+	switch value := value.(type) {
+	case nil:
+	case int64:
+		tag = 1
+		data = binary.BigEndian.AppendUint64(nil, uint64(value))
+	case float64:
+		tag = 2
+		data = binary.BigEndian.AppendUint64(nil, math.Float64bits(value))
+	case []byte:
+		tag = 3
+		data = value
+	case string:
+		tag = 4
+		data = []byte(value)
+	default:
+		tag = 5
+		data = []byte(fmt.Sprint(value))
+	}
+
+	mac.Write([]byte{tag})
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(len(data))))
+	mac.Write(data)
+}
+
+// newManifestMAC returns the MAC of a manifest, keyed by the container
+// key, having written the names of the columns of the metadata. Each
+// metadata row is then written, in order of id, by writeManifestValue.
+func newManifestMAC(containerKey []byte, columns []string) hash.Hash {
+	key := manifestKey(containerKey)
+	mac := hmac.New(sha256.New, key)
+	wipe(key)
+	for _, column := range columns {
+		writeManifestValue(mac, column)
+	}
+	return mac
+}
+
+// computeManifest returns the MAC, keyed by the container key, of all
+// metadata rows, in order of id, along with the names of their columns.
+func computeManifest(db execQuerier, containerKey []byte) (sum []byte, err error) {
+	rows, err := db.Query(queryMetadataRows)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := newManifestMAC(containerKey, columns)
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			writeManifestValue(mac, value)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return mac.Sum(nil), nil
+}
+
+// storeManifest replaces the manifest of the container opened in db by one
+// computed with containerKey. Nothing is stored in containers without
+// [FeatureManifest], or with no container key.
+func storeManifest(db execQuerier, capabilities Capabilities, containerKey []byte) error {
+	if !capabilities.Has(FeatureManifest) || containerKey == nil {
+		return nil
+	}
+
+	sum, err := computeManifest(db, containerKey)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryDeleteManifest)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryInsertManifest, sum)
+	return err
+}
+
+// hasManifest reports whether the container opened in db stores a manifest.
+func hasManifest(db execQuerier, capabilities Capabilities) (bool, error) {
+	if !capabilities.Has(FeatureManifest) {
+		return false, nil
+	}
+
+	var sum []byte
+	err := db.QueryRow(queryManifest).Scan(&sum)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// verifyManifest checks the metadata against the manifest of the
+// container, once the container key is known. Encrypted containers
+// with [FeatureManifest] must store a manifest, or their metadata
+// is reported as tampered.
+func (reader *Reader) verifyManifest() error {
+	containerKey := reader.containerKey()
+	if !reader.capabilities.Has(FeatureManifest) || containerKey == nil {
+		return nil
+	}
+
+	var stored []byte
+	err := reader.db.QueryRow(queryManifest).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrManifestMismatch
+	}
+	if err != nil {
+		return err
+	}
+
+	sum, err := computeManifest(reader.db, containerKey)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sum, stored) {
+		return ErrManifestMismatch
+	}
+	return nil
+}
+
+// verifyManifest checks the metadata against the manifest of the remote
+// container, as [Reader.verifyManifest].
+func (reader *RemoteReader) verifyManifest() error {
+	table, ok := reader.file.tables["manifest"]
+	if !reader.capabilities.Has(FeatureManifest) || !ok || reader.encryptionKey == nil {
+		return nil
+	}
+
+	var stored []byte
+	err := reader.file.walkTable(table.root, func(rowid int64, record []any) error {
+		stored, _ = table.row(rowid, record)["mac"].([]byte)
+		return errStopWalk
+	})
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrManifestMismatch
+	}
+
+	metadata := reader.file.tables["metadata"]
+	mac := newManifestMAC(reader.encryptionKey, metadata.columns)
+	err = reader.file.walkTable(metadata.root, func(rowid int64, record []any) error {
+		for _, value := range metadata.values(rowid, record) {
+			writeManifestValue(mac, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac.Sum(nil), stored) {
+		return ErrManifestMismatch
+	}
+	return nil
+}
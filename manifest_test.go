@@ -0,0 +1,72 @@
+package arc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestManifestTampered(t *testing.T) {
+	files := map[string]string{"first": "first contents", "second": "second contents"}
+	for _, statement := range []string{
+		`UPDATE metadata SET mod_time = mod_time + 1`,
+		`UPDATE metadata SET mode = 511`,
+		`UPDATE metadata SET uid = 0 WHERE id = (SELECT max(id) FROM metadata)`,
+		`DELETE FROM manifest`,
+	} {
+		path := testContainerPath(t)
+		writeTestContainer(t, path, testPassword, Header{Encryption: true}, files)
+		execTestContainer(t, path, statement)
+
+		reader, err := NewReader(path, testPassword)
+		if reader != nil {
+			reader.Close()
+		}
+		if !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("%s: got %v, want %v", statement, err, ErrManifestMismatch)
+		}
+	}
+}
+
+func TestManifestUpdated(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{
+		"first":  "first contents",
+		"second": "second contents",
+	})
+
+	// Changes made with the container key store the manifest again.
+	editor, err := OpenEditor(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.DeleteByName("first")
+	if err == nil {
+		err = editor.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := openTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "third", Encryption: true}, []byte("third contents"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{
+		"second": "second contents",
+		"third":  "third contents",
+	})
+}
+
+func TestManifestUnencrypted(t *testing.T) {
+	// Containers without a container key have no manifest to check.
+	path := testContainerPath(t)
+	files := map[string]string{"first": "first contents", "second": "second contents"}
+	writeTestContainer(t, path, nil, Header{}, files)
+	execTestContainer(t, path, `UPDATE metadata SET mod_time = mod_time + 1`)
+	checkFiles(t, readTestContainer(t, path, nil), files)
+}
@@ -0,0 +1,101 @@
+package arc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// memoryDatabaseArgs opens a database kept in memory, shared by
+// the connections of the process opening it by the same name.
+const memoryDatabaseArgs = databaseArgs + "&mode=memory&cache=shared"
+
+// ErrSerializeUnsupported is returned by [Writer.Serialize] when the
+// sqlite driver can't serialize databases.
+var ErrSerializeUnsupported = errors.New("sqlite driver can't serialize databases")
+
+// serializer is implemented by sqlite driver connections able to
+// serialize their databases, as the one of github.com/mattn/go-sqlite3.
+type serializer interface {
+	Serialize(schema string) ([]byte, error)
+}
+
+func memoryDataSourceName(name string) string {
+	return "file:" + url.PathEscape(name) + memoryDatabaseArgs
+}
+
+// NewMemoryWriter creates a new Writer and a container kept in memory,
+// instead of a file, so ephemeral containers need no temporary files.
+// The container is shared, by name, with the readers opened by
+// [NewMemoryReader] in the same process, and is freed once the Writer
+// and all of them are closed. [Writer.Serialize] returns its contents.
+func NewMemoryWriter(name string, blocksize int, password []byte) (*Writer, error) {
+	db, err := createDB(memoryDataSourceName(name), nil)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+	return newWriter(db, blocksize, password, KDFParams{})
+}
+
+// NewMemoryReader opens the container name created by [NewMemoryWriter]
+// for reading. The Writer must not be closed before the Reader is opened,
+// or the container is freed, so the manifest of encrypted containers must
+// be stored beforehand by [Writer.Serialize]. Serialized containers are
+// read from memory by [NewReaderAt].
+func NewMemoryReader(name string, password []byte) (*Reader, error) {
+	return newReader(memoryDataSourceName(name), password, nil)
+}
+
+// Serialize flushes the current file, stores the manifest of encrypted
+// containers, and returns the contents of the container database, as they would be stored in a file, so containers
+// created by [NewMemoryWriter] can be stored or sent elsewhere.
+// [ErrSerializeUnsupported] is returned if the sqlite driver
+// can't serialize databases.
+func (writer *Writer) Serialize() (data []byte, err error) {
+	if err = writer.acquire(); err != nil {
+		return nil, err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return nil, writer.err
+	}
+	if writer.flush() != nil {
+		return nil, writer.err
+	}
+	writer.err = writer.commitBatch()
+	if writer.err != nil {
+		return nil, writer.err
+	}
+	writer.err = storeSummary(writer.db, writer.capabilities)
+	if writer.err == nil {
+		writer.err = storeManifest(writer.db, writer.capabilities, writer.encryptionKey)
+	}
+	if writer.err != nil {
+		return nil, writer.err
+	}
+
+	conn, err := writer.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := conn.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	err = conn.Raw(func(driverConn any) error {
+		serializer, ok := driverConn.(serializer)
+		if !ok {
+			return ErrSerializeUnsupported
+		}
+		data, err = serializer.Serialize("main")
+		return err
+	})
+	return data, err
+}
@@ -0,0 +1,229 @@
+package arc
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics instruments a [Writer], or a [Reader], as it processes the
+// contents of files, so throughput, or the time left of long jobs, can be
+// reported, as by exporting each counter to a monitoring system. The
+// methods may be called concurrently, by the workers of a [ParallelWriter]
+// or by the goroutines of the codecs, and must return quickly, as they are
+// called for every block.
+type Metrics interface {
+	// AddBytesIn counts n bytes taken in: the contents of files
+	// written, or the stored data of files read.
+	AddBytesIn(n int64)
+
+	// AddBytesOut counts n bytes given out: the stored data of files
+	// written, or the contents of files read.
+	AddBytesOut(n int64)
+
+	// AddBlocks counts n blocks of stored data written, or read.
+	AddBlocks(n int64)
+
+	// AddCompressionTime counts d spent compressing, or decompressing,
+	// not including the time spent by the other stages.
+	AddCompressionTime(d time.Duration)
+
+	// AddEncryptionTime counts d spent encrypting, or decrypting,
+	// not including the time spent by the other stages.
+	AddEncryptionTime(d time.Duration)
+}
+
+// Counters implements [Metrics], adding up each metric.
+// The zero value is ready to use.
+type Counters struct {
+	BytesIn         atomic.Int64
+	BytesOut        atomic.Int64
+	Blocks          atomic.Int64
+	CompressionTime atomic.Int64
+	EncryptionTime  atomic.Int64
+}
+
+func (counters *Counters) AddBytesIn(n int64) {
+	counters.BytesIn.Add(n)
+}
+
+func (counters *Counters) AddBytesOut(n int64) {
+	counters.BytesOut.Add(n)
+}
+
+func (counters *Counters) AddBlocks(n int64) {
+	counters.Blocks.Add(n)
+}
+
+func (counters *Counters) AddCompressionTime(d time.Duration) {
+	counters.CompressionTime.Add(int64(d))
+}
+
+func (counters *Counters) AddEncryptionTime(d time.Duration) {
+	counters.EncryptionTime.Add(int64(d))
+}
+
+// SetMetrics sets metrics to be updated as files are written, or nil to
+// stop instrumenting. It's called concurrently when used by
+// a [ParallelWriter].
+func (writer *Writer) SetMetrics(metrics Metrics) {
+	writer.metrics = metrics
+}
+
+// SetMetrics sets metrics to be updated as files opened by
+// [Reader.Open], or [Reader.OpenStream], are read, or nil to
+// stop instrumenting.
+func (reader *Reader) SetMetrics(metrics Metrics) {
+	reader.metrics = metrics
+}
+
+// countBlock counts a block, of size bytes of stored data, written,
+// or read, if read, to metrics, if not nil.
+func countBlock(metrics Metrics, size int, read bool) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.AddBlocks(1)
+	if read {
+		metrics.AddBytesIn(int64(size))
+	} else {
+		metrics.AddBytesOut(int64(size))
+	}
+}
+
+// stage is a stage of the chain processing the contents of a file.
+type stage int
+
+const (
+	stageStorage stage = iota
+	stageEncryption
+	stageCompression
+)
+
+// stageTimer times a stage of the chain of writers, or readers, of a file,
+// excluding the time spent by the stage it feeds, or is fed by, inner, so
+// each stage is accounted once. As codecs may call inner from goroutines
+// of their own, the exclusion is an estimate.
+type stageTimer struct {
+	metrics Metrics
+	stage   stage
+	inner   *stageTimer
+	spent   atomic.Int64
+}
+
+// time runs call, counting the time spent to metrics.
+func (timer *stageTimer) time(call func()) {
+	var before int64
+	if timer.inner != nil {
+		before = timer.inner.spent.Load()
+	}
+	start := time.Now()
+	call()
+	elapsed := time.Since(start)
+	timer.spent.Add(int64(elapsed))
+	if timer.inner != nil {
+		elapsed -= time.Duration(timer.inner.spent.Load() - before)
+	}
+
+	elapsed = max(elapsed, 0)
+	switch timer.stage {
+	case stageEncryption:
+		timer.metrics.AddEncryptionTime(elapsed)
+	case stageCompression:
+		timer.metrics.AddCompressionTime(elapsed)
+	}
+}
+
+// stageMeter builds the timers of the stages of a chain, innermost first,
+// each stage being fed by, or feeding, the previous one. With no
+// metrics, the stages are left as they are.
+type stageMeter struct {
+	metrics Metrics
+	last    *stageTimer
+}
+
+func (meter *stageMeter) timer(stage stage) *stageTimer {
+	meter.last = &stageTimer{metrics: meter.metrics, stage: stage, inner: meter.last}
+	return meter.last
+}
+
+// writer times the stage writing to the previous one.
+func (meter *stageMeter) writer(next io.WriteCloser, stage stage) io.WriteCloser {
+	if meter.metrics == nil {
+		return next
+	}
+	return &timedWriter{next: next, timer: meter.timer(stage)}
+}
+
+// reader times the stage reading from the previous one.
+func (meter *stageMeter) reader(src io.Reader, stage stage) io.Reader {
+	if meter.metrics == nil {
+		return src
+	}
+	return &timedReader{src: src, timer: meter.timer(stage)}
+}
+
+// contents counts the contents written to the chain, atop it.
+func (meter *stageMeter) contents(next io.Writer) io.WriteCloser {
+	if meter.metrics == nil {
+		return nil
+	}
+	return contentsWriter{next: next, metrics: meter.metrics}
+}
+
+type timedWriter struct {
+	next  io.WriteCloser
+	timer *stageTimer
+}
+
+func (writer *timedWriter) Write(p []byte) (n int, err error) {
+	writer.timer.time(func() {
+		n, err = writer.next.Write(p)
+	})
+	return n, err
+}
+
+func (writer *timedWriter) Close() (err error) {
+	writer.timer.time(func() {
+		err = writer.next.Close()
+	})
+	return err
+}
+
+// unwrapWriter returns the writer timed by writer, if timed.
+func unwrapWriter(writer io.WriteCloser) io.WriteCloser {
+	if timed, ok := writer.(*timedWriter); ok {
+		return timed.next
+	}
+	return writer
+}
+
+type timedReader struct {
+	src   io.Reader
+	timer *stageTimer
+}
+
+func (reader *timedReader) Read(p []byte) (n int, err error) {
+	reader.timer.time(func() {
+		n, err = reader.src.Read(p)
+	})
+	return n, err
+}
+
+// contentsWriter counts the contents written to the next writer, as
+// bytes taken in, being left open, as hashWriter does.
+type contentsWriter struct {
+	next    io.Writer
+	metrics Metrics
+}
+
+func (writer contentsWriter) Write(p []byte) (int, error) {
+	n, err := writer.next.Write(p)
+	writer.metrics.AddBytesIn(int64(n))
+	return n, err
+}
+
+func (contentsWriter) Close() error {
+	return nil
+}
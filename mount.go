@@ -0,0 +1,35 @@
+package arc
+
+import (
+	"io/fs"
+
+	"github.com/bernardo1r/arc/internal/fuse"
+)
+
+// Mount is a filesystem mounted with [MountFS].
+type Mount struct {
+	server *fuse.Server
+}
+
+// MountFS mounts fsys, such as the [FS] of a container, read-only at the
+// folder dir, so its files can be browsed with any program. The files are
+// only served once [Mount.Serve] is called. Mounting needs FUSE, so it is
+// only supported on Linux, either as root or with fusermount installed.
+func MountFS(dir string, fsys fs.FS) (*Mount, error) {
+	server, err := fuse.Mount(dir, fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Mount{server: server}, nil
+}
+
+// Serve replies to the requests of the kernel until the filesystem
+// is unmounted. Requests are served concurrently.
+func (mount *Mount) Serve() error {
+	return mount.server.Serve()
+}
+
+// Unmount unmounts the filesystem, making Serve return.
+func (mount *Mount) Unmount() error {
+	return mount.server.Unmount()
+}
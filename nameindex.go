@@ -0,0 +1,83 @@
+package arc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	queryInsertNameMAC = `INSERT INTO name_index VALUES (?, ?)`
+
+	queryDeleteNameMAC = `DELETE FROM name_index WHERE id = ? OR mac = ?`
+
+	queryIdByNameMAC = `SELECT id FROM name_index WHERE mac = ?`
+
+	queryUnindexedNames = `SELECT EXISTS(SELECT 1 FROM metadata
+		WHERE encrypted = 1 AND id NOT IN (SELECT id FROM name_index))`
+)
+
+const nameIndexLabel = "arc name index key"
+
+// nameIndexKey returns the key of the MACs of the names of the encrypted
+// files, derived from the container key, or nil if the container doesn't
+// support [FeatureNameIndex] or the key isn't known.
+func nameIndexKey(capabilities Capabilities, containerKey []byte) []byte {
+	if containerKey == nil || !capabilities.Has(FeatureNameIndex) {
+		return nil
+	}
+
+	key := make([]byte, encryptionKeysize)
+	input := append([]byte(nameIndexLabel), containerKey...)
+	sha3.ShakeSum256(key, input)
+	wipe(input)
+	return key
+}
+
+// nameMAC returns the MAC of name indexing it under key.
+func nameMAC(key []byte, name string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	return mac.Sum(nil)
+}
+
+// storeNameMAC indexes name as the name of the encrypted file id,
+// replacing its previous MAC, if any. The file named name, being replaced
+// by id (see [ConflictOverwrite]), is left out of the index, and found
+// by decrypting its name if restored. It's a no-op if key is nil.
+func storeNameMAC(db execQuerier, key []byte, id int, name string) error {
+	if key == nil {
+		return nil
+	}
+
+	mac := nameMAC(key, name)
+	_, err := db.Exec(queryDeleteNameMAC, id, mac)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryInsertNameMAC, mac, id)
+	return err
+}
+
+// findIndexedId returns the id of the encrypted file name from the name
+// index, whose key is key. complete reports whether all the encrypted files
+// are indexed, so a name not found isn't the name of any of them.
+func findIndexedId(db execQuerier, key []byte, name string) (id int, complete bool, err error) {
+	err = db.QueryRow(queryIdByNameMAC, nameMAC(key, name)).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	var unindexed bool
+	err = db.QueryRow(queryUnindexedNames).Scan(&unindexed)
+	if err != nil {
+		return 0, false, err
+	}
+	return 0, !unindexed, nil
+}
@@ -0,0 +1,473 @@
+package arc
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// parallelCommitInterval is the number of database operations a
+// [ParallelWriter] runs in each transaction, at least: transactions are
+// only committed once no file is in the middle of being written, unless
+// the container records the files being written, so partial files are
+// rolled back by [Resume] after a crash.
+const parallelCommitInterval = 1024
+
+// ErrParallelWriterClosed is returned when ParallelWriter is used after closed.
+var ErrParallelWriterClosed = errors.New("parallel writer closed")
+
+// parallelOp is a database operation, run by the database goroutine.
+type parallelOp struct {
+	run  func(db execQuerier) error
+	done chan error
+}
+
+// parallelJob is a file to be written by a worker.
+type parallelJob struct {
+	header *Header
+	path   string
+}
+
+// ParallelWriter writes many files to a container concurrently. Each file
+// is read, compressed and encrypted by one of its workers, while the
+// database operations are run by a single goroutine, in batched transactions.
+// The files that fail to be written are deleted, along with those being
+// written once the database fails, so no partial file is left.
+//
+// Files are written in no particular order, so their ids may not follow
+// the order of [ParallelWriter.WriteFile] calls.
+type ParallelWriter struct {
+	writer  *Writer
+	jobs    chan parallelJob
+	ops     chan parallelOp
+	workers sync.WaitGroup
+	dbDone  chan error
+	mu      sync.Mutex
+	err     error
+	closed  bool
+
+	// inFlight are the files being written, by id, with the files they
+	// replace. It's only used by the database goroutine.
+	inFlight map[int]replacedFile
+
+	// owner is set when the ParallelWriter holds the writer, so it
+	// isn't used directly, releasing it once closed.
+	owner bool
+}
+
+// NewParallelWriter returns a ParallelWriter writing to the container of
+// writer with the given number of workers, or [runtime.NumCPU] workers if
+// not positive. The writer must not be used directly until the
+// ParallelWriter is closed, nor have dictionaries added: its methods fail
+// with [ErrConcurrentUse] meanwhile, but [Writer.Unchanged]. Likewise, the
+// ParallelWriter fails with it if the writer is in use already.
+func NewParallelWriter(writer *Writer, workers int) *ParallelWriter {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	pwriter := &ParallelWriter{
+		writer: writer,
+		jobs:   make(chan parallelJob, workers),
+		ops:    make(chan parallelOp),
+		dbDone: make(chan error, 1),
+
+		inFlight: make(map[int]replacedFile),
+	}
+	pwriter.err = writer.acquire()
+	pwriter.owner = pwriter.err == nil
+	go pwriter.runDatabase()
+	pwriter.workers.Add(workers)
+	for range workers {
+		go pwriter.runWorker()
+	}
+
+	return pwriter
+}
+
+func (pwriter *ParallelWriter) setError(err error) {
+	pwriter.mu.Lock()
+	if pwriter.err == nil {
+		pwriter.err = err
+	}
+	pwriter.mu.Unlock()
+}
+
+func (pwriter *ParallelWriter) error() error {
+	pwriter.mu.Lock()
+	defer pwriter.mu.Unlock()
+	return pwriter.err
+}
+
+// runDatabase runs the database operations, committing them every
+// parallelCommitInterval operations, once they may be. After an operation
+// fails, the pending ones are rolled back, all following ones fail, and
+// the files in flight, committed before, are deleted.
+func (pwriter *ParallelWriter) runDatabase() {
+	var transaction *sql.Tx
+	var count int
+	var err error
+	pending := pwriter.writer.capabilities.Has(FeaturePendingFiles)
+	for op := range pwriter.ops {
+		if err == nil && transaction == nil {
+			transaction, err = pwriter.writer.db.Begin()
+		}
+		if err != nil {
+			op.done <- err
+			continue
+		}
+
+		err = op.run(transaction)
+		if err == nil {
+			count++
+			if count >= parallelCommitInterval && (pending || len(pwriter.inFlight) == 0) {
+				err = transaction.Commit()
+				transaction = nil
+				count = 0
+			}
+		}
+		if err != nil && transaction != nil {
+			transaction.Rollback()
+			transaction = nil
+		}
+		op.done <- err
+	}
+
+	if err == nil && transaction != nil {
+		err = transaction.Commit()
+	}
+	if err != nil {
+		err = errors.Join(err, pwriter.discardInFlight())
+	}
+	pwriter.dbDone <- err
+}
+
+// discardInFlight deletes the files in flight once the transaction failed,
+// as they may have been partially committed before, restoring the files
+// they replace.
+func (pwriter *ParallelWriter) discardInFlight() (err error) {
+	if len(pwriter.inFlight) == 0 {
+		return nil
+	}
+
+	transaction, err := pwriter.writer.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+	for id, replaced := range pwriter.inFlight {
+		err = discardFile(transaction, id, replaced)
+		if err != nil {
+			return err
+		}
+	}
+	clear(pwriter.inFlight)
+	return transaction.Commit()
+}
+
+// discardFile deletes the partially written file id, restoring the file
+// it replaces.
+func discardFile(db execQuerier, id int, replaced replacedFile) error {
+	_, err := db.Exec(queryDeleteFileById, id)
+	if err != nil {
+		return err
+	}
+	return restoreReplaced(db, replaced)
+}
+
+// discard deletes the file id, which failed to be written.
+func (pwriter *ParallelWriter) discard(id int) error {
+	return pwriter.do(func(db execQuerier) error {
+		replaced, ok := pwriter.inFlight[id]
+		if !ok {
+			return nil
+		}
+		err := discardFile(db, id, replaced)
+		if err == nil {
+			delete(pwriter.inFlight, id)
+		}
+		return err
+	})
+}
+
+// do runs run in the database goroutine, waiting for it.
+func (pwriter *ParallelWriter) do(run func(db execQuerier) error) error {
+	done := make(chan error, 1)
+	pwriter.ops <- parallelOp{run: run, done: done}
+	return <-done
+}
+
+func (pwriter *ParallelWriter) runWorker() {
+	defer pwriter.workers.Done()
+	for job := range pwriter.jobs {
+		if pwriter.error() != nil {
+			continue
+		}
+
+		err := pwriter.writeFile(job.header, job.path)
+		if err != nil {
+			pwriter.setError(err)
+		}
+	}
+}
+
+// parallelDataWriter splits the stored data of a file into blocks,
+// inserting them through the database goroutine.
+type parallelDataWriter struct {
+	pwriter   *ParallelWriter
+	id        int
+	blockSize int
+	currBlock int
+	stored    int64
+	buffer    bytes.Buffer
+}
+
+func (dwriter *parallelDataWriter) flush() error {
+	block := dwriter.buffer.Bytes()
+	err := dwriter.pwriter.do(func(db execQuerier) error {
+		if dwriter.pwriter.writer.dedup {
+			return insertDedupBlock(db, dwriter.id, dwriter.currBlock, block)
+		}
+		capabilities := dwriter.pwriter.writer.capabilities
+		_, err := db.Exec(insertDataQuery(capabilities), insertDataArgs(capabilities, dwriter.id, dwriter.currBlock, block)...)
+		return err
+	})
+	if err != nil {
+		return blockError("write", dwriter.id, dwriter.currBlock, err)
+	}
+
+	dwriter.stored += int64(len(block))
+	countBlock(dwriter.pwriter.writer.metrics, len(block), false)
+	dwriter.buffer.Reset()
+	dwriter.currBlock++
+	return nil
+}
+
+func (dwriter *parallelDataWriter) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		size := min(dwriter.blockSize-dwriter.buffer.Len(), len(p))
+		dwriter.buffer.Write(p[:size])
+		if dwriter.buffer.Len() == dwriter.blockSize {
+			err := dwriter.flush()
+			if err != nil {
+				return total - len(p), err
+			}
+		}
+		p = p[size:]
+	}
+
+	return total, nil
+}
+
+// Close inserts the last block, unless empty, as [Writer] does.
+func (dwriter *parallelDataWriter) Close() error {
+	if dwriter.buffer.Len() == 0 {
+		return nil
+	}
+	return dwriter.flush()
+}
+
+func (pwriter *ParallelWriter) writeFile(header *Header, path string) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := file.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	contentHash, err := pwriter.writer.inspectFile(header, file)
+	if err != nil {
+		return err
+	}
+	src := writeProgress(file, header.Name, sizeHint(file), pwriter.writer.progress)
+	return pwriter.writeContent(header, src, contentHash)
+}
+
+// writeContent writes the file described by header, with the contents of
+// src. contentHash is the hash of the contents, used for convergent encryption.
+func (pwriter *ParallelWriter) writeContent(header *Header, src io.Reader, contentHash []byte) (err error) {
+	defer func() {
+		err = fileError("write", header.Name, header.Id, err)
+	}()
+
+	writer := pwriter.writer
+	var file insertedFile
+	err = pwriter.do(func(db execQuerier) error {
+		var err error
+		file, err = writer.insertHeader(db, header, contentHash)
+		if err == nil {
+			pwriter.inFlight[header.Id] = file.replaced
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			pwriter.discard(header.Id)
+		}
+	}()
+
+	dwriter := &parallelDataWriter{
+		pwriter:   pwriter,
+		id:        header.Id,
+		blockSize: header.Blocksize,
+	}
+	writers, hash, err := writer.fileWriters(dwriter, header, file.dataKey, file.dict)
+	wipe(file.dataKey)
+	if err != nil {
+		return err
+	}
+
+	read, err := io.Copy(writers[len(writers)-1], src)
+	if err != nil {
+		return err
+	}
+	for i := len(writers) - 1; i >= 0; i-- {
+		err = writers[i].Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return pwriter.do(func(db execQuerier) error {
+		_, err := db.Exec(queryUpdateFileSize, read, dwriter.currBlock, header.Id)
+		if err == nil {
+			err = storeStoredSize(db, writer.capabilities, header.Id, dwriter.stored)
+		}
+		if err == nil {
+			err = storeHoles(db, header.Id, writers)
+		}
+		if err == nil {
+			err = storeSegments(db, header.Id, writers)
+		}
+		if err == nil {
+			err = storeSealedMetadata(db, header.Id, file.seal, read)
+		}
+		if err == nil && hash != nil {
+			_, err = db.Exec(queryUpdateChecksum, hash.Sum(nil), header.Id)
+		}
+		if err == nil {
+			err = writer.completeFile(db, header.Id, file.replaced)
+		}
+		if err == nil {
+			delete(pwriter.inFlight, header.Id)
+		}
+		return err
+	})
+}
+
+// WriteFile queues the file filepath to be added to the container
+// accordingly to header, which must not be used until the ParallelWriter
+// is closed. It only blocks while all workers are busy.
+//
+// Errors writing the file are returned by later calls, or by
+// [ParallelWriter.Close], after which no more files are written.
+func (pwriter *ParallelWriter) WriteFile(header *Header, filepath string) error {
+	err := pwriter.error()
+	if err != nil {
+		return err
+	}
+	if pwriter.closed {
+		return ErrParallelWriterClosed
+	}
+
+	pwriter.jobs <- parallelJob{header: header, path: filepath}
+	return nil
+}
+
+// WriteDir adds the directory described by header to the container,
+// waiting for it to be added.
+func (pwriter *ParallelWriter) WriteDir(header *Header) error {
+	err := pwriter.error()
+	if err != nil {
+		return err
+	}
+	if pwriter.closed {
+		return ErrParallelWriterClosed
+	}
+
+	header.Type = TypeDir
+	err = pwriter.do(func(db execQuerier) error {
+		file, err := pwriter.writer.insertHeader(db, header, nil)
+		if err != nil {
+			return err
+		}
+		wipe(file.dataKey)
+		err = storeSealedMetadata(db, header.Id, file.seal, 0)
+		if err != nil {
+			return err
+		}
+		return pwriter.writer.completeFile(db, header.Id, file.replaced)
+	})
+	if err != nil {
+		pwriter.setError(err)
+	}
+	return err
+}
+
+// WriteSymlink adds the symbolic link described by header, pointing
+// to linkTarget, to the container, waiting for it to be added.
+func (pwriter *ParallelWriter) WriteSymlink(header *Header, linkTarget string) error {
+	err := pwriter.error()
+	if err != nil {
+		return err
+	}
+	if pwriter.closed {
+		return ErrParallelWriterClosed
+	}
+
+	header.Type = TypeSymlink
+	header.Convergent = false
+	err = pwriter.writeContent(header, strings.NewReader(linkTarget), nil)
+	if err != nil {
+		pwriter.setError(err)
+	}
+	return err
+}
+
+// Close waits for the queued files to be written, commits them,
+// and closes the underlying [Writer].
+func (pwriter *ParallelWriter) Close() error {
+	if pwriter.closed {
+		return ErrParallelWriterClosed
+	}
+	pwriter.closed = true
+
+	close(pwriter.jobs)
+	pwriter.workers.Wait()
+	close(pwriter.ops)
+	err := <-pwriter.dbDone
+	if err != nil {
+		pwriter.setError(err)
+	}
+
+	err = pwriter.error()
+	if !pwriter.owner {
+		return err
+	}
+	if err != nil {
+		pwriter.writer.db.Close()
+		pwriter.writer.wipeKeys()
+		pwriter.writer.err = ErrWriterClosed
+		pwriter.writer.release()
+		return err
+	}
+	pwriter.writer.release()
+	return pwriter.writer.Close()
+}
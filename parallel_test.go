@@ -0,0 +1,94 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParallelWriterRoundTrip(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pwriter := NewParallelWriter(writer, 4)
+	want := make(map[string]string)
+	for i := range 16 {
+		name := fmt.Sprintf("file%d", i)
+		want[name] = fmt.Sprintf("contents of %s", name)
+		header := &Header{Name: name, Encryption: i%2 == 0}
+		err = pwriter.WriteFile(header, testSourceFile(t, []byte(want[name])))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = pwriter.WriteDir(&Header{Name: "dir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pwriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFiles(t, readTestContainer(t, path, testPassword), want)
+}
+
+func TestParallelWriterDiscardsFailedFile(t *testing.T) {
+	for _, pending := range []bool{true, false} {
+		t.Run(fmt.Sprintf("pending=%v", pending), func(t *testing.T) {
+			path := testContainerPath(t)
+			writeTestContainer(t, path, nil, Header{}, map[string]string{"kept": "contents"})
+			if !pending {
+				execTestContainer(t, path, `DROP TABLE pending_files`)
+			}
+			writer, err := OpenWriter(path, MinBlocksize, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// More blocks than a transaction holds, so they're committed
+			// while the file is being written, when pending.
+			contents := bytes.Repeat([]byte("x"), (parallelCommitInterval+64)*MinBlocksize)
+			errRead := errors.New("read failed")
+			pwriter := NewParallelWriter(writer, 2)
+			src := io.MultiReader(bytes.NewReader(contents), iotest.ErrReader(errRead))
+			err = pwriter.writeContent(&Header{Name: "partial"}, src, nil)
+			if !errors.Is(err, errRead) {
+				t.Fatalf("got %v, want %v", err, errRead)
+			}
+			err = pwriter.WriteFile(&Header{Name: "whole"}, testSourceFile(t, contents[:4*MinBlocksize]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = pwriter.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkFiles(t, readTestContainer(t, path, nil), map[string]string{
+				"kept":  "contents",
+				"whole": string(contents[:4*MinBlocksize]),
+			})
+			if pending {
+				reader, err := NewReader(path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer reader.Close()
+				var count int
+				err = reader.db.QueryRow(`SELECT count(*) FROM pending_files`).Scan(&count)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count != 0 {
+					t.Errorf("%d files left pending", count)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	queryContainerKeys = `SELECT id, key, name FROM encryption_metadata JOIN metadata USING (id)`
+
+	queryContainerKeysExcluding = `SELECT id, key, name FROM encryption_metadata JOIN metadata USING (id)
+		WHERE id NOT IN (SELECT id FROM file_key_params)`
+
+	queryUpdateEncryptionKey = `UPDATE encryption_metadata SET key = ? WHERE id = ?`
+
+	queryUpdateEncryptionKeyParams = `UPDATE encryption_key_params SET params = ?`
+)
+
+// sealedKey is the sealed master key of a file, along with its encrypted name.
+type sealedKey struct {
+	id   int
+	key  []byte
+	name string
+}
+
+// containerSealedKeys returns the sealed master keys of the files
+// encrypted with the container key.
+func (editor *Editor) containerSealedKeys(transaction *sql.Tx) (keys []sealedKey, err error) {
+	query := queryContainerKeys
+	if editor.capabilities.Has(FeatureFilePasswords) {
+		query = queryContainerKeysExcluding
+	}
+	rows, err := transaction.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var key sealedKey
+		err = rows.Scan(&key.id, &key.key, &key.name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// ChangePassword replaces the container key, derived from oldPassword, by a
+// key derived from newPassword. Only the master keys of the encrypted files
+// are sealed again, within one transaction, so the file data and names are
+// kept as they are, and the change is quick regardless of the size of the
+// container. Files encrypted with their own password are left untouched.
+// The name index (see [FeatureNameIndex]), whose key derives from the
+// container key, is rebuilt in the same transaction.
+//
+// The new key is derived with the cost of the old one, and a new salt.
+//
+// Files written afterwards with convergent encryption are not deduplicated
+// against the files written before, as their keys derive from the
+// container key.
+func (editor *Editor) ChangePassword(oldPassword []byte, newPassword []byte) (err error) {
+	if editor.err != nil {
+		return editor.err
+	}
+	if !editor.capabilities.Has(FeatureEncryption) {
+		return FeatureEncryption.missingError()
+	}
+
+	oldKey, err := readContainerKey(editor.db, editor.capabilities, oldPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotEncrypted
+	}
+	if err != nil {
+		return err
+	}
+	defer wipe(oldKey)
+
+	_, params, err := keySource(editor.db, editor.capabilities)
+	if err != nil {
+		return err
+	}
+	var kdf KDFParams
+	if params != nil {
+		kdf = kdfParams(params)
+	}
+	newKey, paramsString, err := deriveKey(newPassword, kdf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			wipe(newKey)
+		}
+	}()
+
+	transaction, err := editor.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	keys, err := editor.containerSealedKeys(transaction)
+	if err != nil {
+		return err
+	}
+	indexKey := nameIndexKey(editor.capabilities, newKey)
+	defer wipe(indexKey)
+	for _, key := range keys {
+		err = resealKey(transaction, key, oldKey, newKey, indexKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = transaction.Exec(queryUpdateEncryptionKeyParams, paramsString)
+	if err != nil {
+		return err
+	}
+	err = storeKeyCheck(transaction, editor.capabilities, newKey)
+	if err != nil {
+		return err
+	}
+	err = storeManifest(transaction, editor.capabilities, newKey)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.Commit()
+	if err != nil {
+		return err
+	}
+
+	wipe(editor.encryptionKey)
+	editor.encryptionKey = newKey
+	return nil
+}
+
+// resealKey seals the master key of the file of key, sealed with oldKey,
+// with newKey, indexing its name under indexKey, the key of the name index
+// derived from newKey, unless nil.
+func resealKey(transaction *sql.Tx, key sealedKey, oldKey []byte, newKey []byte, indexKey []byte) error {
+	fileMasterKey, err := readFileKey(key.key, key.id, oldKey)
+	if err != nil {
+		return ErrWrongPassword
+	}
+	defer wipe(fileMasterKey)
+
+	sealed, err := sealFileMasterKey(newKey, key.id, fileMasterKey)
+	if err != nil {
+		return err
+	}
+	_, err = transaction.Exec(queryUpdateEncryptionKey, sealed, key.id)
+	if err != nil || indexKey == nil {
+		return err
+	}
+
+	filenameKey, fileDataKey := stretchKey(fileMasterKey)
+	defer wipe(filenameKey, fileDataKey)
+	name, err := decryptFilename(key.name, filenameKey)
+	if err != nil {
+		return err
+	}
+	return storeNameMAC(transaction, indexKey, key.id, name)
+}
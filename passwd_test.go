@@ -0,0 +1,51 @@
+package arc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChangePasswordKeepsNameIndex(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, map[string]string{
+		"a": "first",
+		"b": "second",
+		"c": "third",
+	})
+	newPassword := []byte("new password")
+
+	editor, err := OpenEditor(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = editor.ChangePassword(testPassword, newPassword)
+	if err != nil {
+		editor.Close()
+		t.Fatal(err)
+	}
+	// Found through the name index, under the key of the new password.
+	err = editor.Rename("a", "renamed")
+	if err == nil {
+		err = editor.DeleteByName("b")
+	}
+	err2 := editor.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+
+	reader, err := NewReader(path, newPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for name, want := range map[string]error{"renamed": nil, "c": nil, "a": ErrFileNotFound, "b": ErrFileNotFound} {
+		_, err = reader.StatByName(name)
+		if !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %v", name, err, want)
+		}
+	}
+	checkFiles(t, readTestFiles(t, reader), map[string]string{"renamed": "first", "c": "third"})
+}
@@ -0,0 +1,84 @@
+package arc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// WriteContainer writes the closed container databasePath to w as a single
+// sequential stream, so containers, written to a file first, as SQLite
+// requires seeking, can be piped to other processes, or uploaded, and
+// stored back by [ReadContainer]. The stream is the container database
+// itself, so it's also opened, once stored in a file, by [NewReader], or
+// read from memory by [NewReaderAt]. Split containers must be joined by
+// [JoinVolumes] beforehand.
+func WriteContainer(w io.Writer, databasePath string) (n int64, err error) {
+	src, err := os.Open(databasePath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err2 := src.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	return io.Copy(w, src)
+}
+
+// ReadContainer stores the container streamed from r, as by
+// [WriteContainer], in the new file databasePath, reading r until EOF.
+// [ErrInvalidContainer] is returned, and the file removed, if the stream
+// isn't a container.
+func ReadContainer(r io.Reader, databasePath string) (err error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(sqliteMagic))
+	if errors.Is(err, io.EOF) || (err == nil && !bytes.Equal(magic, []byte(sqliteMagic))) {
+		return ErrInvalidContainer
+	}
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(databasePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(databasePath)
+		}
+	}()
+	_, err = io.Copy(dst, buffered)
+	err2 := dst.Close()
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	return checkContainer(databasePath)
+}
+
+// checkContainer checks the database databasePath is a container
+// this version of the library reads.
+func checkContainer(databasePath string) (err error) {
+	db, err := openDB("file:"+databasePath+databaseArgs+"&mode=ro", nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := db.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	_, err = detectCapabilities(db)
+	return err
+}
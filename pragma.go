@@ -0,0 +1,272 @@
+package arc
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Pragmas tunes the sqlite database of a container, set on each of its
+// connections. The zero value of each field keeps the sqlite default,
+// which favors durability over the speed of bulk insertion.
+type Pragmas struct {
+	// JournalMode is the journal mode, as "WAL", "DELETE" or "OFF".
+	JournalMode string `json:"journal_mode,omitempty" yaml:"journal_mode,omitempty"`
+
+	// Synchronous is how often sqlite waits for writes to reach the
+	// disk: "OFF", "NORMAL", "FULL" or "EXTRA".
+	Synchronous string `json:"synchronous,omitempty" yaml:"synchronous,omitempty"`
+
+	// CacheSize is the size of the page cache, in pages when
+	// positive, or in KiB when negative.
+	CacheSize int `json:"cache_size,omitempty" yaml:"cache_size,omitempty"`
+
+	// MmapSize is the number of bytes of the database
+	// read through memory mapping.
+	MmapSize int64 `json:"mmap_size,omitempty" yaml:"mmap_size,omitempty"`
+
+	// PageSize is the size, in bytes, of the database pages, a power
+	// of two between 512 and 65536. It's only set on new containers.
+	PageSize int `json:"page_size,omitempty" yaml:"page_size,omitempty"`
+
+	// BusyTimeout is how long, in milliseconds, sqlite retries when the
+	// database is locked by another connection before failing with
+	// SQLITE_BUSY, where -1 fails at once. The zero value keeps the
+	// default of the driver, 5 seconds.
+	BusyTimeout int `json:"busy_timeout,omitempty" yaml:"busy_timeout,omitempty"`
+
+	// key is the key encrypting the whole database, set
+	// by [Config.PageEncryption], and never serialized.
+	key []byte
+}
+
+// ErrInvalidPragmas is returned when [Pragmas] have a field with an
+// invalid value.
+var ErrInvalidPragmas = errors.New("invalid pragmas")
+
+// ErrPageEncryptionUnsupported is returned when opening a container with
+// [Config.PageEncryption] through a sqlite driver lacking SQLCipher.
+var ErrPageEncryptionUnsupported = errors.New("sqlite driver doesn't support page encryption")
+
+const queryCipherVersion = `PRAGMA cipher_version`
+
+var (
+	// FastWrite favors the speed of building large containers: the
+	// write-ahead log is never synced, so a crash of the system may
+	// corrupt the container, while a crash of the process may not.
+	FastWrite = Pragmas{
+		JournalMode: "WAL",
+		Synchronous: "OFF",
+		CacheSize:   -64 << 10,
+		MmapSize:    256 << 20,
+	}
+
+	// Durable keeps the container intact on crashes of the system,
+	// syncing the write-ahead log on each commit.
+	Durable = Pragmas{
+		JournalMode: "WAL",
+		Synchronous: "FULL",
+	}
+)
+
+var (
+	journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+	synchronousModes = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
+// statements returns the PRAGMA statements setting pragmas,
+// checking their values, as they are not bound as arguments.
+func (pragmas *Pragmas) statements() ([]string, error) {
+	if pragmas == nil {
+		return nil, nil
+	}
+
+	var statements []string
+	if pragmas.key != nil {
+		// Set first, as SQLCipher reads no page before the key is set.
+		key := strings.ReplaceAll(string(pragmas.key), "'", "''")
+		statements = append(statements, "PRAGMA key = '"+key+"'")
+	}
+	if pragmas.PageSize != 0 {
+		if pragmas.PageSize < 512 || pragmas.PageSize > 65536 || pragmas.PageSize&(pragmas.PageSize-1) != 0 {
+			return nil, fmt.Errorf("%w: invalid page size %d", ErrInvalidPragmas, pragmas.PageSize)
+		}
+		// Set before the journal mode, as it can't change in WAL mode.
+		statements = append(statements, "PRAGMA page_size = "+strconv.Itoa(pragmas.PageSize))
+	}
+	for _, pragma := range []struct {
+		name   string
+		value  string
+		values []string
+	}{
+		{"journal_mode", pragmas.JournalMode, journalModes},
+		{"synchronous", pragmas.Synchronous, synchronousModes},
+	} {
+		if pragma.value == "" {
+			continue
+		}
+		if !containsFold(pragma.values, pragma.value) {
+			return nil, fmt.Errorf("%w: invalid %s %q", ErrInvalidPragmas, pragma.name, pragma.value)
+		}
+		statements = append(statements, "PRAGMA "+pragma.name+" = "+strings.ToUpper(pragma.value))
+	}
+	if pragmas.CacheSize != 0 {
+		statements = append(statements, "PRAGMA cache_size = "+strconv.Itoa(pragmas.CacheSize))
+	}
+	if pragmas.MmapSize < 0 {
+		return nil, fmt.Errorf("%w: negative mmap size", ErrInvalidPragmas)
+	}
+	if pragmas.MmapSize != 0 {
+		statements = append(statements, "PRAGMA mmap_size = "+strconv.FormatInt(pragmas.MmapSize, 10))
+	}
+	if pragmas.BusyTimeout < -1 {
+		return nil, fmt.Errorf("%w: invalid busy timeout %d", ErrInvalidPragmas, pragmas.BusyTimeout)
+	}
+	if pragmas.BusyTimeout != 0 {
+		statements = append(statements, "PRAGMA busy_timeout = "+strconv.Itoa(max(pragmas.BusyTimeout, 0)))
+	}
+
+	return statements, nil
+}
+
+// containsFold reports whether values holds value, ignoring case.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// openDB opens the database dataSourceName with the driver selected by
+// [SetDriver], setting pragmas, if not nil, on each of its connections.
+func openDB(dataSourceName string, pragmas *Pragmas) (*sql.DB, error) {
+	statements, err := pragmas.statements()
+	if err != nil {
+		return nil, err
+	}
+
+	name := currentDriver()
+	if name != DefaultDriver {
+		// Only DefaultDriver reads the foreign keys from dataSourceName.
+		statements = append(statements, queryForeignKeys)
+	}
+	db, err := sql.Open(name, dataSourceName)
+	if err != nil || len(statements) == 0 {
+		return db, err
+	}
+
+	connector := pragmaConnector{
+		driver:         db.Driver(),
+		dataSourceName: dataSourceName,
+		statements:     statements,
+		keyed:          pragmas.key != nil,
+	}
+	db.Close()
+	return sql.OpenDB(connector), nil
+}
+
+// pragmaConnector opens the connections of a database,
+// running the PRAGMA statements on each of them.
+type pragmaConnector struct {
+	driver         driver.Driver
+	dataSourceName string
+	statements     []string
+
+	// keyed is set when the statements set the key of the database,
+	// so the driver is checked to support it, as sqlite ignores it.
+	keyed bool
+}
+
+func (connector pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.driver.Open(connector.dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range connector.statements {
+		err = execConn(ctx, conn, statement)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if connector.keyed {
+		var version string
+		version, err = queryConnString(ctx, conn, queryCipherVersion)
+		if err == nil && version == "" {
+			err = ErrPageEncryptionUnsupported
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (connector pragmaConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// queryConnString returns the first column of the first row returned by
+// query, with no arguments, on conn, or the empty string if no row is.
+func queryConnString(ctx context.Context, conn driver.Conn, query string) (string, error) {
+	var rows driver.Rows
+	var err error
+	if queryer, ok := conn.(driver.QueryerContext); ok {
+		rows, err = queryer.QueryContext(ctx, query, nil)
+	} else {
+		var statement driver.Stmt
+		statement, err = conn.Prepare(query)
+		if err != nil {
+			return "", err
+		}
+		defer statement.Close()
+		rows, err = statement.Query(nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	values := make([]driver.Value, len(rows.Columns()))
+	err = rows.Next(values)
+	if errors.Is(err, io.EOF) || len(values) == 0 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch value := values[0].(type) {
+	case string:
+		return value, nil
+	case []byte:
+		return string(value), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// execConn runs the statement query, with no arguments, on conn.
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+
+	statement, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+	_, err = statement.Exec(nil)
+	return err
+}
@@ -0,0 +1,96 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestPragmaStatements(t *testing.T) {
+	pragmas := &Pragmas{JournalMode: "wal", PageSize: 4096, key: []byte("pass'word")}
+	statements, err := pragmas.statements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PRAGMA key = 'pass''word'",
+		"PRAGMA page_size = 4096",
+		"PRAGMA journal_mode = WAL",
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("got %q, want %q", statements, want)
+	}
+	for i := range want {
+		if statements[i] != want[i] {
+			t.Fatalf("got %q, want %q", statements, want)
+		}
+	}
+
+	for _, pragmas := range []*Pragmas{{PageSize: 1000}, {JournalMode: "wal; DROP TABLE metadata"}} {
+		_, err = pragmas.statements()
+		if !errors.Is(err, ErrInvalidPragmas) {
+			t.Errorf("%+v: got %v, want %v", pragmas, err, ErrInvalidPragmas)
+		}
+	}
+}
+
+func TestPageEncryptionConfig(t *testing.T) {
+	config := &Config{PageEncryption: true, Password: testPassword, KDF: testKDF}
+	err := config.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("without encryption: got %v, want %v", err, ErrInvalidConfig)
+	}
+
+	// The key is set on a copy of the pragmas.
+	config.Encryption = true
+	config.Pragmas = &Pragmas{PageSize: 4096}
+	pragmas := config.pragmas()
+	if !bytes.Equal(pragmas.key, testPassword) || pragmas.PageSize != 4096 || config.Pragmas.key != nil {
+		t.Errorf("got pragmas %+v, config pragmas %+v", pragmas, config.Pragmas)
+	}
+}
+
+// TestPageEncryption writes a container with page encryption, checking
+// it's unreadable without the password, or else that the sqlite driver
+// reports lacking SQLCipher.
+func TestPageEncryption(t *testing.T) {
+	path := testContainerPath(t)
+	config := &Config{Encryption: true, PageEncryption: true, Password: testPassword, KDF: testKDF}
+	writer, err := NewWriterConfig(path, config)
+	if errors.Is(err, ErrPageEncryptionUnsupported) {
+		// Nothing was written in the clear before failing.
+		info, statErr := os.Stat(path)
+		if statErr == nil && info.Size() != 0 {
+			t.Fatalf("wrote %d bytes", info.Size())
+		}
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"file": "contents"}
+	writeTestFile(t, writer, Header{Name: "file", Encryption: true}, []byte(files["file"]))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(data, []byte("SQLite format 3")) {
+		t.Error("database header stored in the clear")
+	}
+	_, err = NewReader(path, testPassword)
+	if err == nil {
+		t.Error("read without the page encryption key")
+	}
+	reader, err := NewReaderConfig(path, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	checkFiles(t, readTestFiles(t, reader), files)
+}
@@ -0,0 +1,61 @@
+package arc
+
+import "bytes"
+
+// prefetchedBlock is a block read ahead by the prefetcher of a dataReader.
+type prefetchedBlock struct {
+	data []byte
+	last bool
+	err  error
+}
+
+// SetPrefetch makes the files read by the Reader, as by [Reader.ReadToFile]
+// and [Reader.ExtractAll], read up to depth blocks ahead, in the background, so
+// decrypting and decompressing a block overlaps with querying the next
+// ones, instead of stalling on them. It speeds up reading files
+// sequentially, at the cost of holding up to depth more blocks in memory
+// for each file being read. Zero, the default, disables it.
+func (reader *Reader) SetPrefetch(depth int) {
+	reader.prefetch = max(depth, 0)
+}
+
+// startPrefetch starts reading up to depth blocks ahead, in a goroutine
+// of its own, which owns the rows until stopped by cleanup.
+func (dreader *dataReader) startPrefetch(depth int) {
+	dreader.blocks = make(chan prefetchedBlock, depth)
+	dreader.stop = make(chan struct{})
+	dreader.stopped = make(chan struct{})
+	go dreader.prefetchBlocks(dreader.blocks, dreader.stop, dreader.stopped)
+}
+
+// prefetchBlocks reads the blocks to blocks, until the last one,
+// an error, or stop is closed, closing stopped once done.
+func (dreader *dataReader) prefetchBlocks(blocks chan<- prefetchedBlock, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	for block := dreader.currBlock; ; block++ {
+		data, last, err := dreader.nextBlock(block)
+		if data != nil {
+			// The blocks scanned are only valid until the next one is.
+			data = bytes.Clone(data)
+		}
+		select {
+		case blocks <- prefetchedBlock{data: data, last: last, err: err}:
+		case <-stop:
+			return
+		}
+		if last || err != nil {
+			return
+		}
+	}
+}
+
+// stopPrefetch stops the prefetcher, if any, waiting for it to be done.
+func (dreader *dataReader) stopPrefetch() {
+	if dreader.stop == nil {
+		return
+	}
+	close(dreader.stop)
+	<-dreader.stopped
+	dreader.stop = nil
+}
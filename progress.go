@@ -0,0 +1,93 @@
+package arc
+
+import (
+	"io"
+	"io/fs"
+)
+
+// ProgressFunc reports the progress of writing, or reading, the file name:
+// written bytes of its contents, out of total, were processed so far.
+// total is -1 when the size isn't known beforehand, as when writing
+// from a pipe.
+type ProgressFunc func(name string, written int64, total int64)
+
+// progressReader reports the bytes read from reader to progress.
+type progressReader struct {
+	reader   io.Reader
+	name     string
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if n > 0 {
+		reader.written += int64(n)
+		reader.progress(reader.name, reader.written, reader.total)
+	}
+	return n, err
+}
+
+// sizeHint returns the size of the contents read from src, when src tells
+// it, as files and in-memory readers do, or -1 if unknown.
+func sizeHint(src io.Reader) int64 {
+	switch src := src.(type) {
+	case interface{ Len() int }:
+		return int64(src.Len())
+	case interface{ Stat() (fs.FileInfo, error) }:
+		info, err := src.Stat()
+		if err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return -1
+}
+
+// writeProgress wraps src, the contents of name, whose size is total,
+// reporting its progress to progress, if not nil.
+func writeProgress(src io.Reader, name string, total int64, progress ProgressFunc) io.Reader {
+	if progress == nil {
+		return src
+	}
+
+	return &progressReader{
+		reader:   src,
+		name:     name,
+		total:    total,
+		progress: progress,
+	}
+}
+
+// SetProgress sets progress to be called as the contents of each file
+// are written by [Writer.WriteFile] or [Writer.WriteFrom], or nil to stop reporting. When used
+// by a [ParallelWriter], progress is called concurrently by its workers.
+func (writer *Writer) SetProgress(progress ProgressFunc) {
+	writer.progress = progress
+}
+
+// SetProgress sets progress to be called as the contents of each file
+// are written by [Reader.ReadToFile], or nil to stop reporting.
+func (reader *Reader) SetProgress(progress ProgressFunc) {
+	reader.progress = progress
+}
+
+// readProgress wraps src, the contents of file id, reporting its progress
+// to the progress of reader, if set.
+func (reader *Reader) readProgress(id int, src io.Reader) (io.Reader, error) {
+	if reader.progress == nil {
+		return src, nil
+	}
+
+	row := reader.db.QueryRow(reader.metadataQuery()+" WHERE id = ?", id)
+	header, err := reader.scanHeader(row.Scan)
+	if err != nil {
+		return nil, err
+	}
+	return &progressReader{
+		reader:   src,
+		name:     header.Name,
+		total:    header.Size,
+		progress: reader.progress,
+	}, nil
+}
@@ -0,0 +1,369 @@
+package arc
+
+import (
+	"crypto/cipher"
+	"database/sql"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/bernardo1r/encdec"
+)
+
+const (
+	queryRangeMetadataById = `SELECT size, compressed, encrypted FROM metadata WHERE id = ?`
+
+	queryBlocksizeById = `SELECT length(data) FROM data WHERE id = ? AND block_id = 0`
+
+	queryDataRangeById = `SELECT data FROM data
+		WHERE id = ? AND block_id BETWEEN ? AND ?
+		ORDER BY block_id ASC`
+)
+
+// ErrInvalidRange is returned when reading a range with negative offset or length.
+var ErrInvalidRange = errors.New("invalid range")
+
+// storedRange reads length bytes of the stored (possibly encrypted and
+// compressed) data of file id, starting at offset. As all blocks of a file,
+// but the last, have the same size, only the blocks covering the range are
+// read from the container, selected by query, as returned by blocksQuery.
+func storedRange(db *sql.DB, query string, id int, blocksize int64, offset int64, length int64) (buffer []byte, err error) {
+	if length == 0 {
+		return nil, nil
+	}
+
+	first := offset / blocksize
+	last := (offset + length - 1) / blocksize
+	rows, err := db.Query(query, id, first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	buffer = make([]byte, 0, (last-first+1)*blocksize)
+	for rows.Next() {
+		var block sql.RawBytes
+		err = rows.Scan(&block)
+		if err != nil {
+			return nil, err
+		}
+		buffer = append(buffer, block...)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	start := offset - first*blocksize
+	if start >= int64(len(buffer)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	end := min(start+length, int64(len(buffer)))
+	return buffer[start:end], nil
+}
+
+// decryptedRange reads the plaintext range of an encrypted and uncompressed
+// file. As encdec encrypts each chunk independently, with a nonce being the
+// chunk index, only the chunks covering the range are read and decrypted,
+// or loaded from cache, if not nil.
+func decryptedRange(db *sql.DB, query string, id int, aead cipher.AEAD, size int64, blocksize int64, offset int64, length int64, cache *blockCache) ([]byte, error) {
+	const chunkSize = encdec.ChunkSize
+	overhead := int64(aead.Overhead())
+	storedChunkSize := chunkSize + overhead
+
+	buffer := make([]byte, 0, length)
+	for chunk := offset / chunkSize; int64(len(buffer)) < length; chunk++ {
+		plaintext, err := cache.load(blockKey{id: id, block: chunk}, func() ([]byte, error) {
+			plainSize := min(chunkSize, size-chunk*chunkSize)
+			ciphertext, err := storedRange(
+				db,
+				query,
+				id,
+				blocksize,
+				chunk*storedChunkSize,
+				plainSize+overhead,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			return aead.Open(ciphertext[:0], chunkNonce(aead.NonceSize(), chunk), ciphertext, nil)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		start := max(offset-chunk*chunkSize, 0)
+		end := min(int64(len(plaintext)), start+length-int64(len(buffer)))
+		buffer = append(buffer, plaintext[start:end]...)
+	}
+
+	return buffer, nil
+}
+
+// FileReader reads a file of the container at any offset, implementing
+// [io.Reader], [io.ReaderAt] and [io.Seeker]. It's created by [Reader.OpenAt].
+//
+// For uncompressed files, only the blocks, and encrypted chunks, holding the
+// range read are read from the container. Files compressed in segments (see
+// [Writer.SetSegmentSize]) only have the segments holding the range read
+// decompressed. Other compressed files are decompressed from the start on
+// every [FileReader.ReadAt], discarding the data before the offset, while
+// [FileReader.Read] keeps decompressing from the last read. Sparse files,
+// with holes (see [Writer.SetSparse]), are read as compressed.
+//
+// Each FileReader reads the file on its own connection of the pool of the
+// Reader, so files, or the same file, can be read concurrently by several
+// goroutines, each with its own FileReader, while the Reader isn't being
+// given keys, by [Reader.SetPassword] or [Reader.AddFilePassword].
+// [FileReader.ReadAt] is also safe for concurrent use on the same FileReader.
+type FileReader struct {
+	reader     *Reader
+	id         int
+	size       int64
+	blocksize  int64
+	compressed bool
+	sparse     bool
+	aead       cipher.AEAD
+	offset     int64
+
+	// segments are the segments of a file compressed in segments,
+	// decompressed by codec. cache holds the contents of the segment
+	// cacheIndex, the last one decompressed.
+	segments   []segment
+	codec      Codec
+	cacheMutex sync.Mutex
+	cacheIndex int
+	cache      []byte
+
+	// stream decompresses a compressed file for Read,
+	// having read it up to streamOffset.
+	stream       *fileStream
+	streamOffset int64
+}
+
+// OpenAt opens the file id for random access. The FileReader
+// should be closed once read, to release its connection.
+func (reader *Reader) OpenAt(id int) (*FileReader, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	file := &FileReader{reader: reader, id: id}
+	var encrypted bool
+	err := reader.db.QueryRow(queryRangeMetadataById, id).Scan(&file.size, &file.compressed, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+	file.size, err = reader.unsealedSize(id, file.size)
+	if err != nil {
+		return nil, err
+	}
+	if file.size == 0 {
+		return file, nil
+	}
+	if file.compressed {
+		file.segments, err = reader.fileSegments(id)
+		if err != nil || file.segments == nil {
+			return file, err
+		}
+		file.codec, err = reader.fileCodec(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	holes, err := reader.fileHoles(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(holes) > 0 {
+		file.sparse = true
+		return file, nil
+	}
+
+	err = reader.db.QueryRow(reader.blocksQuery(queryBlocksizeById), id).Scan(&file.blocksize)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encrypted {
+		return file, nil
+	}
+	if !reader.canDecrypt(id) {
+		return nil, reader.decryptError(id)
+	}
+	filenameKey, dataKey, err := reader.fileEncryptionKeys(id)
+	if err != nil {
+		return nil, err
+	}
+	file.aead, err = reader.suite.newAEAD(dataKey)
+	wipe(filenameKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Size returns the size, in bytes, of the file.
+func (file *FileReader) Size() int64 {
+	return file.size
+}
+
+// readRange reads length bytes of the file, starting at offset. If the range
+// extends past the end of the file, the bytes up to the end are returned.
+// If offset is at or past the end, [io.EOF] is returned.
+func (file *FileReader) readRange(offset int64, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, ErrInvalidRange
+	}
+	if offset >= file.size {
+		return nil, io.EOF
+	}
+	length = min(length, file.size-offset)
+	query := file.reader.blocksQuery(queryDataRangeById)
+
+	switch {
+	case file.sparse || (file.compressed && file.segments == nil):
+		return file.reader.readRangeSequential(file.id, offset, length)
+	case file.compressed:
+		return file.segmentRange(query, offset, length)
+	case file.aead == nil && file.reader.blockCache != nil:
+		return file.cachedRange(query, offset, length)
+	case file.aead == nil:
+		return storedRange(file.reader.db, query, file.id, file.blocksize, offset, length)
+	default:
+		return decryptedRange(file.reader.db, query, file.id, file.aead, file.size, file.blocksize, offset, length, file.reader.blockCache)
+	}
+}
+
+// ReadAt reads len(p) bytes of the file, starting at offset.
+func (file *FileReader) ReadAt(p []byte, offset int64) (int, error) {
+	if file.reader.closed() {
+		return 0, ErrReaderClosed
+	}
+	buffer, err := file.readRange(offset, int64(len(p)))
+	n := copy(p, buffer)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Read reads the file from the offset set by [FileReader.Seek].
+func (file *FileReader) Read(p []byte) (int, error) {
+	if file.reader.closed() {
+		return 0, ErrReaderClosed
+	}
+	if file.sparse || (file.compressed && file.segments == nil) {
+		return file.readStream(p)
+	}
+
+	buffer, err := file.readRange(file.offset, int64(len(p)))
+	n := copy(p, buffer)
+	file.offset += int64(n)
+	return n, err
+}
+
+// readStream reads a compressed file from the offset, going on decompressing
+// from the last read, so reading the file sequentially decompresses it once.
+// The file is decompressed from the start again when seeking backwards.
+func (file *FileReader) readStream(p []byte) (int, error) {
+	if file.offset >= file.size {
+		return 0, io.EOF
+	}
+	if file.stream != nil && file.offset < file.streamOffset {
+		file.stream.Close()
+		file.stream = nil
+	}
+	if file.stream == nil {
+		var err error
+		file.stream, err = file.reader.openReader(file.id, false)
+		if err != nil {
+			return 0, err
+		}
+		file.streamOffset = 0
+	}
+
+	skipped, err := io.CopyN(io.Discard, file.stream, file.offset-file.streamOffset)
+	file.streamOffset += skipped
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := file.stream.Read(p[:min(int64(len(p)), file.size-file.offset)])
+	file.streamOffset += int64(n)
+	file.offset += int64(n)
+	return n, err
+}
+
+// Close releases the resources of the file.
+func (file *FileReader) Close() error {
+	if file.stream == nil {
+		return nil
+	}
+
+	err := file.stream.Close()
+	file.stream = nil
+	return err
+}
+
+// Seek sets the offset of the next [FileReader.Read].
+func (file *FileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += file.size
+	default:
+		return 0, ErrInvalidRange
+	}
+	if offset < 0 {
+		return 0, ErrInvalidRange
+	}
+
+	file.offset = offset
+	return offset, nil
+}
+
+// ReadRange reads length bytes of the file id, starting at offset,
+// as a [FileReader] opened by [Reader.OpenAt] would.
+//
+// If the range extends past the end of the file, the bytes up to the
+// end are returned. If offset is at or past the end, [io.EOF] is returned.
+func (reader *Reader) ReadRange(id int, offset int64, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, ErrInvalidRange
+	}
+
+	file, err := reader.OpenAt(id)
+	if err != nil {
+		return nil, err
+	}
+	return file.readRange(offset, length)
+}
+
+func (reader *Reader) readRangeSequential(id int, offset int64, length int64) ([]byte, error) {
+	stream, err := reader.openReader(id, false)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	_, err = io.CopyN(io.Discard, stream, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, length)
+	n, err := io.ReadFull(stream, buffer)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return buffer[:n], err
+}
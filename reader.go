@@ -2,10 +2,13 @@ package arc
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/bernardo1r/encdec"
@@ -13,13 +16,14 @@ import (
 )
 
 const (
-	queryMetadata = `SELECT id, name, size, mod_time, compressed, encrypted FROM metadata`
+	queryMetadataColumns = `SELECT id, name, size, mod_time, compressed, encrypted`
 
-	queryMetadataOptionById = `SELECT compressed, encrypted FROM metadata WHERE id = ?`
+	queryMetadataOptionById = `SELECT compressed, encrypted, blocks FROM metadata WHERE id = ?`
 
-	queryEncryptionKeyParams = `SELECT params FROM encryption_key_params`
+	queryCompleteMetadata = ` FROM (SELECT * FROM metadata
+		WHERE id NOT IN (SELECT id FROM pending_files)) AS metadata`
 
-	queryFileEncryptionKeyIdAny = `SELECT id FROM encryption_metadata LIMIT 1`
+	queryEncryptionKeyParams = `SELECT params FROM encryption_key_params`
 
 	queryFileEncryptionKeyById = `SELECT key FROM encryption_metadata WHERE id = ?`
 
@@ -30,11 +34,38 @@ type Reader struct {
 	currReader    io.Reader
 	encryptionKey []byte
 	db            *sql.DB
+	capabilities  Capabilities
 	encrypted     bool
-	err           error
+	suite         CipherSuite
+	keys          KeyProvider
+	progress      ProgressFunc
+	metrics       Metrics
+	blockCache    *blockCache
+	prefetch      int
+
+	// extractWorkers is the number of workers extracting files.
+	extractWorkers int
+
+	// filePasswordIds are the ids of the files encrypted with their own
+	// password, and fileKeys the keys of those unlocked.
+	filePasswordIds map[int]bool
+	fileKeys        map[int][]byte
+
+	// keyMu guards the keys against the automatic lock, run by
+	// lockTimer once the keys weren't used for autoLock.
+	keyMu     sync.Mutex
+	autoLock  time.Duration
+	lockTimer *time.Timer
+
+	err error
 }
 
 func (reader *Reader) readEncryptionKey(password []byte) error {
+	if !reader.capabilities.Has(FeatureEncryption) {
+		reader.err = ErrNotEncrypted
+		return reader.err
+	}
+
 	var paramsString []byte
 	reader.err = reader.db.QueryRow(queryEncryptionKeyParams).Scan(&paramsString)
 	switch {
@@ -53,36 +84,102 @@ func (reader *Reader) readEncryptionKey(password []byte) error {
 		return reader.err
 	}
 
-	reader.encryptionKey, reader.err = encdec.Key(password, params)
-	return reader.err
+	var key []byte
+	key, reader.err = encdec.Key(password, params)
+	if reader.err != nil {
+		return reader.err
+	}
+	reader.setContainerKey(key)
+	return nil
 }
 
+// verifyPassword checks the container key against the key check, and the
+// key of an encrypted file, if any, clearing it when wrong.
 func (reader *Reader) verifyPassword() error {
+	_, reader.err = verifyKeyCheck(reader.db, reader.capabilities, reader.containerKey())
+	if errors.Is(reader.err, ErrWrongPassword) {
+		reader.clearContainerKey()
+	}
+	if reader.err != nil {
+		return reader.err
+	}
+
 	var id int
-	reader.err = reader.db.QueryRow(queryFileEncryptionKeyIdAny).Scan(&id)
+	reader.err = reader.db.QueryRow(containerKeyQuery(reader.capabilities)).Scan(&id, new([]byte))
+	if errors.Is(reader.err, sql.ErrNoRows) {
+		reader.err = nil
+		return nil
+	}
 	if reader.err != nil {
 		return reader.err
 	}
 
-	_, _, err := reader.fileEncryptionKeys(id)
+	filenameKey, fileDataKey, err := reader.fileEncryptionKeys(id)
 	if err != nil {
+		reader.clearContainerKey()
 		reader.err = ErrWrongPassword
 		return reader.err
 	}
+	wipe(filenameKey, fileDataKey)
 
 	return nil
 }
 
 func NewReader(databasePath string, password []byte) (*Reader, error) {
+	return newReader("file:"+databasePath+databaseArgs, password, nil)
+}
+
+// NewReaderDB opens the container in the database db, opened by the
+// caller, for reading, as [NewWriterDB] writes them. The Reader takes db
+// over, closing it once closed.
+func NewReaderDB(db *sql.DB, password []byte) (*Reader, error) {
+	return newReaderDB(db, password)
+}
+
+// newReader opens the container database dataSourceName for reading,
+// with pragmas.
+func newReader(dataSourceName string, password []byte, pragmas *Pragmas) (*Reader, error) {
+	db, err := openDB(dataSourceName, pragmas)
+	if err != nil {
+		return nil, err
+	}
+	return newReaderDB(db, password)
+}
+
+// newReaderDB opens the container in db for reading, closing db
+// if it can't be read.
+func newReaderDB(db *sql.DB, password []byte) (*Reader, error) {
 	reader := new(Reader)
+	reader.db = db
 
-	reader.db, reader.err = sql.Open("sqlite3", "file:"+databasePath+databaseArgs)
+	reader.capabilities, reader.err = detectCapabilities(reader.db)
 	if reader.err != nil {
+		reader.db.Close()
 		return nil, reader.err
 	}
 
-	row := reader.db.QueryRow(queryEncryptionKeyParams)
-	reader.encrypted = errors.Is(row.Err(), sql.ErrNoRows)
+	reader.encrypted, reader.err = hasEncryption(reader.db, reader.capabilities)
+	if reader.err != nil {
+		reader.db.Close()
+		return nil, reader.err
+	}
+	reader.suite, reader.err = readCipherSuite(reader.db, reader.capabilities)
+	if reader.err != nil {
+		reader.db.Close()
+		return nil, reader.err
+	}
+	if reader.capabilities.Has(FeatureFilePasswords) {
+		reader.err = reader.loadFilePasswordIds()
+		if reader.err != nil {
+			reader.db.Close()
+			return nil, reader.err
+		}
+	}
+	reader.err = reader.verifySummary()
+	if reader.err != nil {
+		reader.db.Close()
+		return nil, reader.err
+	}
 	if password == nil {
 		return reader, nil
 	}
@@ -90,6 +187,26 @@ func NewReader(databasePath string, password []byte) (*Reader, error) {
 	return reader, reader.SetPassword(password)
 }
 
+// NewReaderConfig opens the container databasePath for reading, using the
+// password, pragmas, block cache, prefetch, workers and read-only options
+// from config.
+func NewReaderConfig(databasePath string, config *Config) (*Reader, error) {
+	args := databaseArgs
+	switch {
+	case config.Immutable:
+		args += "&mode=ro&immutable=1"
+	case config.ReadOnly:
+		args += "&mode=ro"
+	}
+	reader, err := newReader("file:"+databasePath+args, config.Password, config.pragmas())
+	if reader != nil {
+		reader.SetBlockCache(config.BlockCache)
+		reader.SetPrefetch(config.Prefetch)
+		reader.SetExtractWorkers(config.Workers)
+	}
+	return reader, err
+}
+
 func (reader *Reader) checkError() bool {
 	if reader.err == nil || errors.Is(reader.err, io.EOF) {
 		return false
@@ -97,10 +214,24 @@ func (reader *Reader) checkError() bool {
 	return true
 }
 
+// Capabilities reports which optional features the container supports,
+// so containers created by older versions can be opened and inspected
+// for what they lack.
+func (reader *Reader) Capabilities() Capabilities {
+	return reader.capabilities
+}
+
+// IsEncrypted reports whether the container has a container key, or
+// encrypted files. See [Reader.ContainerInfo] for the details.
 func (reader *Reader) IsEncrypted() bool {
 	return reader.encrypted
 }
 
+// SetPassword derives the container key from password, and checks it.
+// The password is only read during the call: it's neither kept by the
+// Reader nor zeroed, as it belongs to the caller, who may zero it once
+// the call returns. A key derived from a wrong password is zeroed, as
+// the keys are by [Reader.Lock] and [Reader.Close].
 func (reader *Reader) SetPassword(password []byte) error {
 	if reader.checkError() {
 		return reader.err
@@ -111,33 +242,173 @@ func (reader *Reader) SetPassword(password []byte) error {
 		return reader.err
 	}
 
-	return reader.verifyPassword()
+	reader.err = reader.verifyPassword()
+	if reader.err != nil {
+		return reader.err
+	}
+
+	reader.err = reader.verifyManifest()
+	return reader.err
 }
 
+// fileEncryptionKeys returns the keys of the encrypted file id. It leaves
+// reader.err unset, as it's called by the [FileReader]s concurrently.
 func (reader *Reader) fileEncryptionKeys(id int) (filenameKey []byte, fileDataKey []byte, err error) {
+	if !reader.capabilities.Has(FeatureEncryption) {
+		return nil, nil, FeatureEncryption.missingError()
+	}
+
 	var keyEncrypted []byte
-	reader.err = reader.db.QueryRow(queryFileEncryptionKeyById, id).Scan(&keyEncrypted)
-	if reader.err != nil {
-		return nil, nil, reader.err
+	err = reader.db.QueryRow(queryFileEncryptionKeyById, id).Scan(&keyEncrypted)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	var fileMasterKey []byte
-	fileMasterKey, reader.err = readFileKey(keyEncrypted, id, reader.encryptionKey)
-	if reader.err != nil {
-		return nil, nil, reader.err
+	fileMasterKey, err := reader.readFileMasterKey(id, keyEncrypted)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	filenameKey, fileDataKey = stretchKey(fileMasterKey)
 	return filenameKey, fileDataKey, nil
 }
 
+// optionalColumns are the metadata columns of optional features,
+// read into headers when the container supports them.
+var optionalColumns = []struct {
+	feature Feature
+	column  string
+	dest    func(header *Header) any
+}{
+	{FeatureDirectories, "type", func(header *Header) any { return &header.Type }},
+	{FeatureChecksums, "checksum", func(header *Header) any { return &header.Checksum }},
+	{FeatureAttributes, "mode", func(header *Header) any { return modeScanner{&header.Mode} }},
+	{FeatureAttributes, "uid", func(header *Header) any { return &header.Uid }},
+	{FeatureAttributes, "gid", func(header *Header) any { return &header.Gid }},
+	{FeatureBlocksizes, "blocksize", func(header *Header) any { return &header.Blocksize }},
+	{FeatureCodecs, "codec", func(header *Header) any { return stringScanner{&header.Codec} }},
+	{FeatureStoredSizes, "stored_size", func(header *Header) any { return sizeScanner{&header.StoredSize} }},
+	{FeatureCompressionLevels, "compression_level", func(header *Header) any { return levelScanner{&header.Compression} }},
+	{FeatureHardlinks, queryLinkColumn, func(header *Header) any { return idScanner{&header.LinkId} }},
+	{FeatureTimestamps, "mod_time_ns", func(header *Header) any { return timeScanner{&header.ModTime} }},
+	{FeatureTimestamps, "access_time", func(header *Header) any { return timeScanner{&header.AccessTime} }},
+	{FeatureTimestamps, "change_time", func(header *Header) any { return timeScanner{&header.ChangeTime} }},
+	{FeatureTimestamps, "birth_time", func(header *Header) any { return timeScanner{&header.BirthTime} }},
+}
+
+// modeScanner scans the nullable mode column into a [Header.Mode].
+type modeScanner struct {
+	mode *fs.FileMode
+}
+
+func (scanner modeScanner) Scan(src any) error {
+	var mode sql.NullInt64
+	err := mode.Scan(src)
+	if err != nil {
+		return err
+	}
+	*scanner.mode = fs.FileMode(mode.Int64) & storedModeBits
+	return nil
+}
+
+// stringScanner scans a nullable text column into a string,
+// left empty for NULL.
+type stringScanner struct {
+	dest *string
+}
+
+func (scanner stringScanner) Scan(src any) error {
+	var value sql.NullString
+	err := value.Scan(src)
+	if err != nil {
+		return err
+	}
+	*scanner.dest = value.String
+	return nil
+}
+
+// levelScanner scans the nullable compression level column into a
+// [Header.Compression], left as scanned from the compressed column for NULL.
+type levelScanner struct {
+	dest *zstd.EncoderLevel
+}
+
+func (scanner levelScanner) Scan(src any) error {
+	var value sql.NullInt64
+	err := value.Scan(src)
+	if err != nil {
+		return err
+	}
+	if value.Valid {
+		*scanner.dest = zstd.EncoderLevel(value.Int64)
+	}
+	return nil
+}
+
+// sizeScanner scans a nullable integer column into
+// a size, left zero for NULL.
+type sizeScanner struct {
+	dest *int64
+}
+
+func (scanner sizeScanner) Scan(src any) error {
+	var value sql.NullInt64
+	err := value.Scan(src)
+	if err != nil {
+		return err
+	}
+	*scanner.dest = value.Int64
+	return nil
+}
+
+// metadataQuery returns the query selecting the metadata of all files,
+// including the optional columns supported by the container.
+func (reader *Reader) metadataQuery() string {
+	query := queryMetadataColumns
+	for _, optional := range optionalColumns {
+		if reader.capabilities.Has(optional.feature) {
+			query += ", " + optional.column
+		}
+	}
+	return query + reader.metadataSource()
+}
+
+// metadataSource returns the FROM clause of the queries selecting the
+// metadata of the files, leaving out the files left pending by an
+// interrupted build, until rolled back by [Resume].
+func (reader *Reader) metadataSource() string {
+	if reader.capabilities.Has(FeaturePendingFiles) {
+		return queryCompleteMetadata
+	}
+	return " FROM metadata"
+}
+
+// metadataDest returns the scan destinations of the columns
+// selected by metadataQuery.
+func (reader *Reader) metadataDest(header *Header, modTime *int64) []any {
+	dest := []any{
+		&header.Id,
+		&header.Name,
+		&header.Size,
+		modTime,
+		&header.Compression,
+		&header.Encryption,
+	}
+	for _, optional := range optionalColumns {
+		if reader.capabilities.Has(optional.feature) {
+			dest = append(dest, optional.dest(header))
+		}
+	}
+	return dest
+}
+
 func (reader *Reader) Files() (files map[string]*Header, err error) {
 	if reader.checkError() {
 		return nil, reader.err
 	}
 
 	var rows *sql.Rows
-	rows, reader.err = reader.db.Query(queryMetadata)
+	rows, reader.err = reader.db.Query(reader.metadataQuery())
 	if reader.err != nil {
 		return nil, reader.err
 	}
@@ -150,92 +421,285 @@ func (reader *Reader) Files() (files map[string]*Header, err error) {
 	}()
 
 	files = make(map[string]*Header)
+	ids := make(map[int]*Header)
 	for rows.Next() {
-		header := new(Header)
-		var modTime int64
-		reader.err = rows.Scan(
-			&header.Id,
-			&header.Name,
-			&header.Size,
-			&modTime,
-			&header.Compression,
-			&header.Encryption,
-		)
-		if reader.err != nil {
+		header, err := reader.scanHeader(rows.Scan)
+		if err != nil {
+			reader.err = err
 			return nil, reader.err
 		}
 
+		files[header.Name] = header
+		ids[header.Id] = header
+	}
+
+	reader.err = reader.loadAttrs(ids)
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return files, nil
+}
+
+// scanHeader scans a row selected by metadataQuery into a header,
+// decrypting the name of encrypted files whose key is known. As
+// fileEncryptionKeys, it leaves reader.err unset.
+func (reader *Reader) scanHeader(scan func(dest ...any) error) (*Header, error) {
+	header := new(Header)
+	var modTime int64
+	err := scan(reader.metadataDest(header, &modTime)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The modification time in nanoseconds, if recorded, was scanned already.
+	if header.ModTime.IsZero() {
 		header.ModTime = time.Unix(modTime, 0)
-		if header.Encryption {
-			if reader.encryptionKey == nil {
-				files[header.Name] = header
-				continue
-			}
+	}
+	if !header.Encryption || !reader.canDecrypt(header.Id) {
+		return header, nil
+	}
 
-			filenameKey, _, err := reader.fileEncryptionKeys(header.Id)
-			if err != nil {
-				return nil, err
-			}
-			header.Name, reader.err = decryptFilename(header.Name, filenameKey)
-			if reader.err != nil {
-				return nil, reader.err
-			}
-		}
+	filenameKey, fileDataKey, err := reader.fileEncryptionKeys(header.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(filenameKey, fileDataKey)
+	header.Name, err = decryptFilename(header.Name, filenameKey)
+	if err != nil {
+		return nil, err
+	}
 
-		files[header.Name] = header
+	metadata, err := reader.sealedMetadata(header.Id, filenameKey)
+	if err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		metadata.apply(header)
 	}
 
-	return files, nil
+	return header, nil
 }
 
 func (reader *Reader) Open(id int, transaction bool) error {
+	return reader.OpenContext(context.Background(), id, transaction)
+}
+
+// OpenContext is like [Reader.Open], but reading the file fails with the
+// error of ctx once it's done, rolling back the transaction of the read.
+func (reader *Reader) OpenContext(ctx context.Context, id int, transaction bool) error {
 	if reader.checkError() {
 		return reader.err
 	}
 
-	var compressed, encrypted bool
-	reader.err = reader.db.QueryRow(queryMetadataOptionById, id).Scan(&compressed, &encrypted)
+	reader.closeStream()
+	var stream *fileStream
+	stream, reader.err = reader.openReaderContext(ctx, id, transaction)
 	if reader.err != nil {
 		return reader.err
 	}
+	reader.currReader = stream
+	return nil
+}
+
+// OpenStream opens the file id for reading, as [Reader.Open], but returning
+// a reader of its own instead of selecting the file in the Reader, so files
+// can be read one after another, or concurrently, while the Reader reads
+// another. The stream must be closed after use, releasing its transaction.
+func (reader *Reader) OpenStream(id int) (io.ReadCloser, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
 
-	reader.currReader, reader.err = newDataReader(reader.db, id, transaction)
-	if reader.err != nil {
+	stream, err := reader.openReader(id, true)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// closeStream closes the file opened by [Reader.Open], if any,
+// so its transaction is released even if not read until the end.
+func (reader *Reader) closeStream() {
+	if stream, ok := reader.currReader.(io.Closer); ok {
+		stream.Close()
+	}
+	reader.currReader = nil
+}
+
+// closed reports whether the Reader was closed.
+func (reader *Reader) closed() bool {
+	return errors.Is(reader.err, ErrReaderClosed)
+}
+
+// Close closes the file opened by [Reader.Open], if any, and the database
+// of the container, so its file is no longer locked. Subsequently calls to
+// Close or any other method, including those of the [FileReader]s, streams
+// and [FS] of the Reader, will yield [ErrReaderClosed]. It must not be
+// called while other goroutines are reading files of the Reader.
+func (reader *Reader) Close() error {
+	if reader.closed() {
 		return reader.err
 	}
 
+	reader.closeStream()
+	reader.blockCache = nil
+	reader.Lock()
+	reader.err = ErrReaderClosed
+	return reader.db.Close()
+}
+
+// fileStream reads the plaintext of a file. Closing it releases
+// the database resources when the file isn't read until the end.
+type fileStream struct {
+	io.Reader
+	reader  *Reader
+	dreader *dataReader
+	decoder io.Closer
+}
+
+func (stream *fileStream) Read(p []byte) (int, error) {
+	if stream.reader.closed() {
+		return 0, ErrReaderClosed
+	}
+	n, err := stream.Reader.Read(p)
+	if stream.reader.metrics != nil {
+		stream.reader.metrics.AddBytesOut(int64(n))
+	}
+	return n, err
+}
+
+func (stream *fileStream) Close() error {
+	if stream.decoder != nil {
+		stream.decoder.Close()
+	}
+	stream.dreader.cleanup()
+	return nil
+}
+
+// openReader creates the chain of readers that decrypts and decompresses
+// the data of the file id.
+func (reader *Reader) openReader(id int, transaction bool) (*fileStream, error) {
+	return reader.openReaderContext(context.Background(), id, transaction)
+}
+
+// openReaderContext is like openReader, running the queries with ctx.
+// Errors are reported as [FileError]s.
+func (reader *Reader) openReaderContext(ctx context.Context, id int, transaction bool) (stream *fileStream, err error) {
+	defer func() {
+		err = fileError("open", "", id, err)
+	}()
+
+	id, err = reader.resolveLink(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed, encrypted bool
+	var blocks int
+	err = reader.db.QueryRowContext(ctx, queryMetadataOptionById, id).Scan(&compressed, &encrypted, &blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypted && !reader.canDecrypt(id) {
+		return nil, reader.decryptError(id)
+	}
+	if blocks == 0 {
+		return reader.emptyStream(ctx, id)
+	}
+
+	dreader, err := newDataReader(ctx, reader.db, reader.dataQuery(), id, transaction, reader.capabilities.Has(FeatureBlockChecksums), reader.prefetch)
+	if err != nil {
+		return nil, err
+	}
+	dreader.metrics = reader.metrics
+	stream = &fileStream{reader: reader, dreader: dreader}
+	var filenameKey, dataKey []byte
 	if encrypted {
-		if reader.encryptionKey == nil {
-			reader.err = ErrEmptyPassword
-			return reader.err
+		filenameKey, dataKey, err = reader.fileEncryptionKeys(id)
+		if err != nil {
+			dreader.cleanup()
+			return nil, err
 		}
+	}
 
-		var dataKey []byte
-		_, dataKey, reader.err = reader.fileEncryptionKeys(id)
-		if reader.err != nil {
-			return reader.err
+	var codec Codec
+	if compressed {
+		codec, err = reader.fileCodec(id)
+		if err != nil {
+			dreader.cleanup()
+			return nil, err
 		}
-		var params encdec.Params
-		reader.currReader, reader.err = encdec.NewReader(dataKey, reader.currReader, &params)
-		if reader.err != nil {
-			return reader.err
+	}
+
+	meter := stageMeter{metrics: reader.metrics}
+	stream.Reader, stream.decoder, err = plaintextReader(meter.reader(dreader, stageStorage), reader.suite, dataKey, codec, &meter)
+	wipe(filenameKey, dataKey)
+	if err == nil {
+		stream.Reader, err = reader.sparseStream(stream.Reader, id)
+	}
+	if err != nil {
+		if stream.decoder != nil {
+			stream.decoder.Close()
 		}
+		dreader.cleanup()
+		return nil, err
 	}
 
-	if compressed {
-		reader.currReader, reader.err = zstd.NewReader(reader.currReader)
-		if reader.err != nil {
-			return reader.err
+	return stream, nil
+}
+
+// emptyStream returns the stream of the file id with no blocks, an empty
+// file or a directory, reading nothing but its holes, if sparse, as there's
+// no stored data to decrypt or decompress.
+func (reader *Reader) emptyStream(ctx context.Context, id int) (*fileStream, error) {
+	dreader, err := newDataReader(ctx, reader.db, reader.dataQuery(), id, false, reader.capabilities.Has(FeatureBlockChecksums), 0)
+	if err != nil {
+		return nil, err
+	}
+	stream := &fileStream{reader: reader, dreader: dreader}
+	stream.Reader, err = reader.sparseStream(dreader, id)
+	if err != nil {
+		dreader.cleanup()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// plaintextReader wraps src, the stored data of a file, with the readers
+// that decrypt, with suite, and decompress it. dataKey is nil for unencrypted
+// files, and codec is nil for uncompressed files. The returned decoder, if
+// not nil, must be closed after use. The stages are timed by meter, if not nil.
+func plaintextReader(src io.Reader, suite CipherSuite, dataKey []byte, codec Codec, meter *stageMeter) (io.Reader, io.Closer, error) {
+	if meter == nil {
+		meter = new(stageMeter)
+	}
+	if dataKey != nil {
+		var err error
+		src, err = newDecrypter(suite, dataKey, src)
+		if err != nil {
+			return nil, nil, err
 		}
+		src = meter.reader(src, stageEncryption)
 	}
 
-	return nil
+	if codec == nil {
+		return src, nil, nil
+	}
+	decoder, err := codec.NewReader(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	return meter.reader(decoder, stageCompression), decoder, nil
 }
 
 func (reader *Reader) ReadToFile(id int, filepath string) (err error) {
 	if reader.checkError() {
 		return reader.err
 	}
+	defer func() {
+		err = fileError("read", "", id, err)
+	}()
 
 	if reader.Open(id, true) != nil {
 		return reader.err
@@ -254,12 +718,89 @@ func (reader *Reader) ReadToFile(id int, filepath string) (err error) {
 		}
 	}()
 
-	_, reader.err = io.Copy(file, reader.currReader)
-	reader.currReader = nil
+	var src io.Reader
+	src, reader.err = reader.readProgress(id, reader.currReader)
+	if reader.err != nil {
+		return reader.err
+	}
+	_, reader.err = reader.copyFile(file, src, id)
+	reader.closeStream()
+	if reader.err != nil {
+		return reader.err
+	}
 
+	reader.err = reader.restoreTimes(id, filepath)
 	return reader.err
 }
 
+// ReadToFileContext is like [Reader.ReadToFile], but the extraction is
+// canceled when ctx is done. The read transaction is then rolled back,
+// the partially written file is removed and the error of ctx is returned,
+// leaving the Reader usable.
+func (reader *Reader) ReadToFileContext(ctx context.Context, id int, filepath string) (err error) {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	stream, err := reader.openReaderContext(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	src, err := reader.readProgress(id, contextReader{ctx: ctx, reader: stream})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.copyFile(file, src, id)
+	err2 := file.Close()
+	if err2 != nil && err == nil {
+		err = err2
+	}
+	if err != nil && ctx.Err() != nil {
+		os.Remove(filepath)
+		return ctx.Err()
+	}
+	if err == nil {
+		err = reader.restoreTimes(id, filepath)
+	}
+
+	return fileError("read", "", id, err)
+}
+
+// ReadTo writes the contents of the file id to w, as they're read from the
+// container, with no intermediate file, returning the number of bytes
+// written. The holes of sparse files are written as zeros. The file is read
+// by a stream of its own, as [Reader.OpenStream] does, so the file opened
+// by [Reader.Open], if any, is left as is.
+//
+// It's named after [Reader.ReadToFile] rather than WriteTo, as a WriteTo
+// method taking an id wouldn't match the signature of [io.WriterTo], which
+// io.Copy and go vet expect of methods by that name.
+func (reader *Reader) ReadTo(id int, w io.Writer) (written int64, err error) {
+	if reader.checkError() {
+		return 0, reader.err
+	}
+
+	stream, err := reader.openReader(id, true)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	src, err := reader.readProgress(id, stream)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err = io.Copy(w, src)
+	return written, fileError("read", "", id, err)
+}
+
 func (reader *Reader) Read(p []byte) (int, error) {
 	if reader.err != nil {
 		return 0, reader.err
@@ -279,49 +820,101 @@ type dataReader struct {
 	id          int
 	currBlock   int
 	lastBlock   bool
+	checksums   bool
 	rows        *sql.Rows
 	buffer      *bytes.Buffer
+	metrics     Metrics
 	err         error
+
+	// blocks are the blocks read ahead, when prefetching, until stop is
+	// closed, and stopped is closed once the prefetcher is done.
+	blocks  chan prefetchedBlock
+	stop    chan struct{}
+	stopped chan struct{}
 }
 
-func openRows(db *sql.DB, id int) (*sql.Rows, error) {
-	rows, err := db.Query(queryDataById, id)
+func openRows(ctx context.Context, db *sql.DB, query string, id int) (*sql.Rows, error) {
+	rows, err := db.QueryContext(ctx, query, id)
 	return rows, err
 }
 
-func newDataReader(db *sql.DB, id int, transaction bool) (*dataReader, error) {
+// newDataReader reads the stored data of the file id, selected by query.
+// With checksums, query also selects the CRC-32 of each block, which is
+// then validated. Up to prefetch blocks are read ahead, if positive.
+func newDataReader(ctx context.Context, db *sql.DB, query string, id int, transaction bool, checksums bool, prefetch int) (*dataReader, error) {
 	dreader := &dataReader{
-		id:     id,
-		buffer: new(bytes.Buffer),
+		id:        id,
+		checksums: checksums,
+		buffer:    new(bytes.Buffer),
 	}
 
 	var err error
 	if transaction {
-		dreader.transaction, err = db.Begin()
+		dreader.transaction, err = db.BeginTx(ctx, nil)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	dreader.rows, err = openRows(db, id)
+	dreader.rows, err = openRows(ctx, db, query, id)
 	if err != nil {
 		dreader.cleanup()
 		return nil, err
 	}
+	if prefetch > 0 {
+		dreader.startPrefetch(prefetch)
+	}
 
 	return dreader, nil
 }
 
-func (dreader *dataReader) readChunk() error {
-	dreader.lastBlock = !dreader.rows.Next()
+// nextBlock scans the block of index block from the rows, valid until
+// the next one is scanned, reporting whether it was the last one instead.
+func (dreader *dataReader) nextBlock(block int) (data []byte, last bool, err error) {
+	if !dreader.rows.Next() {
+		return nil, true, blockError("read", dreader.id, block, dreader.rows.Err())
+	}
+
 	var buffer sql.RawBytes
-	dreader.rows.Scan(&buffer)
-	dreader.buffer = bytes.NewBuffer(buffer)
+	var crc sql.NullInt64
+	dest := []any{&buffer}
+	if dreader.checksums {
+		dest = append(dest, &crc)
+	}
+	err = dreader.rows.Scan(dest...)
+	if err != nil {
+		return nil, false, blockError("read", dreader.id, block, err)
+	}
+	// Deduplicated blocks have no CRC-32, as they are keyed by their hash.
+	if crc.Valid && blockCRC(buffer) != crc.Int64 {
+		return nil, false, &BlockCorruptedError{Id: dreader.id, Block: block}
+	}
+	return buffer, false, nil
+}
+
+func (dreader *dataReader) readChunk() error {
+	var data []byte
+	if dreader.blocks != nil {
+		block := <-dreader.blocks
+		data, dreader.lastBlock, dreader.err = block.data, block.last, block.err
+	} else {
+		data, dreader.lastBlock, dreader.err = dreader.nextBlock(dreader.currBlock)
+	}
+	if dreader.lastBlock {
+		dreader.buffer = new(bytes.Buffer)
+	}
+	if dreader.err != nil || dreader.lastBlock {
+		return dreader.err
+	}
+
+	dreader.buffer = bytes.NewBuffer(data)
+	countBlock(dreader.metrics, len(data), true)
 	dreader.currBlock++
-	return dreader.err
+	return nil
 }
 
 func (dreader *dataReader) cleanup() {
+	dreader.stopPrefetch()
 	if dreader.transaction != nil {
 		dreader.transaction.Rollback()
 	}
@@ -0,0 +1,199 @@
+package arc
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	queryInsertRecipient = `INSERT INTO recipients VALUES (?, ?)`
+
+	queryRecipients = `SELECT ephemeral, wrapped FROM recipients`
+)
+
+const recipientWrapLabel = "arc recipient wrap"
+
+var (
+	// ErrNoRecipients is returned when creating a container
+	// for recipients with no recipient.
+	ErrNoRecipients = errors.New("no recipient provided")
+
+	// ErrNotRecipient is returned when unlocking a container with
+	// an identity whose public key isn't among its recipients.
+	ErrNotRecipient = errors.New("identity is not a recipient of the container")
+)
+
+// GenerateIdentity generates an X25519 identity, returning its private
+// key, for [Reader.SetIdentity], and its public key, for [NewWriterRecipients].
+func GenerateIdentity() (privateKey []byte, publicKey []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// recipientWrapKey derives the key wrapping the container key for
+// recipient, from the secret shared with the ephemeral key.
+func recipientWrapKey(shared []byte, ephemeral []byte, recipient []byte) []byte {
+	material := append([]byte(recipientWrapLabel), shared...)
+	material = append(material, ephemeral...)
+	material = append(material, recipient...)
+
+	key := make([]byte, encryptionKeysize)
+	sha3.ShakeSum256(key, material)
+	wipe(material)
+	return key
+}
+
+// wrapContainerKey wraps containerKey for the X25519 public key recipient,
+// with a new ephemeral key, returning its public key and the wrapped key.
+// As each wrap key is used once, the nonce is zero.
+func wrapContainerKey(containerKey []byte, recipient []byte) (ephemeral []byte, wrapped []byte, err error) {
+	recipientKey, err := ecdh.X25519().NewPublicKey(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeralKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := ephemeralKey.ECDH(recipientKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ephemeral = ephemeralKey.PublicKey().Bytes()
+	aead, err := chacha20poly1305.New(recipientWrapKey(shared, ephemeral, recipient))
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return ephemeral, aead.Seal(nil, nonce, containerKey, nil), nil
+}
+
+// unwrapContainerKey unwraps the container key wrapped for identity,
+// failing if it was wrapped for another recipient.
+func unwrapContainerKey(identity *ecdh.PrivateKey, ephemeral []byte, wrapped []byte) ([]byte, error) {
+	ephemeralKey, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := identity.ECDH(ephemeralKey)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient := identity.PublicKey().Bytes()
+	aead, err := chacha20poly1305.New(recipientWrapKey(shared, ephemeral, recipient))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Open(nil, nonce, wrapped, nil)
+}
+
+// NewWriterRecipients creates a new Writer and a container file with name
+// databasePath, whose encrypted files are read by the holders of the
+// private keys of recipients, X25519 public keys, instead of a password.
+// The container key is random, and wrapped for each recipient, so
+// containers can be built for someone else without sharing a password.
+// Readers unlock it with [Reader.SetIdentity].
+func NewWriterRecipients(databasePath string, blocksize int, recipients [][]byte) (*Writer, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	writer, err := NewWriter(databasePath, blocksize, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.setRecipients(recipients)
+	if err != nil {
+		writer.db.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// setRecipients sets a random container key, wrapped for each of recipients.
+func (writer *Writer) setRecipients(recipients [][]byte) error {
+	if !writer.capabilities.Has(FeatureRecipients) {
+		return FeatureRecipients.missingError()
+	}
+
+	containerKey := make([]byte, encryptionKeysize)
+	_, writer.err = rand.Read(containerKey)
+	if writer.err != nil {
+		return writer.err
+	}
+	for _, recipient := range recipients {
+		var ephemeral, wrapped []byte
+		ephemeral, wrapped, writer.err = wrapContainerKey(containerKey, recipient)
+		if writer.err == nil {
+			_, writer.err = writer.db.Exec(queryInsertRecipient, ephemeral, wrapped)
+		}
+		if writer.err != nil {
+			wipe(containerKey)
+			return writer.err
+		}
+	}
+
+	writer.encryptionKey = containerKey
+	return nil
+}
+
+// SetIdentity unlocks a container created by [NewWriterRecipients] with
+// privateKey, the X25519 private key of one of its recipients, as
+// [Reader.SetPassword] does for containers encrypted with a password.
+// [ErrNotRecipient] is returned if it's not a recipient.
+func (reader *Reader) SetIdentity(privateKey []byte) (err error) {
+	if reader.checkError() {
+		return reader.err
+	}
+	if !reader.capabilities.Has(FeatureRecipients) {
+		return FeatureRecipients.missingError()
+	}
+
+	identity, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	rows, err := reader.db.Query(queryRecipients)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	var containerKey []byte
+	for rows.Next() && containerKey == nil {
+		var ephemeral, wrapped []byte
+		err = rows.Scan(&ephemeral, &wrapped)
+		if err != nil {
+			return err
+		}
+		containerKey, _ = unwrapContainerKey(identity, ephemeral, wrapped)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	if containerKey == nil {
+		return ErrNotRecipient
+	}
+
+	reader.setContainerKey(containerKey)
+	reader.err = reader.verifyManifest()
+	return reader.err
+}
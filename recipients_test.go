@@ -0,0 +1,66 @@
+package arc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecipientsRoundTrip(t *testing.T) {
+	privateKey, publicKey, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := testContainerPath(t)
+	writer, err := NewWriterRecipients(path, 0, [][]byte{publicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "a", Encryption: true}, []byte("secret"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reader.SetIdentity(otherKey)
+	reader.Close()
+	if !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("got %v, want %v", err, ErrNotRecipient)
+	}
+
+	reader, err = NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	err = reader.SetIdentity(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, readTestFiles(t, reader), map[string]string{"a": "secret"})
+}
+
+func TestRecipientsInvalid(t *testing.T) {
+	_, err := NewWriterRecipients(testContainerPath(t), 0, nil)
+	if !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("got %v, want %v", err, ErrNoRecipients)
+	}
+
+	_, publicKey, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := NewWriterRecipients(testContainerPath(t), 0, [][]byte{publicKey, []byte("short")})
+	if err == nil {
+		writer.Close()
+		t.Fatal("invalid recipient accepted")
+	}
+}
@@ -0,0 +1,762 @@
+package arc
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bernardo1r/encdec"
+	"github.com/klauspost/compress/zstd"
+)
+
+// RemoteCachePages is the number of database pages kept in memory by
+// each [RemoteReader].
+const RemoteCachePages = 1024
+
+var (
+	// ErrRangeNotSupported is returned when the server hosting a remote
+	// container doesn't honor HTTP range requests, or replies with
+	// other ranges than the ones requested.
+	ErrRangeNotSupported = errors.New("server does not support range requests")
+
+	// ErrRemoteChanged is returned when the remote container is modified
+	// while being read.
+	ErrRemoteChanged = errors.New("remote container changed")
+
+	// ErrRemoteUnsupported is returned when opening a file stored in
+	// a way the [RemoteReader] can't read, as deduplicated files.
+	ErrRemoteUnsupported = errors.New("not supported by remote reader")
+)
+
+// pageCache is a least recently used cache of pages.
+type pageCache struct {
+	capacity int
+	pages    map[int64]*list.Element
+	order    *list.List
+}
+
+type cachedPage struct {
+	number int64
+	data   []byte
+}
+
+func newPageCache(capacity int) *pageCache {
+	return &pageCache{
+		capacity: capacity,
+		pages:    make(map[int64]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (cache *pageCache) get(number int64) ([]byte, bool) {
+	element, ok := cache.pages[number]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*cachedPage).data, true
+}
+
+func (cache *pageCache) put(number int64, data []byte) {
+	if element, ok := cache.pages[number]; ok {
+		element.Value.(*cachedPage).data = data
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.pages[number] = cache.order.PushFront(&cachedPage{number, data})
+	if cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.pages, oldest.Value.(*cachedPage).number)
+	}
+}
+
+// httpFile implements io.ReaderAt over a file served through HTTP,
+// fetching it page by page with range requests.
+type httpFile struct {
+	client       *http.Client
+	url          string
+	size         int64
+	etag         string
+	lastModified string
+	pageSize     int64
+	cache        *pageCache
+}
+
+// validator returns the If-Range precondition of the range requests, so
+// the server replies with the whole file if it changed. Weak ETags can't
+// be used, so the file falls back to its modification time, if any.
+func (file *httpFile) validator() string {
+	if file.etag != "" && !strings.HasPrefix(file.etag, "W/") {
+		return file.etag
+	}
+	return file.lastModified
+}
+
+func (file *httpFile) fetch(offset int64, length int64) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, file.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	validator := file.validator()
+	if validator != "" {
+		request.Header.Set("If-Range", validator)
+	}
+
+	response, err := file.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent:
+	case response.StatusCode == http.StatusOK && validator != "":
+		return nil, ErrRemoteChanged
+	case response.StatusCode == http.StatusOK:
+		return nil, ErrRangeNotSupported
+	default:
+		return nil, fmt.Errorf("fetching %s: %s", file.url, response.Status)
+	}
+
+	start, size, err := parseContentRange(response.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, err
+	}
+	if start != offset {
+		return nil, fmt.Errorf("%w: got range starting at %d, want %d", ErrRangeNotSupported, start, offset)
+	}
+
+	etag := response.Header.Get("ETag")
+	if file.size < 0 {
+		file.size = size
+		file.etag = etag
+		file.lastModified = response.Header.Get("Last-Modified")
+	} else if size != file.size || etag != file.etag {
+		// Servers ignoring If-Range, or files with no validator,
+		// are still caught changing size or ETag.
+		return nil, ErrRemoteChanged
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, length))
+}
+
+// parseContentRange returns the first byte position and the complete
+// length from a Content-Range header, such as "bytes 0-99/1234".
+func parseContentRange(contentRange string) (start int64, size int64, err error) {
+	unit, rest, ok := strings.Cut(contentRange, " ")
+	positions, length, ok2 := strings.Cut(rest, "/")
+	first, _, ok3 := strings.Cut(positions, "-")
+	if !ok || !ok2 || !ok3 || unit != "bytes" || length == "*" {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	size, err = strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	return start, size, nil
+}
+
+func (file *httpFile) ReadAt(p []byte, offset int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		if offset >= file.size {
+			return n, io.EOF
+		}
+
+		number := offset / file.pageSize
+		page, ok := file.cache.get(number)
+		if !ok {
+			var err error
+			page, err = file.fetch(number*file.pageSize, min(file.pageSize, file.size-number*file.pageSize))
+			if err != nil {
+				return n, err
+			}
+			file.cache.put(number, page)
+		}
+
+		start := offset - number*file.pageSize
+		if start >= int64(len(page)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		copied := copy(p[n:], page[start:])
+		n += copied
+		offset += int64(copied)
+	}
+
+	return n, nil
+}
+
+func openHTTPFile(url string, client *http.Client) (*httpFile, error) {
+	file := &httpFile{
+		client: client,
+		url:    url,
+		size:   -1,
+	}
+
+	header, err := file.fetch(0, sqliteHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) < sqliteHeaderSize {
+		return nil, errCorruptDatabase
+	}
+
+	pageSize, err := sqlitePageSize(header)
+	if err != nil {
+		return nil, err
+	}
+	file.pageSize = int64(pageSize)
+	file.cache = newPageCache(RemoteCachePages)
+	return file, nil
+}
+
+// RemoteReader reads a container served through HTTP, or read from an
+// [io.ReaderAt]. Only the database pages needed by each operation are
+// downloaded, using HTTP range requests, and kept in a least recently
+// used cache.
+//
+// The remote container is checked as by [Reader]: against its summary
+// when opened, against its manifest once the password is set, and each
+// data block against its CRC-32 when read. Files left partially written
+// are left out. Segmented files (see [Writer.SetSegmentSize]) are read
+// sequentially. The remote container must not be in the middle of a
+// write, as uncheckpointed write-ahead logs are not read. Files written
+// with deduplication (see [Writer.SetDeduplication]) can't be read yet,
+// opening them returning [ErrRemoteUnsupported].
+type RemoteReader struct {
+	file          *sqliteFile
+	capabilities  Capabilities
+	encryptionKey []byte
+	currReader    io.Reader
+	decoder       io.Closer
+	suite         CipherSuite
+	err           error
+}
+
+// NewReaderHTTP opens the container at url for reading, using client to make
+// the requests. If client is nil, [http.DefaultClient] is used.
+// The server must support HTTP range requests.
+func NewReaderHTTP(url string, client *http.Client, password []byte) (*RemoteReader, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	src, err := openHTTPFile(url, client)
+	if err != nil {
+		return nil, err
+	}
+	return NewReaderAt(src, password)
+}
+
+// NewReaderAt opens the container read from src, as [NewReaderHTTP],
+// so containers can be read from memory, e.g. from a [bytes.Reader],
+// or any other storage, without the sqlite driver.
+func NewReaderAt(src io.ReaderAt, password []byte) (*RemoteReader, error) {
+	reader := new(RemoteReader)
+	reader.file, reader.err = openSQLiteFile(src)
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	for _, table := range requiredTables {
+		if _, ok := reader.file.tables[table]; !ok {
+			return nil, ErrInvalidContainer
+		}
+	}
+	reader.err = reader.checkFormatVersion()
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	reader.capabilities, reader.err = reader.file.capabilities()
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	reader.err = reader.verifySummary()
+	if reader.err != nil {
+		return nil, reader.err
+	}
+
+	if password == nil {
+		return reader, nil
+	}
+	return reader, reader.SetPassword(password)
+}
+
+func (reader *RemoteReader) checkError() bool {
+	if reader.err == nil || errors.Is(reader.err, io.EOF) {
+		return false
+	}
+	return true
+}
+
+// SetPassword derives the container key from password, verifying it
+// against the key check and one of the encrypted files, and the metadata
+// against the manifest.
+func (reader *RemoteReader) SetPassword(password []byte) error {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	paramsTable, ok := reader.file.tables["encryption_key_params"]
+	if !ok {
+		reader.err = ErrNotEncrypted
+		return reader.err
+	}
+	var paramsString []byte
+	var suiteName string
+	reader.err = reader.file.walkTable(paramsTable.root, func(rowid int64, record []any) error {
+		row := paramsTable.row(rowid, record)
+		paramsString, _ = row["params"].([]byte)
+		suiteName, _ = row["suite"].(string)
+		return errStopWalk
+	})
+	if reader.err != nil {
+		return reader.err
+	}
+	if suiteName != "" {
+		reader.suite, reader.err = ParseCipherSuite(suiteName)
+		if reader.err != nil {
+			return reader.err
+		}
+	}
+	if paramsString == nil {
+		reader.err = ErrNotEncrypted
+		return reader.err
+	}
+
+	var params *encdec.Params
+	params, reader.err = encdec.ParseHeader(bytes.NewReader(paramsString))
+	if reader.err != nil {
+		return reader.err
+	}
+	reader.encryptionKey, reader.err = encdec.Key(password, params)
+	if reader.err != nil {
+		return reader.err
+	}
+	reader.err = reader.verifyKeyCheck()
+	if reader.err != nil {
+		if errors.Is(reader.err, ErrWrongPassword) {
+			wipe(reader.encryptionKey)
+			reader.encryptionKey = nil
+		}
+		return reader.err
+	}
+
+	keysTable := reader.file.tables["encryption_metadata"]
+	reader.err = reader.file.walkTable(keysTable.root, func(rowid int64, record []any) error {
+		if reader.hasFilePassword(int(rowid)) {
+			return nil
+		}
+		filenameKey, fileDataKey, err := reader.fileEncryptionKeys(int(rowid))
+		if err != nil {
+			return ErrWrongPassword
+		}
+		wipe(filenameKey, fileDataKey)
+		return errStopWalk
+	})
+	if errors.Is(reader.err, ErrWrongPassword) {
+		wipe(reader.encryptionKey)
+		reader.encryptionKey = nil
+	}
+	if reader.err != nil {
+		return reader.err
+	}
+
+	reader.err = reader.verifyManifest()
+	return reader.err
+}
+
+// verifyKeyCheck checks the container key against the key check, if the
+// container stores one, returning [ErrWrongPassword] if it doesn't match.
+func (reader *RemoteReader) verifyKeyCheck() error {
+	table, ok := reader.file.tables["key_check"]
+	if !ok {
+		return nil
+	}
+	var mac []byte
+	err := reader.file.walkTable(table.root, func(rowid int64, record []any) error {
+		mac, _ = table.row(rowid, record)["mac"].([]byte)
+		return errStopWalk
+	})
+	if err != nil {
+		return err
+	}
+	if mac != nil && !hmac.Equal(mac, keyCheck(reader.encryptionKey)) {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (reader *RemoteReader) fileEncryptionKeys(id int) (filenameKey []byte, fileDataKey []byte, err error) {
+	table, ok := reader.file.tables["encryption_metadata"]
+	if !ok {
+		return nil, nil, FeatureEncryption.missingError()
+	}
+
+	record, err := reader.file.lookupRowid(table.root, int64(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyEncrypted, _ := table.row(int64(id), record)["key"].([]byte)
+
+	fileMasterKey, err := readFileKey(keyEncrypted, id, reader.encryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filenameKey, fileDataKey = stretchKey(fileMasterKey)
+	return filenameKey, fileDataKey, nil
+}
+
+// linkTarget returns the id of the file the file id is a hard link to,
+// or id itself if it isn't one.
+func (reader *RemoteReader) linkTarget(id int) (int, error) {
+	table, ok := reader.file.tables["links"]
+	if !ok {
+		return id, nil
+	}
+	record, err := reader.file.lookupRowid(table.root, int64(id))
+	if errors.Is(err, errRowNotFound) {
+		return id, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	target, ok := table.row(int64(id), record)["target"].(int64)
+	if !ok {
+		return id, nil
+	}
+	return int(target), nil
+}
+
+func (reader *RemoteReader) header(rowid int64, record []any) (*Header, error) {
+	row := reader.file.tables["metadata"].row(rowid, record)
+	header := &Header{Id: int(rowid)}
+	header.Name, _ = row["name"].(string)
+	header.Size, _ = row["size"].(int64)
+	modTime, _ := row["mod_time"].(int64)
+	header.ModTime = time.Unix(modTime, 0)
+	if modTimeNs, ok := row["mod_time_ns"].(int64); ok {
+		header.ModTime = time.Unix(0, modTimeNs)
+	}
+	header.AccessTime = nanoTime(row["access_time"])
+	header.ChangeTime = nanoTime(row["change_time"])
+	header.BirthTime = nanoTime(row["birth_time"])
+	compressed, _ := row["compressed"].(int64)
+	header.Compression = zstd.EncoderLevel(compressed)
+	if level, ok := row["compression_level"].(int64); ok && compressed != 0 {
+		header.Compression = zstd.EncoderLevel(level)
+	}
+	header.Codec, _ = row["codec"].(string)
+	encrypted, _ := row["encrypted"].(int64)
+	header.Encryption = encrypted != 0
+	fileType, _ := row["type"].(int64)
+	header.Type = FileType(fileType)
+	header.Checksum, _ = row["checksum"].([]byte)
+	mode, _ := row["mode"].(int64)
+	header.Mode = fs.FileMode(mode) & storedModeBits
+	if uid, ok := row["uid"].(int64); ok {
+		header.Uid = new(int)
+		*header.Uid = int(uid)
+	}
+	if gid, ok := row["gid"].(int64); ok {
+		header.Gid = new(int)
+		*header.Gid = int(gid)
+	}
+	blocksize, _ := row["blocksize"].(int64)
+	header.Blocksize = int(blocksize)
+	target, err := reader.linkTarget(header.Id)
+	if err != nil {
+		return nil, err
+	}
+	if target != header.Id {
+		header.LinkId = target
+	}
+
+	if !header.Encryption || reader.encryptionKey == nil || reader.hasFilePassword(header.Id) {
+		return header, nil
+	}
+
+	filenameKey, fileDataKey, err := reader.fileEncryptionKeys(header.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(filenameKey, fileDataKey)
+	header.Name, err = decryptFilename(header.Name, filenameKey)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := reader.sealedMetadata(header.Id, filenameKey)
+	if err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		metadata.apply(header)
+	}
+	return header, nil
+}
+
+// Files returns the headers of all files in the container, keyed by name.
+func (reader *RemoteReader) Files() (map[string]*Header, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	files := make(map[string]*Header)
+	reader.err = reader.file.walkTable(reader.file.tables["metadata"].root, func(rowid int64, record []any) error {
+		pending, err := reader.isPending(rowid)
+		if err != nil || pending {
+			return err
+		}
+		header, err := reader.header(rowid, record)
+		if err != nil {
+			return err
+		}
+		files[header.Name] = header
+		return nil
+	})
+	if reader.err != nil {
+		return nil, reader.err
+	}
+
+	return files, nil
+}
+
+// remoteDataReader reads the blocks of the file id, in order, checking
+// them against their CRC-32, if stored.
+type remoteDataReader struct {
+	file   *sqliteFile
+	id     int
+	rowids []int64
+	block  int
+	buffer []byte
+}
+
+func (dreader *remoteDataReader) Read(p []byte) (int, error) {
+	for len(dreader.buffer) == 0 {
+		if len(dreader.rowids) == 0 {
+			return 0, io.EOF
+		}
+
+		table := dreader.file.tables["data"]
+		record, err := dreader.file.lookupRowid(table.root, dreader.rowids[0])
+		if err != nil {
+			return 0, err
+		}
+		row := table.row(dreader.rowids[0], record)
+		dreader.buffer, _ = row["data"].([]byte)
+		if crc, ok := row["crc"].(int64); ok && blockCRC(dreader.buffer) != crc {
+			return 0, &BlockCorruptedError{Id: dreader.id, Block: dreader.block}
+		}
+		dreader.rowids = dreader.rowids[1:]
+		dreader.block++
+	}
+
+	n := copy(p, dreader.buffer)
+	dreader.buffer = dreader.buffer[n:]
+	return n, nil
+}
+
+// checkDeduplicated returns [ErrRemoteUnsupported] if the file id was
+// written with deduplication, its blocks being stored by their hash.
+func (reader *RemoteReader) checkDeduplicated(id int) error {
+	table, ok := reader.file.tables["block_refs"]
+	if !reader.capabilities.Has(FeatureDeduplication) || !ok {
+		return nil
+	}
+	return reader.file.walkIndexEqual(table.primaryKeyIndex, int64(id), func(key []any) error {
+		return fmt.Errorf("%w: %s", ErrRemoteUnsupported, FeatureDeduplication)
+	})
+}
+
+// dictionary reads the compression dictionary id.
+func (reader *RemoteReader) dictionary(id int64) (*dictionary, error) {
+	table, ok := reader.file.tables["dictionaries"]
+	if !ok {
+		return nil, FeatureDictionaries.missingError()
+	}
+
+	record, err := reader.file.lookupRowid(table.root, id)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := table.row(id, record)["dict"].([]byte)
+	if !ok {
+		return nil, errCorruptDatabase
+	}
+	return &dictionary{id: int(id), dict: dict}, nil
+}
+
+// Open selects the file id for reading.
+func (reader *RemoteReader) Open(id int) error {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	id, reader.err = reader.linkTarget(id)
+	if reader.err != nil {
+		return reader.err
+	}
+	var pending bool
+	pending, reader.err = reader.isPending(int64(id))
+	if reader.err == nil && pending {
+		reader.err = errRowNotFound
+	}
+	if reader.err != nil {
+		return reader.err
+	}
+	reader.err = reader.checkDeduplicated(id)
+	if reader.err != nil {
+		return reader.err
+	}
+	var record []any
+	record, reader.err = reader.file.lookupRowid(reader.file.tables["metadata"].root, int64(id))
+	if reader.err != nil {
+		return reader.err
+	}
+	row := reader.file.tables["metadata"].row(int64(id), record)
+	compressed, _ := row["compressed"].(int64)
+	encrypted, _ := row["encrypted"].(int64)
+
+	var filenameKey, dataKey []byte
+	if encrypted != 0 {
+		if reader.encryptionKey == nil {
+			reader.err = ErrEmptyPassword
+			return reader.err
+		}
+		filenameKey, dataKey, reader.err = reader.fileEncryptionKeys(id)
+		if reader.err != nil {
+			return reader.err
+		}
+	}
+
+	dreader := &remoteDataReader{file: reader.file, id: id}
+	dataTable := reader.file.tables["data"]
+	reader.err = reader.file.walkIndexEqual(dataTable.primaryKeyIndex, int64(id), func(key []any) error {
+		rowid, ok := key[len(key)-1].(int64)
+		if !ok {
+			return errCorruptDatabase
+		}
+		dreader.rowids = append(dreader.rowids, rowid)
+		return nil
+	})
+	if reader.err != nil {
+		return reader.err
+	}
+
+	if reader.decoder != nil {
+		reader.decoder.Close()
+	}
+	var codec Codec
+	if compressed != 0 {
+		codecName, _ := row["codec"].(string)
+		var dict *dictionary
+		dictionaryId, ok := row["dictionary_id"].(int64)
+		if isZstd(codecName) && ok {
+			dict, reader.err = reader.dictionary(dictionaryId)
+			if reader.err != nil {
+				return reader.err
+			}
+		}
+		codec, reader.err = fileCodec(codecName, dict)
+		if reader.err != nil {
+			return reader.err
+		}
+	}
+
+	reader.currReader, reader.decoder, reader.err = plaintextReader(dreader, reader.suite, dataKey, codec, nil)
+	wipe(filenameKey, dataKey)
+	if reader.err != nil {
+		return reader.err
+	}
+
+	var holes []hole
+	holes, reader.err = reader.fileHoles(id)
+	if len(holes) > 0 {
+		reader.currReader = &sparseReader{src: reader.currReader, holes: holes}
+	}
+	return reader.err
+}
+
+// Close closes the source of the container,
+// if it's an [io.Closer], as [Volumes].
+func (reader *RemoteReader) Close() error {
+	if reader.decoder != nil {
+		reader.decoder.Close()
+		reader.decoder = nil
+	}
+	wipe(reader.encryptionKey)
+	reader.encryptionKey = nil
+	if closer, ok := reader.file.src.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Read reads the file selected by [RemoteReader.Open].
+func (reader *RemoteReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+
+	if reader.currReader == nil {
+		return 0, ErrNoFileSelected
+	}
+
+	var read int
+	read, reader.err = reader.currReader.Read(p)
+	return read, reader.err
+}
+
+// ReadToFile writes the file id to the local file at filepath.
+func (reader *RemoteReader) ReadToFile(id int, filepath string) (err error) {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	if reader.Open(id) != nil {
+		return reader.err
+	}
+
+	var file *os.File
+	file, reader.err = os.Create(filepath)
+	if reader.err != nil {
+		return reader.err
+	}
+	defer func() {
+		err2 := file.Close()
+		if err2 != nil && err == nil {
+			reader.err = err2
+			err = reader.err
+		}
+	}()
+
+	if _, sparse := reader.currReader.(*sparseReader); sparse {
+		_, reader.err = copySparse(file, reader.currReader)
+	} else {
+		_, reader.err = io.Copy(file, reader.currReader)
+	}
+	reader.currReader = nil
+	if errors.Is(reader.err, io.EOF) {
+		reader.err = nil
+	}
+
+	return reader.err
+}
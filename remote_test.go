@@ -0,0 +1,327 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRemoteFiles = map[string]string{
+	"first":  "first contents",
+	"second": "second contents",
+}
+
+// readTestRemote returns the contents of the files of the reader, by name.
+func readTestRemote(t testing.TB, reader *RemoteReader) (map[string]string, error) {
+	t.Helper()
+	files, err := reader.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[string]string)
+	for name, header := range files {
+		if header.Type != TypeFile {
+			continue
+		}
+		err = reader.Open(header.Id)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		contents[name] = string(data)
+	}
+	return contents, nil
+}
+
+// testServer serves the container at path, with the validators returned
+// by validators for each request, recording the If-Range headers received.
+type testServer struct {
+	path       string
+	validators func() (etag string, modtime time.Time)
+
+	mu       sync.Mutex
+	ifRanges []string
+}
+
+func (server *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	server.ifRanges = append(server.ifRanges, r.Header.Get("If-Range"))
+	server.mu.Unlock()
+
+	file, err := os.Open(server.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	etag, modtime := server.validators()
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, "", modtime, file)
+}
+
+func TestRemoteReaderHTTP(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, testRemoteFiles)
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		name        string
+		etag        string
+		modtime     time.Time
+		wantIfRange string
+	}{
+		{"strong ETag", `"v1"`, modtime, `"v1"`},
+		{"weak ETag", `W/"v1"`, modtime, modtime.Format(http.TimeFormat)},
+		{"weak ETag only", `W/"v1"`, time.Time{}, ""},
+		{"no validators", "", time.Time{}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &testServer{
+				path:       path,
+				validators: func() (string, time.Time) { return tt.etag, tt.modtime },
+			}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			reader, err := NewReaderHTTP(ts.URL, ts.Client(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			got, err := readTestRemote(t, reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFiles(t, got, testRemoteFiles)
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if server.ifRanges[0] != "" {
+				t.Errorf("first request: got If-Range %q, want none", server.ifRanges[0])
+			}
+			for _, ifRange := range server.ifRanges[1:] {
+				if ifRange != tt.wantIfRange {
+					t.Fatalf("got If-Range %q, want %q", ifRange, tt.wantIfRange)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteReaderHTTPChanged(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, testRemoteFiles)
+
+	for _, tt := range []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"strong ETag", `"v1"`, `"v2"`},
+		{"weak ETag", `W/"v1"`, `W/"v2"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var etag atomic.Value
+			etag.Store(tt.before)
+			server := &testServer{
+				path:       path,
+				validators: func() (string, time.Time) { return etag.Load().(string), time.Time{} },
+			}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			reader, err := NewReaderHTTP(ts.URL, ts.Client(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			etag.Store(tt.after)
+			_, err = readTestRemote(t, reader)
+			if !errors.Is(err, ErrRemoteChanged) {
+				t.Fatalf("got error %v, want %v", err, ErrRemoteChanged)
+			}
+		})
+	}
+}
+
+func TestRemoteReaderHTTPWrongRange(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, testRemoteFiles)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server replies with the first bytes of the container,
+	// whatever the range requested.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Range", "bytes=0-4095")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer ts.Close()
+
+	reader, err := NewReaderHTTP(ts.URL, ts.Client(), nil)
+	if err == nil {
+		_, err = readTestRemote(t, reader)
+		reader.Close()
+	}
+	if !errors.Is(err, ErrRangeNotSupported) {
+		t.Fatalf("got error %v, want %v", err, ErrRangeNotSupported)
+	}
+}
+
+// openTestRemote opens the container at path with a [RemoteReader],
+// reading it as an [io.ReaderAt].
+func openTestRemote(t testing.TB, path string, password []byte) (*RemoteReader, error) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return NewReaderAt(file, password)
+}
+
+func TestRemoteReaderAt(t *testing.T) {
+	for _, encryption := range []bool{false, true} {
+		path := testContainerPath(t)
+		writeTestContainer(t, path, testPassword, Header{Encryption: encryption}, testRemoteFiles)
+
+		reader, err := openTestRemote(t, path, testPassword)
+		if err != nil {
+			t.Fatalf("encryption %v: %v", encryption, err)
+		}
+		got, err := readTestRemote(t, reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("encryption %v: %v", encryption, err)
+		}
+		checkFiles(t, got, testRemoteFiles)
+	}
+}
+
+func TestRemoteReaderManifestMismatch(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, testRemoteFiles)
+	execTestContainer(t, path, `UPDATE metadata SET mod_time = mod_time + 1`)
+
+	_, err := openTestRemote(t, path, testPassword)
+	if !errors.Is(err, ErrManifestMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrManifestMismatch)
+	}
+}
+
+func TestRemoteReaderSummaryMismatch(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, testRemoteFiles)
+	execTestContainer(t, path, `DELETE FROM metadata WHERE name = 'second'`)
+
+	_, err := openTestRemote(t, path, nil)
+	if !errors.Is(err, ErrSummaryMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrSummaryMismatch)
+	}
+}
+
+func TestRemoteReaderBlockCorrupted(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, testRemoteFiles)
+	execTestContainer(t, path, `UPDATE data SET crc = crc + 1`)
+
+	reader, err := openTestRemote(t, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	_, err = readTestRemote(t, reader)
+	var corrupted *BlockCorruptedError
+	if !errors.As(err, &corrupted) || corrupted.Block != 0 {
+		t.Fatalf("got error %v, want %v of the first block", err, ErrBlockCorrupted)
+	}
+}
+
+func TestRemoteReaderPending(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, testRemoteFiles)
+	writeFailingTestFile(t, path, nil, Header{Name: "partial"})
+
+	reader, err := openTestRemote(t, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	got, err := readTestRemote(t, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, got, testRemoteFiles)
+}
+
+func TestRemoteReaderDeduplicated(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.SetDeduplication(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "deduplicated"}, []byte("contents"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := openTestRemote(t, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	_, err = readTestRemote(t, reader)
+	if !errors.Is(err, ErrRemoteUnsupported) {
+		t.Fatalf("got error %v, want %v", err, ErrRemoteUnsupported)
+	}
+}
+
+func TestRemoteReaderManifestMigrated(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, testRemoteFiles)
+	execTestContainer(t, path, `ALTER TABLE metadata DROP COLUMN type`)
+	err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The manifest is stored again over the rows lacking the column
+	// added back, read as its default value.
+	writer, err := openTestWriter(path, 0, testPassword)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := openTestRemote(t, path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	got, err := readTestRemote(t, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, got, testRemoteFiles)
+}
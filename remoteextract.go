@@ -0,0 +1,125 @@
+package arc
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+)
+
+// ExtractMatchingTo extracts the files of the remote container matching any
+// of the patterns include, or all files if include is empty, and none of
+// the patterns exclude, to target, as [Reader.ExtractMatchingTo]. Only the
+// database pages of the files extracted, and of the metadata, are fetched,
+// so a few files are extracted from large containers without downloading
+// them whole. Files left partially written are left out, and the metadata
+// is checked against the manifest again, as containers read from an
+// [io.ReaderAt] may have been replaced since opened.
+func (reader *RemoteReader) ExtractMatchingTo(target ExtractTarget, include []string, exclude []string) error {
+	if reader.checkError() {
+		return reader.err
+	}
+	reader.err = reader.verifyManifest()
+	if reader.err != nil {
+		return reader.err
+	}
+	for _, patterns := range [][]string{include, exclude} {
+		for _, pattern := range patterns {
+			err := validateGlob(pattern)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+	// The symbolic links excluded may have been extracted before.
+	err = checkSymlinkParents(files)
+	if err != nil {
+		return err
+	}
+	for name := range files {
+		if !selectedByGlobs(name, include, exclude) {
+			delete(files, name)
+		}
+	}
+
+	names := extractOrder(files)
+	extracted := newExtractedFiles()
+	for _, name := range names {
+		err = reader.extractFile(target, files[name], extracted)
+		if err != nil {
+			return err
+		}
+	}
+	return restoreDirs(target, files, names)
+}
+
+// extractFile writes the file header to target, as [Reader.extractFile].
+func (reader *RemoteReader) extractFile(target ExtractTarget, header *Header, extracted *extractedFiles) (err error) {
+	defer func() {
+		err = fileError("extract", header.Name, header.Id, err)
+	}()
+
+	if !filepath.IsLocal(filepath.FromSlash(header.Name)) {
+		return ErrUnsafePath
+	}
+	if header.Type == TypeDir {
+		return target.MkdirAll(header.Name, extractDirMode)
+	}
+	dir := path.Dir(header.Name)
+	if dir != "." {
+		err = target.MkdirAll(dir, extractDirMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if header.LinkId != 0 {
+		linked, err := extractHardlink(target, header, extracted)
+		if linked || err != nil {
+			return err
+		}
+	}
+
+	err = reader.Open(header.Id)
+	if err != nil {
+		return err
+	}
+	if header.Type == TypeSymlink {
+		linkTarget, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		err = target.Symlink(string(linkTarget), header.Name)
+		if err != nil {
+			return err
+		}
+		return restoreAttributes(target, header)
+	}
+
+	file, err := target.CreateFile(header.Name, extractFileMode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	err2 := file.Close()
+	if err2 != nil && err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	err = restoreAttributes(target, header)
+	if err != nil {
+		return err
+	}
+	err = target.Chtimes(header.Name, header.accessTime(), header.ModTime)
+	if err == nil && header.LinkId == 0 {
+		extracted.add(header.Id, header.Name)
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package arc
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestRemoteExtractMatching(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, map[string]string{
+		"dir/first":  "first contents",
+		"dir/second": "second contents",
+		"other":      "other contents",
+	})
+	writeFailingTestFile(t, path, nil, Header{Name: "dir/partial"})
+
+	reader, err := openTestRemote(t, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	target := NewMemTarget()
+	err = reader.ExtractMatchingTo(target, []string{"dir/*"}, []string{"*/second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pending file is left out, as by [Reader.ExtractMatchingTo].
+	names := target.Names()
+	if want := []string{"dir", "dir/first"}; !slices.Equal(names, want) {
+		t.Fatalf("extracted %q, want %q", names, want)
+	}
+	entry, _ := target.Entry("dir/first")
+	if string(entry.Data) != "first contents" {
+		t.Errorf("got %q, want %q", entry.Data, "first contents")
+	}
+}
+
+func TestRemoteExtractManifestMismatch(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, testRemoteFiles)
+
+	reader, err := openTestRemote(t, path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	// The container is tampered with once opened.
+	execTestContainer(t, path, `UPDATE metadata SET mod_time = mod_time + 1`)
+
+	target := NewMemTarget()
+	err = reader.ExtractMatchingTo(target, nil, nil)
+	if !errors.Is(err, ErrManifestMismatch) {
+		t.Fatalf("got error %v, want %v", err, ErrManifestMismatch)
+	}
+	if names := target.Names(); len(names) != 0 {
+		t.Errorf("extracted %q", names)
+	}
+}
@@ -0,0 +1,180 @@
+package arc
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	queryTypeById = `SELECT type FROM metadata WHERE id = ?`
+
+	queryUnencryptedNames = `SELECT id, name FROM metadata WHERE encrypted = 0`
+
+	queryEncryptedKeyById = `SELECT metadata.encrypted, encryption_metadata.key
+		FROM metadata LEFT JOIN encryption_metadata ON metadata.id = encryption_metadata.id
+		WHERE metadata.id = ?`
+
+	queryUpdateName = `UPDATE metadata SET name = ? WHERE id = ?`
+)
+
+// Rename renames the file oldName to newName, which mustn't be in the
+// container, returning [ErrFileExists] otherwise. Renaming a directory
+// moves the files within it along. Encrypted names are encrypted again,
+// which needs the password, as do containers storing a manifest.
+//
+// Encrypted files are only renamed in containers with [FeatureNameIndex],
+// whose names are encrypted with random nonces, as the others encrypt them
+// with the zero nonce, reusing it with the key of the file. The old name
+// stays in the free pages of the container until [Editor.Vacuum].
+func (editor *Editor) Rename(oldName string, newName string) (err error) {
+	if editor.err != nil {
+		return editor.err
+	}
+	if oldName == newName {
+		return nil
+	}
+	err = editor.checkManifestKey()
+	if err != nil {
+		return err
+	}
+
+	masterKey := editor.masterKey()
+	indexKey := editor.nameIndexKey()
+	id, err := findFileId(editor.db, masterKey, indexKey, oldName)
+	if err != nil {
+		return err
+	}
+	_, err = findFileId(editor.db, masterKey, indexKey, newName)
+	if err == nil {
+		return ErrFileExists
+	}
+	if !errors.Is(err, ErrFileNotFound) {
+		return err
+	}
+
+	names := map[int]string{id: newName}
+	dir, err := editor.isDir(id)
+	if err != nil {
+		return err
+	}
+	if dir {
+		err = editor.visitNames(func(id int, name string) bool {
+			rest, within := strings.CutPrefix(name, oldName+"/")
+			if within {
+				names[id] = newName + "/" + rest
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	transaction, err := editor.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	for id, name := range names {
+		err = renameFile(transaction, editor.capabilities, id, name, editor.encryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = storeManifest(transaction, editor.capabilities, editor.encryptionKey)
+	if err != nil {
+		return err
+	}
+	return transaction.Commit()
+}
+
+// isDir reports whether the file id is a directory.
+func (editor *Editor) isDir(id int) (bool, error) {
+	if !editor.capabilities.Has(FeatureDirectories) {
+		return false, nil
+	}
+
+	var fileType FileType
+	err := editor.db.QueryRow(queryTypeById, id).Scan(&fileType)
+	return fileType == TypeDir, err
+}
+
+// visitNames calls visit with the names of the unencrypted files, and of
+// the encrypted files if the container key is known, until it returns false.
+func (editor *Editor) visitNames(visit func(id int, name string) bool) (err error) {
+	rows, err := editor.db.Query(queryUnencryptedNames)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var id int
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return err
+		}
+		if !visit(id, name) {
+			return nil
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	masterKey := editor.masterKey()
+	if masterKey == nil {
+		return nil
+	}
+	return decryptNames(editor.db, masterKey, visit)
+}
+
+// renameFile stores name as the name of the file id, encrypting
+// it with the key of the file, sealed by containerKey, if encrypted,
+// and indexing it, if the container supports [FeatureNameIndex].
+func renameFile(db execQuerier, capabilities Capabilities, id int, name string, containerKey []byte) error {
+	var encrypted bool
+	var keyEncrypted []byte
+	err := db.QueryRow(queryEncryptedKeyById, id).Scan(&encrypted, &keyEncrypted)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		if !capabilities.Has(FeatureNameIndex) {
+			return FeatureNameIndex.missingError()
+		}
+		if containerKey == nil {
+			return ErrEmptyPassword
+		}
+		fileMasterKey, err := readFileKey(keyEncrypted, id, containerKey)
+		if err != nil {
+			return ErrFileLocked
+		}
+		filenameKey, fileDataKey := stretchKey(fileMasterKey)
+		defer wipe(filenameKey, fileDataKey)
+		err = storeNameMAC(db, nameIndexKey(capabilities, containerKey), id, name)
+		if err != nil {
+			return err
+		}
+		name, err = encryptFilename(name, filenameKey, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(queryUpdateName, name, id)
+	return err
+}
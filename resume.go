@@ -0,0 +1,188 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	queryInsertPending = `INSERT INTO pending_files VALUES (?, ?, ?)`
+
+	queryDeletePending = `DELETE FROM pending_files WHERE id = ?`
+
+	queryPendingFiles = `SELECT pending_files.id, metadata.name, metadata.encrypted, replaced_id, replaced_name
+		FROM pending_files JOIN metadata ON metadata.id = pending_files.id`
+)
+
+// pendingFile is a file whose writing was interrupted.
+type pendingFile struct {
+	id        int
+	name      string
+	encrypted bool
+	replaced  replacedFile
+}
+
+// markPending records the file id as being written, along with the file
+// it replaces, until completed by completeFile.
+func (writer *Writer) markPending(db execQuerier, id int, replaced replacedFile) error {
+	if !writer.capabilities.Has(FeaturePendingFiles) {
+		return nil
+	}
+
+	var replacedId *int
+	var replacedName *string
+	if replaced.id != 0 {
+		replacedId = &replaced.id
+	}
+	if replaced.name != "" {
+		replacedName = &replaced.name
+	}
+	_, err := db.Exec(queryInsertPending, id, replacedId, replacedName)
+	return err
+}
+
+// completeFile records the file id as completely written,
+// deleting the file it replaces.
+func (writer *Writer) completeFile(db execQuerier, id int, replaced replacedFile) error {
+	if writer.capabilities.Has(FeaturePendingFiles) {
+		_, err := db.Exec(queryDeletePending, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return finishReplace(db, replaced)
+}
+
+// isPending reports whether the file id of the remote container was
+// left partially written, as [Reader] leaves out such files.
+func (reader *RemoteReader) isPending(id int64) (bool, error) {
+	table, ok := reader.file.tables["pending_files"]
+	if !ok {
+		return false, nil
+	}
+	_, err := reader.file.lookupRowid(table.root, id)
+	if errors.Is(err, errRowNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// pendingFiles returns the files whose writing was interrupted.
+func (writer *Writer) pendingFiles() (files []pendingFile, err error) {
+	rows, err := writer.db.Query(queryPendingFiles)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var file pendingFile
+		var replacedId sql.NullInt64
+		var replacedName sql.NullString
+		err = rows.Scan(&file.id, &file.name, &file.encrypted, &replacedId, &replacedName)
+		if err != nil {
+			return nil, err
+		}
+		file.replaced = replacedFile{id: int(replacedId.Int64), name: replacedName.String}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// rollBack removes the files whose writing was interrupted, restoring the
+// files they were replacing, in one transaction, and returns their names.
+// Encrypted names are decrypted when the Writer has the container key.
+func (writer *Writer) rollBack() (names []string, err error) {
+	files, err := writer.pendingFiles()
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	transaction, err := writer.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	for _, file := range files {
+		name := file.name
+		if file.encrypted && writer.encryptionKey != nil {
+			name, err = writer.decryptName(transaction, file.id, file.name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		names = append(names, name)
+
+		_, err = transaction.Exec(queryDeleteFileById, file.id)
+		if err != nil {
+			return nil, err
+		}
+		err = restoreReplaced(transaction, file.replaced)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return names, transaction.Commit()
+}
+
+// decryptName decrypts the stored name of the encrypted file id with the
+// container key, returning the stored name as is if encrypted otherwise.
+func (writer *Writer) decryptName(db execQuerier, id int, storedName string) (string, error) {
+	var keyEncrypted []byte
+	err := db.QueryRow(queryFileEncryptionKeyById, id).Scan(&keyEncrypted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storedName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	fileMasterKey, err := readFileKey(keyEncrypted, id, writer.encryptionKey)
+	if err != nil {
+		// Encrypted with its own password.
+		return storedName, nil
+	}
+	filenameKey, fileDataKey := stretchKey(fileMasterKey)
+	defer wipe(filenameKey, fileDataKey)
+	return decryptFilename(storedName, filenameKey)
+}
+
+// Resume opens the existing container databasePath for adding files, as
+// [OpenWriter], after recovering it from an interrupted build. Writers
+// record each file as pending until it's completely written, so the files
+// left pending by a crash, along with their partial data, are rolled back,
+// and the files they were replacing (see [ConflictOverwrite]) restored.
+// The names of the rolled back files are returned, so they can be
+// written again.
+//
+// The container must support [FeaturePendingFiles].
+func Resume(databasePath string, blocksize int, password []byte) (*Writer, []string, error) {
+	writer, err := OpenWriter(databasePath, blocksize, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !writer.capabilities.Has(FeaturePendingFiles) {
+		writer.db.Close()
+		return nil, nil, FeaturePendingFiles.missingError()
+	}
+
+	names, err := writer.rollBack()
+	if err != nil {
+		writer.db.Close()
+		return nil, nil, err
+	}
+	return writer, names, nil
+}
@@ -0,0 +1,95 @@
+package arc
+
+import (
+	"errors"
+	"testing"
+	"testing/iotest"
+)
+
+// writeFailingTestFile writes the file described by header to the
+// container at path from a failing reader, leaving it pending.
+func writeFailingTestFile(t *testing.T, path string, password []byte, header Header) {
+	t.Helper()
+	writer, err := openTestWriter(path, 0, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.WriteFrom(&header, iotest.ErrReader(iotest.ErrTimeout))
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Fatalf("got %v, want %v", err, iotest.ErrTimeout)
+	}
+	writer.Close()
+}
+
+func TestResumeRollsBackPending(t *testing.T) {
+	path := testContainerPath(t)
+	files := map[string]string{"kept": "contents"}
+	writeTestContainer(t, path, nil, Header{}, files)
+	writeFailingTestFile(t, path, nil, Header{Name: "partial"})
+
+	// Readers leave the pending file out until it's rolled back.
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, readTestFiles(t, reader), files)
+	for offset, want := range []int{1, 0} {
+		headers, err := reader.List("", offset, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(headers) != want {
+			t.Errorf("listed %d files from %d, want %d", len(headers), offset, want)
+		}
+	}
+	reader.Close()
+
+	writer, names, err := Resume(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "partial" {
+		t.Errorf("rolled back %q", names)
+	}
+	writeTestFile(t, writer, Header{Name: "partial"}, []byte("written again"))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files["partial"] = "written again"
+	checkFiles(t, readTestContainer(t, path, nil), files)
+}
+
+func TestResumeRestoresOverwritten(t *testing.T) {
+	for _, encryption := range []bool{false, true} {
+		path := testContainerPath(t)
+		files := map[string]string{"file": "contents"}
+		writeTestContainer(t, path, testPassword, Header{Encryption: encryption}, files)
+		writeFailingTestFile(t, path, testPassword, Header{Name: "file", Encryption: encryption, Conflict: ConflictOverwrite})
+
+		// The failed file is left pending, as by a crash, until resumed.
+		writer, names, err := Resume(path, 0, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 || names[0] != "file" {
+			t.Errorf("encryption %v: rolled back %q", encryption, names)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := NewReader(path, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFiles(t, readTestFiles(t, reader), files)
+		_, err = reader.StatByName("file")
+		if err != nil {
+			t.Errorf("encryption %v: restored file not found: %v", encryption, err)
+		}
+		reader.Close()
+	}
+}
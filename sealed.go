@@ -0,0 +1,296 @@
+package arc
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	queryInsertSealedMetadata = `INSERT INTO sealed_metadata VALUES (?, ?)`
+
+	querySealedMetadataById = `SELECT data FROM sealed_metadata WHERE id = ?`
+
+	queryClearFileSize = `UPDATE metadata SET size = 0 WHERE id = ?`
+)
+
+// sealedMetadataSize is the size of an encoded sealedMetadata.
+const sealedMetadataSize = 8 + 8 + 1 + 4 + 8 + 8
+
+// legacySealedSize is the size of the metadata sealed with the fixed
+// nonce of metadataNonce, before they were sealed with random nonces.
+const legacySealedSize = sealedMetadataSize + chacha20poly1305.Overhead
+
+// Flags of the optional fields of an encoded sealedMetadata.
+const (
+	sealedMode = 1 << iota
+	sealedUid
+	sealedGid
+)
+
+// ErrCorruptMetadata is returned when the sealed metadata
+// of a file can't be decoded.
+var ErrCorruptMetadata = errors.New("corrupt sealed metadata")
+
+// SetMetadataEncryption enables, or disables, sealing the metadata of the
+// encrypted files written afterwards: their size, modification time,
+// permission bits and ownership are stored encrypted, along their name,
+// instead of in the clear, and are decrypted by the [Reader] once the key
+// of the file is known. Headers of files whose key is unknown have them
+// zeroed, and [Reader.Stats] doesn't count their size.
+//
+// The number of blocks of the files is still visible, revealing their
+// size up to their blocksize. The container must support
+// [FeatureSealedMetadata].
+func (writer *Writer) SetMetadataEncryption(enabled bool) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if enabled && !writer.capabilities.Has(FeatureSealedMetadata) {
+		return FeatureSealedMetadata.missingError()
+	}
+
+	writer.sealMetadata = enabled
+	return nil
+}
+
+// sealedMetadata is the metadata of an encrypted file
+// stored encrypted, instead of in the metadata table.
+type sealedMetadata struct {
+	size    int64
+	modTime int64
+	mode    *uint32
+	uid     *int
+	gid     *int
+}
+
+// metadataSeal is the metadata of a file being written,
+// sealed with key once its size is known, zeroing it.
+type metadataSeal struct {
+	key      []byte
+	metadata sealedMetadata
+}
+
+func newMetadataSeal(header *Header, filenameKey []byte) *metadataSeal {
+	seal := &metadataSeal{
+		key: filenameKey,
+		metadata: sealedMetadata{
+			modTime: header.ModTime.Unix(),
+			uid:     header.Uid,
+			gid:     header.Gid,
+		},
+	}
+	if header.Mode&storedModeBits != 0 {
+		bits := uint32(header.Mode & storedModeBits)
+		seal.metadata.mode = &bits
+	}
+	return seal
+}
+
+func (metadata *sealedMetadata) marshal() []byte {
+	buffer := make([]byte, sealedMetadataSize)
+	binary.BigEndian.PutUint64(buffer, uint64(metadata.size))
+	binary.BigEndian.PutUint64(buffer[8:], uint64(metadata.modTime))
+	if metadata.mode != nil {
+		buffer[16] |= sealedMode
+		binary.BigEndian.PutUint32(buffer[17:], *metadata.mode)
+	}
+	if metadata.uid != nil {
+		buffer[16] |= sealedUid
+		binary.BigEndian.PutUint64(buffer[21:], uint64(*metadata.uid))
+	}
+	if metadata.gid != nil {
+		buffer[16] |= sealedGid
+		binary.BigEndian.PutUint64(buffer[29:], uint64(*metadata.gid))
+	}
+	return buffer
+}
+
+func (metadata *sealedMetadata) unmarshal(buffer []byte) error {
+	if len(buffer) != sealedMetadataSize {
+		return ErrCorruptMetadata
+	}
+
+	metadata.size = int64(binary.BigEndian.Uint64(buffer))
+	metadata.modTime = int64(binary.BigEndian.Uint64(buffer[8:]))
+	flags := buffer[16]
+	if flags&sealedMode != 0 {
+		mode := binary.BigEndian.Uint32(buffer[17:])
+		metadata.mode = &mode
+	}
+	if flags&sealedUid != 0 {
+		uid := int(binary.BigEndian.Uint64(buffer[21:]))
+		metadata.uid = &uid
+	}
+	if flags&sealedGid != 0 {
+		gid := int(binary.BigEndian.Uint64(buffer[29:]))
+		metadata.gid = &gid
+	}
+	return nil
+}
+
+// metadataNonce is the nonce the metadata used to be sealed with, along
+// with the filename key of the file. Files with the same contents, as
+// convergent files, share the key, so the nonce was reused.
+func metadataNonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	nonce[len(nonce)-1] = 1
+	return nonce
+}
+
+// storeSealedMetadata seals the metadata of the file id, whose size is now
+// known, clearing its size in the metadata table. Nothing is done if seal
+// is nil, as for files whose metadata isn't sealed. The filename key is
+// shared by files with the same contents, so the metadata is sealed with
+// XChaCha20-Poly1305 and a random nonce, prefixed to it, and bound to id.
+func storeSealedMetadata(db execQuerier, id int, seal *metadataSeal, size int64) error {
+	if seal == nil {
+		return nil
+	}
+
+	aead, err := chacha20poly1305.NewX(seal.key)
+	wipe(seal.key)
+	if err != nil {
+		return err
+	}
+	seal.metadata.size = size
+	nonce := make([]byte, chacha20poly1305.NonceSizeX, chacha20poly1305.NonceSizeX+legacySealedSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, seal.metadata.marshal(), fileKeyData(id))
+
+	_, err = db.Exec(queryInsertSealedMetadata, id, sealed)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryClearFileSize, id)
+	return err
+}
+
+// openSealedMetadata decrypts sealed, the sealed metadata of the file
+// id, with its filename key. Metadata sealed with the fixed nonce of
+// metadataNonce, told apart by their size, are still decrypted.
+func openSealedMetadata(sealed []byte, id int, filenameKey []byte) (*sealedMetadata, error) {
+	var buffer []byte
+	if len(sealed) == legacySealedSize {
+		aead, err := chacha20poly1305.New(filenameKey)
+		if err != nil {
+			return nil, err
+		}
+		buffer, err = aead.Open(nil, metadataNonce(), sealed, nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		aead, err := chacha20poly1305.NewX(filenameKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrCorruptMetadata
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		buffer, err = aead.Open(nil, nonce, ciphertext, fileKeyData(id))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := new(sealedMetadata)
+	return metadata, metadata.unmarshal(buffer)
+}
+
+// apply sets the fields of header sealed in metadata.
+func (metadata *sealedMetadata) apply(header *Header) {
+	header.Size = metadata.size
+	header.ModTime = time.Unix(metadata.modTime, 0)
+	header.Mode = 0
+	if metadata.mode != nil {
+		header.Mode = fs.FileMode(*metadata.mode)
+	}
+	header.Uid = metadata.uid
+	header.Gid = metadata.gid
+}
+
+// sealedMetadata returns the sealed metadata of the file id,
+// or nil if it isn't sealed.
+func (reader *Reader) sealedMetadata(id int, filenameKey []byte) (*sealedMetadata, error) {
+	if !reader.capabilities.Has(FeatureSealedMetadata) {
+		return nil, nil
+	}
+
+	var sealed []byte
+	err := reader.db.QueryRow(querySealedMetadataById, id).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return openSealedMetadata(sealed, id, filenameKey)
+}
+
+// unsealedSize returns the size of the file id, being size, as stored
+// in the metadata table, if its metadata isn't sealed.
+func (reader *Reader) unsealedSize(id int, size int64) (int64, error) {
+	if !reader.capabilities.Has(FeatureSealedMetadata) {
+		return size, nil
+	}
+
+	var sealed []byte
+	err := reader.db.QueryRow(querySealedMetadataById, id).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return size, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !reader.canDecrypt(id) {
+		return 0, reader.decryptError(id)
+	}
+
+	filenameKey, fileDataKey, err := reader.fileEncryptionKeys(id)
+	if err != nil {
+		return 0, err
+	}
+	metadata, err := openSealedMetadata(sealed, id, filenameKey)
+	wipe(filenameKey, fileDataKey)
+	if err != nil {
+		return 0, err
+	}
+	return metadata.size, nil
+}
+
+// sealedMetadata returns the sealed metadata of the file id,
+// or nil if it isn't sealed.
+func (reader *RemoteReader) sealedMetadata(id int, filenameKey []byte) (*sealedMetadata, error) {
+	table, ok := reader.file.tables["sealed_metadata"]
+	if !ok {
+		return nil, nil
+	}
+
+	record, err := reader.file.lookupRowid(table.root, int64(id))
+	if errors.Is(err, errRowNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sealed, ok := table.row(int64(id), record)["data"].([]byte)
+	if !ok {
+		return nil, errCorruptDatabase
+	}
+	return openSealedMetadata(sealed, id, filenameKey)
+}
@@ -0,0 +1,320 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	queryInsertSegment = `INSERT INTO segments VALUES (?, ?, ?, ?)`
+
+	querySegmentsById = `SELECT start, frame_offset, frame_size FROM segments
+		WHERE id = ? ORDER BY start ASC`
+)
+
+// ErrInvalidSegmentSize is returned when setting a negative segment size.
+var ErrInvalidSegmentSize = errors.New("invalid segment size")
+
+// segment is a range of the contents of a compressed file, starting
+// at start, compressed independently into a frame of size bytes, at
+// offset of the compressed data of the file.
+type segment struct {
+	start  int64
+	offset int64
+	size   int64
+}
+
+// SetSegmentSize sets the size, in bytes, of the segments of the compressed
+// files written afterwards, or disables segmenting them, if 0. The contents
+// of each file are split into segments of size bytes, compressed into their
+// own frames concurrently, on as many cores as available, so compressing
+// a single large file isn't bound to one core, and [FileReader] only
+// decompresses the segments holding the range read, instead of the whole
+// file up to it. The frames are concatenated as a regular compressed stream,
+// so the files are read back by older readers too, although sequentially.
+// Smaller segments compress worse, so they should be at least a few MiB.
+// The container must support [FeatureSegments].
+func (writer *Writer) SetSegmentSize(size int) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if size < 0 {
+		return ErrInvalidSegmentSize
+	}
+	if size > 0 && !writer.capabilities.Has(FeatureSegments) {
+		return FeatureSegments.missingError()
+	}
+
+	writer.segmentSize = size
+	return nil
+}
+
+// segmentWriter compresses the contents of a file written to next in
+// segments of size bytes, compressing up to one segment per core at once,
+// and recording the segments.
+type segmentWriter struct {
+	next     io.Writer
+	codec    Codec
+	level    zstd.EncoderLevel
+	size     int
+	buffer   []byte
+	pending  [][]byte
+	free     [][]byte
+	start    int64
+	offset   int64
+	segments []segment
+}
+
+func newSegmentWriter(next io.Writer, codec Codec, level zstd.EncoderLevel, size int) *segmentWriter {
+	return &segmentWriter{
+		next:  next,
+		codec: codec,
+		level: level,
+		size:  size,
+	}
+}
+
+func (writer *segmentWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if writer.buffer == nil {
+			writer.buffer = writer.newBuffer()
+		}
+		n := copy(writer.buffer[len(writer.buffer):writer.size], p)
+		writer.buffer = writer.buffer[:len(writer.buffer)+n]
+		p = p[n:]
+		written += n
+		if len(writer.buffer) < writer.size {
+			break
+		}
+
+		writer.pending = append(writer.pending, writer.buffer)
+		writer.buffer = nil
+		if len(writer.pending) < runtime.GOMAXPROCS(0) {
+			continue
+		}
+		err := writer.compressPending()
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// newBuffer returns an empty buffer of a segment,
+// reusing the buffers of the segments already written.
+func (writer *segmentWriter) newBuffer() []byte {
+	if len(writer.free) == 0 {
+		return make([]byte, 0, writer.size)
+	}
+
+	buffer := writer.free[len(writer.free)-1]
+	writer.free = writer.free[:len(writer.free)-1]
+	return buffer[:0]
+}
+
+// compressPending compresses the pending segments concurrently,
+// writing their frames to next in order.
+func (writer *segmentWriter) compressPending() error {
+	frames := make([][]byte, len(writer.pending))
+	errs := make([]error, len(writer.pending))
+	var wg sync.WaitGroup
+	for i, buffer := range writer.pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			frames[i], errs[i] = writer.compress(buffer)
+		}()
+	}
+	wg.Wait()
+
+	for i, frame := range frames {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		_, err := writer.next.Write(frame)
+		if err != nil {
+			return err
+		}
+		writer.segments = append(writer.segments, segment{
+			start:  writer.start,
+			offset: writer.offset,
+			size:   int64(len(frame)),
+		})
+		writer.start += int64(len(writer.pending[i]))
+		writer.offset += int64(len(frame))
+	}
+
+	writer.free = append(writer.free, writer.pending...)
+	writer.pending = writer.pending[:0]
+	return nil
+}
+
+// compress compresses contents into a frame of their own.
+func (writer *segmentWriter) compress(contents []byte) ([]byte, error) {
+	var frame bytes.Buffer
+	encoder, err := writer.codec.NewWriter(&frame, writer.level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = encoder.Write(contents)
+	err2 := encoder.Close()
+	if err == nil {
+		err = err2
+	}
+	return frame.Bytes(), err
+}
+
+// Close compresses the segments left, without closing next. Empty
+// files have no segments, as zstd writes no frame for them, so
+// they're read as the files compressed without segments.
+func (writer *segmentWriter) Close() error {
+	if len(writer.buffer) > 0 {
+		writer.pending = append(writer.pending, writer.buffer)
+		writer.buffer = nil
+	}
+	err := writer.compressPending()
+	writer.free = nil
+	return err
+}
+
+// storeSegments records the segments of the file id, compressed
+// by the segmentWriter of writers, if any.
+func storeSegments(db execQuerier, id int, writers []io.WriteCloser) error {
+	for _, writer := range writers {
+		segments, ok := unwrapWriter(writer).(*segmentWriter)
+		if !ok {
+			continue
+		}
+		for _, segment := range segments.segments {
+			_, err := db.Exec(queryInsertSegment, id, segment.start, segment.offset, segment.size)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileSegments returns the segments of the file id, in order,
+// or nil if it wasn't compressed in segments.
+func (reader *Reader) fileSegments(id int) (segments []segment, err error) {
+	if !reader.capabilities.Has(FeatureSegments) {
+		return nil, nil
+	}
+
+	rows, err := reader.db.Query(querySegmentsById, id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var segment segment
+		err = rows.Scan(&segment.start, &segment.offset, &segment.size)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+	return segments, rows.Err()
+}
+
+// segmentAt returns the decompressed contents of the segment i of the file,
+// from the block cache of the Reader, if any, or else keeping the last
+// segment decompressed for the next reads.
+func (file *FileReader) segmentAt(query string, i int) ([]byte, error) {
+	if file.reader.blockCache != nil {
+		return file.reader.blockCache.load(blockKey{id: file.id, block: int64(i)}, func() ([]byte, error) {
+			return file.decompressSegment(query, i)
+		})
+	}
+
+	file.cacheMutex.Lock()
+	defer file.cacheMutex.Unlock()
+	if file.cache != nil && file.cacheIndex == i {
+		return file.cache, nil
+	}
+	contents, err := file.decompressSegment(query, i)
+	if err != nil {
+		return nil, err
+	}
+
+	file.cache = contents
+	file.cacheIndex = i
+	return contents, nil
+}
+
+// decompressSegment reads and decompresses the segment i of the file.
+func (file *FileReader) decompressSegment(query string, i int) ([]byte, error) {
+	segment := file.segments[i]
+	var frame []byte
+	var err error
+	if file.aead == nil {
+		frame, err = storedRange(file.reader.db, query, file.id, file.blocksize, segment.offset, segment.size)
+	} else {
+		last := file.segments[len(file.segments)-1]
+		frame, err = decryptedRange(
+			file.reader.db,
+			query,
+			file.id,
+			file.aead,
+			last.offset+last.size,
+			file.blocksize,
+			segment.offset,
+			segment.size,
+			nil,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := file.codec.NewReader(bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return io.ReadAll(decoder)
+}
+
+// segmentRange reads the range of a file compressed in segments,
+// decompressing only the segments covering it.
+func (file *FileReader) segmentRange(query string, offset int64, length int64) ([]byte, error) {
+	first := sort.Search(len(file.segments), func(i int) bool {
+		return file.segments[i].start > offset
+	}) - 1
+
+	buffer := make([]byte, 0, length)
+	for i := first; i < len(file.segments) && int64(len(buffer)) < length; i++ {
+		contents, err := file.segmentAt(query, i)
+		if err != nil {
+			return nil, err
+		}
+
+		start := max(offset-file.segments[i].start, 0)
+		if start >= int64(len(contents)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		end := min(int64(len(contents)), start+length-int64(len(buffer)))
+		buffer = append(buffer, contents[start:end]...)
+	}
+
+	return buffer, nil
+}
@@ -0,0 +1,100 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const testSegmentSize = 4096
+
+// testSegmentContents returns n bytes of compressible contents,
+// differing from one segment to the next.
+func testSegmentContents(n int) []byte {
+	var buffer bytes.Buffer
+	for i := 0; buffer.Len() < n; i++ {
+		fmt.Fprintf(&buffer, "line %d of the segmented file\n", i)
+	}
+	return buffer.Bytes()[:n]
+}
+
+func TestSegments(t *testing.T) {
+	contents := testSegmentContents(10*testSegmentSize + 100)
+	for _, encryption := range []bool{false, true} {
+		path := testContainerPath(t)
+		writer, err := newTestWriter(path, MinBlocksize, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.SetSegmentSize(testSegmentSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := Header{Encryption: encryption, Compression: zstd.SpeedDefault}
+		header.Name = "segmented"
+		writeTestFile(t, writer, header, contents)
+		header.Name = "empty"
+		writeTestFile(t, writer, header, nil)
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Read sequentially, as a regular compressed stream.
+		checkFiles(t, readTestContainer(t, path, testPassword), map[string]string{
+			"segmented": string(contents),
+			"empty":     "",
+		})
+
+		reader, err := NewReader(path, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := reader.StatByName("segmented")
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments, err := reader.fileSegments(info.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segments) != 11 || segments[10].start != 10*testSegmentSize {
+			t.Errorf("encryption %v: got %d segments", encryption, len(segments))
+		}
+
+		file, err := reader.OpenAt(info.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, offset := range []int64{0, testSegmentSize - 10, 5 * testSegmentSize, int64(len(contents)) - 50} {
+			buffer := make([]byte, 100)
+			n, err := file.ReadAt(buffer, offset)
+			if err != nil && err != io.EOF {
+				t.Fatalf("encryption %v, offset %d: %v", encryption, offset, err)
+			}
+			want := contents[offset:min(offset+100, int64(len(contents)))]
+			if !bytes.Equal(buffer[:n], want) {
+				t.Errorf("encryption %v, offset %d: got %q, want %q", encryption, offset, buffer[:n], want)
+			}
+		}
+		file.Close()
+		reader.Close()
+	}
+}
+
+func TestSegmentSizeInvalid(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	err = writer.SetSegmentSize(-1)
+	if !errors.Is(err, ErrInvalidSegmentSize) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidSegmentSize)
+	}
+}
@@ -0,0 +1,64 @@
+package arc
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// ContentTypeAttr is the attribute of a file, in [Header.Attrs],
+// holding its MIME type, served by [ServeFile] as its Content-Type.
+const ContentTypeAttr = "content-type"
+
+// ServeFile replies to the request r with the contents of the file name of
+// the container read by reader, so a container can back a file server.
+//
+// As [http.ServeContent], it handles Range requests, reading only the blocks
+// of the ranges requested from uncompressed files, and conditional requests,
+// with the Last-Modified header set from the modification time of the file,
+// and the ETag header from its checksum, if stored. The Content-Type is the
+// [ContentTypeAttr] attribute of the file, if set, or else detected from the
+// extension of name, or from the contents.
+//
+// Files not found, and entries other than regular files, are replied with
+// 404 Not Found, while encrypted files whose key is unknown are replied with
+// 403 Forbidden. Requests can be served concurrently, as long as the reader
+// isn't given keys meanwhile.
+func ServeFile(w http.ResponseWriter, r *http.Request, reader *Reader, name string) {
+	info, err := reader.StatByName(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if info.Type != TypeFile {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := reader.OpenAt(info.Id)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer file.Close()
+
+	if contentType, ok := info.Attrs[ContentTypeAttr]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if info.Checksum != nil {
+		w.Header().Set("ETag", `"`+hex.EncodeToString(info.Checksum)+`"`)
+	}
+	http.ServeContent(w, r, info.Name, info.ModTime, file)
+}
+
+// serveError replies with the status of err.
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, ErrFileLocked) || errors.Is(err, ErrEmptyPassword):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,278 @@
+package arc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	queryInsertHole = `INSERT INTO holes VALUES (?, ?, ?)`
+
+	queryHolesById = `SELECT start, size FROM holes WHERE id = ? ORDER BY start ASC`
+)
+
+// hole is a range of zeros of a sparse file, starting at start,
+// which isn't stored in the data of the file.
+type hole struct {
+	start int64
+	size  int64
+}
+
+// SetSparse enables, or disables, storing the zeros of the files written
+// afterwards as holes: each block of the file, of its blocksize, holding
+// only zeros is left out of its data, and recorded as a hole instead, so
+// files such as disk images don't store their empty ranges. When extracted,
+// the holes are seeked over, leaving them sparse on filesystems supporting
+// it. The container must support [FeatureSparse].
+func (writer *Writer) SetSparse(enabled bool) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if enabled && !writer.capabilities.Has(FeatureSparse) {
+		return FeatureSparse.missingError()
+	}
+
+	writer.sparse = enabled
+	return nil
+}
+
+// holeWriter leaves the blocks of zeros, of size bytes, out of the
+// contents of a file written to next, recording them as holes.
+type holeWriter struct {
+	next   io.Writer
+	size   int
+	block  []byte
+	offset int64
+	holes  []hole
+}
+
+func newHoleWriter(next io.Writer, size int) *holeWriter {
+	return &holeWriter{next: next, size: size, block: make([]byte, 0, size)}
+}
+
+func (writer *holeWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(writer.block[len(writer.block):writer.size], p)
+		writer.block = writer.block[:len(writer.block)+n]
+		p = p[n:]
+		written += n
+		if len(writer.block) < writer.size {
+			break
+		}
+
+		err := writer.writeBlock()
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// writeBlock writes the buffered block to next, or records it as a hole,
+// merged with the previous one if adjacent, if it's all zeros.
+func (writer *holeWriter) writeBlock() error {
+	block := writer.block
+	writer.block = writer.block[:0]
+	start := writer.offset
+	writer.offset += int64(len(block))
+
+	if !isZeros(block) {
+		_, err := writer.next.Write(block)
+		return err
+	}
+
+	if last := len(writer.holes) - 1; last >= 0 && writer.holes[last].start+writer.holes[last].size == start {
+		writer.holes[last].size += int64(len(block))
+		return nil
+	}
+	writer.holes = append(writer.holes, hole{start: start, size: int64(len(block))})
+	return nil
+}
+
+// Close writes the last block, which may be shorter than the others.
+func (writer *holeWriter) Close() error {
+	if len(writer.block) == 0 {
+		return nil
+	}
+	return writer.writeBlock()
+}
+
+func isZeros(p []byte) bool {
+	for len(p) > 0 {
+		n := min(len(p), len(zeros))
+		if !bytes.Equal(p[:n], zeros[:n]) {
+			return false
+		}
+		p = p[n:]
+	}
+	return true
+}
+
+// zeros are read for the holes of sparse files.
+var zeros = make([]byte, 32*1024)
+
+// storeHoles records the holes of the file id, left out by the
+// holeWriter among writers, as returned by fileWriters, if any.
+func storeHoles(db execQuerier, id int, writers []io.WriteCloser) error {
+	for _, writer := range writers {
+		holes, ok := writer.(*holeWriter)
+		if !ok {
+			continue
+		}
+		for _, hole := range holes.holes {
+			_, err := db.Exec(queryInsertHole, id, hole.start, hole.size)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileHoles returns the holes of the file id, in order.
+func (reader *Reader) fileHoles(id int) (holes []hole, err error) {
+	if !reader.capabilities.Has(FeatureSparse) {
+		return nil, nil
+	}
+
+	rows, err := reader.db.Query(queryHolesById, id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var hole hole
+		err = rows.Scan(&hole.start, &hole.size)
+		if err != nil {
+			return nil, err
+		}
+		holes = append(holes, hole)
+	}
+	return holes, rows.Err()
+}
+
+// sparseReader reads the contents of a sparse file, reading the zeros
+// of its holes in between the data read from src, its stored contents.
+type sparseReader struct {
+	src    io.Reader
+	holes  []hole
+	offset int64
+}
+
+func (reader *sparseReader) Read(p []byte) (int, error) {
+	if len(reader.holes) > 0 {
+		next := reader.holes[0]
+		if reader.offset >= next.start {
+			n := copy(p[:min(int64(len(p)), next.start+next.size-reader.offset)], zeros)
+			reader.offset += int64(n)
+			if reader.offset == next.start+next.size {
+				reader.holes = reader.holes[1:]
+			}
+			return n, nil
+		}
+		p = p[:min(int64(len(p)), next.start-reader.offset)]
+	}
+
+	n, err := reader.src.Read(p)
+	reader.offset += int64(n)
+	if errors.Is(err, io.EOF) && len(reader.holes) > 0 {
+		if reader.offset < reader.holes[0].start {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// copySparse copies src to dst, seeking over the ranges of zeros instead
+// of writing them, so they are left as holes on filesystems supporting it.
+func copySparse(dst *os.File, src io.Reader) (written int64, err error) {
+	buffer := make([]byte, len(zeros))
+	for {
+		n, readErr := io.ReadFull(src, buffer)
+		if isZeros(buffer[:n]) {
+			_, err = dst.Seek(int64(n), io.SeekCurrent)
+		} else {
+			_, err = dst.Write(buffer[:n])
+		}
+		if err != nil {
+			return written, err
+		}
+		written += int64(n)
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+
+	// Sets the size of files ending with a hole.
+	return written, dst.Truncate(written)
+}
+
+// copyFile copies src, the file id, to dst, seeking over its holes, if any.
+func (reader *Reader) copyFile(dst *os.File, src io.Reader, id int) (int64, error) {
+	holes, err := reader.fileHoles(id)
+	if err != nil {
+		return 0, err
+	}
+	if len(holes) == 0 {
+		return io.Copy(dst, src)
+	}
+	return copySparse(dst, src)
+}
+
+// sparseStream wraps stream, the stored contents of the file
+// id, to read the zeros of its holes, if any.
+func (reader *Reader) sparseStream(stream io.Reader, id int) (io.Reader, error) {
+	holes, err := reader.fileHoles(id)
+	if err != nil || len(holes) == 0 {
+		return stream, err
+	}
+	return &sparseReader{src: stream, holes: holes}, nil
+}
+
+// fileHoles returns the holes of the file id, in order.
+func (reader *RemoteReader) fileHoles(id int) ([]hole, error) {
+	table, ok := reader.file.tables["holes"]
+	if !ok {
+		return nil, nil
+	}
+
+	var holes []hole
+	err := reader.file.walkIndexEqual(table.primaryKeyIndex, int64(id), func(key []any) error {
+		rowid, ok := key[len(key)-1].(int64)
+		if !ok {
+			return errCorruptDatabase
+		}
+		record, err := reader.file.lookupRowid(table.root, rowid)
+		if err != nil {
+			return err
+		}
+		row := table.row(rowid, record)
+		start, ok := row["start"].(int64)
+		size, ok2 := row["size"].(int64)
+		if !ok || !ok2 {
+			return errCorruptDatabase
+		}
+		holes = append(holes, hole{start: start, size: size})
+		return nil
+	})
+	return holes, err
+}
@@ -0,0 +1,692 @@
+package arc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	sqliteHeaderSize = 100
+	sqliteMagic      = "SQLite format 3\x00"
+
+	pageInteriorIndex = 0x02
+	pageInteriorTable = 0x05
+	pageLeafIndex     = 0x0a
+	pageLeafTable     = 0x0d
+
+	// minUsableSize is the smallest usable size of the pages, as
+	// SQLite requires, so the local payload sizes are positive.
+	minUsableSize = 480
+
+	// maxTreeDepth is the deepest b-tree walked, deeper than any
+	// SQLite builds, bounding the walks of corrupted trees.
+	maxTreeDepth = 20
+)
+
+var (
+	errCorruptDatabase = fmt.Errorf("%w: corrupted database file", ErrInvalidContainer)
+	errRowNotFound     = errors.New("row not found")
+	errStopWalk        = errors.New("stop walk")
+)
+
+// sqliteFile is a minimal read-only reader of the SQLite database file
+// format, reading pages on demand from src. It only supports what is needed
+// to read a container: rowid tables, their indexes and overflow pages.
+type sqliteFile struct {
+	src      io.ReaderAt
+	pageSize int
+	usable   int
+	tables   map[string]*sqliteTable
+}
+
+type sqliteTable struct {
+	root       uint32
+	columns    []string
+	rowidAlias int
+	primaryKey []string
+
+	// defaults are the default values of the columns, read in place of
+	// the values missing from the records written before the columns
+	// were added.
+	defaults []any
+
+	// primaryKeyIndex is the root page of the index created by
+	// SQLite for the primary key, or 0 if there is none.
+	primaryKeyIndex uint32
+}
+
+type btreePage struct {
+	data     []byte
+	kind     byte
+	cells    int
+	right    uint32
+	pointers int
+}
+
+func openSQLiteFile(src io.ReaderAt) (*sqliteFile, error) {
+	header := make([]byte, sqliteHeaderSize)
+	_, err := src.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(sqliteMagic)], []byte(sqliteMagic)) {
+		return nil, errCorruptDatabase
+	}
+
+	pageSize, err := sqlitePageSize(header)
+	if err != nil {
+		return nil, err
+	}
+	file := &sqliteFile{
+		src:      src,
+		pageSize: pageSize,
+		usable:   pageSize - int(header[20]),
+		tables:   make(map[string]*sqliteTable),
+	}
+	if file.usable < minUsableSize {
+		return nil, errCorruptDatabase
+	}
+
+	err = file.readSchema()
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// sqlitePageSize returns the page size stored in the database header,
+// a power of two from 512 to 65536.
+func sqlitePageSize(header []byte) (int, error) {
+	pageSize := int(binary.BigEndian.Uint16(header[16:]))
+	if pageSize == 1 {
+		pageSize = 1 << 16
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return 0, errCorruptDatabase
+	}
+	return pageSize, nil
+}
+
+func (file *sqliteFile) readSchema() error {
+	type autoindex struct {
+		table string
+		root  uint32
+	}
+	var autoindexes []autoindex
+
+	err := file.walkTable(1, func(rowid int64, record []any) error {
+		if len(record) < 5 {
+			return errCorruptDatabase
+		}
+		kind, _ := record[0].(string)
+		name, _ := record[1].(string)
+		tableName, _ := record[2].(string)
+		root, _ := record[3].(int64)
+		sql, _ := record[4].(string)
+
+		switch {
+		case kind == "table":
+			table := parseCreateTable(sql)
+			table.root = uint32(root)
+			file.tables[name] = table
+		case kind == "index" && strings.HasPrefix(name, "sqlite_autoindex_"):
+			autoindexes = append(autoindexes, autoindex{tableName, uint32(root)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The primary key is the first constraint of the tables in the
+	// container schema, so its index is the first autoindex created.
+	for _, index := range autoindexes {
+		table, ok := file.tables[index.table]
+		if ok && table.primaryKeyIndex == 0 && table.rowidAlias < 0 {
+			table.primaryKeyIndex = index.root
+		}
+	}
+	return nil
+}
+
+// parseCreateTable extracts the column names, their default values
+// and the primary key from a CREATE TABLE statement.
+func parseCreateTable(sql string) *sqliteTable {
+	table := &sqliteTable{rowidAlias: -1}
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return table
+	}
+
+	for _, definition := range splitTopLevel(sql[start+1 : end]) {
+		fields := strings.Fields(definition)
+		if len(fields) == 0 {
+			continue
+		}
+
+		upper := strings.ToUpper(definition)
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY":
+			open := strings.Index(definition, "(")
+			close := strings.LastIndex(definition, ")")
+			if open >= 0 && close > open {
+				for _, column := range strings.Split(definition[open+1:close], ",") {
+					table.primaryKey = append(table.primaryKey, unquoteIdentifier(column))
+				}
+			}
+			continue
+		case "FOREIGN", "UNIQUE", "CHECK", "CONSTRAINT":
+			continue
+		}
+
+		name := unquoteIdentifier(fields[0])
+		if len(fields) > 1 && strings.ToUpper(fields[1]) == "INTEGER" && strings.Contains(upper, "PRIMARY KEY") {
+			table.rowidAlias = len(table.columns)
+			table.primaryKey = []string{name}
+		}
+		table.columns = append(table.columns, name)
+		table.defaults = append(table.defaults, parseDefault(fields))
+	}
+
+	return table
+}
+
+// parseDefault returns the default value of the column defined by fields,
+// only integer and string literals being supported, or nil if it has none.
+func parseDefault(fields []string) any {
+	for i := 1; i+1 < len(fields); i++ {
+		if strings.ToUpper(fields[i]) != "DEFAULT" {
+			continue
+		}
+		literal := fields[i+1]
+		integer, err := strconv.ParseInt(literal, 10, 64)
+		if err == nil {
+			return integer
+		}
+		if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+			return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
+		}
+		return nil
+	}
+	return nil
+}
+
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth := 0
+	var quote rune
+	last := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func unquoteIdentifier(identifier string) string {
+	return strings.Trim(strings.TrimSpace(identifier), "\"`[]'")
+}
+
+// values returns the values of the columns of table in a record, as read
+// by SQLite: the rowid for the column aliasing it, and the default values
+// for the columns missing from the record.
+func (table *sqliteTable) values(rowid int64, record []any) []any {
+	values := make([]any, len(table.columns))
+	for i := range values {
+		if i < len(record) {
+			values[i] = record[i]
+		} else {
+			values[i] = table.defaults[i]
+		}
+	}
+	if table.rowidAlias >= 0 {
+		values[table.rowidAlias] = rowid
+	}
+	return values
+}
+
+// row maps the values of a record of table to their column names.
+func (table *sqliteTable) row(rowid int64, record []any) map[string]any {
+	row := make(map[string]any, len(table.columns))
+	for i, value := range table.values(rowid, record) {
+		row[table.columns[i]] = value
+	}
+	return row
+}
+
+func (file *sqliteFile) page(number uint32) ([]byte, error) {
+	if number == 0 {
+		return nil, errCorruptDatabase
+	}
+
+	buffer := make([]byte, file.pageSize)
+	n, err := file.src.ReadAt(buffer, int64(number-1)*int64(file.pageSize))
+	if n == len(buffer) {
+		return buffer, nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = errCorruptDatabase
+	}
+	return nil, err
+}
+
+func (file *sqliteFile) btreePage(number uint32) (*btreePage, error) {
+	data, err := file.page(number)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if number == 1 {
+		offset = sqliteHeaderSize
+	}
+	page := &btreePage{
+		data:  data,
+		kind:  data[offset],
+		cells: int(binary.BigEndian.Uint16(data[offset+3:])),
+	}
+
+	switch page.kind {
+	case pageInteriorIndex, pageInteriorTable:
+		page.right = binary.BigEndian.Uint32(data[offset+8:])
+		page.pointers = offset + 12
+	case pageLeafIndex, pageLeafTable:
+		page.pointers = offset + 8
+	default:
+		return nil, errCorruptDatabase
+	}
+	if page.pointers+2*page.cells > len(data) {
+		return nil, errCorruptDatabase
+	}
+
+	return page, nil
+}
+
+func (page *btreePage) cell(i int) ([]byte, error) {
+	offset := int(binary.BigEndian.Uint16(page.data[page.pointers+2*i:]))
+	if offset >= len(page.data) {
+		return nil, errCorruptDatabase
+	}
+	return page.data[offset:], nil
+}
+
+// child returns the page number of the left child of an interior cell.
+func child(cell []byte) (uint32, error) {
+	if len(cell) < 4 {
+		return 0, errCorruptDatabase
+	}
+	return binary.BigEndian.Uint32(cell), nil
+}
+
+// visitedPages records the pages of a b-tree walked so far, so corrupted
+// trees whose pages point back to each other are reported, instead of
+// walked forever.
+type visitedPages map[uint32]bool
+
+// visit records the page number, at depth, returning an error if it
+// was visited before, or it's deeper than any b-tree.
+func (visited visitedPages) visit(number uint32, depth int) error {
+	if visited[number] || depth > maxTreeDepth {
+		return errCorruptDatabase
+	}
+	visited[number] = true
+	return nil
+}
+
+func readVarint(buffer []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 8 && i < len(buffer); i++ {
+		value = value<<7 | uint64(buffer[i]&0x7f)
+		if buffer[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	if len(buffer) < 9 {
+		return 0, 0
+	}
+	return value<<8 | uint64(buffer[8]), 9
+}
+
+// payload returns the whole payload of a cell, following its overflow pages.
+func (file *sqliteFile) payload(cell []byte, size uint64, tableLeaf bool) ([]byte, error) {
+	usable := file.usable
+	maxLocal := (usable-12)*64/255 - 23
+	if tableLeaf {
+		maxLocal = usable - 35
+	}
+	if size <= uint64(maxLocal) {
+		if uint64(len(cell)) < size {
+			return nil, errCorruptDatabase
+		}
+		return cell[:size], nil
+	}
+
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + int((size-uint64(minLocal))%uint64(usable-4))
+	if local > maxLocal {
+		local = minLocal
+	}
+	if len(cell) < local+4 {
+		return nil, errCorruptDatabase
+	}
+
+	// The payload is grown as its pages are read, as its size
+	// isn't trusted before.
+	payload := append([]byte(nil), cell[:local]...)
+	next := binary.BigEndian.Uint32(cell[local:])
+	visited := make(visitedPages)
+	for uint64(len(payload)) < size {
+		if visited[next] {
+			return nil, errCorruptDatabase
+		}
+		visited[next] = true
+		page, err := file.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = binary.BigEndian.Uint32(page)
+		n := min(uint64(usable-4), size-uint64(len(payload)))
+		payload = append(payload, page[4:4+n]...)
+	}
+
+	return payload, nil
+}
+
+func decodeRecord(payload []byte) ([]any, error) {
+	headerSize, n := readVarint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, errCorruptDatabase
+	}
+
+	var serialTypes []uint64
+	for position := n; position < int(headerSize); {
+		serialType, n := readVarint(payload[position:])
+		if n == 0 {
+			return nil, errCorruptDatabase
+		}
+		serialTypes = append(serialTypes, serialType)
+		position += n
+	}
+
+	intSizes := [...]int{0, 1, 2, 3, 4, 6, 8}
+	body := payload[headerSize:]
+	record := make([]any, len(serialTypes))
+	for i, serialType := range serialTypes {
+		var size int
+		switch {
+		case serialType == 0:
+		case serialType <= 6:
+			size = intSizes[serialType]
+		case serialType == 7:
+			size = 8
+		case serialType == 8 || serialType == 9:
+			record[i] = int64(serialType - 8)
+			continue
+		case serialType >= 12:
+			if (serialType-12)/2 > uint64(len(body)) {
+				return nil, errCorruptDatabase
+			}
+			size = int(serialType-12) / 2
+		default:
+			return nil, errCorruptDatabase
+		}
+		if size > len(body) {
+			return nil, errCorruptDatabase
+		}
+
+		value := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+		case serialType <= 6:
+			var integer int64
+			for _, b := range value {
+				integer = integer<<8 | int64(b)
+			}
+			shift := 64 - 8*size
+			record[i] = integer << shift >> shift
+		case serialType == 7:
+			record[i] = math.Float64frombits(binary.BigEndian.Uint64(value))
+		case serialType%2 == 0:
+			record[i] = value
+		default:
+			record[i] = string(value)
+		}
+	}
+
+	return record, nil
+}
+
+// walkTable calls fn for each row of the table b-tree rooted at root,
+// in rowid order. Returning errStopWalk from fn stops the walk without error.
+func (file *sqliteFile) walkTable(root uint32, fn func(rowid int64, record []any) error) error {
+	err := file.walkTablePage(root, 0, make(visitedPages), fn)
+	if errors.Is(err, errStopWalk) {
+		return nil
+	}
+	return err
+}
+
+func (file *sqliteFile) walkTablePage(number uint32, depth int, visited visitedPages, fn func(rowid int64, record []any) error) error {
+	err := visited.visit(number, depth)
+	if err != nil {
+		return err
+	}
+	page, err := file.btreePage(number)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < page.cells; i++ {
+		cell, err := page.cell(i)
+		if err != nil {
+			return err
+		}
+
+		if page.kind == pageInteriorTable {
+			left, err := child(cell)
+			if err != nil {
+				return err
+			}
+			err = file.walkTablePage(left, depth+1, visited, fn)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if page.kind != pageLeafTable {
+			return errCorruptDatabase
+		}
+
+		rowid, record, err := file.tableLeafCell(cell)
+		if err != nil {
+			return err
+		}
+		err = fn(rowid, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	if page.kind == pageInteriorTable {
+		return file.walkTablePage(page.right, depth+1, visited, fn)
+	}
+	return nil
+}
+
+func (file *sqliteFile) tableLeafCell(cell []byte) (int64, []any, error) {
+	size, n := readVarint(cell)
+	rowid, m := readVarint(cell[n:])
+	if n == 0 || m == 0 {
+		return 0, nil, errCorruptDatabase
+	}
+
+	payload, err := file.payload(cell[n+m:], size, true)
+	if err != nil {
+		return 0, nil, err
+	}
+	record, err := decodeRecord(payload)
+	return int64(rowid), record, err
+}
+
+// lookupRowid returns the record with the given rowid of the table
+// b-tree rooted at root.
+func (file *sqliteFile) lookupRowid(root uint32, rowid int64) ([]any, error) {
+	number := root
+	visited := make(visitedPages)
+	for depth := 0; ; depth++ {
+		err := visited.visit(number, depth)
+		if err != nil {
+			return nil, err
+		}
+		page, err := file.btreePage(number)
+		if err != nil {
+			return nil, err
+		}
+
+		switch page.kind {
+		case pageInteriorTable:
+			number = page.right
+			for i := 0; i < page.cells; i++ {
+				cell, err := page.cell(i)
+				if err != nil {
+					return nil, err
+				}
+				left, err := child(cell)
+				if err != nil {
+					return nil, err
+				}
+				key, n := readVarint(cell[4:])
+				if n == 0 {
+					return nil, errCorruptDatabase
+				}
+				if rowid <= int64(key) {
+					number = left
+					break
+				}
+			}
+
+		case pageLeafTable:
+			for i := 0; i < page.cells; i++ {
+				cell, err := page.cell(i)
+				if err != nil {
+					return nil, err
+				}
+				_, n := readVarint(cell)
+				key, m := readVarint(cell[n:])
+				if n == 0 || m == 0 {
+					return nil, errCorruptDatabase
+				}
+				if int64(key) != rowid {
+					continue
+				}
+
+				_, record, err := file.tableLeafCell(cell)
+				return record, err
+			}
+			return nil, errRowNotFound
+
+		default:
+			return nil, errCorruptDatabase
+		}
+	}
+}
+
+// walkIndexEqual calls fn, in key order, for each key of the index b-tree
+// rooted at root whose first column is the integer first.
+func (file *sqliteFile) walkIndexEqual(root uint32, first int64, fn func(key []any) error) error {
+	_, err := file.walkIndexPage(root, first, 0, make(visitedPages), fn)
+	return err
+}
+
+func (file *sqliteFile) walkIndexPage(number uint32, first int64, depth int, visited visitedPages, fn func(key []any) error) (done bool, err error) {
+	err = visited.visit(number, depth)
+	if err != nil {
+		return false, err
+	}
+	page, err := file.btreePage(number)
+	if err != nil {
+		return false, err
+	}
+	interior := page.kind == pageInteriorIndex
+	if !interior && page.kind != pageLeafIndex {
+		return false, errCorruptDatabase
+	}
+
+	for i := 0; i < page.cells; i++ {
+		cell, err := page.cell(i)
+		if err != nil {
+			return false, err
+		}
+		offset := 0
+		var left uint32
+		if interior {
+			offset = 4
+			left, err = child(cell)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		size, n := readVarint(cell[offset:])
+		if n == 0 {
+			return false, errCorruptDatabase
+		}
+		payload, err := file.payload(cell[offset+n:], size, false)
+		if err != nil {
+			return false, err
+		}
+		key, err := decodeRecord(payload)
+		if err != nil {
+			return false, err
+		}
+		if len(key) == 0 {
+			return false, errCorruptDatabase
+		}
+		value, ok := key[0].(int64)
+		if !ok {
+			return false, errCorruptDatabase
+		}
+
+		if interior && value >= first {
+			done, err = file.walkIndexPage(left, first, depth+1, visited, fn)
+			if done || err != nil {
+				return done, err
+			}
+		}
+		if value > first {
+			return true, nil
+		}
+		if value == first {
+			err = fn(key)
+			if err != nil {
+				return true, err
+			}
+		}
+	}
+
+	if interior {
+		return file.walkIndexPage(page.right, first, depth+1, visited, fn)
+	}
+	return false, nil
+}
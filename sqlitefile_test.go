@@ -0,0 +1,170 @@
+package arc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// testDatabase returns the bytes of a container with a few files, for
+// parsing with [openSQLiteFile]. Its pages are the smallest, so its schema
+// spills to overflow pages, and the fuzz tests mutate a small input.
+func testDatabase(t testing.TB) []byte {
+	t.Helper()
+	path := testContainerPath(t)
+	writer, err := NewWriterConfig(path, &Config{Pragmas: &Pragmas{PageSize: 512}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "small"}, []byte("small contents"))
+	writeTestFile(t, writer, Header{Name: "large"}, bytes.Repeat([]byte("large contents, "), 128))
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testPages returns a database of pages of 512 bytes, the first
+// beginning with the database header.
+func testPages(pages ...[]byte) []byte {
+	data := make([]byte, 512*len(pages))
+	for i, page := range pages {
+		copy(data[512*i:], page)
+	}
+	copy(data, sqliteMagic)
+	binary.BigEndian.PutUint16(data[16:], 512)
+	return data
+}
+
+// testInteriorPage returns an interior table b-tree page with no cells,
+// whose right child is right, at offset within the page.
+func testInteriorPage(offset int, right uint32) []byte {
+	page := make([]byte, offset+12)
+	page[offset] = pageInteriorTable
+	binary.BigEndian.PutUint32(page[offset+8:], right)
+	return page
+}
+
+func TestOpenSQLiteFileInvalidPageSize(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		pageSize uint16
+		reserved byte
+	}{
+		{"zero", 0, 0},
+		{"too small", 256, 0},
+		{"not a power of two", 1000, 0},
+		{"too much reserved", 512, 33},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testPages(testInteriorPage(sqliteHeaderSize, 1))
+			binary.BigEndian.PutUint16(data[16:], tt.pageSize)
+			data[20] = tt.reserved
+			_, err := openSQLiteFile(bytes.NewReader(data))
+			if !errors.Is(err, ErrInvalidContainer) {
+				t.Fatalf("got error %v, want %v", err, ErrInvalidContainer)
+			}
+		})
+	}
+}
+
+func TestOpenSQLiteFileCycle(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		pages [][]byte
+	}{
+		{"self", [][]byte{testInteriorPage(sqliteHeaderSize, 1)}},
+		{"loop", [][]byte{testInteriorPage(sqliteHeaderSize, 2), testInteriorPage(0, 1)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := openSQLiteFile(bytes.NewReader(testPages(tt.pages...)))
+			if !errors.Is(err, ErrInvalidContainer) {
+				t.Fatalf("got error %v, want %v", err, ErrInvalidContainer)
+			}
+		})
+	}
+}
+
+func TestLookupRowid(t *testing.T) {
+	file, err := openSQLiteFile(bytes.NewReader(testDatabase(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, ok := file.tables["metadata"]
+	if !ok {
+		t.Fatal("missing metadata table")
+	}
+
+	var rowids []int64
+	err = file.walkTable(metadata.root, func(rowid int64, record []any) error {
+		rowids = append(rowids, rowid)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowids) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rowids))
+	}
+	for _, rowid := range rowids {
+		_, err = file.lookupRowid(metadata.root, rowid)
+		if err != nil {
+			t.Errorf("rowid %d: %v", rowid, err)
+		}
+	}
+	_, err = file.lookupRowid(metadata.root, rowids[len(rowids)-1]+1)
+	if !errors.Is(err, errRowNotFound) {
+		t.Errorf("got error %v, want %v", err, errRowNotFound)
+	}
+}
+
+// FuzzOpenSQLiteFile checks malformed databases are reported as errors,
+// parsing their schema and looking up and walking all of their tables.
+func FuzzOpenSQLiteFile(f *testing.F) {
+	// The whole database is too large for the fuzzer to minimize
+	// the inputs found, so only its first pages are a seed.
+	f.Add(testDatabase(f)[:4*512])
+	f.Add(testPages(testInteriorPage(sqliteHeaderSize, 1)))
+	f.Add(testPages(testInteriorPage(sqliteHeaderSize, 2), testInteriorPage(0, 1)))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := openSQLiteFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for _, table := range file.tables {
+			file.lookupRowid(table.root, 1)
+			file.walkTable(table.root, func(rowid int64, record []any) error { return nil })
+			if table.primaryKeyIndex != 0 {
+				file.walkIndexEqual(table.primaryKeyIndex, 1, func(key []any) error { return nil })
+			}
+		}
+	})
+}
+
+// FuzzLookupRowid checks looking up rows of a container whose pages
+// are corrupted, a byte at a time, is reported as errors.
+func FuzzLookupRowid(f *testing.F) {
+	data := testDatabase(f)
+	f.Add(uint32(0), byte(0), int64(1))
+	f.Add(uint32(512+8), byte(0xff), int64(2))
+
+	f.Fuzz(func(t *testing.T, offset uint32, value byte, rowid int64) {
+		corrupted := bytes.Clone(data)
+		corrupted[int(offset)%len(corrupted)] ^= value
+		file, err := openSQLiteFile(bytes.NewReader(corrupted))
+		if err != nil {
+			return
+		}
+		for _, table := range file.tables {
+			file.lookupRowid(table.root, rowid)
+		}
+	})
+}
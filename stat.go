@@ -0,0 +1,241 @@
+package arc
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	queryStoredSizeById = `SELECT count(*), coalesce(sum(length(data)), 0) FROM data WHERE id = ?`
+
+	querySizeByCompression = `SELECT compressed, count(*), coalesce(sum(size), 0)
+		FROM metadata GROUP BY compressed`
+
+	queryStoredSizeByCompression = `SELECT metadata.compressed, coalesce(sum(length(data.data)), 0)
+		FROM data JOIN metadata ON metadata.id = data.id GROUP BY metadata.compressed`
+
+	queryDataSize = `SELECT coalesce(sum(length(data)), 0) FROM data`
+
+	queryBlocksSize = `SELECT coalesce(sum(length(data)), 0) FROM blocks`
+
+	queryPageSize = `PRAGMA page_size`
+
+	queryPageCount = `PRAGMA page_count`
+
+	queryFreelistCount = `PRAGMA freelist_count`
+)
+
+// FileInfo is the header of a file along with how it's stored
+// within the container, returned by [Reader.Stat].
+type FileInfo struct {
+	*Header
+
+	// Blocks is the number of blocks the file is split into.
+	Blocks int
+
+	// StoredSize is the size, in bytes, of the blocks of the file, after
+	// compression and encryption. Deduplicated blocks are counted in full
+	// by every file sharing them.
+	StoredSize int64
+}
+
+// Ratio returns the compression ratio of the file, the size of
+// its contents over its stored size, or zero for empty files.
+func (info *FileInfo) Ratio() float64 {
+	if info.StoredSize == 0 {
+		return 0
+	}
+	return float64(info.Size) / float64(info.StoredSize)
+}
+
+// Stat returns the header of the file id, along with its stored size
+// and number of blocks, without reading its data blocks. [ErrFileNotFound]
+// is returned if there's no file id.
+func (reader *Reader) Stat(id int) (*FileInfo, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	row := reader.db.QueryRow(reader.metadataQuery()+" WHERE id = ?", id)
+	header, err := reader.scanHeader(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header.Attrs, err = reader.Attrs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{Header: header}
+	err = reader.db.QueryRow(reader.blocksQuery(queryStoredSizeById), id).Scan(&info.Blocks, &info.StoredSize)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// StatByName returns the [FileInfo] of the file name, as [Reader.Stat],
+// without listing all files as [Reader.Files]. Unencrypted names are looked
+// up by the index of the name column, while finding an encrypted name
+// decrypts the names of the encrypted files until found. [ErrFileNotFound]
+// is returned if there's no file name.
+func (reader *Reader) StatByName(name string) (*FileInfo, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	id, err := reader.findId(name)
+	if err != nil {
+		return nil, err
+	}
+	return reader.Stat(id)
+}
+
+// CompressionStats accounts for the files of a container
+// that are either compressed or not.
+type CompressionStats struct {
+	// Files is the number of files.
+	Files int
+
+	// Size is the total size, in bytes, of the contents of the files.
+	Size int64
+
+	// StoredSize is the total size, in bytes, of the blocks of the files.
+	// Deduplicated blocks are counted in full by every file sharing them.
+	StoredSize int64
+}
+
+// Stats accounts for the files of a container and the space they take.
+type Stats struct {
+	// Files is the number of files, including directories
+	// and symbolic links.
+	Files int
+
+	// Size is the total size, in bytes, of the contents of the files.
+	Size int64
+
+	// StoredSize is the total size, in bytes, of the blocks stored,
+	// counting each deduplicated block once.
+	StoredSize int64
+
+	// Compressed and Uncompressed break the files down by whether they are
+	// compressed. The compression level isn't stored, so it isn't broken
+	// down further.
+	Compressed   CompressionStats
+	Uncompressed CompressionStats
+
+	// DatabaseSize is the size, in bytes, of the database file.
+	DatabaseSize int64
+
+	// FreeSize is the size, in bytes, of the unused pages of the database,
+	// left by deleted files until the database is vacuumed.
+	FreeSize int64
+}
+
+// Ratio returns the compression ratio of the container, the size of the
+// contents of its files over their stored size, or zero if there's no data.
+func (stats *Stats) Ratio() float64 {
+	if stats.StoredSize == 0 {
+		return 0
+	}
+	return float64(stats.Size) / float64(stats.StoredSize)
+}
+
+// byCompression returns the stats of compressed or uncompressed files.
+func (stats *Stats) byCompression(compressed bool) *CompressionStats {
+	if compressed {
+		return &stats.Compressed
+	}
+	return &stats.Uncompressed
+}
+
+// Stats returns the number of files of the container and the space they
+// take, without reading their data blocks. No password is needed.
+func (reader *Reader) Stats() (*Stats, error) {
+	if reader.checkError() {
+		return nil, reader.err
+	}
+
+	stats := new(Stats)
+	err := reader.scanByCompression(stats, querySizeByCompression, func(row *CompressionStats) []any {
+		return []any{&row.Files, &row.Size}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = reader.scanByCompression(stats, reader.blocksQuery(queryStoredSizeByCompression), func(row *CompressionStats) []any {
+		return []any{&row.StoredSize}
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Files = stats.Compressed.Files + stats.Uncompressed.Files
+	stats.Size = stats.Compressed.Size + stats.Uncompressed.Size
+
+	err = reader.db.QueryRow(queryDataSize).Scan(&stats.StoredSize)
+	if err != nil {
+		return nil, err
+	}
+	if reader.capabilities.Has(FeatureDeduplication) {
+		var blocksSize int64
+		err = reader.db.QueryRow(queryBlocksSize).Scan(&blocksSize)
+		if err != nil {
+			return nil, err
+		}
+		stats.StoredSize += blocksSize
+	}
+
+	var pageSize, pageCount, freelistCount int64
+	for _, pragma := range []struct {
+		query string
+		dest  *int64
+	}{
+		{queryPageSize, &pageSize},
+		{queryPageCount, &pageCount},
+		{queryFreelistCount, &freelistCount},
+	} {
+		err = reader.db.QueryRow(pragma.query).Scan(pragma.dest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stats.DatabaseSize = pageCount * pageSize
+	stats.FreeSize = freelistCount * pageSize
+
+	return stats, nil
+}
+
+// scanByCompression runs query, whose rows start with the compressed
+// column, adding the rest of each row, scanned into the fields of
+// CompressionStats returned by dest, to the matching stats.
+func (reader *Reader) scanByCompression(stats *Stats, query string, dest func(row *CompressionStats) []any) (err error) {
+	rows, err := reader.db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	for rows.Next() {
+		var compressed bool
+		var row CompressionStats
+		err = rows.Scan(append([]any{&compressed}, dest(&row)...)...)
+		if err != nil {
+			return err
+		}
+
+		compression := stats.byCompression(compressed)
+		compression.Files += row.Files
+		compression.Size += row.Size
+		compression.StoredSize += row.StoredSize
+	}
+	return rows.Err()
+}
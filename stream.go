@@ -0,0 +1,172 @@
+package arc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+const (
+	// StreamNamespace is the namespace conventionally used for anonymous
+	// streams, keeping them apart from the files stored by name.
+	StreamNamespace = "streams"
+
+	streamTimeLayout = "20060102T150405Z"
+
+	streamHashPrefixSize = 6
+
+	streamRandomSuffixSize = 4
+)
+
+// streamName returns the name of a stream modified at header.ModTime with
+// contents hashed to contentHash, within namespace, followed by suffix if
+// not empty. The nth name is suffixed with n, for streams colliding with
+// an existing name.
+func streamName(namespace string, header *Header, contentHash []byte, suffix string, n int) string {
+	name := fmt.Sprintf(
+		"%s-%s",
+		header.ModTime.UTC().Format(streamTimeLayout),
+		hex.EncodeToString(contentHash[:streamHashPrefixSize]),
+	)
+	if suffix != "" {
+		name = fmt.Sprintf("%s-%s", name, suffix)
+	}
+	if n > 0 {
+		name = fmt.Sprintf("%s-%d", name, n)
+	}
+	return path.Join(namespace, name)
+}
+
+// streamSuffix returns the random suffix of the name of an encrypted stream,
+// whose name may collide with names encrypted with keys the writer doesn't
+// have, which can't be compared.
+func streamSuffix() (string, error) {
+	suffix := make([]byte, streamRandomSuffixSize)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(suffix), nil
+}
+
+// spoolStream copies src to a temporary file, returning it rewound
+// along with the hash of its contents.
+func spoolStream(src io.Reader) (*os.File, []byte, error) {
+	file, err := os.CreateTemp("", "arc-stream-")
+	if err != nil {
+		return nil, nil, err
+	}
+	os.Remove(file.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), src)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, hash.Sum(nil), nil
+}
+
+// WriteStream adds the contents of src, a stream with no name of its own,
+// to the container. The name is generated from the modification time and
+// a prefix of the SHA-256 hash of the contents, e.g.
+// "streams/20240102T150405Z-1a2b3c4d5e6f", placed within namespace (which
+// may be empty, or [StreamNamespace]), and is returned.
+//
+// Streams with the same time and contents are suffixed with a counter.
+// Encrypted streams are also suffixed with random hex digits before it, e.g.
+// "streams/20240102T150405Z-1a2b3c4d5e6f-9f8e7d6c", as names encrypted with
+// keys other than the container key can't be compared.
+//
+// The name of header is ignored. As the contents must be hashed before being
+// written, src is first copied to a temporary file, which also allows
+// [Header.Convergent] to be honored.
+func (writer *Writer) WriteStream(header *Header, src io.Reader, namespace string) (name string, err error) {
+	if err = writer.acquire(); err != nil {
+		return "", err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return "", writer.err
+	}
+
+	var file *os.File
+	var contentHash []byte
+	file, contentHash, writer.err = spoolStream(src)
+	if writer.err != nil {
+		return "", writer.err
+	}
+	defer func() {
+		err2 := file.Close()
+		if err2 != nil && err == nil {
+			writer.err = err2
+			err = writer.err
+		}
+	}()
+
+	defer restoreContentClass(header, header.ContentClass)
+
+	header.Name = "stream"
+	writer.err = header.check()
+	if writer.err != nil {
+		return "", writer.err
+	}
+	var suffix string
+	if header.Encryption {
+		suffix, writer.err = streamSuffix()
+		if writer.err != nil {
+			return "", writer.err
+		}
+	}
+	db := writer.fileQuerier(context.Background())
+	for n := 0; ; n++ {
+		header.Name = streamName(namespace, header, contentHash, suffix, n)
+
+		var id int
+		id, writer.err = writer.existingId(db, header.Name)
+		if writer.err != nil {
+			return "", writer.err
+		}
+		if id == 0 {
+			break
+		}
+	}
+
+	if !header.Convergent || !header.Encryption {
+		contentHash = nil
+	}
+	if header.Compression != 0 && header.ContentClass == "" && writer.dictionaries != nil {
+		header.ContentClass, writer.err = detectFileClass(file)
+		if writer.err != nil {
+			return "", writer.err
+		}
+	}
+
+	err = writer.writeHeader(context.Background(), header, true, contentHash)
+	if err != nil {
+		return "", fileError("write", header.Name, header.Id, err)
+	}
+
+	var read int64
+	read, writer.err = io.Copy(writer.currWriters[len(writer.currWriters)-1], file)
+	writer.currBytesRead = read
+	if writer.err != nil {
+		return "", fileError("write", header.Name, header.Id, writer.err)
+	}
+
+	err = writer.flush()
+	if err != nil {
+		return "", fileError("write", header.Name, header.Id, err)
+	}
+	return header.Name, nil
+}
@@ -0,0 +1,47 @@
+package arc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteStreamNames(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, encryption := range []bool{false, true} {
+		var password []byte
+		if encryption {
+			password = testPassword
+		}
+		path := testContainerPath(t)
+		writer, err := newTestWriter(path, 0, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]bool)
+		for i := 0; i < 2; i++ {
+			header := &Header{ModTime: modTime, Encryption: encryption}
+			name, err := writer.WriteStream(header, strings.NewReader("log line"), StreamNamespace)
+			if err != nil {
+				t.Fatalf("encryption %v: %v", encryption, err)
+			}
+			if !strings.HasPrefix(name, "streams/20240102T150405Z-") {
+				t.Errorf("encryption %v: unexpected name %q", encryption, name)
+			}
+			names[name] = true
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 2 {
+			t.Fatalf("encryption %v: streams named alike: %v", encryption, names)
+		}
+
+		want := make(map[string]string)
+		for name := range names {
+			want[name] = "log line"
+		}
+		checkFiles(t, readTestContainer(t, path, password), want)
+	}
+}
@@ -0,0 +1,267 @@
+package arc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const (
+	querySummary = `SELECT files, size, created, root FROM summary`
+
+	queryInsertSummary = `INSERT INTO summary VALUES (?, ?, ?, ?)`
+
+	queryDeleteSummary = `DELETE FROM summary`
+
+	queryFileTotals = `SELECT count(*), coalesce(sum(size), 0) FROM metadata`
+
+	queryFileChecksums = `SELECT id, checksum FROM metadata WHERE checksum IS NOT NULL ORDER BY id`
+)
+
+// ErrSummaryMismatch is returned when opening a container whose files
+// don't match its summary, as when it was truncated, or files were
+// added or dropped behind the back of the library.
+var ErrSummaryMismatch = errors.New("container files don't match its summary")
+
+// Summary describes the files of a container, as stored once it was
+// closed. See [Reader.Summary].
+type Summary struct {
+	// Files is the number of files, including directories and links.
+	Files int64
+
+	// Size is the total size of the files, as recorded in their metadata.
+	Size int64
+
+	// Created is when the container was first closed.
+	Created time.Time
+
+	// Root is the root of the Merkle tree over the checksums of the
+	// files, in order of id, or nil if no file has a checksum.
+	Root []byte
+}
+
+// merkleRoot returns the root of the Merkle tree whose leaves are the
+// checksums of the files, each hashed with its id, in order of id,
+// promoting the last node of levels of odd length. It's nil if no file
+// has a checksum.
+func merkleRoot(db execQuerier, capabilities Capabilities) (root []byte, err error) {
+	if !capabilities.Has(FeatureChecksums) {
+		return nil, nil
+	}
+
+	rows, err := db.Query(queryFileChecksums)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	var level [][]byte
+	for rows.Next() {
+		var id int64
+		var checksum []byte
+		err = rows.Scan(&id, &checksum)
+		if err != nil {
+			return nil, err
+		}
+		level = append(level, merkleLeaf(id, checksum))
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return merkleTreeRoot(level), nil
+}
+
+// merkleLeaf returns the leaf of the Merkle tree of the file id.
+func merkleLeaf(id int64, checksum []byte) []byte {
+	leaf := sha256.New()
+	leaf.Write([]byte{0})
+	leaf.Write(binary.BigEndian.AppendUint64(nil, uint64(id)))
+	leaf.Write(checksum)
+	return leaf.Sum(nil)
+}
+
+// merkleTreeRoot returns the root of the Merkle tree over the leaves,
+// or nil if there are none.
+func merkleTreeRoot(level [][]byte) []byte {
+	if len(level) == 0 {
+		return nil
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i+1 < len(level); i += 2 {
+			node := sha256.New()
+			node.Write([]byte{1})
+			node.Write(level[i])
+			node.Write(level[i+1])
+			next = append(next, node.Sum(nil))
+		}
+		if len(level)%2 == 1 {
+			next = append(next, level[len(level)-1])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// computeSummary summarizes the files of the container opened in db,
+// with no creation time.
+func computeSummary(db execQuerier, capabilities Capabilities) (summary Summary, err error) {
+	err = db.QueryRow(queryFileTotals).Scan(&summary.Files, &summary.Size)
+	if err != nil {
+		return summary, err
+	}
+	summary.Root, err = merkleRoot(db, capabilities)
+	return summary, err
+}
+
+// readSummary returns the summary stored in the container opened in db,
+// reporting whether there's one.
+func readSummary(db execQuerier, capabilities Capabilities) (summary Summary, ok bool, err error) {
+	if !capabilities.Has(FeatureSummary) {
+		return summary, false, nil
+	}
+
+	var created int64
+	err = db.QueryRow(querySummary).Scan(&summary.Files, &summary.Size, &created, &summary.Root)
+	if errors.Is(err, sql.ErrNoRows) {
+		return summary, false, nil
+	}
+	if err != nil {
+		return summary, false, err
+	}
+	summary.Created = time.Unix(created, 0)
+	return summary, true, nil
+}
+
+// storeSummary replaces the summary of the container opened in db by one
+// of its current files, keeping the creation time of the replaced one, if
+// any. Nothing is stored in containers without [FeatureSummary].
+func storeSummary(db execQuerier, capabilities Capabilities) error {
+	if !capabilities.Has(FeatureSummary) {
+		return nil
+	}
+
+	stored, ok, err := readSummary(db, capabilities)
+	if err != nil {
+		return err
+	}
+	created := time.Now()
+	if ok {
+		created = stored.Created
+	}
+
+	summary, err := computeSummary(db, capabilities)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryDeleteSummary)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryInsertSummary, summary.Files, summary.Size, created.Unix(), summary.Root)
+	return err
+}
+
+// clearSummary removes the summary of the container opened in db, as
+// when adding files, so a container left partially written by a crash
+// isn't refused for not matching it. The summary is stored again once
+// the [Writer] is closed.
+func clearSummary(db execQuerier, capabilities Capabilities) error {
+	if !capabilities.Has(FeatureSummary) {
+		return nil
+	}
+
+	_, err := db.Exec(queryDeleteSummary)
+	return err
+}
+
+// verifySummary checks the files of the container against its summary,
+// if it stores one: containers written before [FeatureSummary], or still
+// being written, have none.
+func (reader *Reader) verifySummary() error {
+	stored, ok, err := readSummary(reader.db, reader.capabilities)
+	if err != nil || !ok {
+		return err
+	}
+
+	summary, err := computeSummary(reader.db, reader.capabilities)
+	if err != nil {
+		return err
+	}
+	if summary.Files != stored.Files || summary.Size != stored.Size || !bytes.Equal(summary.Root, stored.Root) {
+		return ErrSummaryMismatch
+	}
+	return nil
+}
+
+// verifySummary checks the files of the remote container against its
+// summary, as [Reader.verifySummary].
+func (reader *RemoteReader) verifySummary() error {
+	table, ok := reader.file.tables["summary"]
+	if !reader.capabilities.Has(FeatureSummary) || !ok {
+		return nil
+	}
+
+	var stored map[string]any
+	err := reader.file.walkTable(table.root, func(rowid int64, record []any) error {
+		stored = table.row(rowid, record)
+		return errStopWalk
+	})
+	if err != nil || stored == nil {
+		return err
+	}
+
+	var summary Summary
+	var leaves [][]byte
+	metadata := reader.file.tables["metadata"]
+	err = reader.file.walkTable(metadata.root, func(rowid int64, record []any) error {
+		row := metadata.row(rowid, record)
+		size, _ := row["size"].(int64)
+		summary.Files++
+		summary.Size += size
+		if checksum, ok := row["checksum"].([]byte); ok && reader.capabilities.Has(FeatureChecksums) {
+			leaves = append(leaves, merkleLeaf(rowid, checksum))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	summary.Root = merkleTreeRoot(leaves)
+
+	files, _ := stored["files"].(int64)
+	size, _ := stored["size"].(int64)
+	root, _ := stored["root"].([]byte)
+	if summary.Files != files || summary.Size != size || !bytes.Equal(summary.Root, root) {
+		return ErrSummaryMismatch
+	}
+	return nil
+}
+
+// Summary returns the summary of the files of the container, as stored
+// when it was closed, which was validated when the Reader was opened.
+// [ErrMissingFeature] is returned for containers written without
+// [FeatureSummary], and [sql.ErrNoRows] for those not closed since.
+func (reader *Reader) Summary() (Summary, error) {
+	if reader.checkError() {
+		return Summary{}, reader.err
+	}
+	if !reader.capabilities.Has(FeatureSummary) {
+		return Summary{}, FeatureSummary.missingError()
+	}
+
+	summary, ok, err := readSummary(reader.db, reader.capabilities)
+	if err == nil && !ok {
+		err = sql.ErrNoRows
+	}
+	return summary, err
+}
@@ -0,0 +1,120 @@
+package arc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMerkleTreeRoot(t *testing.T) {
+	node := func(left []byte, right []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{1}, left...), right...))
+		return sum[:]
+	}
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	tests := []struct {
+		leaves [][]byte
+		root   []byte
+	}{
+		{nil, nil},
+		{[][]byte{a}, a},
+		{[][]byte{a, b}, node(a, b)},
+		// The last node of odd levels is promoted.
+		{[][]byte{a, b, c}, node(node(a, b), c)},
+	}
+	for _, test := range tests {
+		root := merkleTreeRoot(test.leaves)
+		if !bytes.Equal(root, test.root) {
+			t.Errorf("%q: got %x, want %x", test.leaves, root, test.root)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	path := testContainerPath(t)
+	files := map[string]string{"first": "first", "second": "second", "third": "third"}
+	before := time.Now().Add(-time.Second)
+	writeTestContainer(t, path, nil, Header{}, files)
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := reader.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := reader.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves := make([][]byte, len(headers)+1)
+	for _, header := range headers {
+		leaves[header.Id] = merkleLeaf(int64(header.Id), header.Checksum)
+	}
+	root := merkleTreeRoot(leaves[1:])
+	reader.Close()
+	if summary.Files != 3 || summary.Size != int64(len("firstsecondthird")) || !bytes.Equal(summary.Root, root) {
+		t.Errorf("got summary %+v, want root %x", summary, root)
+	}
+	if summary.Created.Before(before.Truncate(time.Second)) || summary.Created.After(time.Now()) {
+		t.Errorf("got creation time %v", summary.Created)
+	}
+
+	// The summary is cleared while adding files, and stored again,
+	// keeping the creation time, once closed.
+	writer, err := openTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, writer, Header{Name: "fourth"}, []byte("fourth"))
+	reader, err = NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reader.Summary()
+	reader.Close()
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("while writing: got %v, want %v", err, sql.ErrNoRows)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err = NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	updated, err := reader.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Files != 4 || !updated.Created.Equal(summary.Created) || bytes.Equal(updated.Root, summary.Root) {
+		t.Errorf("got summary %+v, was %+v", updated, summary)
+	}
+}
+
+func TestSummaryMismatch(t *testing.T) {
+	for _, statement := range []string{
+		`DELETE FROM metadata WHERE id = (SELECT max(id) FROM metadata)`,
+		`UPDATE metadata SET size = size + 1 WHERE id = 1`,
+		`UPDATE metadata SET checksum = zeroblob(32) WHERE id = 1`,
+	} {
+		path := testContainerPath(t)
+		writeTestContainer(t, path, nil, Header{}, map[string]string{"first": "first", "second": "second"})
+		execTestContainer(t, path, statement)
+
+		reader, err := NewReader(path, nil)
+		if reader != nil {
+			reader.Close()
+		}
+		if !errors.Is(err, ErrSummaryMismatch) {
+			t.Errorf("%s: got %v, want %v", statement, err, ErrSummaryMismatch)
+		}
+	}
+}
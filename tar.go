@@ -0,0 +1,198 @@
+package arc
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+)
+
+const (
+	tarFileMode fs.FileMode = 0644
+	tarDirMode  fs.FileMode = 0755
+)
+
+// FromTar writes the entries of the tar archive read from r to writer,
+// applying the compression and encryption of template to each of them.
+// Regular files, directories and symbolic links are written, keeping their
+// names, modification times and, in containers with [FeatureAttributes],
+// their permission bits and ownership. Hard links to files written before
+// are written by [Writer.WriteHardlink], in containers with
+// [FeatureHardlinks]. Other entries, such as devices, are skipped.
+//
+// The archive is read as a stream, so template.Convergent is ignored.
+// The writer is left open, with the last file flushed.
+func FromTar(r io.Reader, writer *Writer, template Header) error {
+	if writer.err != nil {
+		return writer.err
+	}
+
+	archive := tar.NewReader(r)
+	ids := make(map[string]int)
+	for {
+		tarHeader, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		header := template
+		header.Name = path.Clean(tarHeader.Name)
+		header.ModTime = tarHeader.ModTime.UTC()
+		header.Convergent = false
+		header.Mode = tarHeader.FileInfo().Mode() & storedModeBits
+		header.Uid = &tarHeader.Uid
+		header.Gid = &tarHeader.Gid
+
+		switch tarHeader.Typeflag {
+		case tar.TypeReg:
+			err = writer.WriteHeader(&header, true)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(writer, archive)
+		case tar.TypeDir:
+			err = writer.WriteDir(&header)
+		case tar.TypeSymlink:
+			err = writer.WriteSymlink(&header, tarHeader.Linkname)
+		case tar.TypeLink:
+			target, ok := ids[path.Clean(tarHeader.Linkname)]
+			if !ok || !writer.capabilities.Has(FeatureHardlinks) {
+				continue
+			}
+			err = writer.WriteHardlink(&header, target)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if header.Type == TypeFile {
+			ids[header.Name] = header.Id
+		}
+	}
+
+	return writer.flush()
+}
+
+// tarHeader returns the tar header of the file header.
+func tarHeader(header *Header) *tar.Header {
+	tarHeader := &tar.Header{
+		Name:    header.Name,
+		ModTime: header.ModTime,
+	}
+	mode := header.Mode
+	switch header.Type {
+	case TypeDir:
+		tarHeader.Typeflag = tar.TypeDir
+		tarHeader.Name += "/"
+		if mode == 0 {
+			mode = tarDirMode
+		}
+	case TypeSymlink:
+		tarHeader.Typeflag = tar.TypeSymlink
+		if mode == 0 {
+			mode = fs.ModePerm
+		}
+	default:
+		tarHeader.Typeflag = tar.TypeReg
+		tarHeader.Size = header.Size
+		if mode == 0 {
+			mode = tarFileMode
+		}
+	}
+	tarHeader.Mode = int64(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		tarHeader.Mode |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		tarHeader.Mode |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		tarHeader.Mode |= 01000
+	}
+	if header.Uid != nil {
+		tarHeader.Uid = *header.Uid
+	}
+	if header.Gid != nil {
+		tarHeader.Gid = *header.Gid
+	}
+
+	return tarHeader
+}
+
+// ToTar writes all files of the container to w as a tar archive, in name
+// order, keeping their names, modification times and, when stored, their
+// permission bits and ownership. Files without stored permission bits are
+// archived with mode 0644, and directories with 0755.
+func (reader *Reader) ToTar(w io.Writer) error {
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+
+	names := make(map[int]string, len(files))
+	for name, header := range files {
+		names[header.Id] = name
+	}
+
+	archive := tar.NewWriter(w)
+	for _, name := range extractOrder(files) {
+		header := files[name]
+		if header.Encryption && !reader.canDecrypt(header.Id) {
+			return reader.decryptError(header.Id)
+		}
+
+		if header.LinkId != 0 {
+			tarHeader := tarHeader(header)
+			tarHeader.Typeflag = tar.TypeLink
+			tarHeader.Size = 0
+			tarHeader.Linkname = names[header.LinkId]
+			err = archive.WriteHeader(tarHeader)
+		} else {
+			err = reader.writeTarEntry(archive, header)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func (reader *Reader) writeTarEntry(archive *tar.Writer, header *Header) (err error) {
+	tarHeader := tarHeader(header)
+	if header.Type == TypeDir {
+		return archive.WriteHeader(tarHeader)
+	}
+
+	stream, err := reader.openReader(header.Id, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := stream.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	if header.Type == TypeSymlink {
+		linkTarget, err := io.ReadAll(stream)
+		if err != nil {
+			return err
+		}
+		tarHeader.Linkname = string(linkTarget)
+		return archive.WriteHeader(tarHeader)
+	}
+
+	err = archive.WriteHeader(tarHeader)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, stream)
+	return err
+}
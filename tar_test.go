@@ -0,0 +1,156 @@
+package arc
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+var testArchiveTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// testTar returns a tar archive with a directory, files, a symbolic
+// link, a hard link and a device, skipped when imported.
+func testTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	entries := []struct {
+		header   tar.Header
+		contents string
+	}{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0o750}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "dir/file", Mode: 0o4640, Uid: 1000, Gid: 100}, "file contents"},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "dir/file", Mode: 0o777}, ""},
+		{tar.Header{Typeflag: tar.TypeLink, Name: "hardlink", Linkname: "dir/file", Mode: 0o640}, ""},
+		{tar.Header{Typeflag: tar.TypeChar, Name: "null", Mode: 0o666, Devmajor: 1, Devminor: 3}, ""},
+	}
+	for _, entry := range entries {
+		entry.header.ModTime = testArchiveTime
+		entry.header.Size = int64(len(entry.contents))
+		err := archive.WriteHeader(&entry.header)
+		if err == nil {
+			_, err = io.WriteString(archive, entry.contents)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFromTar(t *testing.T) {
+	for _, encryption := range []bool{false, true} {
+		path := testContainerPath(t)
+		writer, err := newTestWriter(path, 0, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = FromTar(bytes.NewReader(testTar(t)), writer, Header{Encryption: encryption})
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			t.Fatalf("encryption %v: %v", encryption, err)
+		}
+
+		reader, err := NewReader(path, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFiles(t, readTestFiles(t, reader), map[string]string{
+			"dir/file": "file contents",
+			"hardlink": "file contents",
+		})
+		files, err := reader.Files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 4 {
+			t.Errorf("encryption %v: got %d files, want 4", encryption, len(files))
+		}
+		file := files["dir/file"]
+		if file.Mode != fs.ModeSetuid|0o640 || file.Uid == nil || *file.Uid != 1000 || file.Gid == nil || *file.Gid != 100 {
+			t.Errorf("encryption %v: got mode %v, owner %v:%v", encryption, file.Mode, file.Uid, file.Gid)
+		}
+		if !file.ModTime.Equal(testArchiveTime) || file.Encryption != encryption {
+			t.Errorf("encryption %v: got modification time %v, encryption %v", encryption, file.ModTime, file.Encryption)
+		}
+		if files["dir"].Type != TypeDir || files["dir"].Mode != 0o750 {
+			t.Errorf("encryption %v: got dir %+v", encryption, files["dir"])
+		}
+		if files["link"].Type != TypeSymlink || files["hardlink"].LinkId != file.Id {
+			t.Errorf("encryption %v: got link %+v, hard link %+v", encryption, files["link"], files["hardlink"])
+		}
+		reader.Close()
+	}
+}
+
+func TestToTar(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = FromTar(bytes.NewReader(testTar(t)), writer, Header{})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var buf bytes.Buffer
+	err = reader.ToTar(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		typeflag byte
+		name     string
+		linkname string
+		mode     int64
+		contents string
+	}{
+		{tar.TypeDir, "dir/", "", 0o750, ""},
+		{tar.TypeReg, "dir/file", "", 0o4640, "file contents"},
+		{tar.TypeLink, "hardlink", "dir/file", 0o640, ""},
+		{tar.TypeSymlink, "link", "dir/file", 0o777, ""},
+	}
+	archive := tar.NewReader(&buf)
+	for _, entry := range want {
+		header, err := archive.Next()
+		if err != nil {
+			t.Fatalf("%s: %v", entry.name, err)
+		}
+		contents, err := io.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag != entry.typeflag || header.Name != entry.name || header.Linkname != entry.linkname ||
+			header.Mode != entry.mode || string(contents) != entry.contents {
+			t.Errorf("got %c %s -> %q, mode %o, %q, want %c %s -> %q, mode %o, %q",
+				header.Typeflag, header.Name, header.Linkname, header.Mode, contents,
+				entry.typeflag, entry.name, entry.linkname, entry.mode, entry.contents)
+		}
+		if !header.ModTime.Equal(testArchiveTime) {
+			t.Errorf("%s: got modification time %v", header.Name, header.ModTime)
+		}
+	}
+	_, err = archive.Next()
+	if err != io.EOF {
+		t.Errorf("got %v after the last entry, want %v", err, io.EOF)
+	}
+}
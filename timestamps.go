@@ -0,0 +1,80 @@
+package arc
+
+import (
+	"database/sql"
+	"os"
+	"time"
+)
+
+const queryUpdateTimestamps = `UPDATE metadata SET mod_time_ns = ?,
+	access_time = ?, change_time = ?, birth_time = ? WHERE id = ?`
+
+// storeTimestamps records the times of the file of header in nanoseconds,
+// NULL for the ones unknown.
+func storeTimestamps(db execQuerier, header *Header) error {
+	_, err := db.Exec(
+		queryUpdateTimestamps,
+		header.ModTime.UnixNano(),
+		unixNano(header.AccessTime),
+		unixNano(header.ChangeTime),
+		unixNano(header.BirthTime),
+		header.Id,
+	)
+	return err
+}
+
+// unixNano returns t in nanoseconds since the Unix epoch,
+// or nil for the zero time.
+func unixNano(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// nanoTime returns the time of value, in nanoseconds since the Unix
+// epoch, or the zero time if it isn't an integer, as NULL.
+func nanoTime(value any) time.Time {
+	nanoseconds, ok := value.(int64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, nanoseconds)
+}
+
+// timeScanner scans a nullable time column, in nanoseconds
+// since the Unix epoch, left as the zero time for NULL.
+type timeScanner struct {
+	dest *time.Time
+}
+
+func (scanner timeScanner) Scan(src any) error {
+	var value sql.NullInt64
+	err := value.Scan(src)
+	if err != nil {
+		return err
+	}
+	if value.Valid {
+		*scanner.dest = time.Unix(0, value.Int64)
+	}
+	return nil
+}
+
+// accessTime returns the access time restored along the file of
+// header, its modification time when not recorded.
+func (header *Header) accessTime() time.Time {
+	if header.AccessTime.IsZero() {
+		return header.ModTime
+	}
+	return header.AccessTime
+}
+
+// restoreTimes restores the access and modification times of the
+// file id, extracted to the local file at path.
+func (reader *Reader) restoreTimes(id int, path string) error {
+	info, err := reader.Stat(id)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, info.Header.accessTime(), info.Header.ModTime)
+}
@@ -0,0 +1,37 @@
+package arc
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const queryContainerUUID = `SELECT uuid FROM container`
+
+// newUUID returns a random (version 4) UUID in its canonical form.
+func newUUID() (string, error) {
+	var uuid [16]byte
+	_, err := rand.Read(uuid[:])
+	if err != nil {
+		return "", err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+// UUID returns the random identifier assigned to the container when it
+// was created. Containers created by older versions have none, and
+// an error wrapping [ErrMissingFeature] is returned.
+func (reader *Reader) UUID() (string, error) {
+	if reader.checkError() {
+		return "", reader.err
+	}
+	if !reader.capabilities.Has(FeatureUUID) {
+		return "", FeatureUUID.missingError()
+	}
+
+	var uuid string
+	err := reader.db.QueryRow(queryContainerUUID).Scan(&uuid)
+	return uuid, err
+}
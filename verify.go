@@ -0,0 +1,169 @@
+package arc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"io"
+	"sort"
+)
+
+const (
+	queryChecksumById = `SELECT size, checksum FROM metadata WHERE id = ?`
+
+	queryBlockCountById = `SELECT blocks FROM metadata WHERE id = ?`
+)
+
+var (
+	// ErrChecksumMismatch is returned when the contents of a file
+	// don't match the checksum stored along it.
+	ErrChecksumMismatch = errors.New("file checksum mismatch")
+
+	// ErrSizeMismatch is returned when the contents of a file
+	// don't have the size stored along it.
+	ErrSizeMismatch = errors.New("file size mismatch")
+
+	// ErrBlockCountMismatch is returned when a file doesn't have
+	// the number of blocks stored along it.
+	ErrBlockCountMismatch = errors.New("file block count mismatch")
+)
+
+// Verify reads the whole file id, checking its contents against its size
+// and, if stored, its checksum, as [Reader.VerifyContext].
+func (reader *Reader) Verify(id int) error {
+	return reader.VerifyContext(context.Background(), id)
+}
+
+// VerifyContext reads the whole file id, running the queries with ctx,
+// checking its number of blocks, and its contents against its size and,
+// if stored, its checksum. Encrypted files are checked by decrypting them,
+// as each chunk is authenticated.
+func (reader *Reader) VerifyContext(ctx context.Context, id int) (err error) {
+	if reader.checkError() {
+		return reader.err
+	}
+
+	var size int64
+	var checksum []byte
+	if reader.capabilities.Has(FeatureChecksums) {
+		err = reader.db.QueryRowContext(ctx, queryChecksumById, id).Scan(&size, &checksum)
+	} else {
+		err = reader.db.QueryRowContext(ctx, queryRangeMetadataById, id).Scan(&size, new(bool), new(bool))
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		return err
+	}
+	size, err = reader.unsealedSize(id, size)
+	if err != nil {
+		return err
+	}
+
+	var blocks, storedBlocks int
+	err = reader.db.QueryRowContext(ctx, queryBlockCountById, id).Scan(&blocks)
+	if err != nil {
+		return err
+	}
+	err = reader.db.QueryRowContext(ctx, reader.blocksQuery(queryStoredSizeById), id).Scan(&storedBlocks, new(int64))
+	if err != nil {
+		return err
+	}
+	if blocks != storedBlocks {
+		return ErrBlockCountMismatch
+	}
+
+	stream, err := reader.openReaderContext(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := stream.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	hash := sha256.New()
+	read, err := io.Copy(hash, stream)
+	if err != nil {
+		return err
+	}
+	if read != size {
+		return ErrSizeMismatch
+	}
+	if checksum != nil && !bytes.Equal(hash.Sum(nil), checksum) {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+// DamagedFile is a file failing verification.
+type DamagedFile struct {
+	Id   int
+	Name string
+	Err  error
+}
+
+// VerifyReport is the outcome of [Reader.VerifyAll].
+type VerifyReport struct {
+	// Verified is the number of files verified, damaged or not.
+	Verified int
+
+	// Skipped are the names of the encrypted files
+	// not verified, as their key isn't known.
+	Skipped []string
+
+	// Damaged are the files failing verification, in name order.
+	Damaged []DamagedFile
+}
+
+// Ok reports whether no file is damaged.
+func (report *VerifyReport) Ok() bool {
+	return len(report.Damaged) == 0
+}
+
+// VerifyAll verifies all files of the container, as [Reader.VerifyContext],
+// in name order, streaming their contents without storing them. All files are
+// verified, even after a failure, and the failures are reported as damaged
+// files. The error is only set when the verification is stopped, as when
+// ctx is done, along with the report of the files verified until then.
+func (reader *Reader) VerifyAll(ctx context.Context) (*VerifyReport, error) {
+	files, err := reader.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := new(VerifyReport)
+	for _, name := range names {
+		header := files[name]
+		if header.Type == TypeDir {
+			continue
+		}
+		if header.Encryption && !reader.canDecrypt(header.Id) {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+
+		err = reader.VerifyContext(ctx, header.Id)
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Verified++
+		if err != nil {
+			report.Damaged = append(report.Damaged, DamagedFile{Id: header.Id, Name: name, Err: err})
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,279 @@
+package arc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	queryFormatVersion = `SELECT version FROM format`
+
+	queryInsertFormatVersion = `INSERT INTO format VALUES (?)`
+
+	queryDeleteFormatVersion = `DELETE FROM format`
+
+	queryViews = `SELECT name FROM sqlite_master WHERE type = 'view'`
+)
+
+// FormatVersion is the version of the container format written by this
+// version of the library. Containers created before the format was
+// versioned have version 0, and are still read, as are all versions up to
+// FormatVersion, while newer ones are refused with [ErrUnsupportedVersion].
+// Version 2 encrypts the names of files with random nonces, so readers of
+// version 1 can't decrypt them. Version 3 seals the master keys of files
+// with random nonces, instead of their ids, which are reused once files
+// are deleted. Older versions of the library can't read the encrypted
+// files added by this one, even to containers of older versions.
+const FormatVersion = 3
+
+// ErrUnsupportedVersion is returned when opening a container
+// written in a format newer than [FormatVersion].
+var ErrUnsupportedVersion = errors.New("unsupported container format version")
+
+// migrations upgrade the schema of a container from the version
+// of their index to the next one, within a transaction.
+var migrations = [FormatVersion]func(db execQuerier) error{
+	// The tables and columns of the optional features were added,
+	// unversioned, in between, so version 0 containers may lack any.
+	0: addMissingSchema,
+
+	// The incremental, stored sizes, segments and name index features
+	// were added since, so version 1 containers may lack them.
+	1: addMissingSchema,
+
+	// The keys sealed with the ids of files as nonces are still read,
+	// so only the features added since may be missing.
+	2: addMissingSchema,
+}
+
+// readFormatVersion returns the format version of the container
+// opened in db, given its tables.
+func readFormatVersion(db schemaQuerier, tables map[string]bool) (version int, err error) {
+	if !tables["format"] {
+		return 0, nil
+	}
+
+	rows, err := db.Query(queryFormatVersion)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err2 := rows.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	for rows.Next() {
+		err = rows.Scan(&version)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return version, checkFormatVersion(version)
+}
+
+func checkFormatVersion(version int) error {
+	if version > FormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return nil
+}
+
+// Migrate upgrades the container databasePath in place to [FormatVersion],
+// adding the tables and columns of the features it lacks, so containers
+// created by older versions of the library support all of them. Their files
+// are kept as they are. It's a no-op for containers already up to date.
+func Migrate(databasePath string) (err error) {
+	_, err = os.Stat(databasePath)
+	if err != nil {
+		return err
+	}
+	db, err := openDB("file:"+databasePath+openDatabaseArgs, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := db.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	capabilities, err := detectCapabilities(db)
+	if err != nil {
+		return err
+	}
+	tables, err := queryNames(db, queryTables)
+	if err != nil {
+		return err
+	}
+	version, err := readFormatVersion(db, tables)
+	if err != nil {
+		return err
+	}
+	if version == FormatVersion && len(capabilities.Missing()) == 0 {
+		return nil
+	}
+
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			transaction.Rollback()
+		}
+	}()
+
+	for ; version < FormatVersion; version++ {
+		err = migrations[version](transaction)
+		if err != nil {
+			return err
+		}
+	}
+	// Features readable by older versions of the library, as the
+	// compression levels, are added without a new format version.
+	err = addMissingSchema(transaction)
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(queryDeleteFormatVersion)
+	if err != nil {
+		return err
+	}
+	_, err = transaction.Exec(queryInsertFormatVersion, FormatVersion)
+	if err != nil {
+		return err
+	}
+	return transaction.Commit()
+}
+
+// schemaObject is a table, or view, created by the DDL of the containers.
+type schemaObject struct {
+	name      string
+	view      bool
+	statement string
+
+	// columns are the definitions of the columns of tables, by name.
+	columns map[string]string
+	order   []string
+}
+
+// parseDDL splits the DDL of the containers into the objects it creates,
+// in order. The DDL has CRLF line endings, and no newline after the
+// last statement.
+func parseDDL() []schemaObject {
+	var objects []schemaObject
+	ddl := strings.ReplaceAll(string(queryDDL), "\r\n", "\n")
+	for _, statement := range strings.Split(ddl, ";\n") {
+		statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+		header, body, _ := strings.Cut(statement, "\n")
+
+		var object schemaObject
+		switch {
+		case strings.HasPrefix(header, "CREATE TABLE "):
+			object.name = strings.TrimSuffix(strings.TrimPrefix(header, "CREATE TABLE "), "(")
+		case strings.HasPrefix(header, "CREATE VIEW "):
+			object.name = strings.TrimSuffix(strings.TrimPrefix(header, "CREATE VIEW "), " AS")
+			object.view = true
+		default:
+			continue
+		}
+		object.statement = statement
+
+		if !object.view {
+			object.columns = make(map[string]string)
+			for _, line := range strings.Split(body, "\n") {
+				definition := strings.TrimSuffix(strings.TrimSpace(line), ",")
+				name, _, _ := strings.Cut(definition, " ")
+				switch name {
+				case "", ")", "FOREIGN", "PRIMARY", "UNIQUE", "CHECK":
+					continue
+				}
+				object.columns[name] = definition
+				object.order = append(object.order, name)
+			}
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// addMissingSchema creates the tables and views of the DDL missing from the
+// container opened in db, and adds the columns missing from its tables.
+func addMissingSchema(db execQuerier) error {
+	tables, err := queryNames(db, queryTables)
+	if err != nil {
+		return err
+	}
+	views, err := queryNames(db, queryViews)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range parseDDL() {
+		switch {
+		case object.view && views[object.name]:
+		case !object.view && tables[object.name]:
+			columns, err := queryNames(db, queryTableColumns, object.name)
+			if err != nil {
+				return err
+			}
+			for _, column := range object.order {
+				if columns[column] {
+					continue
+				}
+				_, err = db.Exec("ALTER TABLE " + object.name + " ADD COLUMN " + object.columns[column])
+				if err != nil {
+					return err
+				}
+			}
+
+		default:
+			_, err = db.Exec(object.statement)
+			if err != nil {
+				return err
+			}
+			if object.name == "container" {
+				err = insertUUID(db)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// insertUUID assigns a random identifier to the new container opened in db.
+func insertUUID(db execQuerier) error {
+	uuid, err := newUUID()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryInsertContainerUUID, uuid)
+	return err
+}
+
+// checkFormatVersion refuses containers newer than [FormatVersion].
+func (reader *RemoteReader) checkFormatVersion() error {
+	table, ok := reader.file.tables["format"]
+	if !ok {
+		return nil
+	}
+
+	return reader.file.walkTable(table.root, func(rowid int64, record []any) error {
+		version, ok := table.row(rowid, record)["version"].(int64)
+		if !ok {
+			return errCorruptDatabase
+		}
+		return checkFormatVersion(int(version))
+	})
+}
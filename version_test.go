@@ -0,0 +1,51 @@
+package arc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDDL(t *testing.T) {
+	objects := parseDDL()
+	want := strings.Count(string(queryDDL), "CREATE ")
+	if len(objects) != want {
+		t.Fatalf("got %d objects, want %d", len(objects), want)
+	}
+	for _, object := range objects {
+		if object.view {
+			continue
+		}
+		if len(object.columns) == 0 {
+			t.Errorf("table %s: no columns", object.name)
+		}
+		for name, definition := range object.columns {
+			if strings.ContainsAny(definition, "\r\n") {
+				t.Errorf("table %s: definition of %s spans lines: %q", object.name, name, definition)
+			}
+		}
+	}
+}
+
+func TestMigrateAddsMissingSchema(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, map[string]string{"a": "contents"})
+	execTestContainer(t, path,
+		`DROP TABLE summary`,
+		`ALTER TABLE metadata DROP COLUMN birth_time`,
+	)
+
+	err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if missing := reader.Capabilities().Missing(); len(missing) != 0 {
+		t.Errorf("features missing once migrated: %v", missing)
+	}
+	checkFiles(t, readTestFiles(t, reader), map[string]string{"a": "contents"})
+}
@@ -0,0 +1,289 @@
+package arc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+var (
+	// ErrInvalidVolumeSize is returned when splitting
+	// a container into volumes of non-positive size.
+	ErrInvalidVolumeSize = errors.New("invalid volume size")
+
+	// ErrVolumesUnsupported is returned when splitting a container
+	// not stored in a file, as one created by [NewMemoryWriter].
+	ErrVolumesUnsupported = errors.New("container not stored in a file")
+
+	// ErrUncheckpointed is returned when splitting a container whose
+	// write-ahead log holds changes not yet copied into the container file.
+	ErrUncheckpointed = errors.New("container has changes in its write-ahead log")
+)
+
+// VolumeName returns the name of the volume n, counted from 1,
+// of the container databasePath, e.g. "backup.arc.001".
+func VolumeName(databasePath string, n int) string {
+	return fmt.Sprintf("%s.%03d", databasePath, n)
+}
+
+// SplitVolumes splits the container databasePath into volumes of
+// volumeSize bytes, the last one possibly smaller, named by [VolumeName],
+// so containers fit in filesystems or object stores capping file sizes.
+// The container file is removed once split, along with stale volumes of
+// a previous split. The volumes are read by [NewReaderVolumes], or joined
+// back by [JoinVolumes].
+//
+// The volumes are synced to the disk before the container file is removed.
+// Containers whose write-ahead log isn't empty, as left by a program
+// writing them that crashed, or still has them open, aren't split, failing
+// with [ErrUncheckpointed]: opening and closing the container again copies
+// the log into the container file.
+func SplitVolumes(databasePath string, volumeSize int64) (volumes []string, err error) {
+	if volumeSize <= 0 {
+		return nil, ErrInvalidVolumeSize
+	}
+
+	info, err := os.Stat(databasePath + "-wal")
+	if err == nil && info.Size() > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUncheckpointed, databasePath)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	src, err := os.Open(databasePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := src.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	info, err = src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(max((info.Size()+volumeSize-1)/volumeSize, 1))
+	for n := 1; n <= count; n++ {
+		name := VolumeName(databasePath, n)
+		err = copyVolume(name, src, volumeSize)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, name)
+	}
+
+	for n := count + 1; ; n++ {
+		err = os.Remove(VolumeName(databasePath, n))
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The volumes must be on the disk before the only other copy of
+	// their contents is removed.
+	err = syncDir(filepath.Dir(databasePath))
+	if err != nil {
+		return nil, err
+	}
+	return volumes, os.Remove(databasePath)
+}
+
+// syncDir syncs the entries of the directory name to the disk, so files
+// created within it survive a crash. Windows can't sync directories,
+// syncing the entries along with the files.
+func syncDir(name string) (err error) {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dir, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := dir.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	return dir.Sync()
+}
+
+// copyVolume copies up to size bytes of src to the new file name,
+// syncing it to the disk.
+func copyVolume(name string, src io.Reader, size int64) (err error) {
+	dst, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := dst.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	_, err = io.CopyN(dst, src, size)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return dst.Sync()
+}
+
+// JoinVolumes joins the volumes of the container databasePath, split by
+// [SplitVolumes], back into the container file, removing them, so the
+// container can be opened by [NewReader], [OpenWriter] or [OpenEditor].
+func JoinVolumes(databasePath string) (err error) {
+	volumes, err := OpenVolumes(databasePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := volumes.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	err = copyVolume(databasePath, io.NewSectionReader(volumes, 0, volumes.Size()), volumes.Size())
+	if err == nil {
+		err = syncDir(filepath.Dir(databasePath))
+	}
+	if err != nil {
+		return err
+	}
+	for _, file := range volumes.files {
+		err = os.Remove(file.Name())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Volumes reads the volumes of a container as a single file,
+// implementing [io.ReaderAt]. It's created by [OpenVolumes].
+type Volumes struct {
+	files []*os.File
+
+	// offsets are the offsets of the volumes within the container,
+	// followed by the size of the container.
+	offsets []int64
+}
+
+// OpenVolumes opens the volumes of the container databasePath, split by
+// [SplitVolumes]. The volumes must be closed.
+func OpenVolumes(databasePath string) (*Volumes, error) {
+	volumes := &Volumes{offsets: []int64{0}}
+	for n := 1; ; n++ {
+		file, err := os.Open(VolumeName(databasePath, n))
+		if errors.Is(err, os.ErrNotExist) && n > 1 {
+			break
+		}
+		if err == nil {
+			var info os.FileInfo
+			info, err = file.Stat()
+			if err == nil {
+				volumes.files = append(volumes.files, file)
+				volumes.offsets = append(volumes.offsets, volumes.Size()+info.Size())
+				continue
+			}
+			file.Close()
+		}
+
+		volumes.Close()
+		return nil, err
+	}
+
+	return volumes, nil
+}
+
+// Size returns the size, in bytes, of the container.
+func (volumes *Volumes) Size() int64 {
+	return volumes.offsets[len(volumes.offsets)-1]
+}
+
+// ReadAt reads len(p) bytes of the container, starting at offset,
+// from the volumes holding them.
+func (volumes *Volumes) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, ErrInvalidRange
+	}
+
+	// The last volume starting at or before offset.
+	i := sort.Search(len(volumes.files), func(i int) bool {
+		return volumes.offsets[i+1] > offset
+	})
+	var read int
+	for ; read < len(p) && i < len(volumes.files); i++ {
+		n, err := volumes.files[i].ReadAt(p[read:], offset+int64(read)-volumes.offsets[i])
+		read += n
+		if err != nil && !errors.Is(err, io.EOF) {
+			return read, err
+		}
+	}
+
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// Close closes the volumes.
+func (volumes *Volumes) Close() error {
+	var errs []error
+	for _, file := range volumes.files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// NewReaderVolumes opens the container databasePath, split by
+// [SplitVolumes], for reading, reassembling its volumes as it's read,
+// as [NewReaderAt]. The volumes are closed by [RemoteReader.Close].
+func NewReaderVolumes(databasePath string, password []byte) (*RemoteReader, error) {
+	volumes, err := OpenVolumes(databasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewReaderAt(volumes, password)
+	if err != nil {
+		volumes.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// SetVolumeSize splits the container into volumes of size bytes once the
+// Writer is closed, as [SplitVolumes]. Zero disables splitting.
+func (writer *Writer) SetVolumeSize(size int64) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if size < 0 {
+		return ErrInvalidVolumeSize
+	}
+	if writer.path == "" {
+		return ErrVolumesUnsupported
+	}
+
+	writer.volumeSize = size
+	return nil
+}
@@ -0,0 +1,80 @@
+package arc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSplitVolumes(t *testing.T) {
+	path := testContainerPath(t)
+	files := map[string]string{"file": strings.Repeat("contents ", 10000)}
+	writeTestContainer(t, path, testPassword, Header{Encryption: true}, files)
+
+	volumes, err := SplitVolumes(path, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) < 2 {
+		t.Fatalf("got %d volumes", len(volumes))
+	}
+	_, err = os.Stat(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("container not removed: %v", err)
+	}
+
+	reader, err := NewReaderVolumes(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := reader.Files()
+	if err != nil {
+		reader.Close()
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		err = reader.Open(headers[name].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(reader)
+		if err != nil || string(got) != contents {
+			t.Errorf("%s: got %d bytes, %v", name, len(got), err)
+		}
+	}
+
+	err = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = JoinVolumes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, readTestContainer(t, path, testPassword), files)
+}
+
+func TestSplitVolumesUncheckpointed(t *testing.T) {
+	path := testContainerPath(t)
+	writeTestContainer(t, path, nil, Header{}, map[string]string{"file": "contents"})
+	err := os.WriteFile(path+"-wal", []byte("frames"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SplitVolumes(path, 1024)
+	if !errors.Is(err, ErrUncheckpointed) {
+		t.Fatalf("got %v, want %v", err, ErrUncheckpointed)
+	}
+	_, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("container removed: %v", err)
+	}
+	_, err = os.Stat(VolumeName(path, 1))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("volume written: %v", err)
+	}
+}
@@ -1,15 +1,21 @@
 package arc
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	_ "embed"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"sync/atomic"
 	"time"
 
-	"github.com/bernardo1r/encdec"
 	"github.com/klauspost/compress/zstd"
 )
 
@@ -25,21 +31,51 @@ const (
 
 	queryInsertEncryptedMetadata = `INSERT INTO encryption_metadata VALUES (?, ?)`
 
-	queryInsertData = `INSERT INTO data VALUES (?, ?, ?)`
+	queryInsertData = `INSERT INTO data(id, block_id, data) VALUES (?, ?, ?)`
 
-	queryInsertEncryptionKeyParams = `INSERT INTO encryption_key_params VALUES (?)`
+	queryInsertEncryptionKeyParams = `INSERT INTO encryption_key_params(params) VALUES (?)`
+
+	queryInsertContainerUUID = `INSERT INTO container VALUES (?)`
 
 	queryIdByName = `SELECT id FROM metadata WHERE name = ?`
 
 	queryUpdateFileSize = `UPDATE metadata SET size = ?, blocks = ? WHERE id = ?`
 
 	queryUpdateFilename = `UPDATE metadata SET name = ? WHERE id = ?`
+
+	querySavepoint = `SAVEPOINT file_blocks`
+
+	queryRollbackSavepoint = `ROLLBACK TO file_blocks`
+
+	queryReleaseSavepoint = `RELEASE file_blocks`
+
+	queryUpdateFileType = `UPDATE metadata SET type = ? WHERE id = ?`
+
+	queryUpdateChecksum = `UPDATE metadata SET checksum = ? WHERE id = ?`
+
+	queryUpdateStoredSize = `UPDATE metadata SET stored_size = ? WHERE id = ?`
+
+	queryUpdateAttributes = `UPDATE metadata SET mode = ?, uid = ?, gid = ? WHERE id = ?`
+
+	queryUpdateBlocksize = `UPDATE metadata SET blocksize = ? WHERE id = ?`
+
+	queryUpdateCompressionLevel = `UPDATE metadata SET compression_level = ? WHERE id = ?`
 )
 
 // DefaultBlocksize is the default size, in bytes, of a file chunk
 // within the container.
 const DefaultBlocksize = 8 * (1 << 10) // 8 KiB
 
+const (
+	// MinBlocksize is the smallest size, in bytes, of a file chunk, below
+	// which the per block overhead, of the row, nonce and tag, dominates.
+	MinBlocksize = 512
+
+	// MaxBlocksize is the largest size, in bytes, of a file chunk, as
+	// each block is held in memory whole, while written and read.
+	MaxBlocksize = 64 * (1 << 20) // 64 MiB
+)
+
 const encryptionKeysize = 32
 
 //go:embed ddl.sql
@@ -51,6 +87,9 @@ var (
 	// ErrWriterClosed is returned when Writer is used after closed.
 	ErrWriterClosed = errors.New("writer closed")
 
+	// ErrReaderClosed is returned when Reader is used after closed.
+	ErrReaderClosed = errors.New("reader closed")
+
 	// ErrEmptyPassword is returned when a file have encryption enabled, but
 	// no password was provided.
 	ErrEmptyPassword = errors.New("encrypted marked file with no password provided")
@@ -71,8 +110,35 @@ var (
 	ErrWrongPassword = errors.New("wrong password")
 
 	ErrPadding = errors.New("corrupted filename pad")
+
+	// ErrConvergentStream is returned when a file marked as convergent is
+	// written with [Writer.WriteHeader], as its contents are not known beforehand.
+	ErrConvergentStream = errors.New("convergent encryption requires the whole file")
+
+	// ErrInvalidBlocksize is returned when a blocksize is negative, or
+	// outside of the range between [MinBlocksize] and [MaxBlocksize].
+	ErrInvalidBlocksize = errors.New("invalid blocksize")
+)
+
+// FileType is the type of an entry of the container.
+type FileType int
+
+const (
+	// TypeFile is a regular file.
+	TypeFile FileType = iota
+
+	// TypeDir is a directory, with no data of its own. The files
+	// within it are named with its name as a prefix.
+	TypeDir
+
+	// TypeSymlink is a symbolic link, whose data is its target.
+	// It requires [FeatureAttributes].
+	TypeSymlink
 )
 
+// storedModeBits are the bits of [Header.Mode] stored in the container.
+const storedModeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
 // Header represents a file in the arc file.
 type Header struct {
 	// Id of the file in the container.
@@ -84,28 +150,139 @@ type Header struct {
 	// Name of the file.
 	Name string
 
+	// Type of the file. Directories and symbolic links are only written
+	// by [Writer.WriteDir] and [Writer.WriteSymlink], or [Writer.WriteHeader].
+	Type FileType
+
 	// Size, in bytes, of the file, outside the container.
 	//
 	// As the [Header.Id] field, this field is too ignored
 	// by the [Writer].
-	Size int
+	Size int64
+
+	// StoredSize is the size, in bytes, of the data blocks of the file, after
+	// compression and encryption, so Size over StoredSize is its compression
+	// ratio. Holes aren't stored, while deduplicated blocks are counted in
+	// full by every file sharing them. It's zero when not recorded, in
+	// containers without [FeatureStoredSizes].
+	//
+	// As the [Header.Id] field, this field is ignored by the [Writer].
+	StoredSize int64
+
+	// LinkId is the id of the file this file is a hard link to, sharing its
+	// data, or zero for files with data of their own. Hard links are
+	// written by [Writer.WriteHardlink].
+	//
+	// As the [Header.Id] field, this field is ignored by the [Writer].
+	LinkId int
 
 	// ModTime is the last time the file was modified,
-	// in UTC location.
+	// in UTC location. It's truncated to seconds, but in
+	// containers with [FeatureTimestamps].
 	ModTime time.Time
 
+	// AccessTime, ChangeTime and BirthTime are the last time the file was
+	// accessed, the last time its metadata changed and the time it was
+	// created, or the zero time when unknown. They're only recorded in
+	// containers with [FeatureTimestamps], in nanoseconds, and not for
+	// files whose metadata is encrypted. The access time is restored along
+	// the modification time, while the others can't be set, so they're
+	// only kept for reference.
+	AccessTime time.Time
+	ChangeTime time.Time
+	BirthTime  time.Time
+
 	// Compression indicates what level of compression
 	// is applied to the file.
 	//
 	// The default value (0) indicates that no compression
 	// is applied.
 	//
-	// When reading the file this field must only be checked
-	// against the zero value (0).
+	// When reading the file, it's the level the file was written with, so
+	// it's written again alike, in containers with [FeatureCompressionLevels].
+	// Other containers only record whether files are compressed, and this
+	// field must only be checked against the zero value (0).
 	Compression zstd.EncoderLevel
 
+	// Codec is the name of the codec compressing the file, registered by
+	// [RegisterCodec]. The empty value selects [CodecZstd], the only codec
+	// available in containers without [FeatureCodecs].
+	Codec string
+
 	// Encryption indicates if file is encrypted or not.
 	Encryption bool
+
+	// Convergent indicates, for encrypted files, that the file key is derived
+	// from the file contents and the container key, instead of being random.
+	// Files with identical contents are then encrypted to identical blocks,
+	// allowing them to be deduplicated.
+	//
+	// As a tradeoff, anyone able to read the container learns which files are
+	// equal, and anyone holding the container key can confirm a guess of the
+	// contents of a file by encrypting the guess (confirmation attack).
+	// It must not be used for files with low-entropy secrets.
+	//
+	// Only [Writer.WriteFile] honors it, as the contents must be hashed
+	// before being written. As files with equal contents share their key,
+	// their names must be encrypted with random nonces, so it requires
+	// [FeatureNameIndex], whose containers encrypt names so.
+	Convergent bool
+
+	// ContentClass selects the compression dictionary of compressed files,
+	// added by [Writer.AddDictionary]. When empty, [Writer.WriteFile] detects
+	// it from the file contents, leaving it empty, so a header reused for
+	// the next file has its class detected again.
+	ContentClass ContentClass
+
+	// Checksum is the SHA-256 hash of the contents of unencrypted files,
+	// nil when not stored. Encrypted files are already authenticated,
+	// and storing the hash of their contents would allow to confirm
+	// a guess of them.
+	//
+	// As the [Header.Id] field, this field is ignored by the [Writer].
+	Checksum []byte
+
+	// Mode holds the permission bits of the file, along with the setuid,
+	// setgid and sticky bits. The zero value indicates they are not stored,
+	// and the other bits are ignored.
+	//
+	// As Uid and Gid, it's only stored in containers with [FeatureAttributes].
+	Mode fs.FileMode
+
+	// Uid and Gid are the owner user and group ids of the
+	// file, nil when not stored.
+	Uid *int
+	Gid *int
+
+	// Blocksize is the size, in bytes, of the blocks the file is split
+	// into within the container. When zero, the blocksize of the [Writer]
+	// is used, so large files can use larger blocks than the rest. Else
+	// it's between [MinBlocksize] and [MaxBlocksize], or writing the file
+	// fails with [ErrInvalidBlocksize]. It's only recorded in containers
+	// with [FeatureBlocksizes].
+	Blocksize int
+
+	// Conflict selects what writing the file does when its name is
+	// already in the container. Encrypted names are only compared when
+	// encrypted with the container key, or written by the same [Writer].
+	Conflict ConflictPolicy
+
+	// Password, when not nil, encrypts the file with a key derived from it,
+	// instead of the container key, so containers can be shared by users
+	// holding different passwords. The file is then read only after
+	// [Reader.AddFilePassword] is given the password. It requires
+	// [FeatureFilePasswords], and is never stored nor set by the [Reader].
+	// The [Writer] keeps the key derived from it, zeroed once closed, but
+	// neither the password nor the Header, which may be zeroed once the
+	// file is written.
+	Password []byte
+
+	// Attrs are key/value attributes attached to the file by applications,
+	// such as tags, MIME types or original URLs, nil when it has none.
+	// They are stored in the clear, even for encrypted files, and are read
+	// by [Reader.Files], [Reader.Stat] and [Reader.Attrs]. They require
+	// [FeatureUserAttrs].
+	Attrs map[string]string
 }
 
 func (header *Header) check() error {
@@ -122,52 +299,153 @@ func (header *Header) check() error {
 // Writer implements a arc container writer. [Writer.WriteHeader] initiates
 // a new file with the providaded [Header], and then the Writer can be
 // used as an io.Writer.
+//
+// A Writer isn't safe for concurrent use: its methods fail with
+// [ErrConcurrentUse] while another call is in progress. Files are
+// written concurrently by a [ParallelWriter].
 type Writer struct {
 	blocksize      int
+	kdf            KDFParams
 	encryptionKey  []byte
 	db             *sql.DB
 	currWriters    []io.WriteCloser
-	currBytesRead  int
+	currBytesRead  int64
 	currDataWriter *dataWriter
+	currHash       hash.Hash
+	currReplaced   replacedFile
+	dictionaries   map[ContentClass]dictionary
+	filePasswords  map[[sha256.Size]byte]filePasswordKey
+	names          map[string]int
+	dedup          bool
+	sparse         bool
+	probe          bool
+	segmentSize    int
+	zstdOptions    *ZstdOptions
+	sealMetadata   bool
+	currSeal       *metadataSeal
+	suite          CipherSuite
+	keys           KeyProvider
+	path           string
+	volumeSize     int64
+	commitEvery    int
+	batch          *batch
+	base           *baseLayer
+	progress       ProgressFunc
+	metrics        Metrics
+	capabilities   Capabilities
 	err            error
+
+	// busy is set while a method is in progress, or while
+	// the Writer is used by a [ParallelWriter].
+	busy atomic.Bool
 }
 
-func prepareDB(databasePath string) (*sql.DB, error) {
+func prepareDB(databasePath string, pragmas *Pragmas) (*sql.DB, error) {
 	err := os.Remove(databasePath)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", "file:"+databasePath+databaseArgs)
+	return createDB("file:"+databasePath+databaseArgs, pragmas)
+}
+
+// createDB opens the database dataSourceName, with pragmas,
+// creating the tables of a new container.
+func createDB(dataSourceName string, pragmas *Pragmas) (*sql.DB, error) {
+	db, err := openDB(dataSourceName, pragmas)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = db.Exec(string(queryDDL))
-	return db, err
+	return db, initDB(db)
 }
 
-func (writer *Writer) createEncryptionKey(password []byte) error {
-	var params encdec.Params
-	writer.encryptionKey, writer.err = encdec.Key(password, &params)
-	if writer.err != nil {
-		return writer.err
+// initDB creates the tables of a new container in the empty database db.
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(string(queryDDL))
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(queryInsertFormatVersion, FormatVersion)
+	if err != nil {
+		return err
 	}
 
+	return insertUUID(db)
+}
+
+func (writer *Writer) createEncryptionKey(password []byte) error {
 	var paramsString []byte
-	paramsString, writer.err = params.MarshalHeader()
+	writer.encryptionKey, paramsString, writer.err = deriveKey(password, writer.kdf)
 	if writer.err != nil {
 		return writer.err
 	}
 	_, writer.err = writer.db.Exec(queryInsertEncryptionKeyParams, paramsString)
+	if writer.err != nil {
+		return writer.err
+	}
+	writer.err = storeKeyCheck(writer.db, writer.capabilities, writer.encryptionKey)
 	return writer.err
 }
 
 // NewWriter creates a new Writer and a container file with name databasePath.
+// The blocksize, when zero, is [DefaultBlocksize], and else it's between
+// [MinBlocksize] and [MaxBlocksize], or [ErrInvalidBlocksize] is returned.
 func NewWriter(databasePath string, blocksize int, password []byte) (*Writer, error) {
+	return newFileWriter(databasePath, blocksize, password, nil, KDFParams{})
+}
+
+// NewWriterDB creates a new Writer and a container in the empty database
+// db, opened by the caller, so containers are written with drivers,
+// connection hooks or pragmas of their choosing, or to databases shared
+// with the rest of the application. The connections of db must enable
+// the foreign keys, as by the "_foreign_keys=on" parameter of
+// [DefaultDriver], or the "_pragma=foreign_keys(1)" one of
+// [ModerncDriver]. The Writer takes db over, closing it once closed, and
+// as it has no file, its volumes can't be split (see
+// [Writer.SetVolumeSize]). The blocksize is checked as by [NewWriter].
+func NewWriterDB(db *sql.DB, blocksize int, password []byte) (*Writer, error) {
+	err := initDB(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return newWriter(db, blocksize, password, KDFParams{})
+}
+
+// newFileWriter creates a new Writer and a container file with name
+// databasePath, opened with pragmas, deriving keys with kdf.
+func newFileWriter(databasePath string, blocksize int, password []byte, pragmas *Pragmas, kdf KDFParams) (*Writer, error) {
+	blocksize, err := checkBlocksize(blocksize)
+	if err != nil {
+		return nil, err
+	}
+	db, err := prepareDB(databasePath, pragmas)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := newWriter(db, blocksize, password, kdf)
+	if writer != nil {
+		writer.path = databasePath
+	}
+	return writer, err
+}
+
+// newWriter creates a new Writer for the new container opened in db,
+// deriving keys with kdf.
+func newWriter(db *sql.DB, blocksize int, password []byte, kdf KDFParams) (*Writer, error) {
+	blocksize, err := checkBlocksize(blocksize)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	writer := new(Writer)
 	writer.blocksize = blocksize
-	writer.db, writer.err = prepareDB(databasePath)
+	writer.kdf = kdf
+	writer.db = db
+	writer.capabilities, writer.err = detectCapabilities(writer.db)
 	if writer.err != nil {
 		return nil, writer.err
 	}
@@ -176,10 +454,71 @@ func NewWriter(databasePath string, blocksize int, password []byte) (*Writer, er
 		return writer, nil
 	}
 
-	err := writer.createEncryptionKey(password)
+	err = writer.createEncryptionKey(password)
+	return writer, err
+}
+
+// checkBlocksize returns blocksize, or [DefaultBlocksize] when zero,
+// or [ErrInvalidBlocksize] when it's not a valid blocksize.
+func checkBlocksize(blocksize int) (int, error) {
+	if blocksize == 0 {
+		return DefaultBlocksize, nil
+	}
+	if blocksize < MinBlocksize || blocksize > MaxBlocksize {
+		return 0, fmt.Errorf("%w %d, expected between %d and %d",
+			ErrInvalidBlocksize, blocksize, MinBlocksize, MaxBlocksize)
+	}
+	return blocksize, nil
+}
+
+// NewWriterConfig creates a new Writer and a container file with name databasePath,
+// using the blocksize, password, key derivation params, cipher suite, pragmas,
+// volume size and files per commit from config.
+func NewWriterConfig(databasePath string, config *Config) (*Writer, error) {
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := newFileWriter(databasePath, config.Blocksize, config.Password, config.pragmas(), config.KDF)
+	if err != nil {
+		return nil, err
+	}
+	if config.Encryption {
+		err = writer.SetCipherSuite(config.CipherSuite)
+	}
+	if err == nil {
+		err = writer.applyLimits(config)
+	}
 	return writer, err
 }
 
+// applyLimits sets the volume size and files per commit of config.
+func (writer *Writer) applyLimits(config *Config) error {
+	if config.VolumeSize > 0 {
+		err := writer.SetVolumeSize(config.VolumeSize)
+		if err != nil {
+			return err
+		}
+	}
+	if config.CommitEvery > 0 {
+		return writer.SetCommitEvery(config.CommitEvery)
+	}
+	return nil
+}
+
+// NewWriterOptions creates a new Writer and a container file with name
+// databasePath, configured by options, as [NewWriterConfig] with the
+// [Config] created by [NewConfig], so new options don't change the
+// signature.
+func NewWriterOptions(databasePath string, options ...Option) (*Writer, error) {
+	config, err := NewConfig(options...)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterConfig(databasePath, config)
+}
+
 func (writer *Writer) flush() error {
 	if writer.currWriters == nil {
 		return nil
@@ -192,127 +531,557 @@ func (writer *Writer) flush() error {
 		}
 	}
 
-	_, writer.err = writer.db.Exec(
+	db := writer.fileQuerier(context.Background())
+	_, writer.err = db.Exec(
 		queryUpdateFileSize,
 		writer.currBytesRead,
 		writer.currDataWriter.currBlock,
 		writer.currDataWriter.id,
 	)
+	if writer.err == nil {
+		writer.err = storeStoredSize(db, writer.capabilities, writer.currDataWriter.id, writer.currDataWriter.stored)
+	}
+	if writer.err == nil {
+		writer.err = storeHoles(db, writer.currDataWriter.id, writer.currWriters)
+	}
+	if writer.err == nil {
+		writer.err = storeSegments(db, writer.currDataWriter.id, writer.currWriters)
+	}
+	if writer.err == nil {
+		writer.err = storeSealedMetadata(db, writer.currDataWriter.id, writer.currSeal, writer.currBytesRead)
+	}
+	if writer.err == nil && writer.currHash != nil {
+		_, writer.err = db.Exec(queryUpdateChecksum, writer.currHash.Sum(nil), writer.currDataWriter.id)
+	}
+	if writer.err == nil {
+		writer.err = writer.completeFile(db, writer.currDataWriter.id, writer.currReplaced)
+	}
+	if writer.err == nil {
+		writer.err = writer.batchFileDone()
+	}
 
 	writer.currWriters = nil
 	writer.currDataWriter = nil
+	writer.currHash = nil
+	writer.currSeal = nil
+	writer.currReplaced = replacedFile{}
 	return writer.err
 }
 
-func (writer *Writer) prepareFileEncryption(header *Header) (fileDataKey []byte, err error) {
-	if writer.encryptionKey == nil {
-		return nil, ErrEmptyPassword
+// storeStoredSize records stored as the stored size of the file id,
+// if the container supports [FeatureStoredSizes].
+func storeStoredSize(db execQuerier, capabilities Capabilities, id int, stored int64) error {
+	if !capabilities.Has(FeatureStoredSizes) {
+		return nil
+	}
+
+	_, err := db.Exec(queryUpdateStoredSize, stored, id)
+	return err
+}
+
+// hashWriter hashes the contents of the file being written,
+// before passing them to the next writer.
+type hashWriter struct {
+	hash hash.Hash
+	next io.Writer
+}
+
+func (writer hashWriter) Write(p []byte) (int, error) {
+	writer.hash.Write(p)
+	return writer.next.Write(p)
+}
+
+func (hashWriter) Close() error {
+	return nil
+}
+
+// execQuerier runs queries on a database, or within a transaction.
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func (writer *Writer) prepareFileEncryption(db execQuerier, header *Header, contentHash []byte) (fileDataKey []byte, filenameKey []byte, err error) {
+	masterKey := writer.encryptionKey
+	var passwordKey filePasswordKey
+	if header.Password != nil {
+		passwordKey, writer.err = writer.filePasswordKey(header.Password)
+		if writer.err != nil {
+			return nil, nil, writer.err
+		}
+		masterKey = passwordKey.key
+	}
+	if masterKey == nil {
+		return nil, nil, ErrEmptyPassword
 	}
 
 	var encryptedKey, fileMasterKey []byte
-	encryptedKey, fileMasterKey, writer.err = generateFileMasterKey(writer.encryptionKey, header.Id)
-	_, writer.err = writer.db.Exec(queryInsertEncryptedMetadata, header.Id, encryptedKey)
+	switch {
+	case writer.keys != nil && header.Password == nil:
+		encryptedKey, fileMasterKey, writer.err = writer.wrapFileKey(header.Id, contentHash)
+	case contentHash != nil:
+		fileMasterKey = convergentFileMasterKey(masterKey, contentHash)
+		encryptedKey, writer.err = sealFileMasterKey(masterKey, header.Id, fileMasterKey)
+	default:
+		encryptedKey, fileMasterKey, writer.err = generateFileMasterKey(masterKey, header.Id)
+	}
 	if writer.err != nil {
-		return nil, writer.err
+		return nil, nil, writer.err
+	}
+	_, writer.err = db.Exec(queryInsertEncryptedMetadata, header.Id, encryptedKey)
+	if writer.err != nil {
+		return nil, nil, writer.err
+	}
+	if header.Password != nil {
+		_, writer.err = db.Exec(queryInsertFileKeyParams, header.Id, passwordKey.params)
+		if writer.err != nil {
+			return nil, nil, writer.err
+		}
 	}
 
-	var filenameKey []byte
 	filenameKey, fileDataKey = stretchKey(fileMasterKey)
 	var encryptedFilename string
-	encryptedFilename, writer.err = encryptFilename(header.Name, filenameKey)
+	encryptedFilename, writer.err = encryptFilename(header.Name, filenameKey, writer.capabilities.Has(FeatureNameIndex))
 	if writer.err != nil {
-		return nil, writer.err
+		return nil, nil, writer.err
+	}
+	_, writer.err = db.Exec(queryUpdateFilename, encryptedFilename, header.Id)
+	if writer.err != nil {
+		return nil, nil, writer.err
+	}
+	if header.Password == nil && writer.keys == nil {
+		indexKey := nameIndexKey(writer.capabilities, writer.encryptionKey)
+		writer.err = storeNameMAC(db, indexKey, header.Id, header.Name)
 	}
-	_, writer.err = writer.db.Exec(queryUpdateFilename, encryptedFilename, header.Id)
 
-	return fileDataKey, writer.err
+	return fileDataKey, filenameKey, writer.err
 }
 
 // WriteHeader prepares the Writer for writing the file described by header.
+// The data blocks of the file are inserted within a transaction, if
+// transaction, or else within a savepoint of their own connection, released
+// once the file is complete, so either way a file whose writing fails, or is
+// interrupted, leaves none of its blocks behind.
 func (writer *Writer) WriteHeader(header *Header, transaction bool) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
 	if writer.err != nil {
 		return writer.err
 	}
+	if header.Convergent && header.Encryption {
+		return ErrConvergentStream
+	}
+
+	return writer.writeHeader(context.Background(), header, transaction, nil)
+}
+
+// insertedFile is the outcome of inserting the metadata of a file.
+type insertedFile struct {
+	// dataKey is the data key of encrypted files.
+	dataKey []byte
 
+	// dict is the dictionary of compressed files with one
+	// for their content class.
+	dict *dictionary
+
+	// replaced is the file to be deleted once the file is written.
+	replaced replacedFile
+
+	// seal is the metadata of encrypted files to be sealed
+	// once written, when sealing metadata.
+	seal *metadataSeal
+}
+
+// insertHeader inserts the metadata of the file described by header in db,
+// setting its id, after applying its conflict policy. contentHash is the
+// hash of the file contents, used for convergent encryption.
+func (writer *Writer) insertHeader(db execQuerier, header *Header, contentHash []byte) (file insertedFile, err error) {
 	writer.err = header.check()
 	if writer.err != nil {
-		return writer.err
+		return file, writer.err
 	}
-	if writer.flush() != nil {
-		return writer.err
+	if header.Type == TypeSymlink && !writer.capabilities.Has(FeatureAttributes) {
+		return file, FeatureAttributes.missingError()
+	}
+	if header.Encryption && header.Password != nil && !writer.capabilities.Has(FeatureFilePasswords) {
+		return file, FeatureFilePasswords.missingError()
+	}
+	if header.Encryption && contentHash != nil && !writer.capabilities.Has(FeatureNameIndex) {
+		return file, FeatureNameIndex.missingError()
+	}
+	if header.Type != TypeFile {
+		header.Compression = 0
+	}
+	if header.Compression != 0 && !isZstd(header.Codec) {
+		if !writer.capabilities.Has(FeatureCodecs) {
+			return file, FeatureCodecs.missingError()
+		}
+		_, err = fileCodec(header.Codec, nil)
+		if err != nil {
+			return file, err
+		}
+	}
+	if header.Blocksize == 0 {
+		header.Blocksize = writer.blocksize
+	} else if _, err = checkBlocksize(header.Blocksize); err != nil {
+		return file, err
+	}
+	if writer.base != nil {
+		writer.base.see(header.Name)
+	}
+
+	file.replaced, err = writer.resolveConflict(db, header)
+	if err != nil {
+		return file, err
 	}
+	defer func() {
+		if err != nil {
+			restoreReplaced(db, file.replaced)
+		}
+	}()
 
-	_, writer.err = writer.db.Exec(
+	sealing := writer.sealMetadata && header.Encryption
+	modTime := header.ModTime.Unix()
+	if sealing {
+		modTime = 0
+	}
+	_, writer.err = db.Exec(
 		queryInsertMetadata,
 		header.Name,
 		0,
 		0,
-		header.ModTime.Unix(),
+		modTime,
 		header.Compression != 0,
 		header.Encryption,
 	)
 	if writer.err != nil {
-		return writer.err
+		return file, writer.err
 	}
 
-	var id int
-	writer.err = writer.db.QueryRow(queryIdByName, header.Name).Scan(&id)
+	writer.err = db.QueryRow(queryIdByName, header.Name).Scan(&header.Id)
 	if writer.err != nil {
-		return writer.err
+		return file, writer.err
 	}
-	header.Id = id
 
-	var dataWriter *dataWriter
-	dataWriter, writer.err = newDataWriter(writer.db, id, writer.blocksize, transaction)
+	writer.err = writer.markPending(db, header.Id, file.replaced)
 	if writer.err != nil {
-		return writer.err
+		return file, writer.err
 	}
-	writer.currWriters = append(writer.currWriters, dataWriter)
-	currWriterId := 0
-	writer.currDataWriter = dataWriter
 
-	var currWriter io.WriteCloser
-	if header.Encryption {
-		key, err := writer.prepareFileEncryption(header)
-		if err != nil {
-			return err
+	writer.err = writer.insertAttrs(db, header)
+	if writer.err != nil {
+		return file, writer.err
+	}
+
+	if header.Type != TypeFile {
+		_, writer.err = db.Exec(queryUpdateFileType, header.Type, header.Id)
+		if writer.err != nil {
+			return file, writer.err
 		}
+	}
 
-		var params encdec.Params
-		currWriter, writer.err = encdec.NewWriter(key, writer.currWriters[currWriterId], &params)
+	if writer.capabilities.Has(FeatureBlocksizes) {
+		_, writer.err = db.Exec(queryUpdateBlocksize, header.Blocksize, header.Id)
 		if writer.err != nil {
-			return writer.err
+			return file, writer.err
+		}
+	}
+
+	if header.Compression != 0 && writer.capabilities.Has(FeatureCompressionLevels) {
+		_, writer.err = db.Exec(queryUpdateCompressionLevel, header.Compression, header.Id)
+		if writer.err != nil {
+			return file, writer.err
 		}
-		writer.currWriters = append(writer.currWriters, currWriter)
-		currWriterId++
+	}
+
+	if header.Compression != 0 && !isZstd(header.Codec) {
+		_, writer.err = db.Exec(queryUpdateCodec, header.Codec, header.Id)
+		if writer.err != nil {
+			return file, writer.err
+		}
+	}
+
+	if !sealing && writer.capabilities.Has(FeatureAttributes) && (header.Mode&storedModeBits != 0 || header.Uid != nil || header.Gid != nil) {
+		var mode *uint32
+		if header.Mode&storedModeBits != 0 {
+			bits := uint32(header.Mode & storedModeBits)
+			mode = &bits
+		}
+		_, writer.err = db.Exec(queryUpdateAttributes, mode, header.Uid, header.Gid, header.Id)
+		if writer.err != nil {
+			return file, writer.err
+		}
+	}
+
+	if !sealing && writer.capabilities.Has(FeatureTimestamps) {
+		writer.err = storeTimestamps(db, header)
+		if writer.err != nil {
+			return file, writer.err
+		}
+	}
+
+	if header.Encryption {
+		var filenameKey []byte
+		file.dataKey, filenameKey, writer.err = writer.prepareFileEncryption(db, header, contentHash)
+		if writer.err != nil {
+			return file, writer.err
+		}
+		if sealing {
+			file.seal = newMetadataSeal(header, filenameKey)
+		} else {
+			wipe(filenameKey)
+		}
+		writer.names[header.Name] = header.Id
+	}
+
+	if header.Compression != 0 && isZstd(header.Codec) {
+		classDict, ok := writer.dictionaries[header.ContentClass]
+		if !ok {
+			classDict, ok = writer.dictionaries[ContentAny]
+		}
+		if ok {
+			_, writer.err = db.Exec(queryUpdateDictionaryId, classDict.id, header.Id)
+			if writer.err != nil {
+				return file, writer.err
+			}
+			file.dict = &classDict
+		}
+	}
+
+	return file, nil
+}
+
+// fileWriters returns the chain of writers hashing, compressing and
+// encrypting the contents of the file described by header, before writing
+// them to dst. The contents are written to the last writer, and the
+// writers must be closed backwards. The returned hash, if not nil, hashes
+// the contents. The stages are timed for the metrics of the Writer, if set.
+func (writer *Writer) fileWriters(dst io.WriteCloser, header *Header, fileDataKey []byte, dict *dictionary) ([]io.WriteCloser, hash.Hash, error) {
+	meter := stageMeter{metrics: writer.metrics}
+	writers := []io.WriteCloser{meter.writer(dst, stageStorage)}
+	if fileDataKey != nil {
+		encrypter, err := newEncrypter(writer.suite, fileDataKey, writers[len(writers)-1])
+		if err != nil {
+			return nil, nil, err
+		}
+		writers = append(writers, meter.writer(encrypter, stageEncryption))
 	}
 
 	if header.Compression != 0 {
-		currWriter, writer.err = zstd.NewWriter(
-			writer.currWriters[currWriterId],
-			zstd.WithEncoderLevel(header.Compression),
-		)
+		codec, err := writer.fileCodec(header.Codec, dict)
+		if err != nil {
+			return nil, nil, err
+		}
+		if writer.segmentSize > 0 {
+			segments := newSegmentWriter(writers[len(writers)-1], codec, header.Compression, writer.segmentSize)
+			writers = append(writers, meter.writer(segments, stageCompression))
+		} else {
+			encoder, err := codec.NewWriter(writers[len(writers)-1], header.Compression)
+			if err != nil {
+				return nil, nil, err
+			}
+			writers = append(writers, meter.writer(encoder, stageCompression))
+		}
+	}
+
+	if writer.sparse {
+		writers = append(writers, newHoleWriter(writers[len(writers)-1], header.Blocksize))
+	}
+
+	var contentHash hash.Hash
+	if !header.Encryption && writer.capabilities.Has(FeatureChecksums) {
+		contentHash = sha256.New()
+		writers = append(writers, hashWriter{
+			hash: contentHash,
+			next: writers[len(writers)-1],
+		})
+	}
+	if counter := meter.contents(writers[len(writers)-1]); counter != nil {
+		writers = append(writers, counter)
+	}
+
+	return writers, contentHash, nil
+}
+
+// writeHeader prepares the Writer for writing the file described by header,
+// running its queries with ctx. contentHash is the hash of the file contents,
+// used for convergent encryption.
+func (writer *Writer) writeHeader(ctx context.Context, header *Header, transaction bool, contentHash []byte) error {
+	return writer.writeEntry(ctx, header, transaction, contentHash, 0)
+}
+
+// writeEntry is like writeHeader, writing the file as a hard link to
+// the file link, with no data of its own, unless zero.
+func (writer *Writer) writeEntry(ctx context.Context, header *Header, transaction bool, contentHash []byte, link int) error {
+	if writer.flush() != nil {
+		return writer.err
+	}
+
+	writer.err = writer.beginBatch()
+	if writer.err != nil {
+		return writer.err
+	}
+	db := writer.fileQuerier(ctx)
+	file, err := writer.insertHeader(db, header, contentHash)
+	if err != nil {
+		return err
+	}
+	if header.Type == TypeDir || link != 0 {
+		wipe(file.dataKey)
+		var size int64
+		if link != 0 {
+			size, writer.err = insertLink(db, header.Id, link)
+		}
+		if writer.err == nil {
+			writer.err = storeSealedMetadata(db, header.Id, file.seal, size)
+		}
+		if writer.err == nil {
+			writer.err = writer.completeFile(db, header.Id, file.replaced)
+		}
+		if writer.err == nil {
+			writer.err = writer.batchFileDone()
+		}
+		return writer.err
+	}
+
+	var dataWriter *dataWriter
+	if writer.batch != nil {
+		dataWriter = newBatchDataWriter(ctx, writer.db, writer.batch, header.Id, header.Blocksize, writer.capabilities)
+	} else {
+		dataWriter, writer.err = newDataWriter(ctx, writer.db, header.Id, header.Blocksize, transaction, writer.capabilities)
 		if writer.err != nil {
 			return writer.err
 		}
-		writer.currWriters = append(writer.currWriters, currWriter)
-		currWriterId++
 	}
+	dataWriter.dedup = writer.dedup
+	dataWriter.metrics = writer.metrics
+	writer.currDataWriter = dataWriter
+	writer.currReplaced = file.replaced
+	writer.currSeal = file.seal
 
-	return writer.err
+	writer.currWriters, writer.currHash, writer.err = writer.fileWriters(dataWriter, header, file.dataKey, file.dict)
+	wipe(file.dataKey)
+	if writer.err != nil {
+		dataWriter.cleanup()
+		writer.currDataWriter = nil
+		return writer.err
+	}
+
+	return nil
 }
 
-// WriteFile looks for a filepath file and add to container accordingly to header.
-// The file is added all in one transaction.
-func (writer *Writer) WriteFile(header *Header, filepath string) (err error) {
+// WriteDir adds the directory described by header to the container.
+func (writer *Writer) WriteDir(header *Header) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
 	if writer.err != nil {
 		return writer.err
 	}
 
-	if writer.WriteHeader(header, true) != nil {
+	header.Type = TypeDir
+	err := writer.writeHeader(context.Background(), header, false, nil)
+	return fileError("write", header.Name, header.Id, err)
+}
+
+// WriteSymlink adds the symbolic link described by header, pointing
+// to linkTarget, to the container. The container must support
+// [FeatureAttributes].
+func (writer *Writer) WriteSymlink(header *Header, linkTarget string) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+
+	header.Type = TypeSymlink
+	header.Convergent = false
+	err := writer.writeHeader(context.Background(), header, true, nil)
+	if err == nil {
+		_, err = writer.write([]byte(linkTarget))
+	}
+	if err == nil {
+		err = writer.flush()
+	}
+	return fileError("write", header.Name, header.Id, err)
+}
+
+// hashContent hashes the contents of file, rewinding it afterwards.
+func hashContent(file *os.File) ([]byte, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	return hash.Sum(nil), err
+}
+
+// restoreContentClass restores the content class of header, set by the
+// caller, once the file is written, as the class detected from its
+// contents is that file's own.
+func restoreContentClass(header *Header, class ContentClass) {
+	header.ContentClass = class
+}
+
+// inspectFile reads file, before it's written, returning the hash of its
+// contents for convergent encryption, detecting whether it's incompressible,
+// and its content class for selecting its compression dictionary, as set
+// by header.
+func (writer *Writer) inspectFile(header *Header, file *os.File) (contentHash []byte, err error) {
+	if header.Convergent && header.Encryption {
+		contentHash, err = hashContent(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writer.probeFile(header, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Compression != 0 && header.ContentClass == "" && writer.dictionaries != nil {
+		header.ContentClass, err = detectFileClass(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return contentHash, nil
+}
+
+// WriteFile looks for a filepath file and add to container accordingly to header.
+// The file is added all in one transaction.
+func (writer *Writer) WriteFile(header *Header, filepath string) error {
+	return writer.WriteFileContext(context.Background(), header, filepath)
+}
+
+// WriteFileContext is like [Writer.WriteFile], but the insertion is canceled
+// when ctx is done. The file is then discarded, rolling back its transaction,
+// and the error of ctx is returned, leaving the Writer usable.
+func (writer *Writer) WriteFileContext(ctx context.Context, header *Header, filepath string) (err error) {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
 		return writer.err
 	}
 
+	defer restoreContentClass(header, header.ContentClass)
+
 	var file *os.File
 	file, writer.err = os.Open(filepath)
 	if writer.err != nil {
@@ -326,9 +1095,96 @@ func (writer *Writer) WriteFile(header *Header, filepath string) (err error) {
 		}
 	}()
 
+	var contentHash []byte
+	contentHash, writer.err = writer.inspectFile(header, file)
+	if writer.err != nil {
+		return writer.err
+	}
+
+	return writer.writeFrom(ctx, header, file, sizeHint(file), contentHash)
+}
+
+// WriteFrom adds the file described by header to the container, with the
+// contents read from src until EOF, e.g. a network body or a pipe. The
+// file is added all in one transaction. The size reported to the
+// [ProgressFunc] is taken from src when it has a Len or Stat method, as
+// [bytes.Reader] and [os.File], and is -1 otherwise.
+//
+// As the contents aren't known beforehand, [ErrConvergentStream] is
+// returned for convergent encrypted files, and the content class of
+// compressed files is detected from the start of the contents.
+func (writer *Writer) WriteFrom(header *Header, src io.Reader) error {
+	return writer.WriteFromContext(context.Background(), header, src)
+}
+
+// WriteFromContext is like [Writer.WriteFrom], but the insertion is
+// canceled when ctx is done, as by [Writer.WriteFileContext].
+func (writer *Writer) WriteFromContext(ctx context.Context, header *Header, src io.Reader) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	if header.Convergent && header.Encryption {
+		return ErrConvergentStream
+	}
+	defer restoreContentClass(header, header.ContentClass)
+
+	total := sizeHint(src)
+	sniffSize := 0
+	if header.Compression != 0 && header.ContentClass == "" && writer.dictionaries != nil {
+		sniffSize = contentSniffSize
+	}
+	if header.Compression != 0 && writer.probe {
+		sniffSize = probeSize
+	}
+	if sniffSize > 0 {
+		buffered := bufio.NewReaderSize(src, sniffSize)
+		sample, err := buffered.Peek(sniffSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			writer.err = err
+			return writer.err
+		}
+		writer.err = writer.probeCompression(header, sample)
+		if writer.err != nil {
+			return writer.err
+		}
+		if header.Compression != 0 && header.ContentClass == "" && writer.dictionaries != nil {
+			header.ContentClass = DetectContentClass(sample[:min(len(sample), contentSniffSize)])
+		}
+		src = buffered
+	}
+
+	return writer.writeFrom(ctx, header, src, total, nil)
+}
+
+// writeFrom writes the file described by header, with the contents of src,
+// whose size is total, or -1 if unknown, in one transaction, which is
+// canceled once ctx is done. contentHash is the hash of the contents,
+// used for convergent encryption.
+func (writer *Writer) writeFrom(ctx context.Context, header *Header, src io.Reader, total int64, contentHash []byte) (err error) {
+	header.Id = 0
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = writer.cancel(header.Id, ctx.Err())
+		} else {
+			err = fileError("write", header.Name, header.Id, err)
+		}
+	}()
+
+	err = writer.writeHeader(ctx, header, true, contentHash)
+	if err != nil {
+		return err
+	}
+
+	src = writeProgress(contextReader{ctx: ctx, reader: src}, header.Name, total, writer.progress)
+
 	var read int64
-	read, writer.err = io.Copy(writer.currWriters[len(writer.currWriters)-1], file)
-	writer.currBytesRead = int(read)
+	read, writer.err = io.Copy(writer.currWriters[len(writer.currWriters)-1], src)
+	writer.currBytesRead = read
 	if writer.err != nil {
 		return writer.err
 	}
@@ -339,13 +1195,23 @@ func (writer *Writer) WriteFile(header *Header, filepath string) (err error) {
 // Write writes the current file in the container, implementing
 // the io.Writer interface.
 func (writer *Writer) Write(p []byte) (int, error) {
+	if err := writer.acquire(); err != nil {
+		return 0, err
+	}
+	defer writer.release()
+
+	return writer.write(p)
+}
+
+// write writes p to the current file.
+func (writer *Writer) write(p []byte) (int, error) {
 	if writer.err != nil {
 		return 0, writer.err
 	}
 
 	var read int
 	read, writer.err = writer.currWriters[len(writer.currWriters)-1].Write(p)
-	writer.currBytesRead += read
+	writer.currBytesRead += int64(read)
 	return read, writer.err
 }
 
@@ -353,52 +1219,61 @@ func (writer *Writer) Write(p []byte) (int, error) {
 // the current file to the container.
 // Subsequently calls to Close or any other method will yield [ErrWriterClosed]
 func (writer *Writer) Close() error {
-	if writer.err != nil {
-		return writer.err
-	}
-
-	writer.err = writer.flush()
-	if writer.err != nil {
-		return writer.err
-	}
-
-	writer.err = writer.db.Close()
-	if writer.err != nil {
-		return writer.err
+	if err := writer.acquire(); err != nil {
+		return err
 	}
+	defer writer.release()
 
-	writer.err = ErrWriterClosed
-	return nil
+	return writer.close(context.Background(), nil)
 }
 
 type dataWriter struct {
+	ctx         context.Context
+	db          *sql.DB
 	transaction *sql.Tx
 	statement   *sql.Stmt
-	id          int
-	currBlock   int
-	blockSize   int
-	buffer      bytes.Buffer
-	err         error
+
+	// conn is the connection holding the savepoint of the blocks
+	// of the file, when not written within a transaction.
+	conn *sql.Conn
+
+	dedup        bool
+	metrics      Metrics
+	capabilities Capabilities
+
+	// shared is set when the transaction and statement are shared
+	// with other files, so they are left open.
+	shared bool
+
+	id        int
+	currBlock int
+	blockSize int
+	stored    int64
+	buffer    bytes.Buffer
+	err       error
 }
 
-func newDataWriter(db *sql.DB, id int, blocksize int, transaction bool) (*dataWriter, error) {
+func newDataWriter(ctx context.Context, db *sql.DB, id int, blocksize int, transaction bool, capabilities Capabilities) (*dataWriter, error) {
 	dwriter := &dataWriter{
-		id:        id,
-		blockSize: blocksize,
+		ctx:          ctx,
+		db:           db,
+		id:           id,
+		blockSize:    blocksize,
+		capabilities: capabilities,
 	}
 
 	var err error
 	if transaction {
-		dwriter.transaction, err = db.Begin()
+		dwriter.transaction, err = db.BeginTx(ctx, nil)
 		if err != nil {
 			return nil, err
 		}
-		dwriter.statement, err = dwriter.transaction.Prepare(queryInsertData)
+		dwriter.statement, err = dwriter.transaction.PrepareContext(ctx, insertDataQuery(capabilities))
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		dwriter.statement, err = db.Prepare(queryInsertData)
+		err = dwriter.beginSavepoint()
 		if err != nil {
 			return nil, err
 		}
@@ -408,11 +1283,54 @@ func newDataWriter(db *sql.DB, id int, blocksize int, transaction bool) (*dataWr
 	return dwriter, nil
 }
 
+// beginSavepoint begins the savepoint of the blocks of the file, on
+// a connection of its own, as savepoints are bound to a connection.
+func (dwriter *dataWriter) beginSavepoint() error {
+	conn, err := dwriter.db.Conn(dwriter.ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(dwriter.ctx, querySavepoint)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	dwriter.statement, err = conn.PrepareContext(dwriter.ctx, insertDataQuery(dwriter.capabilities))
+	if err != nil {
+		conn.ExecContext(context.Background(), queryRollbackSavepoint)
+		conn.ExecContext(context.Background(), queryReleaseSavepoint)
+		conn.Close()
+		return err
+	}
+
+	dwriter.conn = conn
+	return nil
+}
+
+// releaseSavepoint releases the savepoint of the blocks of the file,
+// storing them, and returns its connection to the pool.
+func (dwriter *dataWriter) releaseSavepoint() error {
+	_, err := dwriter.conn.ExecContext(context.Background(), queryReleaseSavepoint)
+	err2 := dwriter.conn.Close()
+	if err == nil {
+		err = err2
+	}
+	dwriter.conn = nil
+	return err
+}
+
 func (dwriter *dataWriter) cleanup() {
+	if dwriter.shared {
+		return
+	}
 	dwriter.statement.Close()
 	if dwriter.transaction != nil {
 		dwriter.transaction.Rollback()
 	}
+	if dwriter.conn != nil {
+		dwriter.conn.ExecContext(context.Background(), queryRollbackSavepoint)
+		dwriter.releaseSavepoint()
+	}
 }
 
 func (dwriter *dataWriter) Write(p []byte) (n int, err error) {
@@ -457,10 +1375,25 @@ func (dwriter *dataWriter) Flush() (err error) {
 		}
 	}()
 
-	_, dwriter.err = dwriter.statement.Exec(dwriter.id, dwriter.currBlock, dwriter.buffer.Bytes())
+	if dwriter.dedup {
+		var db execQuerier = contextQuerier{ctx: dwriter.ctx, db: dwriter.db}
+		switch {
+		case dwriter.transaction != nil:
+			db = dwriter.transaction
+		case dwriter.conn != nil:
+			db = contextQuerier{ctx: dwriter.ctx, db: dwriter.conn}
+		}
+		dwriter.err = insertDedupBlock(db, dwriter.id, dwriter.currBlock, dwriter.buffer.Bytes())
+	} else {
+		args := insertDataArgs(dwriter.capabilities, dwriter.id, dwriter.currBlock, dwriter.buffer.Bytes())
+		_, dwriter.err = dwriter.statement.ExecContext(dwriter.ctx, args...)
+	}
 	if dwriter.err != nil {
+		dwriter.err = blockError("write", dwriter.id, dwriter.currBlock, dwriter.err)
 		return dwriter.err
 	}
+	dwriter.stored += int64(dwriter.buffer.Len())
+	countBlock(dwriter.metrics, dwriter.buffer.Len(), false)
 	dwriter.buffer.Reset()
 
 	dwriter.currBlock++
@@ -477,18 +1410,26 @@ func (dwriter *dataWriter) Close() (err error) {
 		}
 	}()
 
-	if dwriter.Flush() != nil {
+	// Only the last block left partial is inserted, so empty files,
+	// and directories, have no blocks, rather than an empty one.
+	if dwriter.buffer.Len() > 0 && dwriter.Flush() != nil {
 		return dwriter.err
 	}
 
-	if dwriter.transaction != nil {
+	switch {
+	case dwriter.shared:
+	case dwriter.transaction != nil:
 		dwriter.err = dwriter.statement.Close()
 		if dwriter.err != nil {
 			return dwriter.err
 		}
 		dwriter.err = dwriter.transaction.Commit()
-	} else {
+	default:
 		dwriter.err = dwriter.statement.Close()
+		if dwriter.err != nil {
+			return dwriter.err
+		}
+		dwriter.err = dwriter.releaseSavepoint()
 	}
 	if dwriter.err != nil {
 		return dwriter.err
@@ -0,0 +1,170 @@
+package arc
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// FromZip writes the entries of the zip archive of size bytes read from r
+// to writer, applying the compression and encryption of template to each
+// of them, as [FromTar]. Regular files, directories and symbolic links are
+// written, keeping their names, modification times and, in containers with
+// [FeatureAttributes], their permission bits. Other entries are skipped.
+//
+// The entries are read as streams, so template.Convergent is ignored.
+// The writer is left open, with the last file flushed.
+func FromZip(r io.ReaderAt, size int64, writer *Writer, template Header) error {
+	if writer.err != nil {
+		return writer.err
+	}
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range archive.File {
+		mode := file.Mode()
+		header := template
+		header.Name = path.Clean(file.Name)
+		header.ModTime = file.Modified.UTC()
+		header.Convergent = false
+		header.Mode = mode & storedModeBits
+
+		switch {
+		case mode.IsDir() || strings.HasSuffix(file.Name, "/"):
+			err = writer.WriteDir(&header)
+		case mode&fs.ModeSymlink != 0:
+			err = writeZipSymlink(writer, &header, file)
+		case mode.IsRegular():
+			err = writeZipFile(writer, &header, file)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.flush()
+}
+
+func writeZipFile(writer *Writer, header *Header, file *zip.File) (err error) {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := src.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	err = writer.WriteHeader(header, true)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, src)
+	return err
+}
+
+// writeZipSymlink writes the symbolic link file, whose contents are its target.
+func writeZipSymlink(writer *Writer, header *Header, file *zip.File) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	linkTarget, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	return writer.WriteSymlink(header, string(linkTarget))
+}
+
+// zipHeader returns the zip header of the file header.
+func zipHeader(header *Header) *zip.FileHeader {
+	zipHeader := &zip.FileHeader{
+		Name:     header.Name,
+		Modified: header.ModTime,
+		Method:   zip.Deflate,
+	}
+	mode := header.Mode
+	switch header.Type {
+	case TypeDir:
+		zipHeader.Name += "/"
+		zipHeader.Method = zip.Store
+		if mode == 0 {
+			mode = tarDirMode
+		}
+		mode |= fs.ModeDir
+	case TypeSymlink:
+		zipHeader.Method = zip.Store
+		if mode == 0 {
+			mode = fs.ModePerm
+		}
+		mode |= fs.ModeSymlink
+	default:
+		if mode == 0 {
+			mode = tarFileMode
+		}
+	}
+	zipHeader.SetMode(mode)
+
+	return zipHeader
+}
+
+// ToZip writes all files of the container to w as a zip archive, in name
+// order, keeping their names, modification times and, when stored, their
+// permission bits, as [Reader.ToTar]. Files are deflated, while
+// directories and symbolic links are stored.
+func (reader *Reader) ToZip(w io.Writer) error {
+	files, err := reader.Files()
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	for _, name := range extractOrder(files) {
+		header := files[name]
+		if header.Encryption && !reader.canDecrypt(header.Id) {
+			return reader.decryptError(header.Id)
+		}
+
+		err = reader.writeZipEntry(archive, header)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func (reader *Reader) writeZipEntry(archive *zip.Writer, header *Header) (err error) {
+	dst, err := archive.CreateHeader(zipHeader(header))
+	if err != nil {
+		return err
+	}
+	if header.Type == TypeDir {
+		return nil
+	}
+
+	stream, err := reader.openReader(header.Id, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := stream.Close()
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	_, err = io.Copy(dst, stream)
+	return err
+}
@@ -0,0 +1,119 @@
+package arc
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+// testZip returns a zip archive with a directory, files and a symbolic link.
+func testZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	entries := []struct {
+		name     string
+		mode     fs.FileMode
+		contents string
+	}{
+		{"dir/", fs.ModeDir | 0o750, ""},
+		{"dir/file", 0o640, "file contents"},
+		{"link", fs.ModeSymlink | 0o777, "dir/file"},
+		{"plain", 0o644, "plain contents"},
+	}
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Modified: testArchiveTime, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		w, err := archive.CreateHeader(header)
+		if err == nil {
+			_, err = io.WriteString(w, entry.contents)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZip(t *testing.T) {
+	path := testContainerPath(t)
+	writer, err := newTestWriter(path, 0, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := testZip(t)
+	err = FromZip(bytes.NewReader(archive), int64(len(archive)), writer, Header{Encryption: true})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(path, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	checkFiles(t, readTestFiles(t, reader), map[string]string{
+		"dir/file": "file contents",
+		"plain":    "plain contents",
+	})
+	files, err := reader.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files["dir"].Type != TypeDir || files["link"].Type != TypeSymlink || files["dir/file"].Mode != 0o640 {
+		t.Errorf("got dir %+v, link %+v, file %+v", files["dir"], files["link"], files["dir/file"])
+	}
+
+	var buf bytes.Buffer
+	err = reader.ToZip(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Symbolic links are written last, as when extracted.
+	want := []struct {
+		name     string
+		mode     fs.FileMode
+		method   uint16
+		contents string
+	}{
+		{"dir/", fs.ModeDir | 0o750, zip.Store, ""},
+		{"dir/file", 0o640, zip.Deflate, "file contents"},
+		{"plain", 0o644, zip.Deflate, "plain contents"},
+		{"link", fs.ModeSymlink | 0o777, zip.Store, "dir/file"},
+	}
+	if len(exported.File) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(exported.File), len(want))
+	}
+	for i, entry := range want {
+		file := exported.File[i]
+		src, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		if file.Name != entry.name || file.Mode() != entry.mode || file.Method != entry.method || string(contents) != entry.contents {
+			t.Errorf("got %s, mode %v, method %d, %q, want %s, mode %v, method %d, %q",
+				file.Name, file.Mode(), file.Method, contents, entry.name, entry.mode, entry.method, entry.contents)
+		}
+		if !file.Modified.Equal(testArchiveTime) {
+			t.Errorf("%s: got modification time %v", file.Name, file.Modified)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package arc
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// LongDistanceWindowSize is the window of the zstd encoder when
+// [ZstdOptions.LongDistance] is set, as zstd's --long default.
+const LongDistanceWindowSize = 128 << 20
+
+// ErrInvalidZstdOptions is returned when setting [ZstdOptions] with
+// a window size not a power of two within the limits of zstd, or
+// a negative concurrency.
+var ErrInvalidZstdOptions = errors.New("invalid zstd options")
+
+// ZstdOptions tune the zstd encoder of the files written, beyond their
+// compression level, as the defaults compress large redundant files poorly.
+// See [Writer.SetZstdOptions].
+type ZstdOptions struct {
+	// WindowSize is the largest distance, in bytes, of the repetitions found,
+	// a power of two between [zstd.MinWindowSize] and [zstd.MaxWindowSize].
+	// Larger windows find repetitions further apart, compressing large files
+	// better, at the cost of memory, when both compressing and decompressing.
+	// The zero value selects the default of the level, up to 8 MiB.
+	WindowSize int
+
+	// Concurrency is the number of goroutines compressing each file,
+	// where the zero value selects GOMAXPROCS.
+	Concurrency int
+
+	// LongDistance enlarges the window to [LongDistanceWindowSize], unless
+	// WindowSize is given, finding the repetitions far apart in large files,
+	// as zstd's long-distance matching, which the encoder lacks, would.
+	LongDistance bool
+}
+
+// validate checks the options hold values accepted by the encoder.
+func (options *ZstdOptions) validate() error {
+	size := options.WindowSize
+	if size != 0 && (size < zstd.MinWindowSize || size > zstd.MaxWindowSize || size&(size-1) != 0) {
+		return ErrInvalidZstdOptions
+	}
+	if options.Concurrency < 0 {
+		return ErrInvalidZstdOptions
+	}
+	return nil
+}
+
+// encoderOptions returns the options of the zstd encoder.
+func (options *ZstdOptions) encoderOptions() []zstd.EOption {
+	var encoderOptions []zstd.EOption
+	switch {
+	case options.WindowSize != 0:
+		encoderOptions = append(encoderOptions, zstd.WithWindowSize(options.WindowSize))
+	case options.LongDistance:
+		encoderOptions = append(encoderOptions, zstd.WithWindowSize(LongDistanceWindowSize))
+	}
+	if options.Concurrency != 0 {
+		encoderOptions = append(encoderOptions, zstd.WithEncoderConcurrency(options.Concurrency))
+	}
+	return encoderOptions
+}
+
+// SetZstdOptions tunes the zstd encoder of the files written afterwards
+// with options. They aren't recorded in the container, as the decoder
+// needs none of them, although decompressing files written with large
+// windows takes as much memory.
+func (writer *Writer) SetZstdOptions(options ZstdOptions) error {
+	if err := writer.acquire(); err != nil {
+		return err
+	}
+	defer writer.release()
+
+	if writer.err != nil {
+		return writer.err
+	}
+	err := options.validate()
+	if err != nil {
+		return err
+	}
+
+	writer.zstdOptions = &options
+	return nil
+}
+
+// fileCodec returns the codec name, as [fileCodec],
+// tuning zstd with the options of the Writer.
+func (writer *Writer) fileCodec(name string, dict *dictionary) (Codec, error) {
+	if isZstd(name) {
+		return zstdCodec{dict: dict, options: writer.zstdOptions}, nil
+	}
+	return fileCodec(name, dict)
+}